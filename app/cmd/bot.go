@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wasya-io/petit-misskey/config"
+	"github.com/wasya-io/petit-misskey/infrastructure/misskey"
+	"github.com/wasya-io/petit-misskey/infrastructure/resolver"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+	model "github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/bot"
+	"github.com/wasya-io/petit-misskey/service/expr"
+)
+
+// botCmd はボットを動かすコマンド
+var botCmd = &cobra.Command{
+	Use:   "bot",
+	Short: "アカウントをボットとして動かします",
+	Long: `ストリーミングAPIに接続し、指定した動作を行うボットとして動きます。
+自分のノートには反応しません。投稿やリアクションは --interval ごとに1回
+(続けて --burst 回まで)に制限します。--dry-run では実際には投稿せず、
+行う操作を表示するだけにします。Ctrl+C で実行中の操作を待ってから終了します。
+
+  --react     --where に当てはまるタイムラインのノートにリアクションする
+  --reply     メンションの最初の語がコマンドなら返信する (例: ping=pong)
+  --welcome   フォローしてきたユーザーにメンションで挨拶する
+
+使用例:
+  petit-misskey bot --key="mybot" --reply "ping=pong" --welcome "フォローありがとう!"
+  petit-misskey bot --key="mybot" --react ":igyo:" --where '"#petit" in tags' --dry-run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		key, _ := cmd.Flags().GetString("key")
+		if key == "" {
+			fmt.Println("エラー: インスタンスキーが指定されていません。--keyフラグを使用してインスタンスキーを指定してください。")
+			os.Exit(1)
+		}
+		opts := bot.Options{Out: os.Stdout}
+		opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+		opts.IgnoreBots, _ = cmd.Flags().GetBool("ignore-bots")
+		opts.Interval, _ = cmd.Flags().GetDuration("interval")
+		opts.Burst, _ = cmd.Flags().GetInt("burst")
+
+		behaviors, err := botBehaviors(cmd)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+
+		userSetting := setting.NewUserSetting()
+		if userSetting.UsesVault() {
+			if err := userSetting.Vault().Unlock(); err != nil {
+				fmt.Printf("エラー: vaultを開けませんでした: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		instance, err := userSetting.ResolveInstance(ctx, key)
+		if err != nil {
+			fmt.Printf("エラー: アクセストークンを取得できませんでした: %v\n", err)
+			os.Exit(1)
+		}
+		if instance == nil {
+			fmt.Printf("エラー: インスタンスキー '%s' が見つかりません\n", key)
+			os.Exit(1)
+		}
+
+		l := logger.New(true)
+		opts.Username = instance.UserName
+		opts.Logger = l
+		client, msgCh := websocket.NewClient(instance.BaseUrl, instance.AccessToken, resolver.NewMisskeyStreamUrlResolver(), nil, l)
+		timeline, err := websocket.ParseChannelType(instance.Preferences.Timeline)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		client.SetTimeline(timeline)
+
+		b := bot.New(client, msgCh, misskey.NewClient(config.NewConfig(), instance), opts)
+		behaviors(b)
+
+		mode := ""
+		if opts.DryRun {
+			mode = "(dry-run)"
+		}
+		fmt.Printf("@%s としてボットを開始します%s。Ctrl+Cで終了します。\n", instance.UserName, mode)
+		if err := b.Run(ctx); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("終了します。")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(botCmd)
+	botCmd.Flags().String("react", "", "--where に当てはまるノートに付けるリアクション")
+	botCmd.Flags().String("where", "", "リアクションするノートの条件式")
+	botCmd.Flags().StringArray("reply", nil, "コマンドと返信 (例: ping=pong)。複数指定できる")
+	botCmd.Flags().String("welcome", "", "フォローしてきたユーザーへの挨拶")
+	botCmd.Flags().Duration("interval", 10*time.Second, "投稿やリアクションの間隔")
+	botCmd.Flags().Int("burst", 3, "間隔を空けずに続けて投稿・リアクションできる回数")
+	botCmd.Flags().Bool("ignore-bots", true, "ほかのbotのノートに反応しない")
+	botCmd.Flags().Bool("dry-run", false, "投稿やリアクションをせず、行う操作を表示する")
+}
+
+// botBehaviors はフラグで指定された動作を、ボットにハンドラとして登録する関数を返します
+func botBehaviors(cmd *cobra.Command) (func(b *bot.Bot), error) {
+	react, _ := cmd.Flags().GetString("react")
+	where, _ := cmd.Flags().GetString("where")
+	replies, _ := cmd.Flags().GetStringArray("reply")
+	welcome, _ := cmd.Flags().GetString("welcome")
+
+	var program *expr.Program
+	if react != "" {
+		// 条件がなければタイムラインのすべてのノートに反応してしまう
+		if where == "" {
+			return nil, errors.New("--react には --where で条件を指定してください")
+		}
+		p, err := expr.Compile(where)
+		if err != nil {
+			var exprErr *expr.Error
+			if errors.As(err, &exprErr) {
+				return nil, fmt.Errorf("--where の式に誤りがあります\n%s", exprErr.Detail())
+			}
+			return nil, err
+		}
+		program = p
+	}
+	commands := make(map[string]string)
+	for _, r := range replies {
+		name, text, ok := strings.Cut(r, "=")
+		if !ok || strings.TrimSpace(name) == "" || text == "" {
+			return nil, fmt.Errorf("--reply は コマンド=返信 の形で指定してください: %q", r)
+		}
+		commands[strings.ToLower(strings.TrimSpace(name))] = text
+	}
+	if program == nil && len(commands) == 0 && welcome == "" {
+		return nil, errors.New("--react、--reply、--welcome のどれかを指定してください")
+	}
+
+	return func(b *bot.Bot) {
+		if program != nil {
+			b.OnNote(func(c *bot.Context, note *model.NoteBody) error {
+				if !program.Match(&model.Note{Body: model.NoteContainer{Body: *note}}) {
+					return nil
+				}
+				return c.React(note, react)
+			})
+		}
+		if len(commands) > 0 {
+			b.OnMention(func(c *bot.Context, note *model.NoteBody) error {
+				name, _ := bot.Command(note.Text)
+				text, ok := commands[name]
+				if !ok {
+					return nil
+				}
+				return c.Reply(note, text)
+			})
+		}
+		if welcome != "" {
+			b.OnFollow(func(c *bot.Context, user *model.NoteUser) error {
+				return c.Post(model.CreateNote{Text: bot.Mention(*user) + " " + welcome, Visibility: model.VisibilityHome})
+			})
+		}
+	}, nil
+}
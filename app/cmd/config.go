@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/wasya-io/petit-misskey/infrastructure/secret"
 	"github.com/wasya-io/petit-misskey/infrastructure/setting"
 	"github.com/wasya-io/petit-misskey/model/misskey"
 	"github.com/wasya-io/petit-misskey/service/accounts"
@@ -52,12 +53,7 @@ var configAddCmd = &cobra.Command{
 		addInstance(scanner, userSetting, accountService)
 
 		// 設定を保存
-		configDir, err := os.UserConfigDir()
-		if err != nil {
-			fmt.Printf("設定ディレクトリの取得に失敗しました: %v\n", err)
-			os.Exit(1)
-		}
-		configPath := filepath.Join(configDir, "petit-misskey.toml")
+		configPath := userSetting.Path()
 
 		if err := saveConfig(configPath, userSetting); err != nil {
 			fmt.Printf("設定の保存に失敗しました: %v\n", err)
@@ -98,12 +94,7 @@ var configDeleteCmd = &cobra.Command{
 		deleteInstance(scanner, userSetting)
 
 		// 設定を保存
-		configDir, err := os.UserConfigDir()
-		if err != nil {
-			fmt.Printf("設定ディレクトリの取得に失敗しました: %v\n", err)
-			os.Exit(1)
-		}
-		configPath := filepath.Join(configDir, "petit-misskey.toml")
+		configPath := userSetting.Path()
 
 		if err := saveConfig(configPath, userSetting); err != nil {
 			fmt.Printf("設定の保存に失敗しました: %v\n", err)
@@ -114,6 +105,136 @@ var configDeleteCmd = &cobra.Command{
 	},
 }
 
+// configExportCmd は設定の書き出しのサブコマンド
+var configExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "設定をファイルに書き出します",
+	Long: `登録済みのインスタンス設定を、別のマシンに持ち運べる形で書き出します。
+--encrypt を指定するとパスフレーズで暗号化し、vaultに保管しているトークンも含めます。
+暗号化しない場合、vaultのトークンは書き出されません。
+
+使用例:
+  petit-misskey config export -o accounts.toml --redact
+  petit-misskey config export -o accounts.json --encrypt`,
+	Run: func(cmd *cobra.Command, args []string) {
+		redact, _ := cmd.Flags().GetBool("redact")
+		encrypt, _ := cmd.Flags().GetBool("encrypt")
+		output, _ := cmd.Flags().GetString("output")
+		format, _ := cmd.Flags().GetString("format")
+
+		if redact && encrypt {
+			fmt.Println("エラー: --redact と --encrypt は同時に指定できません。")
+			os.Exit(1)
+		}
+
+		opts := setting.ExportOptions{
+			Format: setting.Format(format),
+			Redact: redact,
+		}
+		if opts.Format == "" {
+			opts.Format = setting.FormatFromPath(output)
+		}
+		if encrypt {
+			passphrase, err := secret.PromptPassphrase(envExportPassphrase, "エクスポート用のパスフレーズ", true)
+			if err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				os.Exit(1)
+			}
+			opts.Passphrase = passphrase
+		}
+
+		userSetting := setting.NewUserSetting()
+		data, err := userSetting.Export(cmd.Context(), opts)
+		if err != nil {
+			fmt.Printf("エラー: 設定の書き出しに失敗しました: %v\n", err)
+			os.Exit(1)
+		}
+
+		if output == "" || output == "-" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(output, data, 0600); err != nil {
+			fmt.Printf("エラー: ファイルの書き込みに失敗しました: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "設定を書き出しました: %s\n", output)
+	},
+}
+
+// configImportCmd は設定の取り込みのサブコマンド
+var configImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "書き出した設定を取り込みます",
+	Long: `config export で書き出した設定を取り込みます。
+--merge(既定)では既存の設定に追加し、同じキーがある場合は --on-conflict に従います。
+--replace では既存の設定をすべて置き換えます。
+
+使用例:
+  petit-misskey config import accounts.toml
+  petit-misskey config import accounts.json --merge --on-conflict=rename`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		replace, _ := cmd.Flags().GetBool("replace")
+		format, _ := cmd.Flags().GetString("format")
+		policy, _ := cmd.Flags().GetString("on-conflict")
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Printf("エラー: ファイルの読み込みに失敗しました: %v\n", err)
+			os.Exit(1)
+		}
+
+		scanner := bufio.NewScanner(os.Stdin)
+		opts := setting.ImportOptions{
+			Format: setting.Format(format),
+			Mode:   setting.ImportMerge,
+			Policy: setting.ConflictPolicy(policy),
+			Passphrase: func() ([]byte, error) {
+				return secret.PromptPassphrase(envExportPassphrase, "エクスポート時のパスフレーズ", false)
+			},
+		}
+		if opts.Format == "" {
+			opts.Format = setting.FormatFromPath(args[0])
+		}
+		if replace {
+			opts.Mode = setting.ImportReplace
+		}
+		if opts.Policy == setting.ConflictAsk {
+			opts.Resolve = func(key string, current, incoming setting.Instance) (setting.ConflictPolicy, error) {
+				return askConflict(scanner, key, current, incoming), nil
+			}
+		}
+
+		userSetting := setting.NewUserSetting()
+		result, err := userSetting.Import(data, opts)
+		if err != nil {
+			fmt.Printf("エラー: 設定の取り込みに失敗しました: %v\n", err)
+			os.Exit(1)
+		}
+
+		for _, key := range result.Added {
+			fmt.Printf("追加: %s\n", key)
+		}
+		for _, key := range result.Overwritten {
+			fmt.Printf("上書き: %s\n", key)
+		}
+		for from, to := range result.Renamed {
+			fmt.Printf("名前を変えて追加: %s -> %s\n", from, to)
+		}
+		for _, key := range result.Kept {
+			fmt.Printf("スキップ: %s\n", key)
+		}
+		for _, key := range result.MissingToken {
+			fmt.Printf("警告: %s のトークンはファイルに含まれていません。config delete と config add で登録し直してください\n", key)
+		}
+		fmt.Printf("設定を保存しました: %s\n", userSetting.Path())
+	},
+}
+
+// エクスポートの暗号化に使うパスフレーズの環境変数
+const envExportPassphrase = "PETIT_MISSKEY_EXPORT_PASSPHRASE"
+
 func init() {
 	rootCmd.AddCommand(configCmd)
 
@@ -121,24 +242,30 @@ func init() {
 	configCmd.AddCommand(configAddCmd)
 	configCmd.AddCommand(configListCmd)
 	configCmd.AddCommand(configDeleteCmd)
+	configCmd.AddCommand(configExportCmd)
+	configCmd.AddCommand(configImportCmd)
 
 	// 対話式のみの実装にしたため、フラグ設定を削除
+	// (export/importはスクリプトからも使えるようフラグで指定する)
+	configExportCmd.Flags().StringP("output", "o", "", "書き出し先のファイル (省略時は標準出力)")
+	configExportCmd.Flags().String("format", "", "ファイル形式 toml|json (省略時は拡張子から判断、暗号化時は常にjson)")
+	configExportCmd.Flags().Bool("redact", false, "トークンを含めずに書き出す")
+	configExportCmd.Flags().Bool("encrypt", false, "パスフレーズで暗号化し、vaultのトークンも含めて書き出す")
+
+	configImportCmd.Flags().String("format", "", "ファイル形式 toml|json (省略時は拡張子から判断)")
+	configImportCmd.Flags().Bool("merge", true, "既存の設定に追加する")
+	configImportCmd.Flags().Bool("replace", false, "既存の設定を置き換える")
+	configImportCmd.Flags().String("on-conflict", string(setting.ConflictAsk), "同じキーがあるときの扱い ask|keep|overwrite|rename")
+	configImportCmd.MarkFlagsMutuallyExclusive("merge", "replace")
 }
 
 // 以下、既存の関数は変更なし
 // runConfigManager は設定管理の対話型インターフェースを実行します
 func runConfigManager() {
-	// 設定ファイルのパスを取得
-	configDir, err := os.UserConfigDir()
-	if err != nil {
-		fmt.Printf("設定ディレクトリの取得に失敗しました: %v\n", err)
-		os.Exit(1)
-	}
-	configPath := filepath.Join(configDir, "petit-misskey.toml")
-
 	// ユーザー設定と関連サービスの初期化
 	userSetting := setting.NewUserSetting()
 	accountService := accounts.NewService(userSetting)
+	configPath := userSetting.Path()
 
 	scanner := bufio.NewScanner(os.Stdin)
 
@@ -248,24 +375,69 @@ func addInstance(scanner *bufio.Scanner, userSetting *setting.UserSetting, accou
 		break
 	}
 
-	// アクセストークンの入力
-	var token string
+	// トークンの保管方式の選択
+	var source secret.Source
 	for {
-		fmt.Print("アクセストークン: ")
+		fmt.Println("トークンの保管方式:")
+		fmt.Println("  1. 平文で設定ファイルに保存")
+		fmt.Println("  2. パスフレーズで暗号化したvaultに保存")
+		fmt.Println("  3. コマンドの出力から読み込む (例: pass show misskey/io)")
+		fmt.Print("選択してください (1-3) [1]: ")
 		scanner.Scan()
-		token = scanner.Text()
-		if token == "" {
-			fmt.Println("アクセストークンは必須です。")
+		switch scanner.Text() {
+		case "", "1":
+			source = secret.SourcePlain
+		case "2":
+			source = secret.SourceVault
+		case "3":
+			source = secret.SourceCommand
+		default:
+			fmt.Println("無効な選択です。1から3の数字を入力してください。")
 			continue
 		}
 		break
 	}
 
-	// インスタンス情報を設定に追加
 	newInstance := setting.Instance{
 		BaseUrl:     baseURL,
 		UserName:    username,
-		AccessToken: misskey.AccessToken(token),
+		TokenSource: source,
+	}
+
+	if source == secret.SourceCommand {
+		// トークンを出力するコマンドの入力
+		for {
+			fmt.Print("トークンを出力するコマンド: ")
+			scanner.Scan()
+			newInstance.TokenCommand = scanner.Text()
+			if newInstance.TokenCommand == "" {
+				fmt.Println("コマンドは必須です。")
+				continue
+			}
+			break
+		}
+	} else {
+		// アクセストークンの入力
+		var token string
+		for {
+			fmt.Print("アクセストークン: ")
+			scanner.Scan()
+			token = scanner.Text()
+			if token == "" {
+				fmt.Println("アクセストークンは必須です。")
+				continue
+			}
+			break
+		}
+
+		if source == secret.SourceVault {
+			if err := userSetting.Vault().Store(instanceKey, token); err != nil {
+				fmt.Printf("エラー: vaultへの保存に失敗しました: %v\n", err)
+				return
+			}
+		} else {
+			newInstance.AccessToken = misskey.AccessToken(token)
+		}
 	}
 
 	// アカウントサービスを使って追加
@@ -285,6 +457,7 @@ func addInstance(scanner *bufio.Scanner, userSetting *setting.UserSetting, accou
 // listInstances は設定されているインスタンスの一覧を表示します
 func listInstances(userSetting *setting.UserSetting) {
 	fmt.Println("\n--- 登録済みインスタンス一覧 ---")
+	fmt.Printf("設定ファイル: %s\n", userSetting.Path())
 
 	instances := userSetting.GetInstances()
 	if len(instances) == 0 {
@@ -296,7 +469,7 @@ func listInstances(userSetting *setting.UserSetting) {
 		fmt.Printf("- %s\n", name)
 		fmt.Printf("  URL: %s\n", instance.BaseUrl)
 		fmt.Printf("  ユーザー名: %s\n", instance.UserName)
-		fmt.Printf("  トークン: %s\n", maskToken(string(instance.AccessToken)))
+		fmt.Printf("  トークン: %s\n", describeToken(instance))
 	}
 }
 
@@ -334,6 +507,13 @@ func deleteInstance(scanner *bufio.Scanner, userSetting *setting.UserSetting) {
 		instances := userSetting.GetInstances()
 		delete(instances, instanceKey)
 
+		// vaultに保管していたトークンも削除する
+		if instance.Source() == secret.SourceVault {
+			if err := userSetting.Vault().Delete(instanceKey); err != nil {
+				fmt.Printf("警告: vaultからトークンを削除できませんでした: %v\n", err)
+			}
+		}
+
 		// 更新したマップを書き込み
 		if err := userSetting.WriteValue(instances); err != nil {
 			fmt.Printf("エラー: インスタンスの削除に失敗しました: %v\n", err)
@@ -346,10 +526,39 @@ func deleteInstance(scanner *bufio.Scanner, userSetting *setting.UserSetting) {
 	}
 }
 
-// maskToken はトークンを表示用にマスクします
-func maskToken(token string) string {
-	if len(token) <= 8 {
-		return "********"
+// describeToken はトークンの保管方式を表示用の文字列にします
+// トークンそのものは一部であっても表示しません
+func describeToken(instance setting.Instance) string {
+	switch instance.Source() {
+	case secret.SourceCommand:
+		return fmt.Sprintf("%s (%s)", secret.SourceCommand, instance.TokenCommand)
+	case secret.SourceVault:
+		return secret.SourceVault.String()
+	default:
+		if instance.AccessToken == "" {
+			return "(未設定)"
+		}
+		return fmt.Sprintf("%s (********)", secret.SourcePlain)
+	}
+}
+
+// askConflict は同じキーのインスタンスがあるときの扱いをユーザーに尋ねます
+func askConflict(scanner *bufio.Scanner, key string, current, incoming setting.Instance) setting.ConflictPolicy {
+	fmt.Printf("\nインスタンス「%s」は既に登録されています。\n", key)
+	fmt.Printf("  現在:     %s (@%s)\n", current.BaseUrl, current.UserName)
+	fmt.Printf("  取り込み: %s (@%s)\n", incoming.BaseUrl, incoming.UserName)
+	for {
+		fmt.Print("k: 現在の設定を残す / o: 上書き / r: 別名で追加 [k]: ")
+		scanner.Scan()
+		switch strings.ToLower(scanner.Text()) {
+		case "", "k":
+			return setting.ConflictKeep
+		case "o":
+			return setting.ConflictOverwrite
+		case "r":
+			return setting.ConflictRename
+		default:
+			fmt.Println("k, o, r のいずれかを入力してください。")
+		}
 	}
-	return token[:4] + "..." + token[len(token)-4:]
 }
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	"github.com/wasya-io/petit-misskey/config"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/misskey"
+	"github.com/wasya-io/petit-misskey/infrastructure/resolver"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/service/daemon"
+)
+
+// daemonCmd はストリーミングの接続を保ち、ソケットでAPIを提供するコマンド
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "接続を保ち続け、ローカルのソケットでAPIを提供します",
+	Long: `アカウントのストリーミング接続を保ち続け、Unixドメインソケット上の
+HTTP/JSON APIで最近のノートの取得、イベントの購読(SSE)、投稿、リアクションを
+提供します。切断されたら自動で接続し直し、SIGTERM や Ctrl+C で終了します。
+
+デーモンが動いていれば、post コマンドはデーモンを通して投稿し、
+stream --daemon はデーモンの接続を共有してタイムラインを表示します。
+--key を省略すると登録済みのすべてのアカウントに接続します。
+
+使用例:
+  petit-misskey daemon
+  petit-misskey daemon --key="misskey.io,misskey.design"
+  curl --unix-socket "$XDG_RUNTIME_DIR/petit-misskey/daemon.sock" http://daemon/v1/notes?limit=5`,
+	Run: func(cmd *cobra.Command, args []string) {
+		userSetting := setting.NewUserSetting()
+		key, _ := cmd.Flags().GetString("key")
+		keys := splitKeys(key)
+		if len(keys) == 0 {
+			keys = userSetting.GetInstanceKeys()
+		}
+		if len(keys) == 0 {
+			fmt.Println("エラー: 接続するアカウントがありません。先に config add でアカウントを登録してください。")
+			os.Exit(1)
+		}
+		socket, err := socketPath(cmd)
+		if err != nil {
+			fmt.Printf("エラー: ソケットの場所を決められません: %v\n", err)
+			os.Exit(1)
+		}
+
+		if userSetting.UsesVault() {
+			if err := userSetting.Vault().Unlock(); err != nil {
+				fmt.Printf("エラー: vaultを開けませんでした: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// 接続情報は起動時にまとめて解決し、再接続のたびに使い回す
+		cfg := config.NewConfig()
+		instances := make(map[string]*setting.Instance, len(keys))
+		clients := make(map[string]api.Client, len(keys))
+		for _, k := range keys {
+			instance, err := userSetting.ResolveInstance(ctx, k)
+			if err != nil {
+				fmt.Printf("エラー: %s のアクセストークンを取得できませんでした: %v\n", k, err)
+				os.Exit(1)
+			}
+			if instance == nil {
+				fmt.Printf("エラー: インスタンスキー '%s' が見つかりません\n", k)
+				os.Exit(1)
+			}
+			instances[k] = instance
+			clients[k] = misskey.NewClient(cfg, instance)
+		}
+
+		l := logger.New(true)
+		connect := func(key string) (websocket.Client, <-chan tea.Msg, error) {
+			instance := instances[key]
+			client, msgCh := websocket.NewClient(instance.BaseUrl, instance.AccessToken, resolver.NewMisskeyStreamUrlResolver(), nil, l)
+			timeline, err := websocket.ParseChannelType(instance.Preferences.Timeline)
+			if err != nil {
+				return nil, nil, err
+			}
+			client.SetTimeline(timeline)
+			// 通知のイベントも配れるようにmainチャンネルを購読する
+			if _, err := client.Subscribe(websocket.ChannelTypeMain, nil); err != nil {
+				return nil, nil, err
+			}
+			return client, msgCh, nil
+		}
+		d := daemon.New(keys, connect, func(key string) (api.Client, error) { return clients[key], nil },
+			daemon.Options{Out: os.Stdout, Logger: l})
+
+		listener, err := daemon.Listen(socket)
+		if err != nil {
+			if errors.Is(err, daemon.ErrRunning) {
+				fmt.Printf("エラー: デーモンはすでに動いています (%s)\n", socket)
+			} else {
+				fmt.Printf("エラー: ソケットを開けませんでした: %v\n", err)
+			}
+			os.Exit(1)
+		}
+		defer os.Remove(socket)
+
+		fmt.Printf("デーモンを開始します (%s)。Ctrl+Cで終了します。\n", socket)
+		done := make(chan struct{})
+		go func() {
+			d.Run(ctx)
+			close(done)
+		}()
+		if err := d.Serve(ctx, listener); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+		}
+		stop()
+		<-done
+		fmt.Println("終了します。")
+	},
+}
+
+// daemonStatusCmd はデーモンの状態を表示するコマンド
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "デーモンの接続の状態を表示します",
+	Run: func(cmd *cobra.Command, args []string) {
+		socket, err := socketPath(cmd)
+		if err != nil {
+			fmt.Printf("エラー: ソケットの場所を決められません: %v\n", err)
+			os.Exit(1)
+		}
+		ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Second)
+		defer cancel()
+		status, err := daemon.NewClient(socket).Status(ctx)
+		if err != nil {
+			fmt.Printf("デーモンは動いていません (%s)\n", socket)
+			os.Exit(1)
+		}
+		fmt.Printf("開始: %s  ノート: %d件  購読: %d\n", status.StartedAt.Local().Format(scheduleTimeLayout), status.Notes, status.Subscribers)
+		for _, a := range status.Accounts {
+			state := "切断"
+			if a.Connected {
+				state = "接続中 (" + a.Timeline + ")"
+			}
+			fmt.Printf("  %s: %s  再接続: %d回", a.Key, state, a.Reconnects)
+			if a.LastError != "" {
+				fmt.Printf("  最後のエラー: %s", a.LastError)
+			}
+			fmt.Println()
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonCmd.PersistentFlags().String("socket", "", "ソケットの場所 (省略時は $XDG_RUNTIME_DIR/petit-misskey/daemon.sock)")
+}
+
+// socketPath は --socket か既定のデーモンのソケットの場所を返します
+func socketPath(cmd *cobra.Command) (string, error) {
+	if cmd.Flags().Lookup("socket") != nil {
+		if socket, _ := cmd.Flags().GetString("socket"); socket != "" {
+			return socket, nil
+		}
+	}
+	return daemon.SocketPath()
+}
+
+// daemonClient は key のアカウントに接続しているデーモンが動いていれば、そのクライアントを返します
+func daemonClient(ctx context.Context, cmd *cobra.Command, key string) (*daemon.Client, bool) {
+	socket, err := socketPath(cmd)
+	if err != nil {
+		return nil, false
+	}
+	if _, err := os.Stat(socket); err != nil {
+		return nil, false
+	}
+	client := daemon.NewClient(socket)
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, false
+	}
+	for _, a := range status.Accounts {
+		if a.Key == key {
+			return client, true
+		}
+	}
+	return nil, false
+}
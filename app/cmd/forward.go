@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/service/archive"
+	"github.com/wasya-io/petit-misskey/service/forward"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+	"github.com/wasya-io/petit-misskey/view/stream"
+)
+
+// envForwardSecret は --forward の署名に使う秘密を渡す環境変数です
+const envForwardSecret = "PETIT_MISSKEY_FORWARD_SECRET"
+
+// newForwarder は転送先のURLを確かめ、URLごとの待ち行列を読み込んだForwarderを返します
+func newForwarder(target string, opts forward.Options) (*forward.Forwarder, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("転送先のURL %q には転送できません (http:// か https:// で始まるURL)", target)
+	}
+	if opts.Secret == "" {
+		opts.Secret = os.Getenv(envForwardSecret)
+	}
+	// 転送先を変えたときに、前の転送先のイベントを送らないようURLごとに分ける
+	sum := sha256.Sum256([]byte(target))
+	file, err := cache.NewStateFile(fmt.Sprintf("forward-%x.jsonl", sum[:8]))
+	if err != nil {
+		return nil, fmt.Errorf("転送の待ち行列の保存先を決められません: %w", err)
+	}
+	f, err := forward.New(target, file, opts)
+	if err != nil {
+		return nil, fmt.Errorf("転送の待ち行列を読み込めません: %w", err)
+	}
+	return f, nil
+}
+
+// runForward はTUIを使わずにストリーミングのイベントを受信し、webhookに転送します
+// 届いたイベントはdispatcherのフックにも渡し、savedがあれば保存します。ctxが終了するまで受信を続けます
+func runForward(ctx context.Context, accounts []*stream.Account, f *forward.Forwarder, dispatcher *hooks.Dispatcher, saved *archive.Archive) {
+	dispatcher.OnResult(func(h setting.Hook, ev hooks.Event, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: フック %s (%s) が失敗しました: %v\n", h.Event, h.Command, err)
+		}
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f.Run(ctx)
+	}()
+	for _, account := range accounts {
+		go func() {
+			if err := account.Client.Start(); err != nil {
+				fmt.Printf("エラー: %s に接続できませんでした: %v\n", account.Key, err)
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-account.MsgCh:
+					archiveMessage(saved, account.Key, msg)
+					for _, ev := range hooks.Events(account.Key, msg, time.Now()) {
+						dispatcher.Dispatch(ctx, ev)
+						if _, err := f.Enqueue(ev); err != nil {
+							fmt.Fprintf(os.Stderr, "エラー: 転送の待ち行列を保存できません: %v\n", err)
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	for _, account := range accounts {
+		account.Client.Stop()
+	}
+	wg.Wait()
+	dispatcher.Wait()
+	if status := f.Status(); status.Pending > 0 {
+		fmt.Printf("送れなかった %d 件のイベントは次の起動で転送します。\n", status.Pending)
+	}
+}
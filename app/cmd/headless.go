@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/archive"
+	"github.com/wasya-io/petit-misskey/service/expr"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+	"github.com/wasya-io/petit-misskey/view/stream"
+)
+
+type (
+	// headlessNote はヘッドレス出力の1件です
+	headlessNote struct {
+		account string
+		note    *misskey.Note
+	}
+
+	// headlessRecord は --format json で1行ずつ出力する値です
+	headlessRecord struct {
+		Account string            `json:"account"`
+		Note    *misskey.NoteBody `json:"note"`
+	}
+)
+
+// maxHeadlessSeen は同じノートを出力しないよう覚えておくノートの数です
+const maxHeadlessSeen = 1000
+
+// runHeadless はTUIを使わずにタイムラインを受信し、条件に当てはまるノートを1行ずつ書き出します
+// 届いたイベントはdispatcherのフックにも渡し、savedがあれば保存します。ctxが終了するまで受信を続けます
+func runHeadless(ctx context.Context, accounts []*stream.Account, where *expr.Program, format string, w io.Writer, dispatcher *hooks.Dispatcher, saved *archive.Archive) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("出力形式 %q には対応していません (text / json)", format)
+	}
+	dispatcher.OnResult(func(h setting.Hook, ev hooks.Event, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: フック %s (%s) が失敗しました: %v\n", h.Event, h.Command, err)
+		}
+	})
+
+	notes := make(chan headlessNote)
+	var wg sync.WaitGroup
+	for _, account := range accounts {
+		go func() {
+			if err := account.Client.Start(); err != nil {
+				fmt.Printf("エラー: %s に接続できませんでした: %v\n", account.Key, err)
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-account.MsgCh:
+					for _, ev := range hooks.Events(account.Key, msg, time.Now()) {
+						dispatcher.Dispatch(ctx, ev)
+					}
+					archiveMessage(saved, account.Key, msg)
+					note, ok := msg.(websocket.NoteMessage)
+					if !ok || note.Note == nil {
+						continue
+					}
+					select {
+					case notes <- headlessNote{account: account.Key, note: note.Note}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+	}
+	defer func() {
+		for _, account := range accounts {
+			account.Client.Stop()
+		}
+		wg.Wait()
+		dispatcher.Wait()
+	}()
+
+	// 複数のアカウントで同じノートを受信した場合は最初の1件だけを出力する
+	// 同じノートは続けて届くので、覚えておくのは最近のノートだけにする
+	seen := make(map[string]bool)
+	order := make([]string, 0, maxHeadlessSeen)
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-notes:
+			body := n.note.Body.Body
+			id := body.Uri
+			if id == "" {
+				id = n.account + "/" + body.ID
+			}
+			if seen[id] || (where != nil && !where.Match(n.note)) {
+				continue
+			}
+			seen[id] = true
+			order = append(order, id)
+			if len(order) > maxHeadlessSeen {
+				delete(seen, order[0])
+				order = order[1:]
+			}
+
+			if format == "json" {
+				if err := encoder.Encode(headlessRecord{Account: n.account, Note: &body}); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := fmt.Fprintln(w, formatHeadlessNote(n.account, body)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// formatHeadlessNote はノートを「時刻 [アカウント] @ユーザー: 本文」の1行にします
+func formatHeadlessNote(key string, body misskey.NoteBody) string {
+	user := body.User.Username
+	if host, ok := body.User.Host.(string); ok && host != "" {
+		user += "@" + host
+	}
+	text := body.Text
+	if body.RenoteID != "" && text == "" {
+		text = fmt.Sprintf("RN @%s: %s", body.Renote.User.Username, body.Renote.Text)
+	}
+	if cw, ok := body.Cw.(string); ok && cw != "" {
+		text = "[CW " + cw + "] " + text
+	}
+	text = strings.ReplaceAll(text, "\n", " ")
+	return fmt.Sprintf("%s [%s] @%s: %s", body.CreatedAt.Local().Format(time.DateTime), key, user, text)
+}
+
+// archiveMessage は受信したノートと通知をsavedに保存します(savedがnilなら何もしません)
+func archiveMessage(saved *archive.Archive, key string, msg any) {
+	if saved == nil {
+		return
+	}
+	if _, err := saved.Add(key, msg, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "エラー: 受信したノートを保存できません: %v\n", err)
+	}
+}
@@ -32,8 +32,16 @@ var metaCmd = &cobra.Command{
 			return
 		}
 
-		setting := setting.NewUserSetting()       // ユーザ設定を呼び出す
-		instance := setting.GetInstanceByKey(key) // ユーザ設定からインスタンスの接続情報を呼び出す
+		setting := setting.NewUserSetting()                          // ユーザ設定を呼び出す
+		instance, err := setting.ResolveInstance(cmd.Context(), key) // ユーザ設定からインスタンスの接続情報を呼び出す
+		if err != nil {
+			fmt.Printf("エラー: アクセストークンを取得できませんでした: %v\n", err)
+			return
+		}
+		if instance == nil {
+			fmt.Printf("エラー: インスタンスキー '%s' が見つかりません。\n", key)
+			return
+		}
 
 		l := logger.New(true)
 		model := meta.InitializeModel(instance) // initializerでmodelを作る
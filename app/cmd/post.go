@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wasya-io/petit-misskey/config"
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/infrastructure/misskey"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	model "github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/daemon"
+	"github.com/wasya-io/petit-misskey/service/schedule"
+)
+
+// postCmd はノートを投稿するコマンド
+var postCmd = &cobra.Command{
+	Use:   "post [text]",
+	Short: "ノートを投稿します",
+	Long: `ノートを投稿します。本文を省略するか "-" を指定すると標準入力から読み込みます。
+--at を指定すると、その時刻に投稿するよう予約します(schedule run で送信します)。
+公開範囲とCWを省略した場合は、インスタンスの preferences の既定値を使います。
+daemon が動いていれば、デーモンを通して投稿します(--no-daemon で直接投稿)。
+
+使用例:
+  petit-misskey post --key="misskey.io" "こんにちは"
+  echo "おはよう" | petit-misskey post --key="misskey.io"
+  petit-misskey post --key="misskey.io" --at "2026-10-20 09:00" "予約投稿"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		key, _ := cmd.Flags().GetString("key")
+		if key == "" {
+			fmt.Println("エラー: インスタンスキーが指定されていません。--keyフラグを使用してインスタンスキーを指定してください。")
+			fmt.Println("使用例: petit-misskey post --key=\"your-instance-key\" \"本文\"")
+			os.Exit(1)
+		}
+
+		text, err := readPostText(args)
+		if err != nil {
+			fmt.Printf("エラー: 本文を読み込めませんでした: %v\n", err)
+			os.Exit(1)
+		}
+		if text == "" {
+			fmt.Println("エラー: 本文が空です。")
+			os.Exit(1)
+		}
+
+		userSetting := setting.NewUserSetting()
+
+		// デーモンが動いていれば、デーモンの接続を使って投稿する(アクセストークンは不要)
+		at, _ := cmd.Flags().GetString("at")
+		if noDaemon, _ := cmd.Flags().GetBool("no-daemon"); at == "" && !noDaemon {
+			if client, ok := daemonClient(cmd.Context(), cmd, key); ok {
+				postViaDaemon(cmd, client, userSetting, key, text)
+				return
+			}
+		}
+
+		instance, err := userSetting.ResolveInstance(cmd.Context(), key)
+		if err != nil {
+			fmt.Printf("エラー: アクセストークンを取得できませんでした: %v\n", err)
+			os.Exit(1)
+		}
+		if instance == nil {
+			fmt.Printf("エラー: インスタンスキー '%s' が見つかりません。\n", key)
+			os.Exit(1)
+		}
+
+		note, err := buildNote(cmd, instance.Preferences, text)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+
+		if at != "" {
+			schedulePost(key, note, at)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+		defer cancel()
+		ret, err := misskey.NewClient(config.NewConfig(), instance).CreateNote(ctx, note)
+		if err != nil {
+			fmt.Printf("エラー: 投稿できませんでした: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("投稿しました: %s\n", ret.CreatedNote.ID)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(postCmd)
+
+	postCmd.Flags().String("at", "", "投稿する時刻 (例: \"2026-10-20 09:00\"、\"09:00\")")
+	postCmd.Flags().String("visibility", "", "公開範囲 (public / home / followers)")
+	postCmd.Flags().String("cw", "", "CW(注釈)")
+	postCmd.Flags().Bool("local-only", false, "連合なしで投稿する")
+	postCmd.Flags().Bool("no-daemon", false, "デーモンが動いていても直接投稿する")
+}
+
+// postViaDaemon はデーモンを通して投稿します
+func postViaDaemon(cmd *cobra.Command, client *daemon.Client, userSetting *setting.UserSetting, key string, text string) {
+	instance := userSetting.GetInstanceByKey(key)
+	if instance == nil {
+		fmt.Printf("エラー: インスタンスキー '%s' が見つかりません。\n", key)
+		os.Exit(1)
+	}
+	note, err := buildNote(cmd, instance.Preferences, text)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+	defer cancel()
+	id, err := client.Post(ctx, key, note)
+	if err != nil {
+		fmt.Printf("エラー: 投稿できませんでした: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("投稿しました: %s\n", id)
+}
+
+// readPostText は引数か標準入力から本文を読み込みます
+func readPostText(args []string) (string, error) {
+	if len(args) > 0 && !(len(args) == 1 && args[0] == "-") {
+		return strings.Join(args, " "), nil
+	}
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// buildNote はフラグとインスタンスの既定値から投稿の内容を組み立てます
+func buildNote(cmd *cobra.Command, prefs setting.Preferences, text string) (model.CreateNote, error) {
+	note := model.CreateNote{
+		Text:       text,
+		Visibility: prefs.DefaultVisibility(),
+		Cw:         prefs.DefaultCw(),
+		LocalOnly:  prefs.LocalOnly,
+	}
+	if v, _ := cmd.Flags().GetString("visibility"); v != "" {
+		switch visibility := model.Visibility(v); visibility {
+		case model.VisibilityPublic, model.VisibilityHome, model.VisibilityFollowers:
+			note.Visibility = visibility
+		default:
+			return note, fmt.Errorf("公開範囲 '%s' は指定できません (public / home / followers)", v)
+		}
+	}
+	if cmd.Flags().Changed("cw") {
+		cw, _ := cmd.Flags().GetString("cw")
+		note.Cw = &cw
+	}
+	if cmd.Flags().Changed("local-only") {
+		note.LocalOnly, _ = cmd.Flags().GetBool("local-only")
+	}
+	return note, nil
+}
+
+// schedulePost は投稿を予約します
+func schedulePost(key string, note model.CreateNote, value string) {
+	now := time.Now()
+	at, err := schedule.ParseTime(value, now)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+	if !at.After(now) {
+		fmt.Printf("エラー: 過去の時刻には予約できません: %s\n", at.Format(scheduleTimeLayout))
+		os.Exit(1)
+	}
+	queue, err := openSchedule()
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+	post, err := queue.Add(key, note, at, now)
+	if err != nil {
+		fmt.Printf("エラー: 予約できませんでした: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s に投稿するよう予約しました (ID: %s)\n", at.Format(scheduleTimeLayout), post.ID)
+	fmt.Println("予約投稿は schedule run の実行中に送信されます。")
+}
+
+// openSchedule は予約投稿の待ち行列を開きます
+func openSchedule() (*schedule.Queue, error) {
+	file, err := cache.NewStateFile("schedule.json")
+	if err != nil {
+		return nil, fmt.Errorf("予約投稿の保存先を決められません: %w", err)
+	}
+	return schedule.New(file), nil
+}
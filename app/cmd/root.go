@@ -7,8 +7,12 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
 )
 
+// インスタンスキーを指定する環境変数
+const envKey = "PETIT_MISSKEY_KEY"
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "petit-misskey",
@@ -22,6 +26,9 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		applyGlobalFlags(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -38,7 +45,9 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.petit-misskey.yaml)")
+	// ユーザー設定ファイルの指定
+	rootCmd.PersistentFlags().String("config", "", "設定ファイルのパス (環境変数 "+setting.EnvConfig+")")
+	rootCmd.PersistentFlags().String("profile", "", "使用するプロファイル名 (環境変数 "+setting.EnvProfile+")")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -46,5 +55,22 @@ func init() {
 	// rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 
 	// インスタンス設定のkey
-	rootCmd.PersistentFlags().StringP("key", "k", "", "Instance Key")
+	rootCmd.PersistentFlags().StringP("key", "k", "", "Instance Key (環境変数 "+envKey+")")
+}
+
+// applyGlobalFlags は全コマンド共通のフラグと環境変数を反映します
+func applyGlobalFlags(cmd *cobra.Command) {
+	if path, _ := cmd.Flags().GetString("config"); path != "" {
+		setting.UseFile(path)
+	}
+	if profile, _ := cmd.Flags().GetString("profile"); profile != "" {
+		setting.UseProfile(profile)
+	}
+
+	// --key が省略された場合は環境変数から補う
+	if f := cmd.Flags().Lookup("key"); f != nil && !f.Changed {
+		if key := os.Getenv(envKey); key != "" {
+			cmd.Flags().Set("key", key)
+		}
+	}
 }
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wasya-io/petit-misskey/config"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/misskey"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/service/schedule"
+)
+
+const scheduleTimeLayout = "2006-01-02 15:04"
+
+// scheduleCmd は予約投稿を管理するコマンド
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "予約投稿を管理します",
+	Long: `post --at で予約した投稿を一覧・取り消し・送信します。
+予約投稿は schedule run を実行している間に、予約した時刻になると送信されます。
+
+使用例:
+  petit-misskey schedule list
+  petit-misskey schedule cancel <id>
+  petit-misskey schedule run`,
+}
+
+// scheduleListCmd は予約投稿の一覧を表示するサブコマンド
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "予約投稿を一覧表示します",
+	Run: func(cmd *cobra.Command, args []string) {
+		queue, err := openSchedule()
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		posts, err := queue.List()
+		if err != nil {
+			fmt.Printf("エラー: 予約投稿を読み込めませんでした: %v\n", err)
+			os.Exit(1)
+		}
+		if len(posts) == 0 {
+			fmt.Println("予約投稿はありません。")
+			return
+		}
+		for _, post := range posts {
+			status := ""
+			switch {
+			case post.Uncertain:
+				status = fmt.Sprintf(" [送信不明: %s]", post.LastError)
+			case post.Failed:
+				status = fmt.Sprintf(" [失敗: %s]", post.LastError)
+			case post.Attempts > 0:
+				status = fmt.Sprintf(" [再送待ち %s: %s]", post.NextAttempt.Local().Format(scheduleTimeLayout), post.LastError)
+			}
+			text := strings.ReplaceAll(post.Note.Text, "\n", " ")
+			if r := []rune(text); len(r) > 40 {
+				text = string(r[:40]) + "…"
+			}
+			fmt.Printf("%s  %s  [%s] %s%s\n", post.ID, post.At.Local().Format(scheduleTimeLayout), post.Key, text, status)
+		}
+	},
+}
+
+// scheduleCancelCmd は予約投稿を取り消すサブコマンド
+var scheduleCancelCmd = &cobra.Command{
+	Use:   "cancel <id>...",
+	Short: "予約投稿を取り消します",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		queue, err := openSchedule()
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		failed := false
+		for _, id := range args {
+			if err := queue.Cancel(id); err != nil {
+				fmt.Printf("エラー: %s を取り消せませんでした: %v\n", id, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("取り消しました: %s\n", id)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// scheduleRunCmd は予約投稿を送信し続けるサブコマンド
+var scheduleRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "予約した時刻に投稿を送信します",
+	Long: `予約投稿を確認し続け、予約した時刻になったものを送信します。
+止めている間に時刻を過ぎた予約投稿は、起動したときにまとめて送信します。
+--once を指定すると、時刻を過ぎたものを1回送信して終了します(cronなどから使う場合)。
+
+使用例:
+  petit-misskey schedule run
+  petit-misskey schedule run --once`,
+	Run: func(cmd *cobra.Command, args []string) {
+		once, _ := cmd.Flags().GetBool("once")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		if interval <= 0 {
+			fmt.Println("エラー: --interval には正の時間を指定してください。")
+			os.Exit(1)
+		}
+
+		queue, err := openSchedule()
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		// 同じ予約投稿を二重に送らないよう、送信するプロセスを1つに限る
+		release, err := queue.Acquire()
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		defer release()
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// 送信のたびにパスフレーズを聞かないよう、先にvaultを開いておく
+		userSetting := setting.NewUserSetting()
+		if userSetting.UsesVault() {
+			if err := userSetting.Vault().Unlock(); err != nil {
+				fmt.Printf("エラー: vaultを開けませんでした: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		clients := newClientCache(ctx, userSetting)
+		if once {
+			if err := sendScheduled(ctx, queue, clients); err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+
+		fmt.Printf("予約投稿の送信を開始します(%s ごとに確認)。Ctrl+Cで終了します。\n", interval)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			sendScheduled(ctx, queue, clients)
+			select {
+			case <-ctx.Done():
+				fmt.Println("終了します。")
+				return
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.AddCommand(scheduleListCmd)
+	scheduleCmd.AddCommand(scheduleCancelCmd)
+	scheduleCmd.AddCommand(scheduleRunCmd)
+
+	scheduleRunCmd.Flags().Bool("once", false, "時刻を過ぎた予約投稿を1回送信して終了する")
+	scheduleRunCmd.Flags().Duration("interval", 30*time.Second, "予約投稿を確認する間隔")
+}
+
+// sendScheduled は時刻を過ぎた予約投稿を送信し、結果を表示します
+func sendScheduled(ctx context.Context, queue *schedule.Queue, clients schedule.ClientFunc) error {
+	now := time.Now()
+	results, err := queue.Send(ctx, now, clients)
+	for _, r := range results {
+		late := ""
+		if d := now.Sub(r.Post.At); d > time.Minute {
+			late = fmt.Sprintf(" (%s遅れ)", d.Round(time.Minute))
+		}
+		if r.Err != nil {
+			fmt.Printf("%s 送信できませんでした: %s [%s]%s: %v\n", now.Format(scheduleTimeLayout), r.Post.ID, r.Post.Key, late, r.Err)
+			continue
+		}
+		fmt.Printf("%s 送信しました: %s [%s]%s\n", now.Format(scheduleTimeLayout), r.Post.ID, r.Post.Key, late)
+	}
+	if err != nil {
+		fmt.Printf("エラー: 予約投稿を更新できませんでした: %v\n", err)
+	}
+	return err
+}
+
+// newClientCache はインスタンスキーごとにAPIクライアントを作り、使い回す関数を返します
+func newClientCache(ctx context.Context, userSetting *setting.UserSetting) schedule.ClientFunc {
+	cfg := config.NewConfig()
+	clients := make(map[string]api.Client)
+	return func(key string) (api.Client, error) {
+		if c, ok := clients[key]; ok {
+			return c, nil
+		}
+		instance, err := userSetting.ResolveInstance(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("アクセストークンを取得できませんでした: %w", err)
+		}
+		if instance == nil {
+			return nil, fmt.Errorf("インスタンスキー '%s' が見つかりません", key)
+		}
+		clients[key] = misskey.NewClient(cfg, instance)
+		return clients[key], nil
+	}
+}
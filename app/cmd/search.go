@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wasya-io/petit-misskey/config"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/misskey"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/store"
+	model "github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/archive"
+	"github.com/wasya-io/petit-misskey/service/search"
+)
+
+// searchCmd はノートを検索するコマンド
+var searchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "ノートを検索します",
+	Long: `インスタンスのノートを検索します。空白で区切った語をすべて含むものを新しい順に表示します。
+--tag でハッシュタグのノートを、--trends で最近よく使われているハッシュタグを表示します。
+--local を指定すると、stream で受信して保存したノートと通知から検索します(--key は省略可)。
+
+使用例:
+  petit-misskey search --key="misskey.io" "勉強会"
+  petit-misskey search --key="misskey.io" --user "@alice" --host . --since 24h "リリース"
+  petit-misskey search --key="misskey.io" --tag misskey --limit 100
+  petit-misskey search --key="misskey.io" --trends
+  petit-misskey search --local --user "@alice" --since 2026-10-01 --format json "障害"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		local, _ := cmd.Flags().GetBool("local")
+		key, _ := cmd.Flags().GetString("key")
+		user, _ := cmd.Flags().GetString("user")
+		host, _ := cmd.Flags().GetString("host")
+		channel, _ := cmd.Flags().GetString("channel")
+		tag, _ := cmd.Flags().GetString("tag")
+		trends, _ := cmd.Flags().GetBool("trends")
+		limit, _ := cmd.Flags().GetInt("limit")
+		format, _ := cmd.Flags().GetString("format")
+		if format != "text" && format != "json" {
+			fmt.Printf("エラー: 出力形式 %q には対応していません (text / json)\n", format)
+			os.Exit(1)
+		}
+		if limit <= 0 {
+			fmt.Println("エラー: --limit には正の数を指定してください。")
+			os.Exit(1)
+		}
+		text := strings.Join(args, " ")
+		var since time.Time
+		if value, _ := cmd.Flags().GetString("since"); value != "" {
+			t, err := archive.ParseSince(value, time.Now())
+			if err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				os.Exit(1)
+			}
+			since = t
+		}
+
+		if local {
+			if host != "" || channel != "" || tag != "" || trends {
+				fmt.Println("エラー: --local では --host / --channel / --tag / --trends は使えません。")
+				os.Exit(1)
+			}
+			if text == "" && user == "" && since.IsZero() {
+				fmt.Println("エラー: 検索する語か --user / --since を指定してください。")
+				os.Exit(1)
+			}
+			records, err := searchLocal(archive.Query{Text: text, User: user, Since: since, Account: key, Limit: limit})
+			if err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				os.Exit(1)
+			}
+			printRecords(records, format)
+			return
+		}
+
+		if key == "" {
+			fmt.Println("エラー: インスタンスキーが指定されていません。--keyフラグを使用してインスタンスキーを指定してください。")
+			fmt.Println("使用例: petit-misskey search --key=\"your-instance-key\" \"検索する語\"")
+			os.Exit(1)
+		}
+		client, err := searchClient(cmd.Context(), key)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		if trends {
+			if err := printTrends(cmd.Context(), client, format); err != nil {
+				fmt.Printf("エラー: トレンドを取得できませんでした: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		pager, err := search.NewPager(client, search.Query{
+			Text: text, Tag: tag, User: user, Host: host, Channel: channel, Since: since,
+			Limit: min(limit, maxSearchPage),
+		})
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		notes, err := collectNotes(cmd.Context(), pager, limit)
+		if err != nil {
+			fmt.Printf("エラー: 検索できませんでした: %v\n", err)
+			os.Exit(1)
+		}
+		printNotes(key, notes, format)
+	},
+}
+
+// maxSearchPage はAPIで一度に取得できるノートの数です
+const maxSearchPage = 100
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+
+	searchCmd.Flags().Bool("local", false, "受信して保存したノートと通知から検索する")
+	searchCmd.Flags().StringP("key", "k", "", "検索するインスタンスキー(--local では省略時はすべて)")
+	searchCmd.Flags().String("user", "", "投稿者で絞り込む (@username か @username@host)")
+	searchCmd.Flags().String("host", "", "投稿者のホストで絞り込む (ローカルは .)")
+	searchCmd.Flags().String("channel", "", "チャンネルのIDで絞り込む")
+	searchCmd.Flags().String("tag", "", "ハッシュタグのノートを表示する")
+	searchCmd.Flags().Bool("trends", false, "最近よく使われているハッシュタグを表示する")
+	searchCmd.Flags().String("since", "", "この時刻以降のものに絞り込む (24h / 7d / 2026-10-01 など)")
+	searchCmd.Flags().Int("limit", 50, "表示する件数の上限")
+	searchCmd.Flags().String("format", "text", "出力形式 (text / json)")
+}
+
+// searchClient はインスタンスキーのAPIクライアントを返します
+func searchClient(ctx context.Context, key string) (api.Client, error) {
+	instance, err := setting.NewUserSetting().ResolveInstance(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("アクセストークンを取得できませんでした: %w", err)
+	}
+	if instance == nil {
+		return nil, fmt.Errorf("インスタンスキー '%s' が見つかりません", key)
+	}
+	return misskey.NewClient(config.NewConfig(), instance), nil
+}
+
+// collectNotes はlimit件に達するか最後のページまで、検索の結果を取得します
+func collectNotes(ctx context.Context, pager *search.Pager, limit int) ([]model.NoteBody, error) {
+	notes := make([]model.NoteBody, 0, limit)
+	for len(notes) < limit && !pager.Done() {
+		page, err := pager.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, page...)
+	}
+	if len(notes) > limit {
+		notes = notes[:limit]
+	}
+	return notes, nil
+}
+
+// printNotes は検索の結果を stream --headless と同じ形で表示します
+func printNotes(key string, notes []model.NoteBody, format string) {
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, n := range notes {
+			encoder.Encode(headlessRecord{Account: key, Note: &n})
+		}
+		return
+	}
+	if len(notes) == 0 {
+		fmt.Println("見つかりませんでした。")
+		return
+	}
+	for _, n := range notes {
+		fmt.Println(formatHeadlessNote(key, n))
+	}
+}
+
+// printTrends は最近よく使われているハッシュタグと、使ったユーザーの数を表示します
+func printTrends(ctx context.Context, client api.Client, format string) error {
+	trends, err := client.TrendHashtags(ctx)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, t := range trends {
+			encoder.Encode(t)
+		}
+		return nil
+	}
+	if len(trends) == 0 {
+		fmt.Println("トレンドはありません。")
+		return nil
+	}
+	for _, t := range trends {
+		fmt.Printf("#%s (%d人)\n", t.Tag, t.UsersCount)
+	}
+	return nil
+}
+
+// openArchive は保存先のノートと通知を読み込んだArchiveを返します
+// keyを指定した場合はそのアカウントだけを読み込みます
+func openArchive(keys ...string) (*archive.Archive, error) {
+	dir, err := store.DefaultDir()
+	if err != nil {
+		return nil, fmt.Errorf("保存先を決められません: %w", err)
+	}
+	s, err := store.Open(dir, store.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("保存先を開けません: %w", err)
+	}
+	a, err := archive.Open(s, keys)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("保存したノートを読み込めません: %w", err)
+	}
+	return a, nil
+}
+
+// searchLocal は保存したノートと通知から検索します
+func searchLocal(q archive.Query) ([]store.Record, error) {
+	var keys []string
+	if q.Account != "" {
+		keys = []string{q.Account}
+	}
+	a, err := openArchive(keys...)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+	return a.Search(q)
+}
+
+// printRecords は保存したノートと通知を表示します
+func printRecords(records []store.Record, format string) {
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, r := range records {
+			encoder.Encode(r)
+		}
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("見つかりませんでした。")
+		return
+	}
+	for _, r := range records {
+		fmt.Println(formatRecord(r))
+	}
+}
+
+// formatRecord は保存したノートか通知を1行にします
+func formatRecord(r store.Record) string {
+	if r.Note != nil {
+		return formatHeadlessNote(r.Account, *r.Note)
+	}
+	line := fmt.Sprintf("%s [%s] 通知(%s)", r.CreatedAt.Local().Format(time.DateTime), r.Account, r.Notification.Type)
+	if u := archive.User(r); u != nil {
+		line += " @" + u.Username
+		if host, ok := u.Host.(string); ok && host != "" {
+			line += "@" + host
+		}
+	}
+	if n := archive.Note(r); n != nil {
+		line += ": " + strings.ReplaceAll(n.Text, "\n", " ")
+	}
+	return line
+}
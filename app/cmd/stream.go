@@ -4,15 +4,34 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/wasya-io/petit-misskey/config"
+	"github.com/wasya-io/petit-misskey/domain/core"
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/infrastructure/media"
 	"github.com/wasya-io/petit-misskey/infrastructure/misskey"
 	"github.com/wasya-io/petit-misskey/infrastructure/resolver"
 	"github.com/wasya-io/petit-misskey/infrastructure/setting"
 	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
 	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/service/archive"
+	"github.com/wasya-io/petit-misskey/service/daemon"
+	"github.com/wasya-io/petit-misskey/service/emoji"
+	"github.com/wasya-io/petit-misskey/service/expr"
+	"github.com/wasya-io/petit-misskey/service/forward"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+	"github.com/wasya-io/petit-misskey/service/outbox"
+	"github.com/wasya-io/petit-misskey/service/plugins"
 	"github.com/wasya-io/petit-misskey/view"
 	"github.com/wasya-io/petit-misskey/view/stream"
 )
@@ -23,40 +42,309 @@ var streamCmd = &cobra.Command{
 	Short: "Misskey のストリーミングAPIを使ってタイムラインを表示します",
 	Long: `Misskey のストリーミングAPIを使用してリアルタイムでタイムラインを
 表示します。ホームタイムラインとローカルタイムラインを切り替えることができます。
+起動後は ctrl+a で登録済みの別アカウントに切り替えられます。
+
+--key にカンマ区切りで複数のインスタンスキーを指定すると、それぞれの
+タイムラインを1つにまとめて表示します。複数のアカウントで受信したノートは
+1つにまとめられ、返信やリアクションは受信したアカウントから行います。
+
+--where に式を指定すると、式に当てはまるノートだけを表示します。
+--headless を付けるとTUIを使わず、当てはまるノートを1行ずつ標準出力に
+書き出します(--format json で1行1件のJSON)。
+--forward にURLを指定すると、TUIを使わずにイベントを1件ずつJSONでPOSTします。
+--where を指定すると、式に当てはまるノートのイベントだけを転送します。
+--daemon を付けると自分では接続せず、daemon の接続を共有します。
+受信したノートと通知は保存し、search --local や投稿欄の :search で検索できます
+(--no-store で保存しない)。
 
 使用例:
-  petit-misskey stream --key="misskey.io"`,
+  petit-misskey stream --key="misskey.io"
+  petit-misskey stream --key="misskey.io,misskey.design"
+  petit-misskey stream --headless --where 'user.isBot == false && "#ops" in tags'
+  petit-misskey stream --forward http://localhost:9000/hook --forward-secret "$SECRET"`,
 	Run: func(cmd *cobra.Command, args []string) {
 		key, _ := cmd.Flags().GetString("key")
-		if key == "" {
+		keys := splitKeys(key)
+		if len(keys) == 0 {
 			fmt.Println("エラー: インスタンスキーが指定されていません。--keyフラグを使用してインスタンスキーを指定してください。")
 			fmt.Println("使用例: petit-misskey stream --key=\"your-instance-key\"")
 			return
 		}
 
-		setting := setting.NewUserSetting()       // ユーザ設定を呼び出す
-		instance := setting.GetInstanceByKey(key) // ユーザ設定からインスタンスの接続情報を呼び出す
-		if instance == nil {
-			fmt.Printf("エラー: インスタンスキー '%s' が見つかりません。\n", key)
+		var where *expr.Program
+		if src, _ := cmd.Flags().GetString("where"); src != "" {
+			program, err := expr.Compile(src)
+			if err != nil {
+				fmt.Println("エラー: --where の式に誤りがあります")
+				var exprErr *expr.Error
+				if errors.As(err, &exprErr) {
+					fmt.Println(exprErr.Detail())
+				} else {
+					fmt.Println(err)
+				}
+				os.Exit(1)
+			}
+			where = program
+		}
+		headless, _ := cmd.Flags().GetBool("headless")
+		var forwarder *forward.Forwarder
+		if target, _ := cmd.Flags().GetString("forward"); target != "" {
+			opts := forward.Options{Where: where, Out: os.Stderr}
+			opts.Secret, _ = cmd.Flags().GetString("forward-secret")
+			opts.MaxQueue, _ = cmd.Flags().GetInt("forward-queue")
+			f, err := newForwarder(target, opts)
+			if err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				os.Exit(1)
+			}
+			forwarder = f
+			headless = true
+		}
+
+		userSetting := setting.NewUserSetting() // ユーザ設定を呼び出す
+
+		// TUIの起動後は端末からパスフレーズを入力できないため、先にvaultを開いておく
+		if userSetting.UsesVault() {
+			if err := userSetting.Vault().Unlock(); err != nil {
+				fmt.Printf("エラー: vaultを開けませんでした: %v\n", err)
+				return
+			}
+		}
+
+		l := logger.New(true) // ロガーを作成
+		dispatcher, err := hooks.New(userSetting.GetHooks(), userSetting.HookConcurrency())
+		if err != nil {
+			fmt.Printf("エラー: フックの設定を一部使えません: %v\n", err)
+		}
+		// プラグインはTUIでだけ使う。起動できなかったプラグインを除いて続ける
+		host := plugins.New(userSetting.GetPlugins(), pluginAccounts(keys, userSetting.GetInstanceKeys()), plugins.ClientFunc(newClientCache(cmd.Context(), userSetting)))
+		if !headless && host.Len() > 0 {
+			if err := host.Start(cmd.Context()); err != nil {
+				fmt.Printf("エラー: プラグインを一部使えません: %v\n", err)
+			}
+			defer host.Close()
+		}
+		factory := newAccountFactory(cmd.Context(), userSetting, l)
+		if useDaemon, _ := cmd.Flags().GetBool("daemon"); useDaemon {
+			client, ok := daemonClient(cmd.Context(), cmd, keys[0])
+			if !ok {
+				fmt.Println("エラー: アカウントに接続しているデーモンが見つかりません。先に daemon を起動してください。")
+				os.Exit(1)
+			}
+			factory = viaDaemon(factory, client)
+		}
+		if forwarder != nil || dispatcher.NeedsNotifications() || host.NeedsNotifications() {
+			factory = subscribeNotifications(factory)
+		}
+		accounts := make([]*stream.Account, 0, len(keys))
+		for _, k := range keys {
+			account, err := factory(k)
+			if err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				return
+			}
+			accounts = append(accounts, account)
+		}
+
+		// 受信したノートと通知を保存する。保存先が使えなくてもタイムラインは表示する
+		var saved *archive.Archive
+		if noStore, _ := cmd.Flags().GetBool("no-store"); !noStore {
+			a, err := openArchive()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "エラー: 受信したノートを保存できません: %v\n", err)
+			} else {
+				saved = a
+				defer saved.Close()
+			}
+		}
+
+		if headless {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if forwarder != nil {
+				runForward(ctx, accounts, forwarder, dispatcher, saved)
+				return
+			}
+			format, _ := cmd.Flags().GetString("format")
+			if err := runHeadless(ctx, accounts, where, format, os.Stdout, dispatcher, saved); err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				os.Exit(1)
+			}
 			return
 		}
 
+		model := stream.NewAccountModel(accounts[0], l) // initializerでmodelを作る
+		model.SetWhere(where)
+		// 注目の条件のフックも同じDispatcherで実行し、同時に実行する数を制限する
+		model.EnableHooks(dispatcher)
+		if host.Len() > 0 {
+			model.EnablePlugins(host)
+		}
+		if saved != nil {
+			model.EnableArchive(saved)
+		}
+		if len(accounts) > 1 {
+			model.JoinAccounts(accounts[1:]...)
+		}
+		model.EnableAccountSwitch(userSetting.GetInstanceKeys(), factory)
+		// 下書きと送信待ちの投稿は状態ディレクトリに保存する
+		// 保存先が使えない場合は、失敗した投稿を入力欄に残すだけにする
+		if drafts, box, err := openOutbox(); err == nil {
+			model.EnableOutbox(drafts, box)
+		} else {
+			l.Log("stream", fmt.Sprintf("outbox error: %v", err))
+		}
+
+		view.Run(model, l) // modelをrunnerに渡す
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(streamCmd)
+	streamCmd.Flags().String("where", "", "表示するノートの条件式 (例: 'user.isBot == false && text =~ \"deploy\"')")
+	streamCmd.Flags().Bool("headless", false, "TUIを使わずに、当てはまるノートを標準出力に書き出す")
+	streamCmd.Flags().String("format", "text", "--headless の出力形式 (text / json)")
+	streamCmd.Flags().String("forward", "", "TUIを使わずに、イベントをJSONでPOSTするURL")
+	streamCmd.Flags().String("forward-secret", "", "--forward の本文をHMAC-SHA256で署名する秘密 (環境変数 "+envForwardSecret+")")
+	streamCmd.Flags().Int("forward-queue", 1000, "--forward で送れなかったイベントを溜めておく上限")
+	streamCmd.Flags().Bool("daemon", false, "自分では接続せず、daemon の接続を共有する")
+	streamCmd.Flags().Bool("no-store", false, "受信したノートと通知を保存しない")
+}
+
+// splitKeys はカンマ区切りのインスタンスキーを重複なく分割します
+func splitKeys(value string) []string {
+	keys := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, k := range strings.Split(value, ",") {
+		k = strings.TrimSpace(k)
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// pluginAccounts はプラグインがAPIを呼び出せるインスタンスキーを返します
+// --key で指定したキーを先頭にし、切り替え先のアカウントも使えるようにします
+func pluginAccounts(keys []string, all []string) []string {
+	accounts := slices.Clone(keys)
+	for _, k := range all {
+		if !slices.Contains(accounts, k) {
+			accounts = append(accounts, k)
+		}
+	}
+	return accounts
+}
+
+// subscribeNotifications は通知のイベントを受け取れるように、mainチャンネルも購読するAccountFactoryを返します
+// 通知カラムがあれば通知が二重に届きますが、フックは同じ通知で一度だけ実行します
+func subscribeNotifications(factory stream.AccountFactory) stream.AccountFactory {
+	return func(key string) (*stream.Account, error) {
+		account, err := factory(key)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := account.Client.Subscribe(websocket.ChannelTypeMain, nil); err != nil {
+			return nil, fmt.Errorf("通知を購読できません: %w", err)
+		}
+		return account, nil
+	}
+}
+
+// viaDaemon はストリーミングをデーモンから受け取るAccountFactoryを返します
+// REST APIは今までどおりアカウントのクライアントから呼び出します
+func viaDaemon(factory stream.AccountFactory, client *daemon.Client) stream.AccountFactory {
+	return func(key string) (*stream.Account, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		status, err := client.Status(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("デーモンに接続できません: %w", err)
+		}
+		if !slices.ContainsFunc(status.Accounts, func(a daemon.AccountStatus) bool { return a.Key == key }) {
+			return nil, fmt.Errorf("デーモンは %s に接続していません", key)
+		}
+		account, err := factory(key)
+		if err != nil {
+			return nil, err
+		}
+		account.Client, account.MsgCh = daemon.NewStreamClient(client, key)
+		return account, nil
+	}
+}
+
+// openOutbox は下書きと送信待ちの投稿を読み込みます
+func openOutbox() (*outbox.Drafts, *outbox.Outbox, error) {
+	draftFile, err := cache.NewStateFile("drafts.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	drafts, err := outbox.NewDrafts(draftFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	outboxFile, err := cache.NewStateFile("outbox.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	box, err := outbox.New(outboxFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return drafts, box, nil
+}
+
+// newAccountFactory はインスタンスキーから接続用のクライアント一式を組み立てる関数を返します
+// アカウント切り替えのたびに呼ばれます
+func newAccountFactory(ctx context.Context, userSetting *setting.UserSetting, l core.Logger) stream.AccountFactory {
+	return func(key string) (*stream.Account, error) {
+		instance, err := userSetting.ResolveInstance(ctx, key) // ユーザ設定からインスタンスの接続情報を呼び出す
+		if err != nil {
+			return nil, fmt.Errorf("アクセストークンを取得できませんでした: %w", err)
+		}
+		if instance == nil {
+			return nil, fmt.Errorf("インスタンスキー '%s' が見つかりません", key)
+		}
+
 		resolver := resolver.NewMisskeyStreamUrlResolver()
-		l := logger.New(true)                                                                          // ロガーを作成
 		client, msgCh := websocket.NewClient(instance.BaseUrl, instance.AccessToken, resolver, nil, l) // websocketクライアントを作成
 
+		// 設定ファイルで指定されたタイムラインから開始する
+		timeline, err := websocket.ParseChannelType(instance.Preferences.Timeline)
+		if err != nil {
+			return nil, err
+		}
+		client.SetTimeline(timeline)
+
 		cfg := config.NewConfig()
 		apiClient := misskey.NewClient(
 			cfg,
 			instance,
 		)
 
-		model := stream.NewModel(instance, client, apiClient, l, msgCh) // initializerでmodelを作る
-
-		view.Run(model, l) // modelをrunnerに渡す
-	},
-}
+		// カスタム絵文字の一覧はインスタンスごとにキャッシュする
+		// キャッシュの場所が決められない場合は、絵文字を:name:のまま表示する
+		var emojis *emoji.Catalog
+		if file, err := cache.NewFile("emojis-" + key + ".json"); err == nil {
+			emojis = emoji.NewCatalog(apiClient, file, cfg.Emoji.CacheTTL)
+		} else {
+			l.Log("stream", fmt.Sprintf("emoji cache error: %v", err))
+		}
+		fetcher, err := media.NewFetcher(cfg)
+		if err != nil {
+			l.Log("stream", fmt.Sprintf("media cache error: %v", err))
+		}
 
-func init() {
-	rootCmd.AddCommand(streamCmd)
+		return &stream.Account{
+			Key:       key,
+			Instance:  instance,
+			Client:    client,
+			APIClient: apiClient,
+			MsgCh:     msgCh,
+			Emojis:    emojis,
+			Media:     fetcher,
+		}, nil
+	}
 }
@@ -1,20 +1,33 @@
 package config
 
 import (
+	"bytes"
+	_ "embed"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"github.com/wasya-io/petit-misskey/infrastructure/xdg"
 )
 
 var (
 	instance = new(Config)
 	once     sync.Once
+
+	// バイナリに埋め込む既定の設定
+	//go:embed config.default.yaml
+	defaultConfig []byte
 )
 
-// /config/config.{type}.yaml のファイルを読み込む
+// 環境変数で設定を上書きする際の接頭辞(例: PETIT_MISSKEY_HTTP_TIMEOUT=10s)
+const EnvPrefix = "PETIT_MISSKEY"
+
+// config.{type}.yaml のファイルを読み込む
 type ConfigType string
 
 type Config struct {
@@ -27,6 +40,9 @@ type Config struct {
 		BaseUrl     string
 		AccessToken string
 	}
+	Emoji struct {
+		CacheTTL time.Duration // カスタム絵文字の一覧をキャッシュする期間
+	}
 	Log struct {
 		MaxEntries       int // ログファイルの最大エントリ数（これを超えるとローテーション）
 		MaxRotationFiles int // 保持するローテーションファイルの最大数
@@ -44,18 +60,25 @@ func NewConfig() *Config {
 	return instance
 }
 
+// readConfig は埋め込みの既定値に、見つかった設定ファイルと環境変数を重ねて読み込みます
 func readConfig(configType ConfigType) error {
-	// cwd, _ := os.Getwd()
-	// fmt.Printf("%s\n", cwd)
-
-	name := fmt.Sprintf("config.%s", configType)
-	viper.SetConfigName(name)
 	viper.SetConfigType("yaml")
-	viper.AddConfigPath("config/")
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
 
-	if err := viper.ReadInConfig(); err != nil {
+	if err := viper.ReadConfig(bytes.NewReader(defaultConfig)); err != nil {
 		return errors.WithStack(err)
 	}
+
+	name := fmt.Sprintf("config.%s.yaml", configType)
+	if path := findConfigFile(name); path != "" {
+		viper.SetConfigFile(path)
+		if err := viper.MergeInConfig(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
 	if err := viper.Unmarshal(&instance); err != nil {
 		return errors.WithStack(err)
 	}
@@ -70,3 +93,19 @@ func readConfig(configType ConfigType) error {
 
 	return nil
 }
+
+// findConfigFile は設定ファイルを探してパスを返します(見つからなければ空文字)
+// XDGの設定ディレクトリを優先し、最後に開発用としてカレントディレクトリのconfig/を探します
+func findConfigFile(name string) string {
+	if path := os.Getenv(EnvPrefix + "_APP_CONFIG"); path != "" {
+		return path
+	}
+	dirs := append(xdg.ConfigDirs(), "config")
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
@@ -2,12 +2,25 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/wasya-io/petit-misskey/model/misskey"
 )
 
 type (
 	Client interface {
-		CreateNote(ctx context.Context, visibility misskey.Visibility, text string) (*misskey.CreateNoteResponse, error)
+		Meta(ctx context.Context, contents misskey.Meta) (*misskey.MetaResponse, error)
+		CreateNote(ctx context.Context, contents misskey.CreateNote) (*misskey.CreateNoteResponse, error)
+		CreateReaction(ctx context.Context, contents misskey.CreateReaction) error
+		ShowUser(ctx context.Context, contents misskey.ShowUser) (*misskey.User, error)
+		UserNotes(ctx context.Context, contents misskey.UserNotes) ([]misskey.NoteBody, error)
+		Emojis(ctx context.Context) ([]misskey.Emoji, error)
+		SearchUsers(ctx context.Context, contents misskey.SearchUsers) ([]misskey.User, error)
+		SearchHashtags(ctx context.Context, contents misskey.SearchHashtags) ([]string, error)
+		SearchNotes(ctx context.Context, contents misskey.SearchNotes) ([]misskey.NoteBody, error)
+		SearchNotesByTag(ctx context.Context, contents misskey.SearchNotesByTag) ([]misskey.NoteBody, error)
+		TrendHashtags(ctx context.Context) ([]misskey.HashtagTrend, error)
+		// Call は任意のエンドポイントを呼び出し、応答のJSONをそのまま返します
+		Call(ctx context.Context, endpoint string, params map[string]any) (json.RawMessage, error)
 	}
 )
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type (
+	// StatusError はAPIが2xx以外のステータスを返したことを表すエラーです
+	StatusError struct {
+		StatusCode int
+	}
+)
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http bad status: %d", e.StatusCode)
+}
+
+// Temporary はしばらく待てば成功するかもしれないエラーかどうかを返します
+// サーバー側のエラーとレート制限、タイムアウトが該当します
+func (e *StatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode >= http.StatusInternalServerError
+}
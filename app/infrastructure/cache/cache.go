@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wasya-io/petit-misskey/infrastructure/xdg"
+)
+
+type (
+	// File はキャッシュディレクトリに置くJSONファイルです
+	// 更新日時を見て、有効期限が切れているかを判断します
+	File struct {
+		path string
+	}
+)
+
+// NewFile はキャッシュディレクトリにあるnameのファイルを返します
+func NewFile(name string) (*File, error) {
+	dir, err := xdg.CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileAt(filepath.Join(dir, xdg.SafeName(name))), nil
+}
+
+// NewStateFile は状態ディレクトリにあるnameのファイルを返します
+// 下書きなど、キャッシュと違って消えると困るデータに使います
+func NewStateFile(name string) (*File, error) {
+	dir, err := xdg.StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileAt(filepath.Join(dir, xdg.SafeName(name))), nil
+}
+
+// NewFileAt はpathのファイルを返します
+func NewFileAt(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) Path() string {
+	return f.path
+}
+
+// Read はファイルの中身をvに読み込み、ttlより新しければtrueを返します
+// ファイルがなければ(false, nil)を返します
+func (f *File) Read(v any, ttl time.Duration) (bool, error) {
+	info, err := os.Stat(f.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, errors.Wrapf(err, "broken cache file: %s", f.path)
+	}
+	return time.Since(info.ModTime()) < ttl, nil
+}
+
+// Load は有効期限を見ずにファイルの中身をvに読み込みます
+// ファイルがなければfalseを返します
+func (f *File) Load(v any) (bool, error) {
+	raw, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, errors.Wrapf(err, "broken file: %s", f.path)
+	}
+	return true, nil
+}
+
+// Write はvをファイルに書き込みます
+func (f *File) Write(v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	// 書き込み途中で壊れないよう一時ファイル経由で置き換える
+	// 別のプロセスと一時ファイルを取り合わないよう、名前は書き込むたびに変える
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+type (
+	// Lock はファイルのそばに置くロックファイルで、プロセスをまたいで排他します
+	// 同じプロセスの中でも、ロックするたびにファイルを開くので排他されます
+	Lock struct {
+		file *os.File
+	}
+)
+
+// ErrLocked はほかのプロセスがロックしていることを表します
+var ErrLocked = errors.New("locked by another process")
+
+// Lock はファイルを読み直して書き換えるあいだ、ほかのプロセスが書き換えないようにロックします
+// ロックできるまで待ちます
+func (f *File) Lock() (*Lock, error) {
+	return lockFile(f.path+".lock", true)
+}
+
+// TryLock はnameのロックを待たずに取ります。ほかのプロセスがロックしていればErrLockedを返します
+// 書き換えのロックとは別のファイルを使うので、長い処理を1つのプロセスに限るのに使えます
+func (f *File) TryLock(name string) (*Lock, error) {
+	return lockFile(f.path+"."+name+".lock", false)
+}
+
+// Unlock はロックを解放します
+func (l *Lock) Unlock() error {
+	if err := unlock(l.file); err != nil {
+		l.file.Close()
+		return err
+	}
+	return pkgerrors.WithStack(l.file.Close())
+}
+
+func lockFile(path string, wait bool) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, pkgerrors.WithStack(err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, pkgerrors.WithStack(err)
+	}
+	if err := lock(file, wait); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Lock{file: file}, nil
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package cache
+
+import "os"
+
+// flockの無い環境ではプロセス間の排他はしません
+
+func lock(file *os.File, wait bool) error {
+	return nil
+}
+
+func unlock(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package cache
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func lock(file *os.File, wait bool) error {
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return ErrLocked
+		default:
+			return pkgerrors.WithStack(err)
+		}
+	}
+}
+
+func unlock(file *os.File) error {
+	return pkgerrors.WithStack(syscall.Flock(int(file.Fd()), syscall.LOCK_UN))
+}
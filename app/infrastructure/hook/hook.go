@@ -0,0 +1,54 @@
+// Package hook はユーザーが設定したシェルのコマンドを実行します
+package hook
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultTimeout はコマンドの実行を打ち切るまでの時間です
+const DefaultTimeout = 30 * time.Second
+
+// 打ち切った後に出力が閉じられるのを待つ時間
+const waitDelay = time.Second
+
+// Run はコマンドをシェル経由で実行し、終わるまで待ちます
+// envは追加する環境変数("NAME=value")、stdinはコマンドの標準入力です
+// ctxに期限がなければDefaultTimeoutで打ち切ります
+func Run(ctx context.Context, command string, env []string, stdin []byte) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+
+	cmd := shellCommand(ctx, command)
+	// シェルを止めても子プロセスが出力を開いたままにすることがあるため、待つ時間を区切る
+	cmd.WaitDelay = waitDelay
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return errors.Wrapf(ctx.Err(), "hook timed out: %s", command)
+		}
+		return errors.Wrapf(err, "hook failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// shellCommand はOSのシェル経由でコマンド文字列を実行するexec.Cmdを作ります
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
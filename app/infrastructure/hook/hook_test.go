@@ -0,0 +1,31 @@
+package hook_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/infrastructure/hook"
+)
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh が必要です")
+	}
+	assert.NoError(t, hook.Run(context.Background(), `test "$NAME" = value && test "$(cat)" = input`, []string{"NAME=value"}, []byte("input")))
+
+	err := hook.Run(context.Background(), "echo oops >&2; exit 3", nil, nil)
+	assert.ErrorContains(t, err, "hook failed: oops")
+}
+
+func TestRunTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh が必要です")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := hook.Run(ctx, "sleep 5", nil, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
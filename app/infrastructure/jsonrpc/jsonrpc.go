@@ -0,0 +1,342 @@
+// Package jsonrpc は1行に1つのJSONを書く、JSON-RPC 2.0の接続です
+// プラグインの標準入出力のように、順序が保たれる双方向のストリームで使います
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// Conn はJSON-RPCの接続です
+	// 相手からのリクエストはHandlerで処理し、こちらからはCallとNotifyで送ります
+	// 書き込みは1つのgoroutineが順に行うので、相手が読まなくなっても送る側は止まりません
+	Conn struct {
+		w       io.Writer
+		out     chan []byte // 書き出し待ちのメッセージ(nilは書き込みの終わり)
+		stall   time.Duration
+		handler Handler
+		ctx     context.Context // Handlerに渡す、接続が閉じると終了するコンテキスト
+		cancel  context.CancelFunc
+
+		mu        sync.Mutex
+		nextID    int64
+		pending   map[string]chan *message
+		done      chan struct{}
+		closeOnce sync.Once
+		err       error
+	}
+
+	// Handler は相手から届いたリクエストと通知を処理します
+	// 通知の場合は戻り値を使いません
+	Handler func(ctx context.Context, method string, params json.RawMessage) (any, error)
+
+	// Error はJSON-RPCのエラーです
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	message struct {
+		JSONRPC string           `json:"jsonrpc"`
+		ID      *json.RawMessage `json:"id,omitempty"`
+		Method  string           `json:"method,omitempty"`
+		Params  json.RawMessage  `json:"params,omitempty"`
+		Result  json.RawMessage  `json:"result,omitempty"`
+		Error   *Error           `json:"error,omitempty"`
+	}
+)
+
+// JSON-RPC 2.0で決められたエラーコード
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+const (
+	maxQueued           = 64              // 書き出し待ちにできるメッセージの数
+	defaultStallTimeout = 5 * time.Second // 書き出し待ちがいっぱいのまま待つ時間
+)
+
+var (
+	// ErrClosed は接続が閉じていることを表します
+	ErrClosed = errors.New("jsonrpc: connection closed")
+	// ErrStalled は相手が読まず、書き出し待ちがいっぱいのままだったため接続を閉じたことを表します
+	ErrStalled = errors.New("jsonrpc: peer stopped reading")
+)
+
+// NewConn はrから読み、wに書く接続を生成し、読み書きを開始します
+// rが終わると接続は閉じ、応答を待っている呼び出しはErrClosedを返します
+func NewConn(r io.Reader, w io.Writer, handler Handler) *Conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Conn{
+		ctx:     ctx,
+		cancel:  cancel,
+		w:       w,
+		out:     make(chan []byte, maxQueued),
+		stall:   defaultStallTimeout,
+		handler: handler,
+		pending: make(map[string]chan *message),
+		done:    make(chan struct{}),
+	}
+	go c.read(r)
+	go c.write()
+	return c
+}
+
+// SetStallTimeout は書き出し待ちがいっぱいのまま待つ時間を変えます(既定は5秒)
+// この時間が過ぎても空かなければ、相手が読んでいないとみなしてErrStalledで接続を閉じます
+func (c *Conn) SetStallTimeout(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stall = d
+}
+
+// Call はリクエストを送り、応答をresultに読み込みます
+// ctxが終了した場合は応答を待たずにそのエラーを返します
+func (c *Conn) Call(ctx context.Context, method string, params any, result any) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.nextID++
+	id := strconv.FormatInt(c.nextID, 10)
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	raw := json.RawMessage(id)
+	if err := c.send(ctx, &message{ID: &raw, Method: method, Params: marshalParams(params)}); err != nil {
+		return err
+	}
+	select {
+	case res := <-ch:
+		if res.Error != nil {
+			return res.Error
+		}
+		if result == nil || len(res.Result) == 0 {
+			return nil
+		}
+		return errors.WithStack(json.Unmarshal(res.Result, result))
+	case <-c.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// Notify は応答を求めない通知を送ります
+func (c *Conn) Notify(method string, params any) error {
+	return c.send(context.Background(), &message{Method: method, Params: marshalParams(params)})
+}
+
+// CloseWrite は書き出し待ちのメッセージを書き終えてから、書き込み先を閉じます(io.Closerの場合)
+// 以降は送れません。読み込みは相手が閉じるまで続けます
+func (c *Conn) CloseWrite() error {
+	return c.enqueue(context.Background(), nil)
+}
+
+// Done は接続が閉じると閉じるチャネルを返します
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err は接続が閉じた理由を返します(開いている間はnil)
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Conn) send(ctx context.Context, msg *message) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.enqueue(ctx, append(data, '\n'))
+}
+
+// enqueue はdataを書き出し待ちにします
+// いっぱいなら空くかctxが終わるまで待ち、空かないままstallの時間が過ぎたら接続を閉じます
+func (c *Conn) enqueue(ctx context.Context, data []byte) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	select {
+	case c.out <- data:
+		return nil
+	default:
+	}
+
+	c.mu.Lock()
+	timer := time.NewTimer(c.stall)
+	c.mu.Unlock()
+	defer timer.Stop()
+	select {
+	case c.out <- data:
+		return nil
+	case <-c.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	case <-timer.C:
+		c.close(ErrStalled)
+		return ErrStalled
+	}
+}
+
+// write は書き出し待ちのメッセージを順に書き込みます
+func (c *Conn) write() {
+	for {
+		select {
+		case data := <-c.out:
+			if data == nil {
+				if closer, ok := c.w.(io.Closer); ok {
+					closer.Close()
+				}
+				return
+			}
+			if _, err := c.w.Write(data); err != nil {
+				c.close(errors.WithStack(err))
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// close は接続を閉じ、理由を記録します(2回目以降は何もしません)
+func (c *Conn) close(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.done)
+		c.cancel()
+	})
+}
+
+// read は1行ずつメッセージを読み、応答は待っている呼び出しに、リクエストはHandlerに渡します
+// JSONとして読めない行は無視します
+func (c *Conn) read(r io.Reader) {
+	reader := bufio.NewReader(r)
+	var err error
+	for {
+		var line []byte
+		line, err = reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var msg message
+			if json.Unmarshal(line, &msg) == nil {
+				c.dispatch(&msg)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == io.EOF {
+		err = ErrClosed
+	}
+	c.close(errors.WithStack(err))
+}
+
+func (c *Conn) dispatch(msg *message) {
+	if msg.Method == "" {
+		if msg.ID == nil {
+			return
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[idKey(*msg.ID)]
+		c.mu.Unlock()
+		if ok {
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+		return
+	}
+	// 処理に時間がかかっても読み込みを止めないようにする
+	go func() {
+		var result any
+		err := &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+		if c.handler != nil {
+			var herr error
+			result, herr = c.handler(c.ctx, msg.Method, msg.Params)
+			err = toError(herr)
+		}
+		if msg.ID == nil {
+			return
+		}
+		res := &message{ID: msg.ID}
+		if err != nil {
+			res.Error = err
+		} else {
+			res.Result = marshalParams(result)
+			if res.Result == nil {
+				res.Result = json.RawMessage("null")
+			}
+		}
+		c.send(c.ctx, res)
+	}()
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// toError はHandlerのエラーを応答のエラーにします
+func toError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &Error{Code: CodeInternalError, Message: err.Error()}
+}
+
+func marshalParams(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// idKey は数値と文字列のどちらのIDも同じキーにします
+func idKey(id json.RawMessage) string {
+	var s string
+	if json.Unmarshal(id, &s) == nil {
+		return s
+	}
+	return string(id)
+}
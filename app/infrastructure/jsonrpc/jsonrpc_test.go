@@ -0,0 +1,117 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/infrastructure/jsonrpc"
+)
+
+// pair は互いにつながった2つの接続を返します
+func pair(t *testing.T, a, b jsonrpc.Handler) (*jsonrpc.Conn, *jsonrpc.Conn, func()) {
+	ar, bw := io.Pipe()
+	br, aw := io.Pipe()
+	closeAll := func() {
+		aw.Close()
+		bw.Close()
+	}
+	t.Cleanup(closeAll)
+	return jsonrpc.NewConn(ar, aw, a), jsonrpc.NewConn(br, bw, b), closeAll
+}
+
+func TestCall(t *testing.T) {
+	notified := make(chan string, 1)
+	server := func(ctx context.Context, method string, params json.RawMessage) (any, error) {
+		switch method {
+		case "add":
+			var p []int
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: err.Error()}
+			}
+			return p[0] + p[1], nil
+		case "hello":
+			var name string
+			json.Unmarshal(params, &name)
+			notified <- name
+			return nil, nil
+		}
+		return nil, errors.New("unknown")
+	}
+	client, _, _ := pair(t, nil, server)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var sum int
+	assert.NoError(t, client.Call(ctx, "add", []int{1, 2}, &sum))
+	assert.Equal(t, 3, sum)
+
+	var rpcErr *jsonrpc.Error
+	err := client.Call(ctx, "add", "x", &sum)
+	assert.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, jsonrpc.CodeInvalidParams, rpcErr.Code)
+
+	err = client.Call(ctx, "nope", nil, nil)
+	assert.ErrorContains(t, err, "unknown")
+
+	assert.NoError(t, client.Notify("hello", "world"))
+	select {
+	case name := <-notified:
+		assert.Equal(t, "world", name)
+	case <-time.After(time.Second):
+		t.Fatal("通知が届きません")
+	}
+}
+
+func TestClosed(t *testing.T) {
+	block := make(chan struct{})
+	server := func(ctx context.Context, method string, params json.RawMessage) (any, error) {
+		<-block
+		return nil, nil
+	}
+	client, _, closeAll := pair(t, nil, server)
+	defer close(block)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- client.Call(context.Background(), "wait", nil, nil) }()
+	time.Sleep(10 * time.Millisecond)
+	closeAll()
+
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, jsonrpc.ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("接続が閉じても呼び出しが終わりません")
+	}
+	<-client.Done()
+	assert.ErrorIs(t, client.Call(context.Background(), "wait", nil, nil), jsonrpc.ErrClosed)
+}
+
+func TestStalled(t *testing.T) {
+	// 相手が読まない書き込み先
+	_, w := io.Pipe()
+	r, _ := io.Pipe()
+	conn := jsonrpc.NewConn(r, w, nil)
+	conn.SetStallTimeout(time.Hour)
+
+	// 書き出し待ちがいっぱいでも、呼び出しはctxで打ち切れる
+	for i := 0; i < 70; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := conn.Call(ctx, "ping", nil, nil)
+		cancel()
+		if err != nil {
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		}
+	}
+
+	// 空かないまま時間が過ぎたら接続を閉じる
+	conn.SetStallTimeout(20 * time.Millisecond)
+	assert.ErrorIs(t, conn.Notify("hello", nil), jsonrpc.ErrStalled)
+	<-conn.Done()
+	assert.ErrorIs(t, conn.Err(), jsonrpc.ErrStalled)
+	assert.ErrorIs(t, conn.Notify("hello", nil), jsonrpc.ErrClosed)
+}
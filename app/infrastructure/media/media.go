@@ -0,0 +1,83 @@
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/wasya-io/petit-misskey/config"
+	"github.com/wasya-io/petit-misskey/infrastructure/xdg"
+)
+
+type (
+	// Fetcher は絵文字や添付ファイルの画像をダウンロードし、ディスクにキャッシュします
+	Fetcher struct {
+		client http.Client
+		dir    string
+	}
+)
+
+// 1ファイルあたりの上限(これより大きい画像は表示しない)
+const maxMediaSize = 8 << 20
+
+func NewFetcher(cfg *config.Config) (*Fetcher, error) {
+	dir, err := xdg.CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewFetcherAt(cfg, filepath.Join(dir, "media")), nil
+}
+
+// NewFetcherAt はdirをキャッシュに使うFetcherを返します
+func NewFetcherAt(cfg *config.Config, dir string) *Fetcher {
+	return &Fetcher{
+		client: http.Client{Timeout: cfg.Http.Timeout},
+		dir:    dir,
+	}
+}
+
+// Fetch はurlの中身を返します。キャッシュにあればダウンロードしません
+func (f *Fetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	path := f.cachePath(url)
+	if data, err := os.ReadFile(path); err == nil {
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < http.StatusOK || http.StatusMultipleChoices <= res.StatusCode {
+		return nil, errors.Errorf("http bad status: %d", res.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxMediaSize+1))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(data) > maxMediaSize {
+		return nil, errors.Errorf("media too large: %s", url)
+	}
+
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return data, nil
+}
+
+func (f *Fetcher) cachePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:]))
+}
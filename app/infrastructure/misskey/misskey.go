@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/wasya-io/petit-misskey/config"
+	"github.com/wasya-io/petit-misskey/domain/api"
 	"github.com/wasya-io/petit-misskey/infrastructure/setting"
 	"github.com/wasya-io/petit-misskey/model/misskey"
 )
@@ -46,12 +48,8 @@ func (c *Client) Meta(ctx context.Context, contents misskey.Meta) (*misskey.Meta
 	return ret, nil
 }
 
-func (c *Client) CreateNote(ctx context.Context, visibility misskey.Visibility, text string) (*misskey.CreateNoteResponse, error) {
-	contents := misskey.CreateNote{
-		AccessToken: c.accessToken,
-		Visibility:  visibility,
-		Text:        text,
-	}
+func (c *Client) CreateNote(ctx context.Context, contents misskey.CreateNote) (*misskey.CreateNoteResponse, error) {
+	contents.AccessToken = c.accessToken
 	response, err := c.post(ctx, c.createNotes(), contents)
 	if err != nil {
 		return nil, err
@@ -65,6 +63,151 @@ func (c *Client) CreateNote(ctx context.Context, visibility misskey.Visibility,
 	return ret, nil
 }
 
+func (c *Client) CreateReaction(ctx context.Context, contents misskey.CreateReaction) error {
+	contents.AccessToken = c.accessToken
+	if _, err := c.post(ctx, c.createReactions(), contents); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) ShowUser(ctx context.Context, contents misskey.ShowUser) (*misskey.User, error) {
+	contents.AccessToken = c.accessToken
+	response, err := c.post(ctx, c.showUsers(), contents)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := new(misskey.User)
+	if err = json.Unmarshal(response, ret); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return ret, nil
+}
+
+func (c *Client) UserNotes(ctx context.Context, contents misskey.UserNotes) ([]misskey.NoteBody, error) {
+	contents.AccessToken = c.accessToken
+	response, err := c.post(ctx, c.userNotes(), contents)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]misskey.NoteBody, 0)
+	if err = json.Unmarshal(response, &ret); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return ret, nil
+}
+
+func (c *Client) Emojis(ctx context.Context) ([]misskey.Emoji, error) {
+	response, err := c.post(ctx, c.emojis(), misskey.Emojis{})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := new(misskey.EmojisResponse)
+	if err = json.Unmarshal(response, ret); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return ret.Emojis, nil
+}
+
+func (c *Client) SearchUsers(ctx context.Context, contents misskey.SearchUsers) ([]misskey.User, error) {
+	contents.AccessToken = c.accessToken
+	response, err := c.post(ctx, c.searchUsers(), contents)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]misskey.User, 0)
+	if err = json.Unmarshal(response, &ret); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return ret, nil
+}
+
+func (c *Client) SearchHashtags(ctx context.Context, contents misskey.SearchHashtags) ([]string, error) {
+	contents.AccessToken = c.accessToken
+	response, err := c.post(ctx, c.searchHashtags(), contents)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0)
+	if err = json.Unmarshal(response, &ret); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return ret, nil
+}
+
+func (c *Client) SearchNotes(ctx context.Context, contents misskey.SearchNotes) ([]misskey.NoteBody, error) {
+	contents.AccessToken = c.accessToken
+	response, err := c.post(ctx, c.searchNotes(), contents)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]misskey.NoteBody, 0)
+	if err = json.Unmarshal(response, &ret); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return ret, nil
+}
+
+func (c *Client) SearchNotesByTag(ctx context.Context, contents misskey.SearchNotesByTag) ([]misskey.NoteBody, error) {
+	contents.AccessToken = c.accessToken
+	response, err := c.post(ctx, c.searchNotesByTag(), contents)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]misskey.NoteBody, 0)
+	if err = json.Unmarshal(response, &ret); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return ret, nil
+}
+
+func (c *Client) TrendHashtags(ctx context.Context) ([]misskey.HashtagTrend, error) {
+	response, err := c.post(ctx, c.trendHashtags(), misskey.TrendHashtags{})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]misskey.HashtagTrend, 0)
+	if err = json.Unmarshal(response, &ret); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return ret, nil
+}
+
+// Call は任意のエンドポイントを呼び出し、応答のJSONをそのまま返します
+// endpointは "notes/create" のようにapi/より後の部分です
+func (c *Client) Call(ctx context.Context, endpoint string, params map[string]any) (json.RawMessage, error) {
+	body := make(map[string]any, len(params)+1)
+	for k, v := range params {
+		body[k] = v
+	}
+	body["i"] = c.accessToken
+	response, err := c.post(ctx, fmt.Sprintf("%s/%s", c.url, strings.TrimPrefix(endpoint, "/")), body)
+	if err != nil {
+		return nil, err
+	}
+	// 204 No Content のように本文のない応答はnullにする
+	if len(bytes.TrimSpace(response)) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	return json.RawMessage(response), nil
+}
+
 func (c *Client) meta() string {
 	return fmt.Sprintf("%s/meta", c.url)
 }
@@ -73,6 +216,42 @@ func (c *Client) createNotes() string {
 	return fmt.Sprintf("%s/notes/create", c.url)
 }
 
+func (c *Client) createReactions() string {
+	return fmt.Sprintf("%s/notes/reactions/create", c.url)
+}
+
+func (c *Client) showUsers() string {
+	return fmt.Sprintf("%s/users/show", c.url)
+}
+
+func (c *Client) userNotes() string {
+	return fmt.Sprintf("%s/users/notes", c.url)
+}
+
+func (c *Client) emojis() string {
+	return fmt.Sprintf("%s/emojis", c.url)
+}
+
+func (c *Client) searchUsers() string {
+	return fmt.Sprintf("%s/users/search-by-username-and-host", c.url)
+}
+
+func (c *Client) searchHashtags() string {
+	return fmt.Sprintf("%s/hashtags/search", c.url)
+}
+
+func (c *Client) searchNotes() string {
+	return fmt.Sprintf("%s/notes/search", c.url)
+}
+
+func (c *Client) searchNotesByTag() string {
+	return fmt.Sprintf("%s/notes/search-by-tag", c.url)
+}
+
+func (c *Client) trendHashtags() string {
+	return fmt.Sprintf("%s/hashtags/trend", c.url)
+}
+
 func (c *Client) post(ctx context.Context, url string, contents interface{}) ([]byte, error) {
 	body, err := json.Marshal(contents)
 	if err != nil {
@@ -94,10 +273,10 @@ func (c *Client) post(ctx context.Context, url string, contents interface{}) ([]
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	defer res.Body.Close()
 	if res.StatusCode < http.StatusOK || http.StatusMultipleChoices <= res.StatusCode {
-		return nil, errors.Errorf("http bad status: %d\n", res.StatusCode)
+		return nil, errors.WithStack(&api.StatusError{StatusCode: res.StatusCode})
 	}
-	defer res.Body.Close()
 
 	bytes, err := io.ReadAll(res.Body)
 	if err != nil {
@@ -2,9 +2,14 @@ package misskey_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/config"
 	"github.com/wasya-io/petit-misskey/infrastructure/misskey"
 	"github.com/wasya-io/petit-misskey/infrastructure/setting"
 	model "github.com/wasya-io/petit-misskey/model/misskey"
@@ -30,3 +35,82 @@ func TestMeta(t *testing.T) {
 	}
 	fmt.Println(util.PrittyJson(result))
 }
+
+func TestSearch(t *testing.T) {
+	bodies := make(map[string]map[string]any)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := make(map[string]any)
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies[r.URL.Path] = body
+		switch r.URL.Path {
+		case "/api/users/search-by-username-and-host":
+			fmt.Fprint(w, `[{"id":"1","username":"syuilo","host":"misskey.io"},{"id":"2","username":"ai","host":null}]`)
+		case "/api/hashtags/search":
+			fmt.Fprint(w, `["misskey"]`)
+		case "/api/notes/search", "/api/notes/search-by-tag":
+			fmt.Fprint(w, `[{"id":"n2","text":"misskey #dev"},{"id":"n1","text":"misskey"}]`)
+		case "/api/hashtags/trend":
+			fmt.Fprint(w, `[{"tag":"dev","chart":[1,2,3],"usersCount":3}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := misskey.NewClient(config.NewConfig(), &setting.Instance{BaseUrl: server.URL + "/api", AccessToken: "token"})
+
+	users, err := client.SearchUsers(context.Background(), model.SearchUsers{Username: "syu", Limit: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, "misskey.io", *users[0].Host)
+	assert.Nil(t, users[1].Host)
+	assert.Equal(t, map[string]any{"i": "token", "username": "syu", "limit": float64(5), "detail": false}, bodies["/api/users/search-by-username-and-host"])
+
+	tags, err := client.SearchHashtags(context.Background(), model.SearchHashtags{Query: "miss"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"misskey"}, tags)
+	assert.Equal(t, "miss", bodies["/api/hashtags/search"]["query"])
+
+	notes, err := client.SearchNotes(context.Background(), model.SearchNotes{Query: "misskey", Host: ".", UntilId: "n3", Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "n2", notes[0].ID)
+	assert.Equal(t, map[string]any{"i": "token", "query": "misskey", "host": ".", "untilId": "n3", "limit": float64(2)}, bodies["/api/notes/search"])
+
+	notes, err = client.SearchNotesByTag(context.Background(), model.SearchNotesByTag{Tag: "dev"})
+	assert.NoError(t, err)
+	assert.Len(t, notes, 2)
+	assert.Equal(t, map[string]any{"i": "token", "tag": "dev"}, bodies["/api/notes/search-by-tag"])
+
+	trends, err := client.TrendHashtags(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []model.HashtagTrend{{Tag: "dev", Chart: []int{1, 2, 3}, UsersCount: 3}}, trends)
+}
+
+func TestCall(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/api/notes/show":
+			fmt.Fprint(w, `{"id":"n1","text":"hello"}`)
+		case "/api/notes/reactions/create":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := misskey.NewClient(config.NewConfig(), &setting.Instance{BaseUrl: server.URL + "/api", AccessToken: "token"})
+
+	res, err := client.Call(context.Background(), "notes/show", map[string]any{"noteId": "n1"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":"n1","text":"hello"}`, string(res))
+	assert.Equal(t, map[string]any{"i": "token", "noteId": "n1"}, body)
+
+	res, err = client.Call(context.Background(), "/notes/reactions/create", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "null", string(res))
+
+	_, err = client.Call(context.Background(), "i/unknown", nil)
+	assert.ErrorContains(t, err, "404")
+}
@@ -0,0 +1,63 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// CommandProvider はユーザー定義のコマンド(例: `pass show misskey/io`)を実行し、
+	// 標準出力の1行目をトークンとして返します
+	CommandProvider struct {
+		command string
+		timeout time.Duration
+	}
+)
+
+const defaultCommandTimeout = 30 * time.Second
+
+func NewCommandProvider(command string) *CommandProvider {
+	return &CommandProvider{
+		command: command,
+		timeout: defaultCommandTimeout,
+	}
+}
+
+func (p *CommandProvider) Token(ctx context.Context, key string) (string, error) {
+	if strings.TrimSpace(p.command) == "" {
+		return "", ErrSecretNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, p.command)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "token_command failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	// passなどは1行目にパスワードを出力するため、1行目だけを採用する
+	line, _, _ := strings.Cut(stdout.String(), "\n")
+	token := strings.TrimSpace(line)
+	if token == "" {
+		return "", errors.Wrap(ErrSecretNotFound, "token_command returned empty output")
+	}
+	return token, nil
+}
+
+// shellCommand はOSのシェル経由でコマンド文字列を実行するexec.Cmdを作ります
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,98 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+type (
+	// Envelope はパスフレーズから導出した鍵で暗号化されたデータです
+	// 鍵導出にscrypt、暗号化にAES-256-GCMを用います
+	Envelope struct {
+		Version int    `json:"version"`
+		KDF     string `json:"kdf"`
+		N       int    `json:"n"`
+		R       int    `json:"r"`
+		P       int    `json:"p"`
+		Salt    []byte `json:"salt"`
+		Nonce   []byte `json:"nonce"`
+		Data    []byte `json:"data"`
+	}
+)
+
+const (
+	envelopeVersion = 1
+	kdfScrypt       = "scrypt"
+	scryptN         = 1 << 15
+	scryptR         = 8
+	scryptP         = 1
+	keyLength       = 32
+	saltLength      = 16
+)
+
+var ErrInvalidPassphrase = errors.New("invalid passphrase or corrupted data")
+
+// Seal は平文をパスフレーズで暗号化します
+func Seal(passphrase []byte, plaintext []byte) (*Envelope, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	e := &Envelope{
+		Version: envelopeVersion,
+		KDF:     kdfScrypt,
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    salt,
+	}
+	aead, err := e.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	e.Data = aead.Seal(nil, e.Nonce, plaintext, nil)
+
+	return e, nil
+}
+
+// Open はパスフレーズで復号した平文を返します
+func (e *Envelope) Open(passphrase []byte) ([]byte, error) {
+	if e.Version != envelopeVersion || e.KDF != kdfScrypt {
+		return nil, errors.Errorf("unsupported envelope: version=%d kdf=%s", e.Version, e.KDF)
+	}
+	aead, err := e.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, e.Nonce, e.Data, nil)
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+	return plaintext, nil
+}
+
+func (e *Envelope) aead(passphrase []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, e.Salt, e.N, e.R, e.P, keyLength)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return aead, nil
+}
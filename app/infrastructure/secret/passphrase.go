@@ -0,0 +1,58 @@
+package secret
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+type (
+	// PassphraseFunc はvaultのパスフレーズを返します
+	// confirmがtrueの場合は新規作成のため確認入力を求めます
+	PassphraseFunc func(confirm bool) ([]byte, error)
+)
+
+// PassphraseEnv はパスフレーズを非対話で渡すための環境変数です
+const PassphraseEnv = "PETIT_MISSKEY_VAULT_PASSPHRASE"
+
+// DefaultPassphrase は環境変数、なければ端末からパスフレーズを読み込みます
+func DefaultPassphrase(confirm bool) ([]byte, error) {
+	return PromptPassphrase(PassphraseEnv, "vaultのパスフレーズ", confirm)
+}
+
+// PromptPassphrase は環境変数envが設定されていればその値を、なければ端末から入力されたパスフレーズを返します
+func PromptPassphrase(env string, prompt string, confirm bool) ([]byte, error) {
+	if p := os.Getenv(env); p != "" {
+		return []byte(p), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, errors.Errorf("passphrase required: set %s or run in a terminal", env)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(p) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "確認のためもう一度入力してください: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if string(p) != string(again) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+	return p, nil
+}
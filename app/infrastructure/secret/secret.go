@@ -0,0 +1,55 @@
+package secret
+
+import (
+	"context"
+	"errors"
+)
+
+type (
+	// Source はアクセストークンの保管方式を表します
+	Source string
+
+	// Provider はインスタンスキーに対応するアクセストークンを返します
+	Provider interface {
+		Token(ctx context.Context, key string) (string, error)
+	}
+
+	// PlainProvider は設定ファイルに平文で書かれたトークンをそのまま返します
+	PlainProvider struct {
+		token string
+	}
+)
+
+const (
+	SourcePlain   Source = "plain"   // 設定ファイルに平文で保存(互換用)
+	SourceVault   Source = "vault"   // パスフレーズで暗号化したローカルvaultに保存
+	SourceCommand Source = "command" // 外部コマンドの標準出力から読み込む
+)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+func NewPlainProvider(token string) *PlainProvider {
+	return &PlainProvider{
+		token: token,
+	}
+}
+
+func (p *PlainProvider) Token(ctx context.Context, key string) (string, error) {
+	if p.token == "" {
+		return "", ErrSecretNotFound
+	}
+	return p.token, nil
+}
+
+func (s Source) String() string {
+	switch s {
+	case SourcePlain:
+		return "平文"
+	case SourceVault:
+		return "暗号化vault"
+	case SourceCommand:
+		return "コマンド"
+	default:
+		return string(s)
+	}
+}
@@ -0,0 +1,64 @@
+package secret_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/infrastructure/secret"
+)
+
+func fixedPassphrase(p string) secret.PassphraseFunc {
+	return func(confirm bool) ([]byte, error) {
+		return []byte(p), nil
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	envelope, err := secret.Seal([]byte("passphrase"), []byte("access-token"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(envelope.Data), "access-token")
+
+	plaintext, err := envelope.Open([]byte("passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, "access-token", string(plaintext))
+
+	_, err = envelope.Open([]byte("wrong"))
+	assert.ErrorIs(t, err, secret.ErrInvalidPassphrase)
+}
+
+func TestVault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "petit-misskey.vault")
+
+	vault := secret.NewVault(path, fixedPassphrase("passphrase"))
+	require.NoError(t, vault.Store("io", "access-token"))
+
+	// 別インスタンスから読み直しても復号できる
+	reopened := secret.NewVault(path, fixedPassphrase("passphrase"))
+	token, err := reopened.Token(context.Background(), "io")
+	require.NoError(t, err)
+	assert.Equal(t, "access-token", token)
+
+	_, err = reopened.Token(context.Background(), "unknown")
+	assert.ErrorIs(t, err, secret.ErrSecretNotFound)
+
+	wrong := secret.NewVault(path, fixedPassphrase("wrong"))
+	_, err = wrong.Token(context.Background(), "io")
+	assert.ErrorIs(t, err, secret.ErrInvalidPassphrase)
+
+	require.NoError(t, reopened.Delete("io"))
+	_, err = secret.NewVault(path, fixedPassphrase("passphrase")).Token(context.Background(), "io")
+	assert.ErrorIs(t, err, secret.ErrSecretNotFound)
+}
+
+func TestCommandProvider(t *testing.T) {
+	provider := secret.NewCommandProvider("printf 'access-token\\nmetadata\\n'")
+	token, err := provider.Token(context.Background(), "io")
+	require.NoError(t, err)
+	assert.Equal(t, "access-token", token)
+
+	_, err = secret.NewCommandProvider("exit 1").Token(context.Background(), "io")
+	assert.Error(t, err)
+}
@@ -0,0 +1,157 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// Vault はパスフレーズで暗号化したローカルファイルにトークンを保管します
+	// ファイルの中身はインスタンスキーとトークンのmapをEnvelopeで包んだJSONです
+	Vault struct {
+		path       string
+		passphrase PassphraseFunc
+		mu         sync.Mutex
+		key        []byte            // 入力済みのパスフレーズ
+		secrets    map[string]string // 復号済みの中身(nilなら未読み込み)
+	}
+)
+
+func NewVault(path string, passphrase PassphraseFunc) *Vault {
+	if passphrase == nil {
+		passphrase = DefaultPassphrase
+	}
+	return &Vault{
+		path:       path,
+		passphrase: passphrase,
+	}
+}
+
+func (v *Vault) Path() string {
+	return v.path
+}
+
+func (v *Vault) Token(ctx context.Context, key string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.load(); err != nil {
+		return "", err
+	}
+	token, ok := v.secrets[key]
+	if !ok {
+		return "", errors.Wrapf(ErrSecretNotFound, "vault has no token for %s", key)
+	}
+	return token, nil
+}
+
+// Unlock はパスフレーズを入力してvaultを復号しておきます
+// TUIの起動後に端末からパスフレーズを読めなくなる前に呼び出します
+func (v *Vault) Unlock() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.load()
+}
+
+// Store はトークンをvaultに書き込みます
+func (v *Vault) Store(key string, token string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.load(); err != nil {
+		return err
+	}
+	v.secrets[key] = token
+	return v.save()
+}
+
+// Delete はトークンをvaultから削除します
+func (v *Vault) Delete(key string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.load(); err != nil {
+		return err
+	}
+	if _, ok := v.secrets[key]; !ok {
+		return nil
+	}
+	delete(v.secrets, key)
+	return v.save()
+}
+
+func (v *Vault) load() error {
+	if v.secrets != nil {
+		return nil
+	}
+
+	raw, err := os.ReadFile(v.path)
+	if os.IsNotExist(err) {
+		// 新規作成なのでパスフレーズは確認入力付きで受け取る
+		key, err := v.passphrase(true)
+		if err != nil {
+			return err
+		}
+		v.key = key
+		v.secrets = make(map[string]string)
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return errors.Wrapf(err, "broken vault file: %s", v.path)
+	}
+	key, err := v.passphrase(false)
+	if err != nil {
+		return err
+	}
+	plaintext, err := envelope.Open(key)
+	if err != nil {
+		return err
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return errors.WithStack(err)
+	}
+
+	v.key = key
+	v.secrets = secrets
+	return nil
+}
+
+func (v *Vault) save() error {
+	plaintext, err := json.Marshal(v.secrets)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	envelope, err := Seal(v.key, plaintext)
+	if err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(v.path), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	// 書き込み途中で壊れないよう一時ファイル経由で置き換える
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Rename(tmp, v.path); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package setting
+
+import "time"
+
+type (
+	// Hook はストリームのイベントで実行するコマンドです
+	Hook struct {
+		Event   HookEvent `toml:"event" json:"event"`                         // note / mention / notification / followed / reaction / disconnect
+		Where   string    `toml:"where,omitempty" json:"where,omitempty"`     // イベントのノートの条件式(service/expr)。ノートのないイベントには当てはまらない
+		Command string    `toml:"command" json:"command"`                     // sh -c で実行するコマンド。イベントのJSONを標準入力に渡す
+		Keys    []string  `toml:"keys,omitempty" json:"keys,omitempty"`       // 対象のインスタンスキー。空ならすべて
+		Timeout int       `toml:"timeout,omitempty" json:"timeout,omitempty"` // 打ち切るまでの秒数(未設定なら30秒)
+	}
+
+	// HookEvent はフックを実行するイベントの種類です
+	HookEvent string
+)
+
+const (
+	HookEventNote         HookEvent = "note"         // タイムラインに届いたノート
+	HookEventMention      HookEvent = "mention"      // メンションと返信の通知
+	HookEventNotification HookEvent = "notification" // すべての通知
+	HookEventFollowed     HookEvent = "followed"     // フォローされた通知
+	HookEventReaction     HookEvent = "reaction"     // リアクションの通知
+	HookEventDisconnect   HookEvent = "disconnect"   // ストリーミングの切断やエラー
+)
+
+const (
+	defaultHookTimeout     = 30 * time.Second
+	defaultHookConcurrency = 4
+)
+
+// HookEvents は指定できるイベントの種類の一覧です
+func HookEvents() []HookEvent {
+	return []HookEvent{HookEventNote, HookEventMention, HookEventNotification, HookEventFollowed, HookEventReaction, HookEventDisconnect}
+}
+
+// 打ち切るまでの時間(未設定なら30秒)
+func (h Hook) TimeoutDuration() time.Duration {
+	if h.Timeout <= 0 {
+		return defaultHookTimeout
+	}
+	return time.Duration(h.Timeout) * time.Second
+}
+
+// フックの設定の読み出し
+func (s *UserSetting) GetHooks() []Hook {
+	return s.value.Hooks
+}
+
+// 同時に実行するフックの数(未設定なら4)
+func (s *UserSetting) HookConcurrency() int {
+	if s.value.HookConcurrency <= 0 {
+		return defaultHookConcurrency
+	}
+	return s.value.HookConcurrency
+}
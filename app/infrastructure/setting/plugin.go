@@ -0,0 +1,16 @@
+package setting
+
+type (
+	// Plugin は標準入出力のJSON-RPCで話す、外部のプログラムの拡張です
+	Plugin struct {
+		Name      string   `toml:"name" json:"name"`                               // 一覧やエラーに表示する名前
+		Command   string   `toml:"command" json:"command"`                         // 実行ファイル
+		Args      []string `toml:"args,omitempty" json:"args,omitempty"`           // 実行ファイルに渡す引数
+		Endpoints []string `toml:"endpoints,omitempty" json:"endpoints,omitempty"` // 呼び出しを許すAPIのエンドポイント(例: notes/create)
+	}
+)
+
+// プラグインの設定の読み出し
+func (s *UserSetting) GetPlugins() []Plugin {
+	return s.value.Plugins
+}
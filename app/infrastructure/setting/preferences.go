@@ -0,0 +1,162 @@
+package setting
+
+import (
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// Preferences はインスタンス(アカウント)ごとの表示・投稿の既定値です
+	Preferences struct {
+		Timeline    string              `toml:"timeline,omitempty" json:"timeline,omitempty"`       // 起動時のタイムライン: home / local / social / global
+		Visibility  misskey.Visibility  `toml:"visibility,omitempty" json:"visibility,omitempty"`   // 投稿の公開範囲の既定値
+		LocalOnly   bool                `toml:"local_only,omitempty" json:"local_only,omitempty"`   // 連合なしで投稿するか
+		Cw          string              `toml:"cw,omitempty" json:"cw,omitempty"`                   // 空でなければ投稿に付けるCWの既定値
+		Theme       string              `toml:"theme,omitempty" json:"theme,omitempty"`             // 配色テーマ名
+		Reaction    string              `toml:"reaction,omitempty" json:"reaction,omitempty"`       // リアクションキーで付けるリアクション
+		Mute        Mute                `toml:"mute,omitempty" json:"mute,omitempty"`               // タイムラインに表示しないノートの条件
+		Watch       []Watch             `toml:"watch,omitempty" json:"watch,omitempty"`             // 目立たせて知らせるノートの条件
+		Keybindings map[string][]string `toml:"keybindings,omitempty" json:"keybindings,omitempty"` // 操作名ごとのキー割り当ての上書き
+		Deck        []Column            `toml:"deck,omitempty" json:"deck,omitempty"`               // 横に並べるカラム(未設定ならタイムラインのみ)
+		Emoji       Emoji               `toml:"emoji,omitempty" json:"emoji,omitempty"`             // カスタム絵文字の表示
+		Media       Media               `toml:"media,omitempty" json:"media,omitempty"`             // 添付ファイルのプレビュー
+	}
+
+	// Emoji はカスタム絵文字の表示方法です
+	Emoji struct {
+		Fallback  map[string]string `toml:"fallback,omitempty" json:"fallback,omitempty"`   // 絵文字名(:を除く)ごとに代わりに表示するUnicodeの絵文字
+		Images    bool              `toml:"images,omitempty" json:"images,omitempty"`       // 対応する端末では画像で表示する(実験的)
+		Favorites []string          `toml:"favorites,omitempty" json:"favorites,omitempty"` // リアクションの一覧の先頭に出す絵文字
+	}
+
+	// Media は添付ファイルのプレビューの表示方法です
+	Media struct {
+		Preview   MediaPreview `toml:"preview,omitempty" json:"preview,omitempty"`     // auto / blurhash / none
+		Sensitive bool         `toml:"sensitive,omitempty" json:"sensitive,omitempty"` // 閲覧注意の画像も最初から表示する
+	}
+
+	// MediaPreview は添付ファイルのプレビューの方式です
+	MediaPreview string
+
+	// Column はデッキ表示の1カラムです
+	Column struct {
+		Type     ColumnType `toml:"type" json:"type"`
+		Title    string     `toml:"title,omitempty" json:"title,omitempty"`       // 見出し(未設定なら種類から決める)
+		Timeline string     `toml:"timeline,omitempty" json:"timeline,omitempty"` // type=timeline: home / local / social / global
+		Id       string     `toml:"id,omitempty" json:"id,omitempty"`             // type=channel / list / antenna: 対象のID
+		User     string     `toml:"user,omitempty" json:"user,omitempty"`         // type=user: @username, @username@host またはユーザーID
+		Width    int        `toml:"width,omitempty" json:"width,omitempty"`       // 幅(文字数)。0なら残りの幅を等分する
+	}
+
+	// ColumnType はカラムに表示する内容の種類です
+	ColumnType string
+
+	// Mute はタイムラインのノートを絞り込む条件です
+	Mute struct {
+		Words       []string   `toml:"words,omitempty" json:"words,omitempty"`             // 本文・CWに含まれていたら非表示にする語(大文字小文字は区別しない)
+		Regexps     []string   `toml:"regexps,omitempty" json:"regexps,omitempty"`         // 本文・CWに一致したら非表示にする正規表現
+		Users       []string   `toml:"users,omitempty" json:"users,omitempty"`             // username または username@host
+		Hosts       []string   `toml:"hosts,omitempty" json:"hosts,omitempty"`             // 投稿者のホスト
+		Bots        bool       `toml:"bots,omitempty" json:"bots,omitempty"`               // botのノートを非表示にする
+		Renotes     bool       `toml:"renotes,omitempty" json:"renotes,omitempty"`         // 本文のない純粋なリノートを非表示にする
+		Cw          bool       `toml:"cw,omitempty" json:"cw,omitempty"`                   // CW付きのノートを非表示にする
+		Sensitive   bool       `toml:"sensitive,omitempty" json:"sensitive,omitempty"`     // 閲覧注意のファイル付きのノートを非表示にする
+		Languages   []string   `toml:"languages,omitempty" json:"languages,omitempty"`     // 表示する言語(ja / en / ko / ru など)。空ならすべて
+		Expressions []string   `toml:"expressions,omitempty" json:"expressions,omitempty"` // 当てはまったら非表示にする式(service/expr)
+		Action      MuteAction `toml:"action,omitempty" json:"action,omitempty"`           // hide / collapse
+	}
+
+	// MuteAction は条件に当てはまったノートの扱いです
+	MuteAction string
+
+	// Watch は目立たせて知らせるノートの条件です
+	// 条件のどれかに当てはまると、ノートを強調して注目の一覧に加えます
+	Watch struct {
+		Name       string     `toml:"name,omitempty" json:"name,omitempty"`             // 一覧や通知に表示する名前
+		Words      []string   `toml:"words,omitempty" json:"words,omitempty"`           // 本文・CWに含まれる語(大文字小文字は区別しない)
+		Regexps    []string   `toml:"regexps,omitempty" json:"regexps,omitempty"`       // 本文・CWに一致する正規表現
+		Users      []string   `toml:"users,omitempty" json:"users,omitempty"`           // username または username@host
+		Mentions   bool       `toml:"mentions,omitempty" json:"mentions,omitempty"`     // 自分へのメンション
+		Expression string     `toml:"expression,omitempty" json:"expression,omitempty"` // 条件式(service/expr)
+		Alert      WatchAlert `toml:"alert,omitempty" json:"alert,omitempty"`           // bell / osc9 / osc777。空なら知らせない
+		Hook       string     `toml:"hook,omitempty" json:"hook,omitempty"`             // 当てはまったときに実行するシェルのコマンド
+	}
+
+	// WatchAlert は端末で知らせる方法です
+	WatchAlert string
+)
+
+const (
+	// 最初のtimelineカラムがメインのタイムラインで、タイムライン切り替えキーと複数アカウントの統合の対象になる
+	ColumnTimeline      ColumnType = "timeline"
+	ColumnChannel       ColumnType = "channel"
+	ColumnList          ColumnType = "list"
+	ColumnAntenna       ColumnType = "antenna"
+	ColumnNotifications ColumnType = "notifications"
+	ColumnUser          ColumnType = "user"
+)
+
+const (
+	// タイムラインに表示しない
+	MuteActionHide MuteAction = "hide"
+	// 「フィルタ済み」の1行だけ表示し、選ぶと本文を表示できる
+	MuteActionCollapse MuteAction = "collapse"
+)
+
+const (
+	// 端末のベルを鳴らす
+	WatchAlertBell WatchAlert = "bell"
+	// OSC 9 でデスクトップ通知を出す(iTerm2、Windows Terminal など)
+	WatchAlertOsc9 WatchAlert = "osc9"
+	// OSC 777 でデスクトップ通知を出す(rxvt-unicode、foot など)
+	WatchAlertOsc777 WatchAlert = "osc777"
+)
+
+const (
+	// 対応する端末では画像を表示し、それ以外はblurhashで色だけ表示する
+	MediaPreviewAuto MediaPreview = "auto"
+	// 画像を取得せず、blurhashで色だけ表示する
+	MediaPreviewBlurhash MediaPreview = "blurhash"
+	// ファイル名だけ表示する
+	MediaPreviewNone MediaPreview = "none"
+)
+
+// 投稿の公開範囲の既定値(未設定ならホーム)
+func (p Preferences) DefaultVisibility() misskey.Visibility {
+	if p.Visibility == "" {
+		return misskey.VisibilityHome
+	}
+	return p.Visibility
+}
+
+// リアクションキーで付けるリアクション(未設定なら👍)
+func (p Preferences) DefaultReaction() string {
+	if p.Reaction == "" {
+		return "👍"
+	}
+	return p.Reaction
+}
+
+// 投稿に付けるCWの既定値(未設定ならnil)
+func (p Preferences) DefaultCw() *string {
+	if p.Cw == "" {
+		return nil
+	}
+	cw := p.Cw
+	return &cw
+}
+
+// 条件に当てはまったノートの扱い(未設定ならhide)
+func (m Mute) ActionMode() MuteAction {
+	if m.Action == "" {
+		return MuteActionHide
+	}
+	return m.Action
+}
+
+// 添付ファイルのプレビューの方式(未設定ならauto)
+func (m Media) PreviewMode() MediaPreview {
+	if m.Preview == "" {
+		return MediaPreviewAuto
+	}
+	return m.Preview
+}
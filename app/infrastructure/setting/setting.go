@@ -1,12 +1,16 @@
 package setting
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/google/wire"
 	"github.com/pkg/errors"
+	"github.com/wasya-io/petit-misskey/infrastructure/secret"
 	"github.com/wasya-io/petit-misskey/model/misskey"
 )
 
@@ -17,15 +21,22 @@ type (
 	UserSetting struct {
 		value    *Value
 		filepath string
+		vault    *secret.Vault
 	}
 	Value struct {
-		Instances map[string]Instance `toml:"instance"`
+		HookConcurrency int                 `toml:"hook_concurrency,omitempty" json:"hook_concurrency,omitempty"` // 同時に実行するフックの数
+		Instances       map[string]Instance `toml:"instance" json:"instance"`
+		Hooks           []Hook              `toml:"hook,omitempty" json:"hook,omitempty"`     // ストリームのイベントで実行するコマンド
+		Plugins         []Plugin            `toml:"plugin,omitempty" json:"plugin,omitempty"` // 起動するプラグイン
 	}
 
 	Instance struct {
-		BaseUrl     string              `toml:"baseurl" validate:"required"`
-		UserName    string              `toml:"username" validate:"required"`
-		AccessToken misskey.AccessToken `toml:"token" validate:"required"`
+		BaseUrl      string              `toml:"baseurl" json:"baseurl" validate:"required"`
+		UserName     string              `toml:"username" json:"username" validate:"required"`
+		AccessToken  misskey.AccessToken `toml:"token,omitempty" json:"token,omitempty"`
+		TokenSource  secret.Source       `toml:"token_source,omitempty" json:"token_source,omitempty"`   // 省略時はtoken_commandの有無から判断する
+		TokenCommand string              `toml:"token_command,omitempty" json:"token_command,omitempty"` // 例: pass show misskey/io
+		Preferences  Preferences         `toml:"preferences,omitempty" json:"preferences,omitempty"`
 	}
 )
 
@@ -33,12 +44,60 @@ var ProviderSet = wire.NewSet(
 	NewUserSetting,
 )
 
+// 設定ファイルの場所を指定する環境変数
+const (
+	EnvConfig  = "PETIT_MISSKEY_CONFIG"  // 設定ファイルのパス
+	EnvProfile = "PETIT_MISSKEY_PROFILE" // プロファイル名
+)
+
+var (
+	overridePath    string // --config で指定された設定ファイル
+	overrideProfile string // --profile で指定されたプロファイル
+)
+
+// UseFile は以降に生成するUserSettingが読み書きするファイルを指定します
+func UseFile(path string) {
+	overridePath = path
+}
+
+// UseProfile は以降に生成するUserSettingが使うプロファイルを指定します
+func UseProfile(name string) {
+	overrideProfile = name
+}
+
+// SettingPath は読み書きする設定ファイルのパスを返します
+// 優先順位は --config, PETIT_MISSKEY_CONFIG, プロファイル(--profile, PETIT_MISSKEY_PROFILE), 既定のファイルの順です
+// プロファイルを使う場合は {UserConfigDir}/petit-misskey/profiles/{name}.toml を読み書きします
+func SettingPath() string {
+	if overridePath != "" {
+		return overridePath
+	}
+	if path := os.Getenv(EnvConfig); path != "" {
+		return path
+	}
+
+	settingDir, _ := os.UserConfigDir()
+	profile := overrideProfile
+	if profile == "" {
+		profile = os.Getenv(EnvProfile)
+	}
+	if profile != "" {
+		return filepath.Join(settingDir, "petit-misskey", "profiles", profile+".toml")
+	}
+	return filepath.Join(settingDir, "petit-misskey.toml")
+}
+
 func NewUserSetting() *UserSetting {
 	// TODO: once.Doをかける
-	settingDir, _ := os.UserConfigDir()
-	settingPath := filepath.Join(settingDir, "petit-misskey.toml")
+	settingPath := SettingPath()
 
 	value, _ := readValue(settingPath)
+	if value == nil {
+		value = &Value{}
+	}
+	if value.Instances == nil {
+		value.Instances = make(map[string]Instance)
+	}
 
 	return &UserSetting{
 		value:    value,
@@ -46,6 +105,11 @@ func NewUserSetting() *UserSetting {
 	}
 }
 
+// 設定ファイルのパス
+func (s *UserSetting) Path() string {
+	return s.filepath
+}
+
 func readValue(settingPath string) (*Value, error) {
 	var data Value
 	if _, err := os.Stat(settingPath); err != nil {
@@ -61,6 +125,10 @@ func readValue(settingPath string) (*Value, error) {
 
 // 設定ファイルの書き込み
 func (s *UserSetting) WriteValue(instances map[string]Instance) error {
+	if err := os.MkdirAll(filepath.Dir(s.filepath), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
 	var file *os.File
 	file, err := os.Create(s.filepath)
 	if err != nil {
@@ -69,9 +137,14 @@ func (s *UserSetting) WriteValue(instances map[string]Instance) error {
 
 	defer file.Close()
 
+	// フックとプラグインの設定はそのまま残す
 	v := &Value{
-		Instances: instances,
+		HookConcurrency: s.value.HookConcurrency,
+		Instances:       instances,
+		Hooks:           s.value.Hooks,
+		Plugins:         s.value.Plugins,
 	}
+	s.value = v
 	err = toml.NewEncoder(file).Encode(v)
 	if err != nil {
 		return errors.WithStack(err)
@@ -84,6 +157,26 @@ func (s *UserSetting) GetInstances() map[string]Instance {
 	return s.value.Instances
 }
 
+// インスタンスキーの一覧(昇順)
+func (s *UserSetting) GetInstanceKeys() []string {
+	keys := make([]string, 0, len(s.value.Instances))
+	for key := range s.value.Instances {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// vaultにトークンを保管しているインスタンスがあるか
+func (s *UserSetting) UsesVault() bool {
+	for _, instance := range s.value.Instances {
+		if instance.Source() == secret.SourceVault {
+			return true
+		}
+	}
+	return false
+}
+
 // 特定インスタンス情報の読み出し
 func (s *UserSetting) GetInstanceByKey(key string) *Instance {
 	var instance Instance
@@ -93,3 +186,57 @@ func (s *UserSetting) GetInstanceByKey(key string) *Instance {
 	}
 	return &instance
 }
+
+// トークン保管用vaultファイルのパス
+// 設定ファイルと同じディレクトリに、拡張子だけを変えて置く
+func (s *UserSetting) VaultPath() string {
+	return strings.TrimSuffix(s.filepath, filepath.Ext(s.filepath)) + ".vault"
+}
+
+// トークン保管用vaultの取得
+// パスフレーズの入力を一度で済ませるため、同じインスタンスを使い回す
+func (s *UserSetting) Vault() *secret.Vault {
+	if s.vault == nil {
+		s.vault = secret.NewVault(s.VaultPath(), secret.DefaultPassphrase)
+	}
+	return s.vault
+}
+
+// インスタンスのトークン保管方式に応じたProviderの取得
+func (s *UserSetting) SecretProvider(instance Instance) secret.Provider {
+	switch instance.Source() {
+	case secret.SourceVault:
+		return s.Vault()
+	case secret.SourceCommand:
+		return secret.NewCommandProvider(instance.TokenCommand)
+	default:
+		return secret.NewPlainProvider(string(instance.AccessToken))
+	}
+}
+
+// 接続用インスタンス情報の読み出し
+// AccessTokenには保管方式から解決した実際のトークンが入る
+// 戻り値をWriteValueに渡すとトークンが平文で保存されてしまうので注意
+func (s *UserSetting) ResolveInstance(ctx context.Context, key string) (*Instance, error) {
+	instance := s.GetInstanceByKey(key)
+	if instance == nil {
+		return nil, nil
+	}
+	token, err := s.SecretProvider(*instance).Token(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	instance.AccessToken = misskey.AccessToken(token)
+	return instance, nil
+}
+
+// トークンの保管方式
+func (i Instance) Source() secret.Source {
+	if i.TokenSource != "" {
+		return i.TokenSource
+	}
+	if i.TokenCommand != "" {
+		return secret.SourceCommand
+	}
+	return secret.SourcePlain
+}
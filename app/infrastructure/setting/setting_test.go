@@ -1,9 +1,13 @@
 package setting_test
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/wasya-io/petit-misskey/infrastructure/setting"
 )
 
@@ -31,3 +35,32 @@ func TestWriteValue(t *testing.T) {
 	assert.Equal(t, i.UserName, instance.UserName)
 	assert.Equal(t, i.AccessToken, instance.AccessToken)
 }
+
+func TestWriteValueKeepsHooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+hook_concurrency = 2
+
+[[hook]]
+event = "mention"
+command = "notify-send mention"
+timeout = 5
+
+[[plugin]]
+name = "translate"
+command = "petit-translate"
+endpoints = ["notes/show"]
+`), 0600))
+	setting.UseFile(path)
+	t.Cleanup(func() { setting.UseFile("") })
+
+	s := setting.NewUserSetting()
+	require.NoError(t, s.WriteValue(map[string]setting.Instance{"io": {BaseUrl: "https://misskey.io", UserName: "alice"}}))
+
+	s = setting.NewUserSetting()
+	assert.Equal(t, []setting.Hook{{Event: setting.HookEventMention, Command: "notify-send mention", Timeout: 5}}, s.GetHooks())
+	assert.Equal(t, 2, s.HookConcurrency())
+	assert.Equal(t, 5*time.Second, s.GetHooks()[0].TimeoutDuration())
+	assert.Equal(t, []setting.Plugin{{Name: "translate", Command: "petit-translate", Endpoints: []string{"notes/show"}}}, s.GetPlugins())
+	assert.NotNil(t, s.GetInstanceByKey("io"))
+}
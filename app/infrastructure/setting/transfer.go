@@ -0,0 +1,292 @@
+package setting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"github.com/wasya-io/petit-misskey/infrastructure/secret"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+// 設定のエクスポート・インポート(別マシンへの移行用)
+
+type (
+	// Format はエクスポートファイルの形式です
+	Format string
+
+	// ImportMode は既存の設定との統合方法です
+	ImportMode string
+
+	// ConflictPolicy は同じキーのインスタンスが既にある場合の扱いです
+	ConflictPolicy string
+
+	// ExportOptions はエクスポートの方法です
+	ExportOptions struct {
+		Format Format
+		// Redact がtrueならトークンを一切含めない
+		Redact bool
+		// Passphrase が空でなければ全体を暗号化し、vaultのトークンも含める
+		Passphrase []byte
+	}
+
+	// ImportOptions はインポートの方法です
+	ImportOptions struct {
+		Format Format
+		Mode   ImportMode
+		// Resolve はmergeで衝突したときの扱いを決めます(ConflictAskの代わりに呼ばれる)
+		Resolve func(key string, current Instance, incoming Instance) (ConflictPolicy, error)
+		// Policy はResolveがnilのときに使う衝突時の扱いです
+		Policy ConflictPolicy
+		// Passphrase は暗号化されたファイルの復号に使うパスフレーズを返します
+		Passphrase func() ([]byte, error)
+	}
+
+	// ImportResult はインポートで行った変更です
+	ImportResult struct {
+		Added       []string
+		Overwritten []string
+		Kept        []string
+		Renamed     map[string]string // 元のキー -> 新しいキー
+		// MissingToken はvaultのトークンが含まれていなかったインスタンスです(取り込み後のキー)
+		// token_sourceをplainにして取り込むので、トークンを設定し直す必要があります
+		MissingToken []string
+	}
+
+	// encryptedExport は暗号化したエクスポートファイルの中身です(常にJSON)
+	encryptedExport struct {
+		Kind     string           `json:"kind"`
+		Envelope *secret.Envelope `json:"envelope"`
+	}
+)
+
+const (
+	FormatTOML Format = "toml"
+	FormatJSON Format = "json"
+
+	ImportMerge   ImportMode = "merge"   // 既存の設定に追加する
+	ImportReplace ImportMode = "replace" // 既存の設定を置き換える
+
+	ConflictAsk       ConflictPolicy = "ask"       // Resolveで対話的に決める
+	ConflictKeep      ConflictPolicy = "keep"      // 既存の設定を残す
+	ConflictOverwrite ConflictPolicy = "overwrite" // インポートした設定で上書きする
+	ConflictRename    ConflictPolicy = "rename"    // 別のキーで追加する
+
+	encryptedExportKind = "petit-misskey-encrypted-export"
+)
+
+// FormatFromPath は拡張子からファイル形式を推測します(不明なら空文字)
+func FormatFromPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return FormatTOML
+	case ".json":
+		return FormatJSON
+	default:
+		return ""
+	}
+}
+
+// Export は設定をファイルに書き出せる形にします
+// 暗号化しない場合、vaultに保管しているトークンは書き出しません
+func (s *UserSetting) Export(ctx context.Context, opts ExportOptions) ([]byte, error) {
+	instances := make(map[string]Instance, len(s.value.Instances))
+	for key, instance := range s.value.Instances {
+		switch {
+		case opts.Redact:
+			instance.AccessToken = ""
+		case instance.Source() == secret.SourceVault && len(opts.Passphrase) > 0:
+			// 暗号化する場合のみ、vaultから取り出して持ち運べるようにする
+			token, err := s.Vault().Token(ctx, key)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read token of %s", key)
+			}
+			instance.AccessToken = misskey.AccessToken(token)
+		}
+		instances[key] = instance
+	}
+	value := &Value{Instances: instances}
+
+	if len(opts.Passphrase) == 0 {
+		return encodeValue(value, opts.Format)
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	envelope, err := secret.Seal(opts.Passphrase, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.MarshalIndent(&encryptedExport{Kind: encryptedExportKind, Envelope: envelope}, "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return raw, nil
+}
+
+// Import はエクスポートしたファイルの設定を取り込んで保存します
+// vaultのトークンを含む場合は、このマシンのvaultに保管し直します
+func (s *UserSetting) Import(data []byte, opts ImportOptions) (*ImportResult, error) {
+	incoming, err := decodeExport(data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{Renamed: make(map[string]string)}
+	instances := make(map[string]Instance)
+	if opts.Mode != ImportReplace {
+		for key, instance := range s.value.Instances {
+			instances[key] = instance
+		}
+	}
+
+	for key, instance := range incoming.Instances {
+		target := key
+		if current, exists := instances[key]; exists {
+			policy := opts.Policy
+			if opts.Resolve != nil && (policy == "" || policy == ConflictAsk) {
+				if policy, err = opts.Resolve(key, current, instance); err != nil {
+					return nil, err
+				}
+			}
+			switch policy {
+			case ConflictOverwrite:
+				result.Overwritten = append(result.Overwritten, key)
+			case ConflictRename:
+				target = uniqueKey(instances, key)
+				result.Renamed[key] = target
+			case ConflictKeep:
+				result.Kept = append(result.Kept, key)
+				continue
+			default:
+				return nil, errors.Errorf("conflicting instance %s: unknown policy %q", key, policy)
+			}
+		} else {
+			result.Added = append(result.Added, key)
+		}
+
+		if previous, exists := s.value.Instances[target]; exists && !hasToken(instance) && (hasToken(previous) || previous.Source() == secret.SourceVault) {
+			// トークンを含まないファイルで、使えているトークンを消さないよう引き継ぐ
+			instance.AccessToken = previous.AccessToken
+			instance.TokenSource = previous.TokenSource
+			instance.TokenCommand = previous.TokenCommand
+		} else if instance.Source() == secret.SourceVault {
+			if instance.AccessToken == "" {
+				// 暗号化していないエクスポートにはvaultのトークンが無く、このマシンのvaultにも無い
+				instance.TokenSource = secret.SourcePlain
+				result.MissingToken = append(result.MissingToken, target)
+			} else {
+				if err := s.Vault().Store(target, string(instance.AccessToken)); err != nil {
+					return nil, errors.Wrapf(err, "failed to store token of %s", target)
+				}
+				instance.AccessToken = ""
+			}
+		} else if !hasToken(instance) {
+			// トークンを伏せてエクスポートしたファイル
+			result.MissingToken = append(result.MissingToken, target)
+		}
+		instances[target] = instance
+	}
+
+	previous := s.value.Instances
+	if err := s.WriteValue(instances); err != nil {
+		return nil, err
+	}
+	// 上書きしたり置き換えたりして使わなくなったvaultのトークンを消す
+	for key, instance := range previous {
+		if instance.Source() != secret.SourceVault {
+			continue
+		}
+		if current, exists := instances[key]; exists && current.Source() == secret.SourceVault {
+			continue
+		}
+		if err := s.Vault().Delete(key); err != nil {
+			return nil, errors.Wrapf(err, "failed to delete token of %s", key)
+		}
+	}
+	return result, nil
+}
+
+// hasToken はトークンを解決できる情報をinstanceが持っているかを返します(vaultのトークンはinstanceに含まれるときだけ)
+func hasToken(instance Instance) bool {
+	return instance.Source() == secret.SourceCommand || instance.AccessToken != ""
+}
+
+func encodeValue(value *Value, format Format) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		raw, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return raw, nil
+	case FormatTOML, "":
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(value); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, errors.Errorf("unknown format: %s", format)
+	}
+}
+
+func decodeExport(data []byte, opts ImportOptions) (*Value, error) {
+	var encrypted encryptedExport
+	if json.Unmarshal(data, &encrypted) == nil && encrypted.Kind == encryptedExportKind {
+		if opts.Passphrase == nil {
+			return nil, errors.New("file is encrypted but no passphrase is given")
+		}
+		passphrase, err := opts.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := encrypted.Envelope.Open(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		data = plaintext
+		opts.Format = FormatJSON
+	}
+
+	value := &Value{}
+	switch opts.Format {
+	case FormatJSON:
+		if err := json.Unmarshal(data, value); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	case FormatTOML:
+		if _, err := toml.Decode(string(data), value); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	case "":
+		// 形式が分からなければJSON, TOMLの順に試す
+		if err := json.Unmarshal(data, value); err != nil {
+			value = &Value{}
+			if _, err := toml.Decode(string(data), value); err != nil {
+				return nil, errors.Wrap(err, "file is neither JSON nor TOML")
+			}
+		}
+	default:
+		return nil, errors.Errorf("unknown format: %s", opts.Format)
+	}
+	return value, nil
+}
+
+// uniqueKey はinstancesに存在しないキーを作ります
+func uniqueKey(instances map[string]Instance, key string) string {
+	candidate := key + "-imported"
+	for i := 2; ; i++ {
+		if _, exists := instances[candidate]; !exists {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-imported-%d", key, i)
+	}
+}
@@ -0,0 +1,131 @@
+package setting_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/infrastructure/secret"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+)
+
+// useTempSetting は一時ディレクトリの設定ファイルを使うUserSettingを返します
+func useTempSetting(t *testing.T, name string) *setting.UserSetting {
+	t.Helper()
+	setting.UseFile(filepath.Join(t.TempDir(), name))
+	t.Cleanup(func() { setting.UseFile("") })
+	return setting.NewUserSetting()
+}
+
+func TestExportImport(t *testing.T) {
+	src := useTempSetting(t, "src.toml")
+	require.NoError(t, src.WriteValue(map[string]setting.Instance{
+		"io":   {BaseUrl: "https://misskey.io", UserName: "alice", AccessToken: "token-io"},
+		"work": {BaseUrl: "https://work.example", UserName: "bob", TokenCommand: "pass show work"},
+	}))
+
+	for _, format := range []setting.Format{setting.FormatTOML, setting.FormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := src.Export(context.Background(), setting.ExportOptions{Format: format, Redact: true})
+			require.NoError(t, err)
+			assert.NotContains(t, string(data), "token-io")
+
+			dst := useTempSetting(t, "dst.toml")
+			require.NoError(t, dst.WriteValue(map[string]setting.Instance{
+				"io": {BaseUrl: "https://old.example", UserName: "carol", AccessToken: "old"},
+			}))
+			result, err := dst.Import(data, setting.ImportOptions{Format: format, Mode: setting.ImportMerge, Policy: setting.ConflictRename})
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{"work"}, result.Added)
+			assert.Equal(t, "io-imported", result.Renamed["io"])
+			assert.Equal(t, "carol", dst.GetInstanceByKey("io").UserName)
+			assert.Equal(t, "alice", dst.GetInstanceByKey("io-imported").UserName)
+			assert.Equal(t, "pass show work", dst.GetInstanceByKey("work").TokenCommand)
+		})
+	}
+}
+
+func TestExportImportEncrypted(t *testing.T) {
+	src := useTempSetting(t, "src.toml")
+	require.NoError(t, src.WriteValue(map[string]setting.Instance{
+		"io": {BaseUrl: "https://misskey.io", UserName: "alice", AccessToken: "token-io"},
+	}))
+
+	data, err := src.Export(context.Background(), setting.ExportOptions{Passphrase: []byte("passphrase")})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "token-io")
+
+	dst := useTempSetting(t, "dst.toml")
+	_, err = dst.Import(data, setting.ImportOptions{
+		Mode:       setting.ImportReplace,
+		Passphrase: func() ([]byte, error) { return []byte("wrong"), nil },
+	})
+	assert.Error(t, err)
+
+	_, err = dst.Import(data, setting.ImportOptions{
+		Mode:       setting.ImportReplace,
+		Passphrase: func() ([]byte, error) { return []byte("passphrase"), nil },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "token-io", string(dst.GetInstanceByKey("io").AccessToken))
+}
+
+func TestImportWithoutVaultToken(t *testing.T) {
+	src := useTempSetting(t, "src.toml")
+	require.NoError(t, src.WriteValue(map[string]setting.Instance{
+		"io": {BaseUrl: "https://misskey.io", UserName: "alice", TokenSource: secret.SourceVault},
+	}))
+
+	data, err := src.Export(context.Background(), setting.ExportOptions{})
+	require.NoError(t, err)
+
+	dst := useTempSetting(t, "dst.toml")
+	result, err := dst.Import(data, setting.ImportOptions{Mode: setting.ImportReplace})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"io"}, result.MissingToken)
+	assert.Equal(t, secret.SourcePlain, dst.GetInstanceByKey("io").Source())
+}
+
+func TestImportKeepsToken(t *testing.T) {
+	t.Setenv(secret.PassphraseEnv, "passphrase")
+	src := useTempSetting(t, "src.toml")
+	require.NoError(t, src.WriteValue(map[string]setting.Instance{
+		"io":    {BaseUrl: "https://misskey.io", UserName: "alice", AccessToken: "token-io"},
+		"vault": {BaseUrl: "https://vault.example", UserName: "bob", AccessToken: "token-vault"},
+		"new":   {BaseUrl: "https://new.example", UserName: "carol", AccessToken: "token-new"},
+	}))
+	data, err := src.Export(context.Background(), setting.ExportOptions{Redact: true})
+	require.NoError(t, err)
+
+	dst := useTempSetting(t, "dst.toml")
+	require.NoError(t, dst.Vault().Store("vault", "old-vault"))
+	require.NoError(t, dst.WriteValue(map[string]setting.Instance{
+		"io":    {BaseUrl: "https://misskey.io", UserName: "old", AccessToken: "old-io"},
+		"vault": {BaseUrl: "https://vault.example", UserName: "old", TokenSource: secret.SourceVault},
+	}))
+	result, err := dst.Import(data, setting.ImportOptions{Mode: setting.ImportMerge, Policy: setting.ConflictOverwrite})
+	require.NoError(t, err)
+
+	// トークンを含まないファイルで上書きしても、使えているトークンは残す
+	assert.ElementsMatch(t, []string{"io", "vault"}, result.Overwritten)
+	assert.Equal(t, []string{"new"}, result.MissingToken)
+	assert.Equal(t, "alice", dst.GetInstanceByKey("io").UserName)
+	assert.Equal(t, "old-io", string(dst.GetInstanceByKey("io").AccessToken))
+	resolved, err := dst.ResolveInstance(context.Background(), "vault")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", resolved.UserName)
+	assert.Equal(t, "old-vault", string(resolved.AccessToken))
+
+	// トークンを含むファイルで置き換えたら、使わなくなったvaultのトークンを消す
+	data, err = src.Export(context.Background(), setting.ExportOptions{})
+	require.NoError(t, err)
+	_, err = dst.Import(data, setting.ImportOptions{Mode: setting.ImportReplace})
+	require.NoError(t, err)
+	assert.Equal(t, "token-vault", string(dst.GetInstanceByKey("vault").AccessToken))
+	_, err = dst.Vault().Token(context.Background(), "vault")
+	assert.ErrorIs(t, err, secret.ErrSecretNotFound)
+}
@@ -0,0 +1,363 @@
+// Package store は受信したノートと通知を、アカウントごとのファイルに追記して保存します
+// 1行に1件のJSONを追記するだけなので、書き込みの途中で終了しても前の行までは読み出せます
+// ファイルは一定の大きさで次のファイルに切り替え、数が上限を超えたら古いものから消します
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wasya-io/petit-misskey/infrastructure/xdg"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// Store はアカウントごとの追記専用のファイルです
+	Store struct {
+		dir   string
+		opts  Options
+		mu    sync.Mutex
+		files map[string]*writer
+	}
+
+	// Options は保存の設定です
+	Options struct {
+		SegmentSize int64 // 1つのファイルの大きさの目安(未設定なら8MB。超えたら次のファイルに書く)
+		MaxSegments int   // アカウントごとに残すファイルの数(未設定なら64。超えたら古いものから消す)
+	}
+
+	// Record は保存する1件のノートか通知です
+	Record struct {
+		Kind         Kind                  `json:"kind"`
+		Account      string                `json:"account"`
+		ID           string                `json:"id"` // ノートか通知のID
+		CreatedAt    time.Time             `json:"createdAt"`
+		ReceivedAt   time.Time             `json:"receivedAt"`
+		Note         *misskey.NoteBody     `json:"note,omitempty"`
+		Notification *misskey.Notification `json:"notification,omitempty"`
+	}
+
+	// Kind は保存したものの種類です
+	Kind string
+
+	// Segment はアカウントのファイルの1つです。古いものから順に番号が付きます
+	Segment struct {
+		Account string
+		Seq     int
+		Path    string
+	}
+
+	// Position はrecordを書いたファイルの番号とファイルの中の位置です
+	Position struct {
+		Seq    int
+		Offset int64
+	}
+
+	// writer は書き込み中のファイルです
+	writer struct {
+		file *os.File
+		seq  int
+		size int64
+	}
+)
+
+const (
+	KindNote         Kind = "note"
+	KindNotification Kind = "notification"
+
+	ext = ".jsonl"
+
+	defaultSegmentSize = 8 * 1024 * 1024
+	defaultMaxSegments = 64
+)
+
+// DefaultDir は保存先の既定のディレクトリを返します
+func DefaultDir() (string, error) {
+	dir, err := xdg.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "store"), nil
+}
+
+// Open はdirのファイルを使うStoreを返します
+// 以前の形式(アカウントごとに1つのファイル)で保存したものは、最初のファイルとして引き継ぎます
+func Open(dir string, opts Options) (*Store, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.MaxSegments <= 0 {
+		opts.MaxSegments = defaultMaxSegments
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ext) {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ext)
+		if err := os.MkdirAll(filepath.Join(dir, name), 0700); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := os.Rename(filepath.Join(dir, e.Name()), filepath.Join(dir, name, segmentName(1))); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return &Store{dir: dir, opts: opts, files: make(map[string]*writer)}, nil
+}
+
+// Dir は保存先のディレクトリを返します
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Append はアカウントのファイルにrecordを追記し、書いた位置を返します
+func (s *Store) Append(record Record) (Position, error) {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return Position{}, errors.WithStack(err)
+	}
+	line := append(raw, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, err := s.writer(record.Account)
+	if err != nil {
+		return Position{}, err
+	}
+	if w.size >= s.opts.SegmentSize {
+		w.file.Close()
+		delete(s.files, record.Account)
+		if w, err = s.open(record.Account, w.seq+1); err != nil {
+			return Position{}, err
+		}
+		if err := s.trim(record.Account); err != nil {
+			return Position{}, err
+		}
+	}
+	// 1回の書き込みで1行を書き、ほかのプロセスの追記と混ざらないようにする
+	if _, err := w.file.Write(line); err != nil {
+		return Position{}, errors.WithStack(err)
+	}
+	// ほかのプロセスも追記していることがあるので、書いたあとのファイルの末尾から位置を求める
+	end, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return Position{}, errors.WithStack(err)
+	}
+	w.size = end
+	return Position{Seq: w.seq, Offset: end - int64(len(line))}, nil
+}
+
+// writer はアカウントの書き込み中のファイルを返します。なければいちばん新しいファイルを開きます
+func (s *Store) writer(account string) (*writer, error) {
+	if w, ok := s.files[account]; ok {
+		return w, nil
+	}
+	segments, err := s.Segments(account)
+	if err != nil {
+		return nil, err
+	}
+	seq := 1
+	if len(segments) > 0 {
+		seq = segments[len(segments)-1].Seq
+	}
+	return s.open(account, seq)
+}
+
+func (s *Store) open(account string, seq int) (*writer, error) {
+	if err := os.MkdirAll(s.accountDir(account), 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	f, err := os.OpenFile(s.segmentPath(account, seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.WithStack(err)
+	}
+	w := &writer{file: f, seq: seq, size: info.Size()}
+	s.files[account] = w
+	return w, nil
+}
+
+// trim はファイルの数が上限を超えていたら古いものから消します
+// ファイルと同じ番号の付いたファイル(索引など)も一緒に消します
+func (s *Store) trim(account string) error {
+	segments, err := s.Segments(account)
+	if err != nil {
+		return err
+	}
+	for len(segments) > s.opts.MaxSegments {
+		matches, _ := filepath.Glob(strings.TrimSuffix(segments[0].Path, ext) + ".*")
+		for _, path := range matches {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return errors.WithStack(err)
+			}
+		}
+		segments = segments[1:]
+	}
+	return nil
+}
+
+// Segments はアカウントのファイルを古い順に返します
+func (s *Store) Segments(account string) ([]Segment, error) {
+	entries, err := os.ReadDir(s.accountDir(account))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	segments := make([]Segment, 0, len(entries))
+	for _, e := range entries {
+		seq, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ext))
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ext) || err != nil || seq <= 0 {
+			continue
+		}
+		segments = append(segments, Segment{Account: account, Seq: seq, Path: filepath.Join(s.accountDir(account), e.Name())})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Seq < segments[j].Seq })
+	return segments, nil
+}
+
+// Scan はアカウントのすべてのファイルのrecordを古い順にfnに渡します
+func (s *Store) Scan(account string, fn func(Record) error) error {
+	segments, err := s.Segments(account)
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if err := ScanSegment(seg, func(r Record, offset int64) error { return fn(r) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanSegment はファイルのrecordを、ファイルの中の位置とともに古い順にfnに渡します
+// 読めない行(書き込みの途中で終了した行など)は読み飛ばします
+func ScanSegment(seg Segment, fn func(r Record, offset int64) error) error {
+	f, err := os.Open(seg.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var offset int64
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		start := offset
+		offset += int64(len(line)) + 1
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil || record.ID == "" {
+			continue
+		}
+		if err := fn(record, start); err != nil {
+			return err
+		}
+	}
+	return errors.WithStack(scanner.Err())
+}
+
+// Read はアカウントのファイルのposにあるrecordを読みます
+func (s *Store) Read(account string, pos Position) (Record, error) {
+	f, err := os.Open(s.segmentPath(account, pos.Seq))
+	if err != nil {
+		return Record{}, errors.WithStack(err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(pos.Offset, io.SeekStart); err != nil {
+		return Record{}, errors.WithStack(err)
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return Record{}, errors.WithStack(err)
+	}
+	var record Record
+	if err := json.Unmarshal(line, &record); err != nil {
+		return Record{}, errors.Wrapf(err, "broken record: %s@%d", s.segmentPath(account, pos.Seq), pos.Offset)
+	}
+	return record, nil
+}
+
+// Accounts は保存されているアカウントのキーを返します
+// ファイル名はキーを置き換えたものなので、保存したrecordからキーを読みます
+func (s *Store) Accounts() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	errFound := errors.New("found")
+	accounts := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		segments, err := s.Segments(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		for _, seg := range segments {
+			var account string
+			err := ScanSegment(seg, func(r Record, offset int64) error {
+				account = r.Account
+				return errFound
+			})
+			if err != nil && err != errFound {
+				return nil, err
+			}
+			if account != "" {
+				accounts = append(accounts, account)
+				break
+			}
+		}
+	}
+	sort.Strings(accounts)
+	return accounts, nil
+}
+
+// Close は開いているファイルを閉じます
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var first error
+	for k, w := range s.files {
+		if err := w.file.Close(); err != nil && first == nil {
+			first = errors.WithStack(err)
+		}
+		delete(s.files, k)
+	}
+	return first
+}
+
+func (s *Store) accountDir(account string) string {
+	return filepath.Join(s.dir, xdg.SafeName(account))
+}
+
+func (s *Store) segmentPath(account string, seq int) string {
+	return filepath.Join(s.accountDir(account), segmentName(seq))
+}
+
+func segmentName(seq int) string {
+	return fmt.Sprintf("%06d%s", seq, ext)
+}
@@ -0,0 +1,87 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/infrastructure/store"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+func TestAppendAndScan(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.Open(dir, store.Options{})
+	require.NoError(t, err)
+
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	_, err = s.Append(store.Record{Kind: store.KindNote, Account: "misskey.io", ID: "n1", CreatedAt: now, Note: &misskey.NoteBody{ID: "n1", Text: "こんにちは"}})
+	require.NoError(t, err)
+	_, err = s.Append(store.Record{Kind: store.KindNotification, Account: "misskey.io", ID: "x1", CreatedAt: now, Notification: &misskey.Notification{ID: "x1", Type: "follow"}})
+	require.NoError(t, err)
+	_, err = s.Append(store.Record{Kind: store.KindNote, Account: "example/social", ID: "n2", Note: &misskey.NoteBody{ID: "n2"}})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// 書き込みの途中で終了した行は読み飛ばす
+	f, err := os.OpenFile(filepath.Join(dir, "misskey.io", "000001.jsonl"), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	f.WriteString(`{"kind":"note","account":"misskey.io","id":"n3","no`)
+	f.Close()
+
+	var records []store.Record
+	require.NoError(t, s.Scan("misskey.io", func(r store.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	require.Len(t, records, 2)
+	assert.Equal(t, "こんにちは", records[0].Note.Text)
+	assert.True(t, now.Equal(records[0].CreatedAt))
+	assert.Equal(t, "follow", records[1].Notification.Type)
+
+	accounts, err := s.Accounts()
+	require.NoError(t, err)
+	// ファイル名ではなく保存したアカウントのキーを返す
+	assert.Equal(t, []string{"example/social", "misskey.io"}, accounts)
+
+	// 保存していないアカウントは空
+	assert.NoError(t, s.Scan("unknown", func(r store.Record) error { return nil }))
+}
+
+func TestSegments(t *testing.T) {
+	dir := t.TempDir()
+	// 以前の形式のファイルは最初のファイルとして引き継ぐ
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "misskey.io.jsonl"), []byte(`{"kind":"note","account":"misskey.io","id":"old"}`+"\n"), 0600))
+	s, err := store.Open(dir, store.Options{SegmentSize: 1, MaxSegments: 2})
+	require.NoError(t, err)
+	defer s.Close()
+
+	// 大きさを超えたら次のファイルに書き、数が上限を超えたら古いものから消す
+	positions := make([]store.Position, 0)
+	for _, id := range []string{"n1", "n2", "n3"} {
+		pos, err := s.Append(store.Record{Kind: store.KindNote, Account: "misskey.io", ID: id})
+		require.NoError(t, err)
+		positions = append(positions, pos)
+	}
+	assert.Equal(t, []int{2, 3, 4}, []int{positions[0].Seq, positions[1].Seq, positions[2].Seq})
+	segments, err := s.Segments("misskey.io")
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+	assert.Equal(t, 3, segments[0].Seq)
+
+	record, err := s.Read("misskey.io", positions[2])
+	require.NoError(t, err)
+	assert.Equal(t, "n3", record.ID)
+	_, err = s.Read("misskey.io", positions[0])
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	var ids []string
+	require.NoError(t, s.Scan("misskey.io", func(r store.Record) error {
+		ids = append(ids, r.ID)
+		return nil
+	}))
+	assert.Equal(t, []string{"n2", "n3"}, ids)
+}
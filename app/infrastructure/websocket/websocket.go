@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"sync"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/google/uuid"
@@ -24,8 +25,10 @@ type (
 		Start() error
 		Stop()
 		SetWriter(w io.Writer)
-		// SetTimeline(timelineType string) error
+		SetTimeline(timelineType ChannelType) error
 		ToggleTimeline() error
+		Subscribe(channel ChannelType, params map[string]string) (string, error)
+		Unsubscribe(id string)
 		Pong()
 	}
 
@@ -37,22 +40,54 @@ type (
 		msgCh            chan tea.Msg
 		ctx              context.Context
 		cancel           context.CancelFunc
-		socket           *gowebsocket.Socket
 		logger           core.Logger
+		mu               sync.Mutex // 以下を守る
+		socket           *gowebsocket.Socket
 		currentTimeline  ChannelType
 		currentChannelId string
+		connected        bool                    // 接続済みか。接続するまでチャンネルの購読は送らずに覚えておく
+		subscriptions    map[string]subscription // タイムライン以外に購読しているチャンネル
+	}
+
+	// subscription は追加で購読しているチャンネルです
+	subscription struct {
+		channel ChannelType
+		params  map[string]string
 	}
 	ConnectChannelPayload struct {
 		Type string      `json:"type"`
 		Body PayloadBody `json:"body"`
 	}
 	PayloadBody struct {
-		Channel ChannelType `json:"channel,omitempty"`
-		Id      string      `json:"id"`
+		Channel ChannelType       `json:"channel,omitempty"`
+		Id      string            `json:"id"`
+		Params  map[string]string `json:"params,omitempty"`
+	}
+
+	// channelEvent はチャンネルから届いたイベントの種類を調べるための部分的な構造です
+	channelEvent struct {
+		Type string `json:"type"`
+		Body struct {
+			Id   string          `json:"id"`
+			Type string          `json:"type"`
+			Body json.RawMessage `json:"body"`
+		} `json:"body"`
 	}
 
 	NoteMessage struct {
-		Note *misskey.Note `json:"note"`
+		ChannelId string        `json:"channel_id"` // ノートが届いたチャンネルのID
+		Note      *misskey.Note `json:"note"`
+	}
+
+	// EmojiAddedMessage はインスタンスにカスタム絵文字が追加されたことを表します
+	EmojiAddedMessage struct {
+		Emoji misskey.Emoji `json:"emoji"`
+	}
+
+	// NotificationMessage はmainチャンネルに届いた通知です
+	NotificationMessage struct {
+		ChannelId    string                `json:"channel_id"`
+		Notification *misskey.Notification `json:"notification"`
 	}
 
 	TimelineChangedMsg struct {
@@ -80,9 +115,16 @@ type (
 )
 
 var (
-	ChannelTypeMain  ChannelType = "main"
-	ChannelTypeHome  ChannelType = "homeTimeline"
-	ChannelTypeLocal ChannelType = "localTimeline"
+	ChannelTypeMain   ChannelType = "main"
+	ChannelTypeHome   ChannelType = "homeTimeline"
+	ChannelTypeLocal  ChannelType = "localTimeline"
+	ChannelTypeSocial ChannelType = "hybridTimeline"
+	ChannelTypeGlobal ChannelType = "globalTimeline"
+
+	// タイムライン以外のチャンネル(paramsでIDを指定する)
+	ChannelTypeChannel  ChannelType = "channel"  // params: channelId
+	ChannelTypeUserList ChannelType = "userList" // params: listId
+	ChannelTypeAntenna  ChannelType = "antenna"  // params: antennaId
 )
 
 var ProviderSet = wire.NewSet(
@@ -105,6 +147,7 @@ func NewClient(baseUrl string, accessToken misskey.AccessToken, urlResolver urlr
 		logger:           logger,
 		currentTimeline:  ChannelTypeHome,
 		currentChannelId: "",
+		subscriptions:    make(map[string]subscription),
 	}, msgCh
 }
 
@@ -123,45 +166,59 @@ func (c *StandardClient) Start() error {
 	}
 
 	socket := gowebsocket.New(wsUrl)
+	c.mu.Lock()
 	c.socket = &socket
+	c.connected = false
+	c.currentChannelId = ""
+	c.mu.Unlock()
 
-	c.socket.OnConnected = func(socket gowebsocket.Socket) {
+	socket.OnConnected = func(gowebsocket.Socket) {
 		c.logger.Log("websocket", "Connected to WebSocket server")
+		// タイムラインと、接続前に購読を指定されたチャンネルに接続
+		c.mu.Lock()
+		c.connected = true
+		timeline := c.currentTimeline
+		err := c.connectToTimeline(timeline)
+		for id, sub := range c.subscriptions {
+			c.sendConnect(sub.channel, id, sub.params)
+		}
+		c.mu.Unlock()
+		if err != nil {
+			c.logger.Log("websocket", fmt.Sprintf("Failed to connect to timeline: %v", err))
+		}
 		if c.msgCh != nil {
-			c.msgCh <- WebSocketConnectedMsg{c.currentTimeline}
+			c.msgCh <- WebSocketConnectedMsg{timeline}
 		}
 	}
 
-	c.socket.OnConnectError = func(err error, socket gowebsocket.Socket) {
+	var connectErr error
+	socket.OnConnectError = func(err error, _ gowebsocket.Socket) {
+		connectErr = err
 		c.logger.Log("websocket", fmt.Sprintf("WebSocket connection error: %v", err))
 		if c.msgCh != nil {
 			c.msgCh <- WebSocketErrorMsg{Err: err}
 		}
 	}
 
-	c.socket.OnTextMessage = func(message string, socket gowebsocket.Socket) {
+	socket.OnTextMessage = func(message string, socket gowebsocket.Socket) {
 		// TODO: このあたりの描画処理はまるごとwriterへ委譲する
 		c.logger.Log("websocket", fmt.Sprintf("Received message: %s", message))
-		note := &misskey.Note{}
-		if err := json.Unmarshal([]byte(message), &note); err != nil {
-			// log.Printf("note marshalize error %v", err)
-			c.logger.Log("websocket", fmt.Sprintf("Failed to unmarshal message: %v", err))
-			return
-		}
-
-		if c.msgCh != nil {
-			c.msgCh <- NoteMessage{Note: note}
+		if msg := c.parseMessage([]byte(message)); msg != nil && c.msgCh != nil {
+			c.msgCh <- msg
 		}
 	}
 
-	c.socket.OnDisconnected = func(err error, socket gowebsocket.Socket) {
+	socket.OnDisconnected = func(err error, socket gowebsocket.Socket) {
+		c.mu.Lock()
+		c.connected = false
+		c.mu.Unlock()
 		c.logger.Log("websocket", fmt.Sprintf("Disconnected from WebSocket server: %v", err))
 		if c.msgCh != nil {
 			c.msgCh <- WebSocketDisconnectedMsg{Err: err}
 		}
 	}
 
-	c.socket.OnPingReceived = func(data string, socket gowebsocket.Socket) {
+	socket.OnPingReceived = func(data string, socket gowebsocket.Socket) {
 		c.logger.Log("websocket", fmt.Sprintf("Ping received: %s", data))
 		if c.msgCh != nil {
 			c.msgCh <- WebSocketPingReceivedMsg{Data: data}
@@ -169,19 +226,17 @@ func (c *StandardClient) Start() error {
 		c.Pong()
 	}
 
-	c.socket.OnPongReceived = func(data string, socket gowebsocket.Socket) {
+	socket.OnPongReceived = func(data string, socket gowebsocket.Socket) {
 		c.logger.Log("websocket", fmt.Sprintf("Pong received: %s", data))
 		if c.msgCh != nil {
 			c.msgCh <- WebSocketPingReceivedMsg{Data: data}
 		}
 	}
 
-	c.socket.Connect()
-
-	// タイムラインに接続
-	if err := c.connectToTimeline(c.currentTimeline); err != nil {
-		c.logger.Log("websocket", fmt.Sprintf("Failed to connect to timeline: %v", err))
-		return err
+	// 接続できればOnConnectedでタイムラインとチャンネルに接続する
+	socket.Connect()
+	if connectErr != nil {
+		return connectErr
 	}
 
 	<-c.ctx.Done()
@@ -189,12 +244,17 @@ func (c *StandardClient) Start() error {
 	// 接続を閉じる準備
 	log.Println("Closing WebSocket connection...")
 
-	disconnectBody := &PayloadBody{
-		Id: c.currentChannelId,
+	c.mu.Lock()
+	connected := c.connected
+	if connected {
+		disconnectText, _ := json.Marshal(&ConnectChannelPayload{Type: "disconnect", Body: PayloadBody{Id: c.currentChannelId}})
+		socket.SendText(string(disconnectText))
+	}
+	c.mu.Unlock()
+	if connected {
+		// OnDisconnectedが呼ばれるのでロックの外で閉じる
+		socket.Close()
 	}
-	disconnectText, _ := json.Marshal(&ConnectChannelPayload{Type: "disconnect", Body: *disconnectBody})
-	c.socket.SendText(string(disconnectText))
-	c.socket.Close()
 	c.logger.Flush()
 	return nil
 }
@@ -205,42 +265,148 @@ func (c *StandardClient) Stop() {
 }
 
 func (c *StandardClient) Pong() {
-	c.socket.SendBinary([]byte{websocket.PongMessage})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected {
+		c.socket.SendBinary([]byte{websocket.PongMessage})
+	}
 }
 
 // SetTimeline はタイムラインの種類を変更します
-func (c *StandardClient) setTimeline(timelineType ChannelType) error {
+// 接続前に呼んだ場合は、接続時に購読するタイムラインを変更します
+func (c *StandardClient) SetTimeline(timelineType ChannelType) error {
+	c.mu.Lock()
+	oldTimeline := c.currentTimeline
 	if c.socket == nil {
-		return fmt.Errorf("WebSocket接続が確立されていません")
+		c.currentTimeline = timelineType
+		c.mu.Unlock()
+		return nil
 	}
+	c.mu.Unlock()
 
 	// 同じタイムラインの場合は何もしない
-	if c.currentTimeline == timelineType {
+	if oldTimeline == timelineType {
 		return nil
 	}
 
 	// タイムライン変更を通知
 	if c.msgCh != nil {
 		c.msgCh <- TimelineChangedMsg{
-			OldTimeline: c.currentTimeline,
+			OldTimeline: oldTimeline,
 			NewTimeline: timelineType,
 		}
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.connectToTimeline(timelineType)
 }
 
 // ToggleTimeline は現在のタイムラインをローカルとホームで切り替えます
 func (c *StandardClient) ToggleTimeline() error {
-	if c.currentTimeline == ChannelTypeLocal {
-		return c.setTimeline(ChannelTypeHome)
+	c.mu.Lock()
+	current := c.currentTimeline
+	c.mu.Unlock()
+	if current == ChannelTypeLocal {
+		return c.SetTimeline(ChannelTypeHome)
 	} else {
-		return c.setTimeline(ChannelTypeLocal)
+		return c.SetTimeline(ChannelTypeLocal)
 	}
 }
 
-// タイムラインに接続する内部メソッド
+// Subscribe はタイムラインとは別にチャンネルを購読し、そのチャンネルのIDを返します
+// 届いたメッセージはIDで区別できます。接続前に呼んだ場合は接続時に購読します
+func (c *StandardClient) Subscribe(channel ChannelType, params map[string]string) (string, error) {
+	uu, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("チャネルID生成エラー: %w", err)
+	}
+	id := uu.String()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscriptions[id] = subscription{channel: channel, params: params}
+	if c.connected {
+		c.sendConnect(channel, id, params)
+	}
+	c.logger.Log("websocket", fmt.Sprintf("チャンネル %s を購読しました: %s", channel, id))
+	return id, nil
+}
+
+// Unsubscribe はSubscribeで購読したチャンネルから切断します
+func (c *StandardClient) Unsubscribe(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.subscriptions[id]; !ok {
+		return
+	}
+	delete(c.subscriptions, id)
+	if c.connected {
+		disconnectText, _ := json.Marshal(&ConnectChannelPayload{Type: "disconnect", Body: PayloadBody{Id: id}})
+		c.socket.SendText(string(disconnectText))
+	}
+}
+
+// sendConnect はチャンネルに接続します。c.muを持ち、接続済みのときに呼びます
+func (c *StandardClient) sendConnect(channel ChannelType, id string, params map[string]string) {
+	connectText, _ := json.Marshal(&ConnectChannelPayload{
+		Type: "connect",
+		Body: PayloadBody{Channel: channel, Id: id, Params: params},
+	})
+	c.socket.SendText(string(connectText))
+}
+
+// parseMessage はチャンネルから届いたメッセージをモデルに渡すメッセージに変換します
+// 表示に使わない種類のイベントであればnilを返します
+func (c *StandardClient) parseMessage(message []byte) tea.Msg {
+	event := &channelEvent{}
+	if err := json.Unmarshal(message, event); err != nil {
+		c.logger.Log("websocket", fmt.Sprintf("Failed to unmarshal message: %v", err))
+		return nil
+	}
+
+	if event.Type == "emojiAdded" {
+		// チャンネルに関係なく全体に届くイベント
+		added := &struct {
+			Body EmojiAddedMessage `json:"body"`
+		}{}
+		if err := json.Unmarshal(message, added); err != nil {
+			c.logger.Log("websocket", fmt.Sprintf("Failed to unmarshal emoji: %v", err))
+			return nil
+		}
+		return added.Body
+	}
+
+	switch event.Body.Type {
+	case "note":
+		note := &misskey.Note{}
+		if err := json.Unmarshal(message, note); err != nil {
+			// log.Printf("note marshalize error %v", err)
+			c.logger.Log("websocket", fmt.Sprintf("Failed to unmarshal message: %v", err))
+			return nil
+		}
+		return NoteMessage{ChannelId: event.Body.Id, Note: note}
+	case "notification":
+		notification := &misskey.Notification{}
+		if err := json.Unmarshal(event.Body.Body, notification); err != nil {
+			c.logger.Log("websocket", fmt.Sprintf("Failed to unmarshal notification: %v", err))
+			return nil
+		}
+		return NotificationMessage{ChannelId: event.Body.Id, Notification: notification}
+	default:
+		c.logger.Log("websocket", fmt.Sprintf("ignore event: %s", event.Body.Type))
+		return nil
+	}
+}
+
+// タイムラインに接続する内部メソッド。c.muを持って呼びます
+// 接続前であれば、接続したときに購読するタイムラインを変更します
 func (c *StandardClient) connectToTimeline(timelineType ChannelType) error {
+	if !c.connected {
+		c.currentTimeline = timelineType
+		c.currentChannelId = ""
+		return nil
+	}
 	uu, err := uuid.NewRandom()
 	if err != nil {
 		return fmt.Errorf("チャネルID生成エラー: %w", err)
@@ -273,12 +439,41 @@ func (c *StandardClient) connectToTimeline(timelineType ChannelType) error {
 	return nil
 }
 
+// ParseChannelType は設定ファイルに書かれたタイムライン名をChannelTypeに変換します
+// home / local / social / global のほか、APIのチャンネル名もそのまま受け付けます
+func ParseChannelType(name string) (ChannelType, error) {
+	switch name {
+	case "", "home", string(ChannelTypeHome):
+		return ChannelTypeHome, nil
+	case "local", string(ChannelTypeLocal):
+		return ChannelTypeLocal, nil
+	case "social", "hybrid", string(ChannelTypeSocial):
+		return ChannelTypeSocial, nil
+	case "global", string(ChannelTypeGlobal):
+		return ChannelTypeGlobal, nil
+	default:
+		return "", fmt.Errorf("unknown timeline: %s", name)
+	}
+}
+
 func (t ChannelType) String() string {
 	switch t {
 	case ChannelTypeHome:
 		return "ホーム"
 	case ChannelTypeLocal:
 		return "ローカル"
+	case ChannelTypeSocial:
+		return "ソーシャル"
+	case ChannelTypeGlobal:
+		return "グローバル"
+	case ChannelTypeChannel:
+		return "チャンネル"
+	case ChannelTypeUserList:
+		return "リスト"
+	case ChannelTypeAntenna:
+		return "アンテナ"
+	case ChannelTypeMain:
+		return "通知"
 	default:
 		return string(t)
 	}
@@ -1,9 +1,18 @@
 package websocket_test
 
 import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	gorilla "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/wasya-io/petit-misskey/infrastructure/resolver"
 	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
 	"github.com/wasya-io/petit-misskey/logger"
@@ -18,3 +27,71 @@ func TestGetStream(t *testing.T) {
 	wsClient, _ := websocket.NewClient(cfg.Test.BaseUrl, misskey.AccessToken(cfg.Test.AccessToken), resolver, os.Stdout, l)
 	wsClient.Start()
 }
+
+type fixedResolver string
+
+func (r fixedResolver) Resolve(string, map[string]string) (string, error) {
+	return string(r), nil
+}
+
+func TestSubscribeBeforeConnected(t *testing.T) {
+	received := make(chan websocket.ConnectChannelPayload, 10)
+	upgrader := gorilla.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var payload websocket.ConnectChannelPayload
+			if err := conn.ReadJSON(&payload); err != nil {
+				return
+			}
+			received <- payload
+		}
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	client, msgCh := websocket.NewClient(server.URL, "", fixedResolver(url), nil, logger.New(false))
+
+	// 接続前の購読は接続してから送る
+	before, err := client.Subscribe(websocket.ChannelTypeMain, nil)
+	require.NoError(t, err)
+	require.NoError(t, client.SetTimeline(websocket.ChannelTypeLocal))
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- client.Start() }()
+	select {
+	case msg := <-msgCh:
+		assert.Equal(t, websocket.WebSocketConnectedMsg{Timeline: websocket.ChannelTypeLocal}, msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("not connected")
+	}
+
+	after, err := client.Subscribe(websocket.ChannelTypeAntenna, map[string]string{"antennaId": "a"})
+	require.NoError(t, err)
+
+	channels := make(map[string]websocket.ChannelType)
+	for len(channels) < 3 {
+		select {
+		case payload := <-received:
+			assert.Equal(t, "connect", payload.Type)
+			channels[payload.Body.Id] = payload.Body.Channel
+		case <-time.After(5 * time.Second):
+			t.Fatalf("not subscribed: %v", channels)
+		}
+	}
+	assert.Equal(t, websocket.ChannelTypeMain, channels[before])
+	assert.Equal(t, websocket.ChannelTypeAntenna, channels[after])
+	assert.Len(t, channels, 3)
+	assert.Contains(t, slices.Collect(maps.Values(channels)), websocket.ChannelTypeLocal)
+
+	client.Stop()
+	go func() {
+		for range msgCh {
+		}
+	}()
+	assert.NoError(t, <-errCh)
+}
@@ -0,0 +1,102 @@
+package xdg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// アプリケーションのディレクトリ名
+const AppName = "petit-misskey"
+
+// ConfigDirs は設定ファイルを探すディレクトリを優先度の高い順に返します
+// $XDG_CONFIG_HOME, os.UserConfigDir(), $XDG_CONFIG_DIRS の順で、重複は除きます
+func ConfigDirs() []string {
+	candidates := make([]string, 0, 4)
+	if home := os.Getenv("XDG_CONFIG_HOME"); home != "" {
+		candidates = append(candidates, home)
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, dir)
+	}
+	if dirs := os.Getenv("XDG_CONFIG_DIRS"); dirs != "" {
+		candidates = append(candidates, filepath.SplitList(dirs)...)
+	} else {
+		candidates = append(candidates, "/etc/xdg")
+	}
+
+	seen := make(map[string]bool)
+	ret := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if c == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		ret = append(ret, filepath.Join(c, AppName))
+	}
+	return ret
+}
+
+// CacheDir は消えても困らないデータ(絵文字や画像のキャッシュなど)を置くディレクトリを返します
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return ensure(filepath.Join(dir, AppName))
+}
+
+// StateDir は下書きや送信待ちキューなど、再起動後も残したいデータを置くディレクトリを返します
+// $XDG_STATE_HOME が未設定なら ~/.local/state を使います
+func StateDir() (string, error) {
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" && filepath.IsAbs(state) {
+		return ensure(filepath.Join(state, AppName))
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return ensure(filepath.Join(home, ".local", "state", AppName))
+}
+
+// DataDir は受信したノートの保存先など、ユーザーのデータを置くディレクトリを返します
+// $XDG_DATA_HOME が未設定なら ~/.local/share を使います
+func DataDir() (string, error) {
+	if data := os.Getenv("XDG_DATA_HOME"); data != "" && filepath.IsAbs(data) {
+		return ensure(filepath.Join(data, AppName))
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return ensure(filepath.Join(home, ".local", "share", AppName))
+}
+
+// RuntimeDir はソケットなど、実行中だけ使うファイルを置くディレクトリを返します
+// $XDG_RUNTIME_DIR が未設定ならStateDirを使います
+func RuntimeDir() (string, error) {
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" && filepath.IsAbs(runtime) {
+		return ensure(filepath.Join(runtime, AppName))
+	}
+	return StateDir()
+}
+
+// SafeName はインスタンスキーなどをファイル名に使える文字列にします
+func SafeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', 0:
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func ensure(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return dir, nil
+}
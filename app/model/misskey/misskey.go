@@ -17,16 +17,96 @@ type (
 		Name           string `json:"name"`
 		BannerUrl      string `json:"bannerUrl"`
 		IconUrl        string `json:"iconUrl"`
+		MaxNoteLength  int    `json:"maxNoteLength"`
 	}
 
 	CreateNote struct {
 		AccessToken AccessToken `json:"i"`
 		Visibility  Visibility  `json:"visibility"`
 		Text        string      `json:"text"`
+		Cw          *string     `json:"cw,omitempty"`
+		LocalOnly   bool        `json:"localOnly,omitempty"`
+		ReplyId     string      `json:"replyId,omitempty"`
+	}
+
+	// api/notes/reactions/create
+	CreateReaction struct {
+		AccessToken AccessToken `json:"i"`
+		NoteId      string      `json:"noteId"`
+		Reaction    string      `json:"reaction"`
+	}
+
+	// api/users/show
+	ShowUser struct {
+		AccessToken AccessToken `json:"i"`
+		Username    string      `json:"username"`
+		Host        *string     `json:"host,omitempty"` // ローカルのユーザーならnil
+	}
+
+	// api/users/notes
+	UserNotes struct {
+		AccessToken AccessToken `json:"i"`
+		UserId      string      `json:"userId"`
+		SinceId     string      `json:"sinceId,omitempty"`
+		Limit       int         `json:"limit,omitempty"`
+	}
+
+	// api/users/search-by-username-and-host
+	SearchUsers struct {
+		AccessToken AccessToken `json:"i"`
+		Username    string      `json:"username,omitempty"`
+		Host        string      `json:"host,omitempty"`
+		Limit       int         `json:"limit,omitempty"`
+		Detail      bool        `json:"detail"`
+	}
+
+	// api/hashtags/search
+	SearchHashtags struct {
+		AccessToken AccessToken `json:"i"`
+		Query       string      `json:"query"`
+		Limit       int         `json:"limit,omitempty"`
+	}
+
+	// api/notes/search
+	SearchNotes struct {
+		AccessToken AccessToken `json:"i"`
+		Query       string      `json:"query"`
+		UserId      string      `json:"userId,omitempty"`
+		Host        string      `json:"host,omitempty"` // ローカルは "."
+		ChannelId   string      `json:"channelId,omitempty"`
+		SinceId     string      `json:"sinceId,omitempty"`
+		UntilId     string      `json:"untilId,omitempty"`
+		Limit       int         `json:"limit,omitempty"`
+	}
+
+	// api/notes/search-by-tag
+	SearchNotesByTag struct {
+		AccessToken AccessToken `json:"i"`
+		Tag         string      `json:"tag"`
+		SinceId     string      `json:"sinceId,omitempty"`
+		UntilId     string      `json:"untilId,omitempty"`
+		Limit       int         `json:"limit,omitempty"`
+	}
+
+	// api/hashtags/trend
+	TrendHashtags struct{}
+
+	// HashtagTrend は最近よく使われているハッシュタグです
+	HashtagTrend struct {
+		Tag        string `json:"tag"`
+		Chart      []int  `json:"chart"` // 10分ごとの投稿したユーザーの数(古い順)
+		UsersCount int    `json:"usersCount"`
+	}
+
+	// api/emojis
+	Emojis struct{}
+
+	EmojisResponse struct {
+		Emojis []Emoji `json:"emojis"`
 	}
 
 	CreateNoteResponse struct {
-		CreatedNote Note `json:"createdNote"`
+		CreatedNote NoteBody `json:"createdNote"`
 	}
 
 	// misskey defined types
@@ -40,12 +120,21 @@ type (
 	}
 
 	User struct {
-		Id        string `json:"id"`
-		Name      string `json:"name"`
-		UserName  string `json:"username"`
-		AvatarUrl string `json:"avatarUrl"`
-		IsBot     bool   `json:"isBot"`
-		IsCat     bool   `json:"isCat"`
+		Id        string  `json:"id"`
+		Name      string  `json:"name"`
+		UserName  string  `json:"username"`
+		Host      *string `json:"host"` // ローカルのユーザーならnil
+		AvatarUrl string  `json:"avatarUrl"`
+		IsBot     bool    `json:"isBot"`
+		IsCat     bool    `json:"isCat"`
+	}
+
+	// Emoji はインスタンスのカスタム絵文字を表します
+	Emoji struct {
+		Name     string   `json:"name"`
+		Aliases  []string `json:"aliases"`
+		Category string   `json:"category"`
+		Url      string   `json:"url"`
 	}
 
 	// 新しい構造体定義
@@ -108,6 +197,8 @@ type (
 	RenoteContent struct {
 		ID                       string            `json:"id"`
 		CreatedAt                time.Time         `json:"createdAt"`
+		Uri                      string            `json:"uri,omitempty"` // リモートのノートのみ
+		Url                      string            `json:"url,omitempty"`
 		UserID                   string            `json:"userId"`
 		User                     NoteUser          `json:"user"`
 		Text                     string            `json:"text"`
@@ -132,6 +223,8 @@ type (
 	NoteBody struct {
 		ID                       string            `json:"id"`
 		CreatedAt                time.Time         `json:"createdAt"`
+		Uri                      string            `json:"uri,omitempty"` // リモートのノートのみ
+		Url                      string            `json:"url,omitempty"`
 		UserID                   string            `json:"userId"`
 		User                     NoteUser          `json:"user"`
 		Text                     string            `json:"text"`
@@ -144,8 +237,9 @@ type (
 		Reactions                map[string]int    `json:"reactions"`
 		ReactionEmojis           map[string]string `json:"reactionEmojis"`
 		ReactionAndUserPairCache []any             `json:"reactionAndUserPairCache"`
-		FileIds                  []any             `json:"fileIds"`
-		Files                    []any             `json:"files"`
+		Tags                     []string          `json:"tags"`
+		FileIds                  []string          `json:"fileIds"`
+		Files                    []NoteFile        `json:"files"`
 		ReplyID                  any               `json:"replyId"`
 		RenoteID                 string            `json:"renoteId"`
 		ClippedCount             int               `json:"clippedCount"`
@@ -159,6 +253,16 @@ type (
 		Body NoteBody `json:"body"`
 	}
 
+	// Notification はmainチャンネルに届く通知を表します
+	Notification struct {
+		ID        string    `json:"id"`
+		CreatedAt time.Time `json:"createdAt"`
+		Type      string    `json:"type"` // follow / mention / reply / renote / quote / reaction など
+		User      *NoteUser `json:"user,omitempty"`
+		Note      *NoteBody `json:"note,omitempty"`
+		Reaction  string    `json:"reaction,omitempty"`
+	}
+
 	// Note はMisskeyのノートを表します
 	Note struct {
 		Type string        `json:"type"`
@@ -0,0 +1,325 @@
+// Package archive は受信したノートと通知を保存し、全文検索できるようにします
+// 索引は保存先のファイルごとに作ります。書き込み中のファイルの索引だけをメモリに置き、
+// 書き込みの終わったファイルの索引はファイルの隣に保存して、検索するときに読み込みます
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/infrastructure/store"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// Archive は保存したノートと通知の全文検索の索引です
+	Archive struct {
+		store    *store.Store
+		accounts []string // 検索するアカウント(空なら保存されているすべて)
+
+		mu     sync.Mutex
+		active map[string]*active // アカウントごとの書き込み中のファイルの索引
+	}
+
+	// active は書き込み中のファイルの索引です
+	active struct {
+		seq int // ファイルの番号(まだ保存していなければ0)
+		idx *index
+	}
+
+	// hit は検索に当てはまった1件の索引の位置です
+	hit struct {
+		account string
+		seq     int
+		doc     doc
+	}
+
+	// Query は検索の条件です
+	Query struct {
+		Text    string     // 空白で区切った語をすべて含むもの
+		User    string     // 投稿者(@username か @username@host)
+		Since   time.Time  // これ以降に作成されたもの
+		Account string     // 受信したアカウント(空ならすべて)
+		Kind    store.Kind // 種類(空ならノートと通知の両方)
+		Limit   int        // 返す件数の上限(未設定なら50)
+	}
+)
+
+const defaultLimit = 50
+
+// Open はstoreに保存したノートと通知を検索するArchiveを返します
+// accountsが空なら保存されているすべてのアカウントを検索します。索引は使うときに読み込みます
+func Open(s *store.Store, accounts []string) (*Archive, error) {
+	return &Archive{store: s, accounts: accounts, active: make(map[string]*active)}, nil
+}
+
+// Add はストリーミングのメッセージのうち、ノートと通知を保存します
+// 保存済みのものと、それ以外のメッセージは保存せずにfalseを返します
+func (a *Archive) Add(account string, msg any, now time.Time) (bool, error) {
+	var r store.Record
+	switch msg := msg.(type) {
+	case websocket.NoteMessage:
+		if msg.Note == nil {
+			return false, nil
+		}
+		body := msg.Note.Body.Body
+		r = store.Record{Kind: store.KindNote, ID: body.ID, CreatedAt: body.CreatedAt, Note: &body}
+	case websocket.NotificationMessage:
+		if msg.Notification == nil {
+			return false, nil
+		}
+		n := msg.Notification
+		r = store.Record{Kind: store.KindNotification, ID: n.ID, CreatedAt: n.CreatedAt, Notification: n}
+	default:
+		return false, nil
+	}
+	if r.ID == "" {
+		return false, nil
+	}
+	r.Account, r.ReceivedAt = account, now
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = now
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cur, err := a.current(account)
+	if err != nil {
+		return false, err
+	}
+	if cur.idx.has(r) {
+		return false, nil
+	}
+	pos, err := a.store.Append(r)
+	if err != nil {
+		return false, err
+	}
+	if pos.Seq != cur.seq {
+		// 次のファイルに切り替わった。前のファイルの索引は検索するときに作って保存する
+		cur = &active{seq: pos.Seq, idx: newIndex()}
+		a.active[account] = cur
+	}
+	return cur.idx.add(r, pos.Offset), nil
+}
+
+// current はアカウントの書き込み中のファイルの索引を返します。初めてならファイルを読んで作ります
+// a.muをロックして呼びます
+func (a *Archive) current(account string) (*active, error) {
+	if cur, ok := a.active[account]; ok {
+		return cur, nil
+	}
+	segments, err := a.store.Segments(account)
+	if err != nil {
+		return nil, err
+	}
+	cur := &active{idx: newIndex()}
+	if len(segments) > 0 {
+		last := segments[len(segments)-1]
+		idx, err := buildIndex(last)
+		if err != nil {
+			return nil, err
+		}
+		cur = &active{seq: last.Seq, idx: idx}
+	}
+	a.active[account] = cur
+	return cur, nil
+}
+
+// Close は保存先のファイルを閉じます
+func (a *Archive) Close() error {
+	return a.store.Close()
+}
+
+// Search は条件に当てはまるノートと通知を、新しい順に返します
+// 新しいファイルから順に索引を読み、上限の件数より古いものしかないファイルは読みません
+func (a *Archive) Search(q Query) ([]store.Record, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	terms := strings.Fields(normalize(q.Text))
+	user := strings.ToLower(strings.TrimPrefix(q.User, "@"))
+
+	accounts := a.accounts
+	if q.Account != "" {
+		accounts = []string{q.Account}
+	} else if len(accounts) == 0 {
+		saved, err := a.store.Accounts()
+		if err != nil {
+			return nil, err
+		}
+		accounts = saved
+	}
+
+	hits := make([]hit, 0)
+	// oldest は上限の件数に入るもののうちいちばん古い作成日時を返します
+	oldest := func() (time.Time, bool) {
+		if len(hits) < limit {
+			return time.Time{}, false
+		}
+		sortHits(hits)
+		return hits[limit-1].doc.CreatedAt, true
+	}
+	for _, account := range accounts {
+		a.mu.Lock()
+		cur, err := a.current(account)
+		if err == nil {
+			for _, d := range cur.idx.search(q, terms, user) {
+				hits = append(hits, hit{account: account, seq: cur.seq, doc: d})
+			}
+		}
+		a.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		segments, err := a.store.Segments(account)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(segments) - 1; i >= 0; i-- {
+			seg := segments[i]
+			if seg.Seq == cur.seq {
+				continue
+			}
+			idx, err := loadIndex(seg, func(newest time.Time) bool {
+				if !q.Since.IsZero() && newest.Before(q.Since) {
+					return true
+				}
+				t, ok := oldest()
+				return ok && newest.Before(t)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if idx == nil {
+				continue
+			}
+			for _, d := range idx.search(q, terms, user) {
+				hits = append(hits, hit{account: account, seq: seg.Seq, doc: d})
+			}
+		}
+	}
+
+	sortHits(hits)
+	records := make([]store.Record, 0, min(len(hits), limit))
+	seen := make(map[string]bool)
+	for _, h := range hits {
+		if len(records) >= limit {
+			break
+		}
+		// 複数のファイルに同じものが保存されていることがあるので一度だけ返す
+		k := fmt.Sprintf("%s/%s/%s", h.account, h.doc.Kind, h.doc.ID)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		r, err := a.store.Read(h.account, store.Position{Seq: h.seq, Offset: h.doc.Offset})
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // 上限を超えて消された
+		}
+		if err != nil {
+			return nil, err
+		}
+		// 名前を置き換えると同じファイルになるアカウントのものは除く
+		if r.Account != h.account || r.Kind != h.doc.Kind || r.ID != h.doc.ID {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func sortHits(hits []hit) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].doc.CreatedAt.After(hits[j].doc.CreatedAt)
+	})
+}
+
+// intersect は昇順の2つの列の共通部分を返します
+func intersect(a, b []int) []int {
+	ret := a[:0]
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			ret = append(ret, a[i])
+			i++
+			j++
+		}
+	}
+	return ret
+}
+
+func containsAll(text string, terms []string) bool {
+	for _, t := range terms {
+		if !strings.Contains(text, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Note はrecordの本文にあたるノートを返します(フォローの通知などではnil)
+func Note(r store.Record) *misskey.NoteBody {
+	if r.Note != nil {
+		return r.Note
+	}
+	if r.Notification != nil {
+		return r.Notification.Note
+	}
+	return nil
+}
+
+// User はrecordの投稿者(通知では通知したユーザー)を返します
+func User(r store.Record) *misskey.NoteUser {
+	if r.Notification != nil {
+		return r.Notification.User
+	}
+	if r.Note != nil {
+		return &r.Note.User
+	}
+	return nil
+}
+
+// searchText はrecordの検索の対象になる文字列を返します
+// リノートだけのノートはリノート元の本文を使います
+func searchText(r store.Record) string {
+	n := Note(r)
+	if n == nil {
+		return ""
+	}
+	parts := make([]string, 0, 3)
+	if cw, ok := n.Cw.(string); ok && cw != "" {
+		parts = append(parts, cw)
+	}
+	parts = append(parts, n.Text)
+	if n.RenoteID != "" && n.Text == "" {
+		parts = append(parts, n.Renote.Text)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// users は検索で照らし合わせる投稿者の名前を返します
+func users(r store.Record) []string {
+	u := User(r)
+	if u == nil {
+		return nil
+	}
+	name := strings.ToLower(u.Username)
+	names := []string{name}
+	if host, ok := u.Host.(string); ok && host != "" {
+		names = append(names, name+"@"+strings.ToLower(host))
+	}
+	return names
+}
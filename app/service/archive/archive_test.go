@@ -0,0 +1,145 @@
+package archive_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/infrastructure/store"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/archive"
+)
+
+var base = time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+
+func noteMsg(id string, user string, text string, at time.Time) websocket.NoteMessage {
+	return websocket.NoteMessage{Note: &misskey.Note{Body: misskey.NoteContainer{Body: misskey.NoteBody{
+		ID: id, Text: text, CreatedAt: at, User: misskey.NoteUser{Username: user},
+	}}}}
+}
+
+// search は検索してIDを返します
+func search(t *testing.T, a *archive.Archive, q archive.Query) []string {
+	records, err := a.Search(q)
+	require.NoError(t, err)
+	return ids(records)
+}
+
+func ids(records []store.Record) []string {
+	ret := make([]string, 0, len(records))
+	for _, r := range records {
+		ret = append(ret, r.ID)
+	}
+	return ret
+}
+
+func open(t *testing.T, dir string, opts store.Options) *archive.Archive {
+	s, err := store.Open(dir, opts)
+	require.NoError(t, err)
+	a, err := archive.Open(s, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	a := open(t, dir, store.Options{})
+	for _, msg := range []websocket.NoteMessage{
+		noteMsg("n1", "alice", "今日は東京で勉強会があります", base),
+		noteMsg("n2", "bob", "京都に行きたい", base.Add(time.Hour)),
+		noteMsg("n3", "alice", "ＧｏＬａｎｇ の勉強会 #petit", base.Add(2*time.Hour)),
+	} {
+		added, err := a.Add("io", msg, base)
+		require.NoError(t, err)
+		assert.True(t, added)
+	}
+	notification := websocket.NotificationMessage{Notification: &misskey.Notification{
+		ID: "x1", Type: "mention", CreatedAt: base.Add(3 * time.Hour), User: &misskey.NoteUser{Username: "carol"},
+		Note: &misskey.NoteBody{ID: "n4", Text: "@me 勉強会に参加します"},
+	}}
+	added, err := a.Add("io", notification, base)
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	// 複数のチャンネルから届いた同じノートは一度だけ保存する
+	added, err = a.Add("io", noteMsg("n1", "alice", "今日は東京で勉強会があります", base), base)
+	require.NoError(t, err)
+	assert.False(t, added)
+	assert.Len(t, search(t, a, archive.Query{}), 4)
+
+	assert.Equal(t, []string{"x1", "n3", "n1"}, search(t, a, archive.Query{Text: "勉強会"}))
+	// 「東京」の2-gramは「京都」と重ならない
+	assert.Equal(t, []string{"n1"}, search(t, a, archive.Query{Text: "東京"}))
+	assert.Equal(t, []string{"n2"}, search(t, a, archive.Query{Text: "京都"}))
+	// 全角の英字と大文字小文字は区別しない
+	assert.Equal(t, []string{"n3"}, search(t, a, archive.Query{Text: "golang 勉強"}))
+	// 1文字の語は本文と照らし合わせる
+	assert.Equal(t, []string{"n2"}, search(t, a, archive.Query{Text: "都"}))
+	assert.Equal(t, []string{"n3", "n1"}, search(t, a, archive.Query{Text: "勉強会", User: "@alice"}))
+	assert.Equal(t, []string{"x1"}, search(t, a, archive.Query{Text: "勉強会", User: "carol"}))
+	assert.Equal(t, []string{"x1", "n3"}, search(t, a, archive.Query{Text: "勉強会", Since: base.Add(time.Hour)}))
+	assert.Equal(t, []string{"n3", "n1"}, search(t, a, archive.Query{Text: "勉強会", Kind: store.KindNote}))
+	assert.Equal(t, []string{"x1"}, search(t, a, archive.Query{Text: "勉強会", Limit: 1}))
+	assert.Empty(t, search(t, a, archive.Query{Text: "勉強会", Account: "design"}))
+	// 2-gramが別々のノートにしかないものは当てはまらない
+	assert.Empty(t, search(t, a, archive.Query{Text: "東京に行"}))
+
+	// 保存したものは次に開いたときも検索できる
+	a.Close()
+	reopened := open(t, dir, store.Options{})
+	assert.Len(t, search(t, reopened, archive.Query{}), 4)
+	assert.Equal(t, []string{"n1"}, search(t, reopened, archive.Query{Text: "東京"}))
+	records, err := reopened.Search(archive.Query{User: "carol"})
+	require.NoError(t, err)
+	assert.Equal(t, "@me 勉強会に参加します", archive.Note(records[0]).Text)
+}
+
+func TestParseSince(t *testing.T) {
+	for value, want := range map[string]time.Time{
+		"24h":              base.Add(-24 * time.Hour),
+		"7d":               base.AddDate(0, 0, -7),
+		"2026-10-01":       time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		"2026-10-01 12:30": time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC),
+	} {
+		got, err := archive.ParseSince(value, base)
+		require.NoError(t, err, value)
+		assert.True(t, want.Equal(got), value)
+	}
+	_, err := archive.ParseSince("yesterday", base)
+	assert.Error(t, err)
+}
+
+func TestSegments(t *testing.T) {
+	dir := t.TempDir()
+	// 1件ごとに次のファイルに切り替える
+	opts := store.Options{SegmentSize: 1}
+	a := open(t, dir, opts)
+	for i := 1; i <= 5; i++ {
+		msg := noteMsg(fmt.Sprintf("n%d", i), "alice", fmt.Sprintf("勉強会 その%d", i), base.Add(time.Duration(i)*time.Hour))
+		added, err := a.Add("example/social", msg, base)
+		require.NoError(t, err)
+		assert.True(t, added)
+	}
+	assert.Equal(t, []string{"n5", "n4"}, search(t, a, archive.Query{Text: "勉強会", Limit: 2}))
+	assert.Equal(t, []string{"n3"}, search(t, a, archive.Query{Text: "その3"}))
+
+	// 書き込みの終わったファイルの索引は保存して、次からはそれを読む
+	idx, err := filepath.Glob(filepath.Join(dir, "example_social", "*.idx"))
+	require.NoError(t, err)
+	assert.Len(t, idx, 4)
+
+	// キーに使えない文字を含むアカウントも、保存したキーで検索できる
+	a.Close()
+	reopened := open(t, dir, opts)
+	records, err := reopened.Search(archive.Query{Text: "勉強会"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"n5", "n4", "n3", "n2", "n1"}, ids(records))
+	assert.Equal(t, "example/social", records[0].Account)
+	assert.Equal(t, []string{"n5", "n4"}, search(t, reopened, archive.Query{Text: "勉強会", Since: base.Add(4 * time.Hour)}))
+	assert.Equal(t, []string{"n2"}, search(t, reopened, archive.Query{Text: "その2", Account: "example/social"}))
+}
@@ -0,0 +1,221 @@
+package archive
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wasya-io/petit-misskey/infrastructure/store"
+)
+
+type (
+	// index は保存先の1つのファイルの全文検索の索引です
+	// 書き込みの終わったファイルの索引はファイルの隣に保存し、検索するときに読み込みます
+	index struct {
+		Size     int64            // 索引を作ったときのファイルの大きさ
+		Newest   time.Time        // いちばん新しい作成日時
+		Docs     []doc            // 保存した順
+		Postings map[string][]int // 2-gramを含むDocsの位置(昇順)
+
+		seen map[string]bool // 索引に入っている種類・ID
+	}
+
+	// header は保存した索引の先頭に書く、索引の本体を読むかどうかを決めるための情報です
+	header struct {
+		Size   int64
+		Newest time.Time
+	}
+
+	// doc は索引に入れた1件です。本文の全体はファイルの位置から読みます
+	doc struct {
+		Offset    int64
+		Kind      store.Kind
+		ID        string
+		CreatedAt time.Time
+		Text      string   // 正規化した本文
+		Users     []string // 投稿者(username と username@host を小文字で)
+	}
+)
+
+const indexExt = ".idx"
+
+func newIndex() *index {
+	return &index{Postings: make(map[string][]int), seen: make(map[string]bool)}
+}
+
+// buildIndex はファイルを読んで索引を作ります
+func buildIndex(seg store.Segment) (*index, error) {
+	idx := newIndex()
+	// 読んでいる間に追記されたら次に読み込むときに作り直すよう、読む前の大きさを記録する
+	info, err := os.Stat(seg.Path)
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	idx.Size = info.Size()
+	err = store.ScanSegment(seg, func(r store.Record, offset int64) error {
+		idx.add(r, offset)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// loadIndex は保存した索引を読み込みます
+// 索引がないか、索引を作ったあとにファイルが変わっていれば作り直して保存します
+// いちばん新しい作成日時を見てskipがtrueを返せば、索引の本体は読まずにnilを返します
+func loadIndex(seg store.Segment, skip func(newest time.Time) bool) (*index, error) {
+	info, err := os.Stat(seg.Path)
+	if os.IsNotExist(err) {
+		return nil, nil // 上限を超えて消された
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	path := indexPath(seg)
+	if f, err := os.Open(path); err == nil {
+		defer f.Close()
+		dec := gob.NewDecoder(f)
+		var h header
+		if err := dec.Decode(&h); err == nil && h.Size == info.Size() {
+			if skip(h.Newest) {
+				return nil, nil
+			}
+			var idx index
+			if err := dec.Decode(&idx); err == nil {
+				return &idx, nil
+			}
+		}
+	}
+	idx, err := buildIndex(seg)
+	if err != nil {
+		return nil, err
+	}
+	// 保存できなくても検索はできるので、次に作り直すことにする
+	idx.save(path)
+	if skip(idx.Newest) {
+		return nil, nil
+	}
+	return idx, nil
+}
+
+// save は索引をpathに書き込みます
+// 索引の本体を読まずに済むよう、先に大きさといちばん新しい作成日時を書きます
+func (idx *index) save(path string) error {
+	// 書き込み途中で壊れないよう一時ファイル経由で置き換える
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+	enc := gob.NewEncoder(tmp)
+	if err := enc.Encode(header{Size: idx.Size, Newest: idx.Newest}); err != nil {
+		tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err := enc.Encode(idx); err != nil {
+		tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp.Name(), path))
+}
+
+// add はファイルのoffsetにあるrecordを索引に加えます。索引に入っていればfalseを返します
+func (idx *index) add(r store.Record, offset int64) bool {
+	if idx.has(r) {
+		return false
+	}
+	idx.seen[docKey(r.Kind, r.ID)] = true
+	d := doc{Offset: offset, Kind: r.Kind, ID: r.ID, CreatedAt: r.CreatedAt, Text: normalize(searchText(r)), Users: users(r)}
+	pos := len(idx.Docs)
+	idx.Docs = append(idx.Docs, d)
+	for _, g := range grams(d.Text) {
+		idx.Postings[g] = append(idx.Postings[g], pos)
+	}
+	if r.CreatedAt.After(idx.Newest) {
+		idx.Newest = r.CreatedAt
+	}
+	return true
+}
+
+// has はrecordが索引に入っているかどうかを返します
+func (idx *index) has(r store.Record) bool {
+	if idx.seen == nil {
+		// 読み込んだ索引には保存していないので作る
+		idx.seen = make(map[string]bool, len(idx.Docs))
+		for _, d := range idx.Docs {
+			idx.seen[docKey(d.Kind, d.ID)] = true
+		}
+	}
+	return idx.seen[docKey(r.Kind, r.ID)]
+}
+
+// search は条件に当てはまるDocsを返します
+func (idx *index) search(q Query, terms []string, user string) []doc {
+	hits := make([]doc, 0)
+	for _, pos := range idx.candidates(terms) {
+		d := idx.Docs[pos]
+		if q.Kind != "" && d.Kind != q.Kind {
+			continue
+		}
+		if !q.Since.IsZero() && d.CreatedAt.Before(q.Since) {
+			continue
+		}
+		if user != "" && !slices.Contains(d.Users, user) {
+			continue
+		}
+		// 2-gramがすべて含まれていても、続けて現れるとは限らないので本文で確かめる
+		if !containsAll(d.Text, terms) {
+			continue
+		}
+		hits = append(hits, d)
+	}
+	return hits
+}
+
+// candidates は検索語の2-gramをすべて含むDocsの位置を返します
+// 索引で絞り込めない(1文字だけの語しかない)場合はすべての位置を返します
+func (idx *index) candidates(terms []string) []int {
+	var lists [][]int
+	for _, t := range terms {
+		for _, g := range grams(t) {
+			lists = append(lists, idx.Postings[g])
+		}
+	}
+	if len(lists) == 0 {
+		all := make([]int, len(idx.Docs))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	ret := slices.Clone(lists[0])
+	for _, l := range lists[1:] {
+		ret = intersect(ret, l)
+		if len(ret) == 0 {
+			break
+		}
+	}
+	return ret
+}
+
+func docKey(kind store.Kind, id string) string {
+	return string(kind) + "/" + id
+}
+
+func indexPath(seg store.Segment) string {
+	return strings.TrimSuffix(seg.Path, filepath.Ext(seg.Path)) + indexExt
+}
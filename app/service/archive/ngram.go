@@ -0,0 +1,53 @@
+package archive
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// normalize は検索のために文字列を揃えます
+// 全角の英数字は半角に、半角カナは全角にし、英字は小文字にします
+func normalize(s string) string {
+	return strings.ToLower(width.Fold.String(s))
+}
+
+// segments は正規化した文字列を、文字と数字が続く区間に分けます
+// 空白や記号は区切りとして扱います
+func segments(s string) [][]rune {
+	var ret [][]rune
+	var cur []rune
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+			cur = append(cur, r)
+			continue
+		}
+		if len(cur) > 0 {
+			ret = append(ret, cur)
+			cur = nil
+		}
+	}
+	if len(cur) > 0 {
+		ret = append(ret, cur)
+	}
+	return ret
+}
+
+// grams は正規化した文字列から、重複のない2-gramを返します
+// 日本語は単語の区切りがないため、区間ごとに2文字ずつずらした組を索引に使います
+// 1文字だけの区間は索引に入れず、検索するときに本文と照らし合わせます
+func grams(s string) []string {
+	seen := make(map[string]bool)
+	ret := make([]string, 0)
+	for _, seg := range segments(s) {
+		for i := 0; i+1 < len(seg); i++ {
+			g := string(seg[i : i+2])
+			if !seen[g] {
+				seen[g] = true
+				ret = append(ret, g)
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,32 @@
+package archive
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var sinceLayouts = []string{"2006-01-02 15:04", "2006-01-02"}
+
+// ParseSince は検索する期間の始まりを解釈します
+// "24h" や "7d" のような今からさかのぼる期間のほか、"2026-10-01" のような日付と RFC3339 を受け付けます
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range sinceLayouts {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("期間を解釈できません: %q (例: \"24h\", \"7d\", \"2026-10-01\")", value)
+}
@@ -0,0 +1,266 @@
+// Package bot はストリーミングAPIとREST APIの上で動く、ボットの仕組みです
+//
+//	b := bot.New(client, msgCh, apiClient, bot.Options{Username: "mybot"})
+//	b.OnMention(func(c *bot.Context, note *misskey.NoteBody) error {
+//		return c.Reply(note, "pong")
+//	})
+//	b.Run(ctx)
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/domain/core"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// Bot はストリーミングで届いたイベントをハンドラに渡します
+	Bot struct {
+		client  websocket.Client
+		msgCh   <-chan tea.Msg
+		api     api.Client
+		opts    Options
+		limiter *Limiter
+		meID    string
+
+		notes     []NoteHandler
+		mentions  []NoteHandler
+		follows   []FollowHandler
+		reactions []ReactionHandler
+
+		sem chan struct{}
+		wg  sync.WaitGroup
+	}
+
+	// Options はボットの動作の設定です
+	Options struct {
+		Username        string        // ボットのユーザー名(自分のノートに反応しないために使う)
+		DryRun          bool          // 投稿やリアクションをせず、Outに書き出すだけにする
+		IgnoreBots      bool          // ほかのbotのノートにも反応しない
+		Interval        time.Duration // 投稿やリアクションの間隔(0なら制限しない)
+		Burst           int           // 間隔を空けずに続けてできる回数
+		Concurrency     int           // 同時に実行するハンドラの数(未設定なら4)
+		ShutdownTimeout time.Duration // 終了時に実行中のハンドラを待つ時間(未設定なら10秒)
+		Out             io.Writer     // dry-runの操作とハンドラのエラーの書き出し先(nilなら書き出さない)
+		Logger          core.Logger
+	}
+
+	// NoteHandler はノートを受け取るハンドラです
+	NoteHandler func(c *Context, note *misskey.NoteBody) error
+
+	// FollowHandler はフォローしてきたユーザーを受け取るハンドラです
+	FollowHandler func(c *Context, user *misskey.NoteUser) error
+
+	// ReactionHandler はリアクションの通知を受け取るハンドラです
+	ReactionHandler func(c *Context, notification *misskey.Notification) error
+)
+
+const (
+	defaultConcurrency     = 4
+	defaultShutdownTimeout = 10 * time.Second
+)
+
+// New はストリーミングのクライアントとAPIのクライアントからBotを生成します
+// msgChはclientがメッセージを送るチャネルです
+func New(client websocket.Client, msgCh <-chan tea.Msg, apiClient api.Client, opts Options) *Bot {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = defaultShutdownTimeout
+	}
+	return &Bot{
+		client:  client,
+		msgCh:   msgCh,
+		api:     apiClient,
+		opts:    opts,
+		limiter: NewLimiter(opts.Interval, opts.Burst),
+		sem:     make(chan struct{}, opts.Concurrency),
+	}
+}
+
+// OnNote はタイムラインに届いたノートのハンドラを追加します
+func (b *Bot) OnNote(h NoteHandler) {
+	b.notes = append(b.notes, h)
+}
+
+// OnMention はメンションと返信のハンドラを追加します
+func (b *Bot) OnMention(h NoteHandler) {
+	b.mentions = append(b.mentions, h)
+}
+
+// OnFollow はフォローされたときのハンドラを追加します
+func (b *Bot) OnFollow(h FollowHandler) {
+	b.follows = append(b.follows, h)
+}
+
+// OnReaction はボットのノートにリアクションが付いたときのハンドラを追加します
+func (b *Bot) OnReaction(h ReactionHandler) {
+	b.reactions = append(b.reactions, h)
+}
+
+// Run はストリーミングに接続し、ctxが終了するまでイベントをハンドラに渡します
+// 終了時は新しいイベントの受け付けをやめ、実行中のハンドラをShutdownTimeoutまで待ちます
+func (b *Bot) Run(ctx context.Context) error {
+	b.resolveMe(ctx)
+	// 通知はmainチャンネルに届く
+	if len(b.mentions)+len(b.follows)+len(b.reactions) > 0 {
+		if _, err := b.client.Subscribe(websocket.ChannelTypeMain, nil); err != nil {
+			return fmt.Errorf("通知を購読できません: %w", err)
+		}
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- b.client.Start()
+	}()
+
+	// ハンドラにはRunのctxが終了してもすぐには終了しないctxを渡す
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+
+	var runErr error
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case err := <-errCh:
+			if err != nil {
+				runErr = fmt.Errorf("ストリーミングに接続できません: %w", err)
+				break loop
+			}
+		case msg := <-b.msgCh:
+			b.handle(handlerCtx, msg)
+		}
+	}
+	b.client.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(b.opts.ShutdownTimeout):
+		b.logf("shutdown timeout: cancel running handlers")
+		cancelHandlers()
+		<-done
+	}
+	return runErr
+}
+
+// resolveMe は自分のノートを見分けるために、ボットのユーザーIDを調べます
+// 調べられない場合はユーザー名で見分けます
+func (b *Bot) resolveMe(ctx context.Context) {
+	if b.opts.Username == "" {
+		return
+	}
+	user, err := b.api.ShowUser(ctx, misskey.ShowUser{Username: b.opts.Username})
+	if err != nil {
+		b.logf("resolve user error: %v", err)
+		return
+	}
+	b.meID = user.Id
+}
+
+// handle はメッセージをイベントの種類ごとのハンドラに渡します
+func (b *Bot) handle(ctx context.Context, msg tea.Msg) {
+	switch msg := msg.(type) {
+	case websocket.NoteMessage:
+		if msg.Note == nil || len(b.notes) == 0 {
+			return
+		}
+		note := msg.Note.Body.Body
+		if b.ignore(note.User) {
+			return
+		}
+		for _, h := range b.notes {
+			b.spawn(ctx, "note", func(c *Context) error { return h(c, &note) })
+		}
+
+	case websocket.NotificationMessage:
+		n := msg.Notification
+		if n == nil {
+			return
+		}
+		switch n.Type {
+		case "mention", "reply":
+			if n.Note == nil || b.ignore(n.Note.User) {
+				return
+			}
+			for _, h := range b.mentions {
+				b.spawn(ctx, "mention", func(c *Context) error { return h(c, n.Note) })
+			}
+		case "follow":
+			if n.User == nil || b.ignore(*n.User) {
+				return
+			}
+			for _, h := range b.follows {
+				b.spawn(ctx, "follow", func(c *Context) error { return h(c, n.User) })
+			}
+		case "reaction":
+			if n.User != nil && b.ignore(*n.User) {
+				return
+			}
+			for _, h := range b.reactions {
+				b.spawn(ctx, "reaction", func(c *Context) error { return h(c, n) })
+			}
+		}
+
+	case websocket.WebSocketPingReceivedMsg:
+		b.client.Pong()
+
+	case websocket.WebSocketErrorMsg:
+		b.logf("websocket error: %v", msg.Err)
+	}
+}
+
+// ignore はボット自身(とIgnoreBotsならほかのbot)のイベントであればtrueを返します
+// 自分の投稿に反応して投稿し続けるのを防ぎます
+func (b *Bot) ignore(user misskey.NoteUser) bool {
+	if b.meID != "" && user.ID == b.meID {
+		return true
+	}
+	if b.opts.Username != "" && user.Host == nil && strings.EqualFold(user.Username, b.opts.Username) {
+		return true
+	}
+	return b.opts.IgnoreBots && user.IsBot
+}
+
+// spawn はハンドラを、同時に実行する数を制限して実行します
+func (b *Bot) spawn(ctx context.Context, event string, f func(c *Context) error) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		select {
+		case b.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		defer func() { <-b.sem }()
+		if err := f(&Context{Context: ctx, bot: b}); err != nil {
+			b.logf("%s handler error: %v", event, err)
+		}
+	}()
+}
+
+func (b *Bot) logf(format string, a ...any) {
+	msg := fmt.Sprintf(format, a...)
+	if b.opts.Logger != nil {
+		b.opts.Logger.Log("bot", msg)
+	}
+	if b.opts.Out != nil {
+		fmt.Fprintln(b.opts.Out, msg)
+	}
+}
@@ -0,0 +1,223 @@
+package bot_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/bot"
+)
+
+// streamMock はStopが呼ばれるまでStartが戻らないストリーミングのクライアントです
+type streamMock struct {
+	stop       chan struct{}
+	once       sync.Once
+	subscribed []websocket.ChannelType
+	pongs      int
+}
+
+func newStreamMock() *streamMock {
+	return &streamMock{stop: make(chan struct{})}
+}
+
+func (c *streamMock) Start() error {
+	<-c.stop
+	return nil
+}
+func (c *streamMock) Stop()                                   { c.once.Do(func() { close(c.stop) }) }
+func (c *streamMock) SetWriter(w io.Writer)                   {}
+func (c *streamMock) SetTimeline(websocket.ChannelType) error { return nil }
+func (c *streamMock) ToggleTimeline() error                   { return nil }
+func (c *streamMock) Unsubscribe(id string)                   {}
+func (c *streamMock) Pong()                                   { c.pongs++ }
+func (c *streamMock) Subscribe(channel websocket.ChannelType, params map[string]string) (string, error) {
+	c.subscribed = append(c.subscribed, channel)
+	return "main", nil
+}
+
+// apiMock は投稿とリアクションを記録するAPIクライアントです
+type apiMock struct {
+	mu        sync.Mutex
+	notes     []misskey.CreateNote
+	reactions []misskey.CreateReaction
+}
+
+func (c *apiMock) Meta(ctx context.Context, contents misskey.Meta) (*misskey.MetaResponse, error) {
+	return nil, errors.New("not implemented")
+}
+func (c *apiMock) CreateNote(ctx context.Context, contents misskey.CreateNote) (*misskey.CreateNoteResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notes = append(c.notes, contents)
+	return &misskey.CreateNoteResponse{}, nil
+}
+func (c *apiMock) CreateReaction(ctx context.Context, contents misskey.CreateReaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reactions = append(c.reactions, contents)
+	return nil
+}
+func (c *apiMock) ShowUser(ctx context.Context, contents misskey.ShowUser) (*misskey.User, error) {
+	return &misskey.User{Id: "bot-id", UserName: contents.Username}, nil
+}
+func (c *apiMock) UserNotes(ctx context.Context, contents misskey.UserNotes) ([]misskey.NoteBody, error) {
+	return nil, nil
+}
+func (c *apiMock) Emojis(ctx context.Context) ([]misskey.Emoji, error) { return nil, nil }
+func (c *apiMock) SearchUsers(ctx context.Context, contents misskey.SearchUsers) ([]misskey.User, error) {
+	return nil, nil
+}
+func (c *apiMock) SearchHashtags(ctx context.Context, contents misskey.SearchHashtags) ([]string, error) {
+	return nil, nil
+}
+func (c *apiMock) SearchNotes(ctx context.Context, contents misskey.SearchNotes) ([]misskey.NoteBody, error) {
+	return nil, nil
+}
+func (c *apiMock) SearchNotesByTag(ctx context.Context, contents misskey.SearchNotesByTag) ([]misskey.NoteBody, error) {
+	return nil, nil
+}
+func (c *apiMock) TrendHashtags(ctx context.Context) ([]misskey.HashtagTrend, error) { return nil, nil }
+func (c *apiMock) Call(ctx context.Context, endpoint string, params map[string]any) (json.RawMessage, error) {
+	return nil, errors.New("not implemented")
+}
+
+func newNote(id string, userID string, username string, text string) *misskey.Note {
+	return &misskey.Note{Body: misskey.NoteContainer{Body: misskey.NoteBody{
+		ID:         id,
+		User:       misskey.NoteUser{ID: userID, Username: username},
+		Text:       text,
+		Visibility: "public",
+	}}}
+}
+
+// run はメッセージを送ってからボットを止め、Runの戻り値を返します
+func run(t *testing.T, b *bot.Bot, msgCh chan tea.Msg, msgs ...tea.Msg) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.Run(ctx) }()
+	for _, msg := range msgs {
+		msgCh <- msg
+	}
+	// 送ったメッセージをボットが受け取るまで待つ
+	require.Eventually(t, func() bool { return len(msgCh) == 0 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestHandlers(t *testing.T) {
+	client, api := newStreamMock(), &apiMock{}
+	msgCh := make(chan tea.Msg, 10)
+	b := bot.New(client, msgCh, api, bot.Options{Username: "mybot"})
+
+	b.OnNote(func(c *bot.Context, note *misskey.NoteBody) error {
+		return c.React(note, "👍")
+	})
+	b.OnMention(func(c *bot.Context, note *misskey.NoteBody) error {
+		if cmd, _ := bot.Command(note.Text); cmd == "ping" {
+			return c.Reply(note, "pong")
+		}
+		return nil
+	})
+	b.OnFollow(func(c *bot.Context, user *misskey.NoteUser) error {
+		return c.Post(misskey.CreateNote{Text: bot.Mention(*user) + " ようこそ", Visibility: misskey.VisibilityHome})
+	})
+
+	mention := newNote("n2", "u1", "alice", "@mybot PING")
+	run(t, b, msgCh,
+		websocket.NoteMessage{Note: newNote("n1", "u1", "alice", "hello")},
+		// 自分のノートには反応しない
+		websocket.NoteMessage{Note: newNote("n3", "bot-id", "mybot", "hello")},
+		websocket.NotificationMessage{Notification: &misskey.Notification{Type: "mention", Note: &mention.Body.Body}},
+		websocket.NotificationMessage{Notification: &misskey.Notification{Type: "follow", User: &misskey.NoteUser{Username: "bob", Host: "remote.example"}}},
+		websocket.WebSocketPingReceivedMsg{},
+	)
+
+	assert.Equal(t, []websocket.ChannelType{websocket.ChannelTypeMain}, client.subscribed)
+	assert.Equal(t, 1, client.pongs)
+	assert.Equal(t, []misskey.CreateReaction{{NoteId: "n1", Reaction: "👍"}}, api.reactions)
+	assert.ElementsMatch(t, []misskey.CreateNote{
+		{Text: "@alice pong", Visibility: misskey.VisibilityHome, ReplyId: "n2"},
+		{Text: "@bob@remote.example ようこそ", Visibility: misskey.VisibilityHome},
+	}, api.notes)
+}
+
+func TestDryRun(t *testing.T) {
+	client, api := newStreamMock(), &apiMock{}
+	msgCh := make(chan tea.Msg, 10)
+	var out bytes.Buffer
+	b := bot.New(client, msgCh, api, bot.Options{Username: "mybot", DryRun: true, Concurrency: 1, Out: &out})
+	b.OnNote(func(c *bot.Context, note *misskey.NoteBody) error {
+		return c.Reply(note, "hi")
+	})
+
+	run(t, b, msgCh, websocket.NoteMessage{Note: newNote("n1", "u1", "alice", "hello")})
+	assert.Empty(t, api.notes)
+	assert.Equal(t, "[dry-run] post: @alice hi (reply to n1, home)\n", out.String())
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	client, api := newStreamMock(), &apiMock{}
+	msgCh := make(chan tea.Msg, 10)
+	b := bot.New(client, msgCh, api, bot.Options{ShutdownTimeout: 50 * time.Millisecond})
+
+	var mu sync.Mutex
+	results := make([]error, 0)
+	b.OnNote(func(c *bot.Context, note *misskey.NoteBody) error {
+		// 終了の時間内に終わらないハンドラはctxを取り消される
+		wait := 10 * time.Millisecond
+		if note.ID == "slow" {
+			wait = time.Second
+		}
+		var err error
+		select {
+		case <-time.After(wait):
+		case <-c.Done():
+			err = c.Err()
+		}
+		mu.Lock()
+		results = append(results, err)
+		mu.Unlock()
+		return err
+	})
+
+	run(t, b, msgCh,
+		websocket.NoteMessage{Note: newNote("fast", "u1", "alice", "")},
+		websocket.NoteMessage{Note: newNote("slow", "u1", "alice", "")},
+	)
+	assert.ElementsMatch(t, []error{nil, context.Canceled}, results)
+}
+
+func TestLimiter(t *testing.T) {
+	limiter := bot.NewLimiter(30*time.Millisecond, 2)
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Wait(ctx))
+	}
+	// 2回までは続けて、3回目は間隔を空ける
+	assert.GreaterOrEqual(t, time.Since(start), 25*time.Millisecond)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, limiter.Wait(canceled), context.Canceled)
+}
+
+func TestCommand(t *testing.T) {
+	cmd, args := bot.Command("@bot @other Dice 2 6")
+	assert.Equal(t, "dice", cmd)
+	assert.Equal(t, []string{"2", "6"}, args)
+	cmd, _ = bot.Command("@bot")
+	assert.Equal(t, "", cmd)
+}
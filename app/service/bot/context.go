@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// Context はハンドラに渡す、ボットとして操作するための値です
+	// 操作はレート制限の範囲で行い、dry-runなら書き出すだけにします
+	Context struct {
+		context.Context
+		bot *Bot
+	}
+)
+
+// Post はノートを投稿します
+func (c *Context) Post(note misskey.CreateNote) error {
+	if err := c.bot.limiter.Wait(c); err != nil {
+		return err
+	}
+	if c.bot.opts.DryRun {
+		c.bot.dryRun("post", describeNote(note))
+		return nil
+	}
+	_, err := c.bot.api.CreateNote(c, note)
+	return err
+}
+
+// Reply はノートに返信します
+// 公開範囲は返信先に合わせ(publicはhomeにする)、返信先の投稿者へのメンションを付けます
+func (c *Context) Reply(to *misskey.NoteBody, text string) error {
+	visibility := misskey.Visibility(to.Visibility)
+	if visibility == "" || visibility == misskey.VisibilityPublic {
+		visibility = misskey.VisibilityHome
+	}
+	return c.Post(misskey.CreateNote{
+		Text:       Mention(to.User) + " " + text,
+		Visibility: visibility,
+		ReplyId:    to.ID,
+	})
+}
+
+// React はノートにリアクションを付けます
+func (c *Context) React(to *misskey.NoteBody, reaction string) error {
+	if err := c.bot.limiter.Wait(c); err != nil {
+		return err
+	}
+	if c.bot.opts.DryRun {
+		c.bot.dryRun("react", fmt.Sprintf("%s to %s", reaction, to.ID))
+		return nil
+	}
+	return c.bot.api.CreateReaction(c, misskey.CreateReaction{NoteId: to.ID, Reaction: reaction})
+}
+
+// Mention はユーザーへのメンション(@username または @username@host)を返します
+func Mention(user misskey.NoteUser) string {
+	if host, ok := user.Host.(string); ok && host != "" {
+		return "@" + user.Username + "@" + host
+	}
+	return "@" + user.Username
+}
+
+// Command はメンションの本文から先頭のメンションを除いた、コマンドと引数を返します
+// 例: "@bot ping 1 2" → "ping", ["1", "2"]
+func Command(text string) (string, []string) {
+	fields := strings.Fields(text)
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return strings.ToLower(fields[0]), fields[1:]
+}
+
+func (b *Bot) dryRun(action string, detail string) {
+	if b.opts.Out != nil {
+		fmt.Fprintf(b.opts.Out, "[dry-run] %s: %s\n", action, detail)
+	}
+}
+
+func describeNote(note misskey.CreateNote) string {
+	text := strings.ReplaceAll(note.Text, "\n", " ")
+	if note.ReplyId != "" {
+		return fmt.Sprintf("%s (reply to %s, %s)", text, note.ReplyId, note.Visibility)
+	}
+	return fmt.Sprintf("%s (%s)", text, note.Visibility)
+}
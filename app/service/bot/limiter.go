@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// Limiter は操作の回数を、間隔ごとに1回(まとめてburst回まで)に制限します
+	Limiter struct {
+		mu       sync.Mutex
+		interval time.Duration
+		burst    float64
+		tokens   float64
+		last     time.Time
+		now      func() time.Time
+	}
+)
+
+// NewLimiter はintervalごとに1回、最大burst回まで続けて操作できるLimiterを生成します
+// intervalが0以下なら制限しません
+func NewLimiter(interval time.Duration, burst int) *Limiter {
+	burst = max(burst, 1)
+	return &Limiter{
+		interval: interval,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		now:      time.Now,
+	}
+}
+
+// Wait は操作できるようになるまで待ちます
+// 待っている間にctxが終了した場合はそのエラーを返します
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+	for {
+		delay := l.reserve()
+		if delay == 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve は操作できれば回数を1つ使って0を、できなければ次に操作できるまでの時間を返します
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+float64(now.Sub(l.last))/float64(l.interval))
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) * float64(l.interval))
+}
@@ -0,0 +1,200 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+)
+
+type (
+	// Client はデーモンのAPIをソケット越しに呼び出すクライアントです
+	Client struct {
+		http *http.Client
+		base string
+	}
+
+	// APIError はデーモンが返したエラーです
+	APIError struct {
+		StatusCode int
+		Message    string
+	}
+
+	// Events はデーモンから届くイベントの列です
+	Events struct {
+		body    io.ReadCloser
+		scanner *bufio.Scanner
+	}
+)
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("daemon: %s (%d)", e.Message, e.StatusCode)
+}
+
+// NewClient はソケットにつながるクライアントを生成します
+func NewClient(socket string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport}, base: "http://daemon"}
+}
+
+// Status はデーモンの状態を返します
+// デーモンが動いているかを調べるのにも使えます
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodGet, "/v1/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Notes はデーモンが受信した最近のノートを新しい順に返します
+// accountが空ならすべてのアカウント、limitが0なら覚えているすべてのノートを返します
+func (c *Client) Notes(ctx context.Context, account string, limit int) ([]Entry, error) {
+	query := url.Values{}
+	if account != "" {
+		query.Set("account", account)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var notes []Entry
+	if err := c.do(ctx, http.MethodGet, "/v1/notes?"+query.Encode(), nil, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// Post はデーモンを通してノートを投稿し、作成されたノートのIDを返します
+func (c *Client) Post(ctx context.Context, account string, note misskey.CreateNote) (string, error) {
+	var ret PostResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/notes", PostRequest{Account: account, Note: note}, &ret); err != nil {
+		return "", err
+	}
+	return ret.ID, nil
+}
+
+// React はデーモンを通してノートにリアクションを付けます
+func (c *Client) React(ctx context.Context, account string, noteId string, reaction string) error {
+	return c.do(ctx, http.MethodPost, "/v1/reactions", ReactionRequest{Account: account, NoteId: noteId, Reaction: reaction}, nil)
+}
+
+// Events はイベントの購読を始めます
+// typesが空ならすべての種類のイベントを受け取ります。ctxが終了すると購読も終わります
+func (c *Client) Events(ctx context.Context, account string, types []setting.HookEvent) (*Events, error) {
+	query := url.Values{}
+	if account != "" {
+		query.Set("account", account)
+	}
+	if len(types) > 0 {
+		values := make([]string, 0, len(types))
+		for _, t := range types {
+			values = append(values, string(t))
+		}
+		query.Set("type", strings.Join(values, ","))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/v1/events?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, readError(res)
+	}
+	// 添付やリアクションの多いノートは既定の上限(64KB)を超えることがあるので広げておく
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return &Events{body: res.Body, scanner: scanner}, nil
+}
+
+// Next は次のイベントを待って返します
+// 接続が閉じたらエラーを返します
+func (e *Events) Next() (hooks.Event, error) {
+	var data []byte
+	for e.scanner.Scan() {
+		line := e.scanner.Text()
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				continue
+			}
+			var ev hooks.Event
+			if err := json.Unmarshal(data, &ev); err != nil {
+				return hooks.Event{}, err
+			}
+			return ev, nil
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data:"))...)
+		}
+		// "event:" は data の type と同じなので読み飛ばし、":" で始まる行はコメント
+	}
+	if err := e.scanner.Err(); err != nil {
+		return hooks.Event{}, err
+	}
+	return hooks.Event{}, io.EOF
+}
+
+// Close は購読をやめます
+func (e *Events) Close() error {
+	return e.body.Close()
+}
+
+// do はAPIを呼び出し、応答のJSONをoutに読み込みます
+func (c *Client) do(ctx context.Context, method string, path string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return readError(res)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// readError はエラーの応答を読み込みます
+func readError(res *http.Response) error {
+	var body errorResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil || body.Error == "" {
+		body.Error = res.Status
+	}
+	return &APIError{StatusCode: res.StatusCode, Message: body.Error}
+}
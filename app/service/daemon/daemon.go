@@ -0,0 +1,389 @@
+// Package daemon はアカウントのストリーミング接続を保ち続け、
+// Unixドメインソケット上のHTTP/JSON APIで他のプロセスと共有する仕組みです
+//
+//	GET  /v1/status              接続の状態
+//	GET  /v1/notes?account=&limit= 最近届いたノート(新しい順)
+//	GET  /v1/events?account=&type= イベントの購読(Server-Sent Events)
+//	POST /v1/notes               投稿
+//	POST /v1/reactions           リアクション
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/domain/core"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+)
+
+type (
+	// Daemon はアカウントごとのストリーミング接続と、届いたノートとイベントを管理します
+	Daemon struct {
+		keys    []string
+		connect ConnectFunc
+		clients ClientFunc
+		opts    Options
+		started time.Time
+
+		mu       sync.Mutex
+		notes    []Entry // 新しい順
+		accounts map[string]*AccountStatus
+		subs     map[*subscriber]struct{}
+	}
+
+	// ConnectFunc はインスタンスキーから新しいストリーミングのクライアントを作る関数です
+	// 再接続のたびに呼ばれます
+	ConnectFunc func(key string) (websocket.Client, <-chan tea.Msg, error)
+
+	// ClientFunc はインスタンスキーからAPIクライアントを返す関数です
+	ClientFunc func(key string) (api.Client, error)
+
+	// Options はデーモンの動作の設定です
+	Options struct {
+		Recent     int           // 覚えておくノートの数(未設定なら200)
+		MinBackoff time.Duration // 再接続までの最初の待ち時間(未設定なら1秒)
+		MaxBackoff time.Duration // 再接続までの最長の待ち時間(未設定なら60秒)
+		Out        io.Writer     // 接続と切断の書き出し先(nilなら書き出さない)
+		Logger     core.Logger
+	}
+
+	// Entry はデーモンが受信したノートです
+	Entry struct {
+		Account    string            `json:"account"`
+		ReceivedAt time.Time         `json:"receivedAt"`
+		Note       *misskey.NoteBody `json:"note"`
+	}
+
+	// AccountStatus はアカウントの接続の状態です
+	AccountStatus struct {
+		Key         string     `json:"key"`
+		Connected   bool       `json:"connected"`
+		Timeline    string     `json:"timeline,omitempty"`
+		ConnectedAt *time.Time `json:"connectedAt,omitempty"`
+		Reconnects  int        `json:"reconnects"`
+		LastError   string     `json:"lastError,omitempty"`
+	}
+
+	// Status はデーモン全体の状態です
+	Status struct {
+		StartedAt   time.Time       `json:"startedAt"`
+		Accounts    []AccountStatus `json:"accounts"`
+		Notes       int             `json:"notes"`
+		Subscribers int             `json:"subscribers"`
+	}
+
+	// subscriber はイベントを購読しているクライアントです
+	subscriber struct {
+		account string
+		types   []setting.HookEvent
+		ch      chan hooks.Event
+	}
+)
+
+const (
+	defaultRecent     = 200
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = time.Minute
+	subscriberBuffer  = 100 // 購読者ごとに溜めておくイベントの上限(超えたら捨てる)
+)
+
+// ErrUnknownAccount はデーモンが扱っていないアカウントを指定されたことを表すエラーです
+var ErrUnknownAccount = errors.New("unknown account")
+
+// New はインスタンスキーの一覧からDaemonを生成します
+// 最初のキーが、アカウントを省略したときに使うアカウントになります
+func New(keys []string, connect ConnectFunc, clients ClientFunc, opts Options) *Daemon {
+	if opts.Recent <= 0 {
+		opts.Recent = defaultRecent
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(defaultMaxBackoff, opts.MinBackoff)
+	}
+	accounts := make(map[string]*AccountStatus, len(keys))
+	for _, k := range keys {
+		accounts[k] = &AccountStatus{Key: k}
+	}
+	return &Daemon{
+		keys:     slices.Clone(keys),
+		connect:  connect,
+		clients:  clients,
+		opts:     opts,
+		started:  time.Now(),
+		accounts: accounts,
+		subs:     make(map[*subscriber]struct{}),
+	}
+}
+
+// Run はすべてのアカウントに接続し、ctxが終了するまで接続を保ちます
+// 切断されたら、待ち時間を延ばしながら接続し直します
+func (d *Daemon) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, key := range d.keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.keep(ctx, key)
+		}()
+	}
+	wg.Wait()
+}
+
+// keep は1つのアカウントの接続を保ちます
+func (d *Daemon) keep(ctx context.Context, key string) {
+	backoff := d.opts.MinBackoff
+	for {
+		started := time.Now()
+		err := d.session(ctx, key)
+		if ctx.Err() != nil {
+			return
+		}
+		// しばらく接続できていたなら、待ち時間を最初に戻す
+		if time.Since(started) > d.opts.MaxBackoff {
+			backoff = d.opts.MinBackoff
+		}
+		d.disconnected(key, err)
+		d.logf("%s: disconnected: %v (reconnect in %s)", key, err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, d.opts.MaxBackoff)
+	}
+}
+
+// session は1回分の接続を、切断されるかctxが終了するまで続けます
+func (d *Daemon) session(ctx context.Context, key string) error {
+	client, msgCh, err := d.connect(key)
+	if err != nil {
+		return err
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Start()
+	}()
+	started := true
+	defer func() {
+		client.Stop()
+		// Startが戻るまでメッセージを読み捨て、クライアントの送信で止まらないようにする
+		for started {
+			select {
+			case <-errCh:
+				started = false
+			case <-msgCh:
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errCh:
+			started = false
+			if err == nil {
+				err = errors.New("connection closed")
+			}
+			return err
+		case msg := <-msgCh:
+			if err := d.handle(key, msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handle は届いたメッセージを記録して購読者に配ります
+// 切断とエラーのメッセージではエラーを返します
+func (d *Daemon) handle(key string, msg tea.Msg) error {
+	now := time.Now()
+	switch msg := msg.(type) {
+	case websocket.WebSocketConnectedMsg:
+		d.mu.Lock()
+		s := d.accounts[key]
+		s.Connected = true
+		s.Timeline = string(msg.Timeline)
+		s.ConnectedAt = &now
+		d.mu.Unlock()
+		d.logf("%s: connected (%s)", key, msg.Timeline)
+
+	case websocket.NoteMessage:
+		if msg.Note != nil {
+			body := msg.Note.Body.Body
+			d.remember(Entry{Account: key, ReceivedAt: now, Note: &body})
+		}
+	}
+	for _, ev := range hooks.Events(key, msg, now) {
+		d.publish(ev)
+	}
+
+	switch msg := msg.(type) {
+	case websocket.WebSocketDisconnectedMsg:
+		if msg.Err == nil {
+			return errors.New("disconnected")
+		}
+		return msg.Err
+	case websocket.WebSocketErrorMsg:
+		if msg.Err == nil {
+			return errors.New("connection error")
+		}
+		return msg.Err
+	}
+	return nil
+}
+
+// remember はノートを最近のノートに加えます
+// 複数のチャンネルから届いた同じノートは1つにまとめます
+func (d *Daemon) remember(entry Entry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range d.notes {
+		if e.Account == entry.Account && e.Note.ID == entry.Note.ID {
+			return
+		}
+	}
+	d.notes = slices.Insert(d.notes, 0, entry)
+	if len(d.notes) > d.opts.Recent {
+		d.notes = d.notes[:d.opts.Recent]
+	}
+}
+
+// disconnected は接続が切れたことを記録します
+func (d *Daemon) disconnected(key string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.accounts[key]
+	s.Connected = false
+	s.ConnectedAt = nil
+	s.Reconnects++
+	if err != nil {
+		s.LastError = err.Error()
+	}
+}
+
+// Notes はアカウントで受信した最近のノートを新しい順に返します
+// accountが空ならすべてのアカウントのノートを返します
+func (d *Daemon) Notes(account string, limit int) ([]Entry, error) {
+	if account != "" && !slices.Contains(d.keys, account) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAccount, account)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	notes := make([]Entry, 0)
+	for _, e := range d.notes {
+		if limit > 0 && len(notes) >= limit {
+			break
+		}
+		if account == "" || e.Account == account {
+			notes = append(notes, e)
+		}
+	}
+	return notes, nil
+}
+
+// Status はデーモンの状態を返します
+func (d *Daemon) Status() Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	accounts := make([]AccountStatus, 0, len(d.keys))
+	for _, k := range d.keys {
+		accounts = append(accounts, *d.accounts[k])
+	}
+	return Status{StartedAt: d.started, Accounts: accounts, Notes: len(d.notes), Subscribers: len(d.subs)}
+}
+
+// Post はアカウントでノートを投稿し、作成されたノートのIDを返します
+func (d *Daemon) Post(ctx context.Context, account string, note misskey.CreateNote) (string, error) {
+	client, err := d.client(account)
+	if err != nil {
+		return "", err
+	}
+	note.AccessToken = "" // トークンはデーモンのクライアントが付ける
+	ret, err := client.CreateNote(ctx, note)
+	if err != nil {
+		return "", err
+	}
+	return ret.CreatedNote.ID, nil
+}
+
+// React はアカウントでノートにリアクションを付けます
+func (d *Daemon) React(ctx context.Context, account string, noteId string, reaction string) error {
+	client, err := d.client(account)
+	if err != nil {
+		return err
+	}
+	return client.CreateReaction(ctx, misskey.CreateReaction{NoteId: noteId, Reaction: reaction})
+}
+
+// client はアカウントのAPIクライアントを返します。空なら最初のアカウントを使います
+func (d *Daemon) client(account string) (api.Client, error) {
+	if account == "" && len(d.keys) > 0 {
+		account = d.keys[0]
+	}
+	if !slices.Contains(d.keys, account) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAccount, account)
+	}
+	return d.clients(account)
+}
+
+// subscribe はイベントの購読を始めます
+// typesが空ならすべての種類のイベントを受け取ります
+func (d *Daemon) subscribe(account string, types []setting.HookEvent) (*subscriber, error) {
+	if account != "" && !slices.Contains(d.keys, account) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAccount, account)
+	}
+	sub := &subscriber{account: account, types: types, ch: make(chan hooks.Event, subscriberBuffer)}
+	d.mu.Lock()
+	d.subs[sub] = struct{}{}
+	d.mu.Unlock()
+	return sub, nil
+}
+
+// unsubscribe はイベントの購読をやめます
+func (d *Daemon) unsubscribe(sub *subscriber) {
+	d.mu.Lock()
+	delete(d.subs, sub)
+	d.mu.Unlock()
+}
+
+// publish はイベントを当てはまる購読者に配ります
+// 読み出しが追いつかない購読者のイベントは捨てます
+func (d *Daemon) publish(ev hooks.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for sub := range d.subs {
+		if sub.account != "" && sub.account != ev.Account {
+			continue
+		}
+		if len(sub.types) > 0 && !slices.Contains(sub.types, ev.Type) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+}
+
+func (d *Daemon) logf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if d.opts.Logger != nil {
+		d.opts.Logger.Log("daemon", msg)
+	}
+	if d.opts.Out != nil {
+		fmt.Fprintln(d.opts.Out, msg)
+	}
+}
@@ -0,0 +1,279 @@
+package daemon_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/daemon"
+)
+
+// fakeClient はStopされるまで戻らないストリーミングのクライアントです
+type fakeClient struct {
+	websocket.Client
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func (c *fakeClient) Start() error {
+	<-c.stopped
+	return nil
+}
+
+func (c *fakeClient) Stop() {
+	c.once.Do(func() { close(c.stopped) })
+}
+
+// fakeServer はアカウントの接続ごとに新しいメッセージのチャネルを渡します
+type fakeServer struct {
+	conns map[string]chan chan tea.Msg
+}
+
+func newFakeServer(keys ...string) *fakeServer {
+	conns := make(map[string]chan chan tea.Msg)
+	for _, k := range keys {
+		conns[k] = make(chan chan tea.Msg)
+	}
+	return &fakeServer{conns: conns}
+}
+
+func (s *fakeServer) connect(key string) (websocket.Client, <-chan tea.Msg, error) {
+	msgCh := make(chan tea.Msg)
+	s.conns[key] <- msgCh
+	return &fakeClient{stopped: make(chan struct{})}, msgCh, nil
+}
+
+// apiMock は投稿とリアクションを記録するAPIクライアントです
+type apiMock struct {
+	api.Client
+	mu        sync.Mutex
+	notes     []misskey.CreateNote
+	reactions []misskey.CreateReaction
+}
+
+func (c *apiMock) CreateNote(ctx context.Context, contents misskey.CreateNote) (*misskey.CreateNoteResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notes = append(c.notes, contents)
+	return &misskey.CreateNoteResponse{CreatedNote: misskey.NoteBody{ID: "created"}}, nil
+}
+
+func (c *apiMock) CreateReaction(ctx context.Context, contents misskey.CreateReaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reactions = append(c.reactions, contents)
+	return nil
+}
+
+func note(id string, text string) websocket.NoteMessage {
+	return websocket.NoteMessage{Note: &misskey.Note{Body: misskey.NoteContainer{Type: "note", Body: misskey.NoteBody{ID: id, Text: text}}}}
+}
+
+// start はデーモンを動かし、ソケットにつながるクライアントを返します
+func start(t *testing.T, server *fakeServer, apiClient api.Client) (*daemon.Daemon, *daemon.Client) {
+	d := daemon.New([]string{"io", "design"}, server.connect, func(key string) (api.Client, error) { return apiClient, nil },
+		daemon.Options{Recent: 2, MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+	listener, err := daemon.Listen(socket)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		d.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, d.Serve(ctx, listener))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	return d, daemon.NewClient(socket)
+}
+
+// accept はアカウントの接続を受け付け、接続できたことを知らせます
+func (s *fakeServer) accept(t *testing.T, key string) chan tea.Msg {
+	select {
+	case msgCh := <-s.conns[key]:
+		msgCh <- websocket.WebSocketConnectedMsg{Timeline: websocket.ChannelTypeHome}
+		return msgCh
+	case <-time.After(2 * time.Second):
+		t.Fatal("接続されません")
+		return nil
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	server := newFakeServer("io", "design")
+	apiClient := &apiMock{}
+	_, client := start(t, server, apiClient)
+	first, second := server.accept(t, "io"), server.accept(t, "design")
+	ctx := context.Background()
+
+	events, err := client.Events(ctx, "", []setting.HookEvent{setting.HookEventNote})
+	require.NoError(t, err)
+	defer events.Close()
+
+	for i, id := range []string{"n1", "n2", "n3"} {
+		if i%2 == 0 {
+			first <- note(id, "hello "+id)
+		} else {
+			second <- note(id, "hello "+id)
+		}
+		ev, err := events.Next()
+		require.NoError(t, err)
+		assert.Equal(t, setting.HookEventNote, ev.Type)
+		assert.Equal(t, id, ev.Note.ID)
+	}
+
+	// 覚えておくのは新しいものから Recent 件まで
+	notes, err := client.Notes(ctx, "", 0)
+	require.NoError(t, err)
+	require.Len(t, notes, 2)
+	assert.Equal(t, "n3", notes[0].Note.ID)
+	assert.Equal(t, "n2", notes[1].Note.ID)
+	notes, err = client.Notes(ctx, "design", 0)
+	require.NoError(t, err)
+	require.Len(t, notes, 1)
+	assert.Equal(t, "design", notes[0].Account)
+
+	_, err = client.Notes(ctx, "unknown", 0)
+	var apiErr *daemon.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 404, apiErr.StatusCode)
+
+	status, err := client.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, status.Accounts[0].Connected)
+	assert.Equal(t, "homeTimeline", status.Accounts[0].Timeline)
+	assert.Equal(t, 1, status.Subscribers)
+
+	id, err := client.Post(ctx, "", misskey.CreateNote{Text: "hi", Visibility: misskey.VisibilityHome, AccessToken: "leak"})
+	require.NoError(t, err)
+	assert.Equal(t, "created", id)
+	require.NoError(t, client.React(ctx, "design", "n1", "👍"))
+	_, err = client.Post(ctx, "", misskey.CreateNote{Text: " "})
+	assert.ErrorContains(t, err, "text is empty")
+
+	assert.Equal(t, []misskey.CreateNote{{Text: "hi", Visibility: misskey.VisibilityHome}}, apiClient.notes)
+	assert.Equal(t, []misskey.CreateReaction{{NoteId: "n1", Reaction: "👍"}}, apiClient.reactions)
+}
+
+func TestReconnect(t *testing.T) {
+	server := newFakeServer("io", "design")
+	d, client := start(t, server, &apiMock{})
+	first := server.accept(t, "io")
+	server.accept(t, "design")
+
+	events, err := client.Events(context.Background(), "io", []setting.HookEvent{setting.HookEventDisconnect})
+	require.NoError(t, err)
+	defer events.Close()
+
+	first <- websocket.WebSocketDisconnectedMsg{Err: errors.New("reset")}
+	ev, err := events.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "reset", ev.Error)
+
+	// 切断されたら新しいクライアントで接続し直す
+	server.accept(t, "io")
+	assert.Eventually(t, func() bool {
+		s := d.Status().Accounts[0]
+		return s.Connected && s.Reconnects == 1 && s.LastError == "reset"
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestShutdown(t *testing.T) {
+	server := newFakeServer("io", "design")
+	d := daemon.New([]string{"io", "design"}, server.connect, nil, daemon.Options{})
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+	listener, err := daemon.Listen(socket)
+	require.NoError(t, err)
+
+	// 動いているデーモンがあれば起動しない
+	_, err = daemon.Listen(socket)
+	assert.ErrorIs(t, err, daemon.ErrRunning)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- d.Serve(ctx, listener) }()
+
+	events, err := daemon.NewClient(socket).Events(context.Background(), "", nil)
+	require.NoError(t, err)
+	defer events.Close()
+
+	// 終了すると購読中の接続も閉じる
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("終了しません")
+	}
+	_, err = events.Next()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// 終了した後は同じ場所で起動し直せる
+	listener, err = daemon.Listen(socket)
+	require.NoError(t, err)
+	listener.Close()
+}
+
+func TestStreamClient(t *testing.T) {
+	server := newFakeServer("io", "design")
+	_, client := start(t, server, &apiMock{})
+	first := server.accept(t, "io")
+	server.accept(t, "design")
+
+	stream, msgCh := daemon.NewStreamClient(client, "io")
+	mainId, err := stream.Subscribe(websocket.ChannelTypeMain, nil)
+	require.NoError(t, err)
+	_, err = stream.Subscribe(websocket.ChannelTypeAntenna, map[string]string{"antennaId": "a"})
+	assert.ErrorIs(t, err, daemon.ErrNotSupported)
+	go stream.Start()
+	defer stream.Stop()
+
+	receive := func() tea.Msg {
+		select {
+		case msg := <-msgCh:
+			return msg
+		case <-time.After(2 * time.Second):
+			t.Fatal("メッセージが届きません")
+			return nil
+		}
+	}
+	assert.Equal(t, websocket.WebSocketConnectedMsg{Timeline: websocket.ChannelTypeHome}, receive())
+
+	first <- note("n1", "hello")
+	msg, ok := receive().(websocket.NoteMessage)
+	require.True(t, ok)
+	assert.Equal(t, "hello", msg.Note.Body.Body.Text)
+
+	// 64KBを超えるイベントでも購読が切れない
+	long := strings.Repeat("あ", 100*1024)
+	first <- note("n2", long)
+	msg, ok = receive().(websocket.NoteMessage)
+	require.True(t, ok)
+	assert.Equal(t, long, msg.Note.Body.Body.Text)
+
+	first <- websocket.NotificationMessage{Notification: &misskey.Notification{ID: "x", Type: "follow"}}
+	notification, ok := receive().(websocket.NotificationMessage)
+	require.True(t, ok)
+	assert.Equal(t, mainId, notification.ChannelId)
+	assert.Equal(t, "x", notification.Notification.ID)
+}
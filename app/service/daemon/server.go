@@ -0,0 +1,270 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/xdg"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// PostRequest は POST /v1/notes の本文です
+	PostRequest struct {
+		Account string             `json:"account,omitempty"` // 省略したら最初のアカウント
+		Note    misskey.CreateNote `json:"note"`
+	}
+
+	// PostResponse は POST /v1/notes の応答です
+	PostResponse struct {
+		ID string `json:"id"`
+	}
+
+	// ReactionRequest は POST /v1/reactions の本文です
+	ReactionRequest struct {
+		Account  string `json:"account,omitempty"` // 省略したら最初のアカウント
+		NoteId   string `json:"noteId"`
+		Reaction string `json:"reaction"`
+	}
+
+	// errorResponse はエラーの応答です
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+const (
+	// SocketEnv はソケットの場所を指定する環境変数です
+	SocketEnv = "PETIT_MISSKEY_SOCKET"
+
+	heartbeatInterval = 30 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+// ErrRunning はすでに別のデーモンがソケットを使っていることを表すエラーです
+var ErrRunning = errors.New("daemon is already running")
+
+// SocketPath はデーモンのソケットの場所を返します
+// 環境変数 PETIT_MISSKEY_SOCKET があればそれを使います
+func SocketPath() (string, error) {
+	if path := os.Getenv(SocketEnv); path != "" {
+		return path, nil
+	}
+	dir, err := xdg.RuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "daemon.sock"), nil
+}
+
+// Listen はソケットを開きます
+// 前回のデーモンが残したソケットは消し、動いているデーモンがあればErrRunningを返します
+func Listen(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: %s", ErrRunning, path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// ソケットを使えるのは自分だけにする
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// Handler はデーモンのHTTP APIのハンドラを返します
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", d.handleStatus)
+	mux.HandleFunc("GET /v1/notes", d.handleNotes)
+	mux.HandleFunc("GET /v1/events", d.handleEvents)
+	mux.HandleFunc("POST /v1/notes", d.handlePost)
+	mux.HandleFunc("POST /v1/reactions", d.handleReaction)
+	return mux
+}
+
+// Serve はctxが終了するまでlistenerでAPIを提供します
+// 終了時は購読中の接続を閉じ、処理中のリクエストを待ってから戻ります
+func (d *Daemon) Serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{
+		Handler:     d.Handler(),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Serve(listener)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, d.Status())
+}
+
+func (d *Daemon) handleNotes(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %s", v))
+			return
+		}
+		limit = n
+	}
+	notes, err := d.Notes(r.URL.Query().Get("account"), limit)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, notes)
+}
+
+// handleEvents はイベントをServer-Sent Eventsで送り続けます
+// 1件ごとに "event: 種類" と "data: JSON" を書き、定期的にコメント行で接続を保ちます
+func (d *Daemon) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	types, err := parseTypes(r.URL.Query().Get("type"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	sub, err := d.subscribe(r.URL.Query().Get("account"), types)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	defer d.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case ev := <-sub.ch:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func (d *Daemon) handlePost(w http.ResponseWriter, r *http.Request) {
+	var req PostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(req.Note.Text) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("text is empty"))
+		return
+	}
+	id, err := d.Post(r.Context(), req.Account, req.Note)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, PostResponse{ID: id})
+}
+
+func (d *Daemon) handleReaction(w http.ResponseWriter, r *http.Request) {
+	var req ReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.NoteId == "" || req.Reaction == "" {
+		writeError(w, http.StatusBadRequest, errors.New("noteId and reaction are required"))
+		return
+	}
+	if err := d.React(r.Context(), req.Account, req.NoteId, req.Reaction); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseTypes はカンマ区切りのイベントの種類を分割します
+func parseTypes(value string) ([]setting.HookEvent, error) {
+	if value == "" {
+		return nil, nil
+	}
+	types := make([]setting.HookEvent, 0)
+	for _, v := range strings.Split(value, ",") {
+		typ := setting.HookEvent(strings.TrimSpace(v))
+		if !slices.Contains(setting.HookEvents(), typ) {
+			return nil, fmt.Errorf("unknown event type: %s", v)
+		}
+		types = append(types, typ)
+	}
+	return types, nil
+}
+
+// statusOf はエラーに対応するHTTPのステータスを返します
+func statusOf(err error) int {
+	if errors.Is(err, ErrUnknownAccount) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadGateway
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,157 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// streamClient はデーモンのイベントをストリーミングのクライアントとして扱うためのアダプタです
+	// TUIはデーモンの接続を共有して、自分では接続しません
+	streamClient struct {
+		client  *Client
+		account string
+		msgCh   chan tea.Msg
+		ctx     context.Context
+		cancel  context.CancelFunc
+
+		mu    sync.Mutex
+		mains []string // 購読しているmainチャンネルのID
+		next  int
+	}
+)
+
+const retryInterval = 3 * time.Second
+
+// ErrNotSupported はデーモン経由では使えない操作であることを表すエラーです
+var ErrNotSupported = errors.New("not supported via daemon")
+
+// NewStreamClient はデーモンのアカウントのイベントを受け取るストリーミングのクライアントを生成します
+// タイムラインはデーモンが接続しているものになり、切り替えはできません
+func NewStreamClient(c *Client, account string) (websocket.Client, chan tea.Msg) {
+	ctx, cancel := context.WithCancel(context.Background())
+	msgCh := make(chan tea.Msg, 100)
+	return &streamClient{client: c, account: account, msgCh: msgCh, ctx: ctx, cancel: cancel}, msgCh
+}
+
+// Start はデーモンのイベントの購読を、Stopが呼ばれるまで続けます
+// デーモンとの接続が切れたら、つなぎ直します
+func (s *streamClient) Start() error {
+	for s.ctx.Err() == nil {
+		err := s.receive()
+		if s.ctx.Err() != nil {
+			break
+		}
+		s.send(websocket.WebSocketDisconnectedMsg{Err: err})
+		select {
+		case <-s.ctx.Done():
+		case <-time.After(retryInterval):
+		}
+	}
+	return nil
+}
+
+// receive は1回分の購読を続けます
+func (s *streamClient) receive() error {
+	status, err := s.client.Status(s.ctx)
+	if err != nil {
+		return err
+	}
+	var timeline websocket.ChannelType
+	for _, a := range status.Accounts {
+		if a.Key == s.account {
+			timeline = websocket.ChannelType(a.Timeline)
+		}
+	}
+	events, err := s.client.Events(s.ctx, s.account, []setting.HookEvent{setting.HookEventNote, setting.HookEventNotification})
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+	s.send(websocket.WebSocketConnectedMsg{Timeline: timeline})
+
+	for {
+		ev, err := events.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("daemon closed the connection")
+			}
+			return err
+		}
+		switch ev.Type {
+		case setting.HookEventNote:
+			if ev.Note == nil {
+				continue
+			}
+			s.send(websocket.NoteMessage{Note: &misskey.Note{Body: misskey.NoteContainer{Type: "note", Body: *ev.Note}}})
+		case setting.HookEventNotification:
+			s.mu.Lock()
+			mains := append([]string(nil), s.mains...)
+			s.mu.Unlock()
+			for _, id := range mains {
+				s.send(websocket.NotificationMessage{ChannelId: id, Notification: ev.Notification})
+			}
+		}
+	}
+}
+
+func (s *streamClient) send(msg tea.Msg) {
+	select {
+	case s.msgCh <- msg:
+	case <-s.ctx.Done():
+	}
+}
+
+// Stop は購読を終了します
+func (s *streamClient) Stop() {
+	s.cancel()
+}
+
+func (s *streamClient) SetWriter(w io.Writer) {}
+
+// SetTimeline はデーモンの接続を共有しているため、切り替えられません
+func (s *streamClient) SetTimeline(timelineType websocket.ChannelType) error {
+	return fmt.Errorf("タイムラインを切り替えられません: %w", ErrNotSupported)
+}
+
+// ToggleTimeline はデーモンの接続を共有しているため、切り替えられません
+func (s *streamClient) ToggleTimeline() error {
+	return fmt.Errorf("タイムラインを切り替えられません: %w", ErrNotSupported)
+}
+
+// Subscribe はmainチャンネルだけを購読できます
+// 通知はデーモンのmainチャンネルから届いたものを、返したIDで送ります
+func (s *streamClient) Subscribe(channel websocket.ChannelType, params map[string]string) (string, error) {
+	if channel != websocket.ChannelTypeMain {
+		return "", fmt.Errorf("%s を購読できません: %w", channel, ErrNotSupported)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	id := fmt.Sprintf("main-%d", s.next)
+	s.mains = append(s.mains, id)
+	return id, nil
+}
+
+func (s *streamClient) Unsubscribe(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, m := range s.mains {
+		if m == id {
+			s.mains = append(s.mains[:i], s.mains[i+1:]...)
+			return
+		}
+	}
+}
+
+// Pong はデーモンとの接続では不要です
+func (s *streamClient) Pong() {}
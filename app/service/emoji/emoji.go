@@ -0,0 +1,159 @@
+package emoji
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// Catalog はインスタンスのカスタム絵文字の一覧です
+	// 取得した一覧はディスクにキャッシュし、ストリームで追加されたものも反映します
+	Catalog struct {
+		client api.Client
+		file   *cache.File
+		ttl    time.Duration
+		mu     sync.RWMutex
+		emojis map[string]misskey.Emoji
+	}
+)
+
+func NewCatalog(client api.Client, file *cache.File, ttl time.Duration) *Catalog {
+	return &Catalog{
+		client: client,
+		file:   file,
+		ttl:    ttl,
+		emojis: make(map[string]misskey.Emoji),
+	}
+}
+
+// Load は有効期限内のキャッシュがあればそれを、なければインスタンスから一覧を読み込みます
+// 取得に失敗した場合でも、期限切れのキャッシュがあればそれを使います
+func (c *Catalog) Load(ctx context.Context) error {
+	cached := make([]misskey.Emoji, 0)
+	fresh := false
+	if c.file != nil {
+		var err error
+		if fresh, err = c.file.Read(&cached, c.ttl); err != nil {
+			cached = cached[:0]
+		}
+	}
+	if fresh {
+		c.set(cached)
+		return nil
+	}
+
+	emojis, err := c.client.Emojis(ctx)
+	if err != nil {
+		if len(cached) > 0 {
+			c.set(cached)
+			return nil
+		}
+		return err
+	}
+	c.set(emojis)
+	return c.save()
+}
+
+// Add はストリームで追加を通知された絵文字を一覧に加えます
+// キャッシュファイルは書き換えません(更新日時が変わると有効期限が延びてしまうため)
+func (c *Catalog) Add(emoji misskey.Emoji) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.emojis[emoji.Name] = emoji
+}
+
+// Lookup は名前(:を除く)に対応する絵文字を返します
+func (c *Catalog) Lookup(name string) (misskey.Emoji, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	emoji, ok := c.emojis[name]
+	return emoji, ok
+}
+
+// Len は絵文字の数を返します
+func (c *Catalog) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.emojis)
+}
+
+// Search は名前かエイリアスにqueryを含む絵文字を最大limit件返します
+// 前方一致するものを先に、それぞれ名前順で並べます
+func (c *Catalog) Search(query string, limit int) []misskey.Emoji {
+	query = strings.ToLower(strings.Trim(query, ":"))
+	c.mu.RLock()
+	prefix := make([]misskey.Emoji, 0)
+	contains := make([]misskey.Emoji, 0)
+	for _, emoji := range c.emojis {
+		switch matchEmoji(emoji, query) {
+		case matchPrefix:
+			prefix = append(prefix, emoji)
+		case matchContains:
+			contains = append(contains, emoji)
+		}
+	}
+	c.mu.RUnlock()
+
+	byName := func(emojis []misskey.Emoji) {
+		sort.Slice(emojis, func(i, j int) bool { return emojis[i].Name < emojis[j].Name })
+	}
+	byName(prefix)
+	byName(contains)
+	ret := append(prefix, contains...)
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret
+}
+
+type match int
+
+const (
+	matchNone match = iota
+	matchContains
+	matchPrefix
+)
+
+func matchEmoji(emoji misskey.Emoji, query string) match {
+	best := matchNone
+	for _, name := range append([]string{emoji.Name}, emoji.Aliases...) {
+		name = strings.ToLower(name)
+		switch {
+		case strings.HasPrefix(name, query):
+			return matchPrefix
+		case strings.Contains(name, query):
+			best = matchContains
+		}
+	}
+	return best
+}
+
+func (c *Catalog) set(emojis []misskey.Emoji) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.emojis = make(map[string]misskey.Emoji, len(emojis))
+	for _, emoji := range emojis {
+		c.emojis[emoji.Name] = emoji
+	}
+}
+
+func (c *Catalog) save() error {
+	if c.file == nil {
+		return nil
+	}
+	c.mu.RLock()
+	emojis := make([]misskey.Emoji, 0, len(c.emojis))
+	for _, emoji := range c.emojis {
+		emojis = append(emojis, emoji)
+	}
+	c.mu.RUnlock()
+	sort.Slice(emojis, func(i, j int) bool { return emojis[i].Name < emojis[j].Name })
+	return c.file.Write(emojis)
+}
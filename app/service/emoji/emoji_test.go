@@ -0,0 +1,71 @@
+package emoji_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/emoji"
+)
+
+type fakeClient struct {
+	api.Client
+	emojis []misskey.Emoji
+	err    error
+	calls  int
+}
+
+func (c *fakeClient) Emojis(ctx context.Context) ([]misskey.Emoji, error) {
+	c.calls++
+	return c.emojis, c.err
+}
+
+func TestCatalogCache(t *testing.T) {
+	file := cache.NewFileAt(filepath.Join(t.TempDir(), "emojis.json"))
+	client := &fakeClient{emojis: []misskey.Emoji{{Name: "blobcat"}, {Name: "ai_yay", Aliases: []string{"ai"}}}}
+
+	catalog := emoji.NewCatalog(client, file, time.Hour)
+	assert.NoError(t, catalog.Load(context.Background()))
+	assert.Equal(t, 2, catalog.Len())
+
+	// 有効期限内はキャッシュから読み込む
+	cached := emoji.NewCatalog(client, file, time.Hour)
+	assert.NoError(t, cached.Load(context.Background()))
+	assert.Equal(t, 1, client.calls)
+	_, ok := cached.Lookup("blobcat")
+	assert.True(t, ok)
+
+	// 期限切れでも取得に失敗したらキャッシュを使う
+	client.err = errors.New("offline")
+	stale := emoji.NewCatalog(client, file, 0)
+	assert.NoError(t, stale.Load(context.Background()))
+	assert.Equal(t, 2, stale.Len())
+
+	// 追加した絵文字はメモリ上の一覧だけに加え、キャッシュの有効期限は延ばさない
+	stale.Add(misskey.Emoji{Name: "new"})
+	assert.Equal(t, 3, stale.Len())
+	client.err = nil
+	reloaded := emoji.NewCatalog(client, file, time.Nanosecond)
+	assert.NoError(t, reloaded.Load(context.Background()))
+	assert.Equal(t, 3, client.calls)
+}
+
+func TestCatalogSearch(t *testing.T) {
+	catalog := emoji.NewCatalog(&fakeClient{emojis: []misskey.Emoji{
+		{Name: "blobcat"}, {Name: "awesome_blob"}, {Name: "ai_yay", Aliases: []string{"blobai"}}, {Name: "other"},
+	}}, nil, 0)
+	assert.NoError(t, catalog.Load(context.Background()))
+
+	names := make([]string, 0)
+	for _, e := range catalog.Search(":blob", 0) {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"ai_yay", "blobcat", "awesome_blob"}, names)
+	assert.Len(t, catalog.Search("blob", 1), 1)
+}
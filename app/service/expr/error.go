@@ -0,0 +1,37 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+type (
+	// Error は式の誤りと、その位置です
+	Error struct {
+		Src string
+		Pos int // 式の先頭からのバイト位置
+		Msg string
+	}
+)
+
+func newError(src string, pos int, format string, a ...any) *Error {
+	return &Error{Src: src, Pos: pos, Msg: fmt.Sprintf(format, a...)}
+}
+
+// Column は誤りのある位置が何文字目かを返します(1始まり)
+func (e *Error) Column() int {
+	return utf8.RuneCountInString(e.Src[:e.Pos]) + 1
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d文字目: %s", e.Column(), e.Msg)
+}
+
+// Detail は式と誤りのある位置を示す行を、エラーの説明とともに返します
+func (e *Error) Detail() string {
+	caret := strings.Repeat(" ", runewidth.StringWidth(e.Src[:e.Pos])) + "^"
+	return fmt.Sprintf("%s\n%s\n%s", e.Src, caret, e.Error())
+}
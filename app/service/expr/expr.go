@@ -0,0 +1,393 @@
+// Package expr はノートを絞り込む小さな式言語です
+//
+//	user.isBot == false && (text =~ "deploy" || "#ops" in tags) && visibility != "specified"
+//
+// 式はCompileで構文と型を確かめてから、Matchでノートごとに評価します
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// Program はコンパイル済みの式です
+	Program struct {
+		src  string
+		root *node
+	}
+
+	// Type は式の値の型です
+	Type int
+
+	// node は型を確かめた式の木の節です
+	node struct {
+		typ  Type
+		pos  int
+		lit  any // リテラルならその値(それ以外はnil)
+		eval func(env *Env) any
+	}
+
+	parser struct {
+		src    string
+		tokens []token
+		i      int
+	}
+)
+
+// comparisons は比較の演算子です(in は識別子として扱う)
+var comparisons = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "=~": true, "!~": true,
+}
+
+const (
+	TypeBool Type = iota
+	TypeString
+	TypeNumber
+	TypeList // 文字列のリスト
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeBool:
+		return "bool"
+	case TypeString:
+		return "string"
+	case TypeNumber:
+		return "number"
+	case TypeList:
+		return "list"
+	}
+	return "unknown"
+}
+
+// Compile は式を解釈し、型を確かめます
+// 誤りがあれば位置を含む*Errorを返します
+func Compile(src string) (*Program, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, newError(src, 0, "式が空です")
+	}
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, newError(src, t.pos, "%q は余分です(&& か || でつなぎます)", t.text)
+	}
+	if root.typ != TypeBool {
+		return nil, newError(src, root.pos, "式の結果が bool ではありません (%s)", root.typ)
+	}
+	return &Program{src: src, root: root}, nil
+}
+
+// MustCompile はCompileと同じですが、誤りがあればpanicします
+func MustCompile(src string) *Program {
+	p, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Match はノートが式に当てはまるかを返します
+func (p *Program) Match(note *misskey.Note) bool {
+	return p.root.eval(newEnv(note)).(bool)
+}
+
+func (p *Program) String() string {
+	return p.src
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokenOp && t.text == op
+}
+
+func (p *parser) errorf(pos int, format string, a ...any) error {
+	return newError(p.src, pos, format, a...)
+}
+
+// parseOr は a || b を読みます(最も優先順位が低い)
+func (p *parser) parseOr() (*node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		op := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(op, left, right); err != nil {
+			return nil, err
+		}
+		l, r := left.eval, right.eval
+		left = &node{typ: TypeBool, pos: left.pos, eval: func(env *Env) any {
+			return l(env).(bool) || r(env).(bool)
+		}}
+	}
+	return left, nil
+}
+
+// parseAnd は a && b を読みます
+func (p *parser) parseAnd() (*node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		op := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(op, left, right); err != nil {
+			return nil, err
+		}
+		l, r := left.eval, right.eval
+		left = &node{typ: TypeBool, pos: left.pos, eval: func(env *Env) any {
+			return l(env).(bool) && r(env).(bool)
+		}}
+	}
+	return left, nil
+}
+
+func (p *parser) checkBool(op token, left, right *node) error {
+	if left.typ != TypeBool {
+		return p.errorf(left.pos, "%s の左辺が bool ではありません (%s)", op.text, left.typ)
+	}
+	if right.typ != TypeBool {
+		return p.errorf(right.pos, "%s の右辺が bool ではありません (%s)", op.text, right.typ)
+	}
+	return nil
+}
+
+// parseNot は !a を読みます
+func (p *parser) parseNot() (*node, error) {
+	if !p.isOp("!") {
+		return p.parseCompare()
+	}
+	op := p.next()
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if operand.typ != TypeBool {
+		return nil, p.errorf(operand.pos, "! の対象が bool ではありません (%s)", operand.typ)
+	}
+	eval := operand.eval
+	return &node{typ: TypeBool, pos: op.pos, eval: func(env *Env) any {
+		return !eval(env).(bool)
+	}}, nil
+}
+
+// parseCompare は a == b、a =~ "re"、a in b などの比較を読みます
+func (p *parser) parseCompare() (*node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if !(t.kind == tokenIdent && t.text == "in") && !(t.kind == tokenOp && comparisons[t.text]) {
+		return left, nil
+	}
+	op := p.next()
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.text {
+	case "==", "!=":
+		return p.equal(op, left, right)
+	case "<", "<=", ">", ">=":
+		return p.order(op, left, right)
+	case "=~", "!~":
+		return p.match(op, left, right)
+	default:
+		return p.in(op, left, right)
+	}
+}
+
+func (p *parser) equal(op token, left, right *node) (*node, error) {
+	if left.typ == TypeList || right.typ == TypeList {
+		return nil, p.errorf(op.pos, "list は %s で比べられません(in を使います)", op.text)
+	}
+	if left.typ != right.typ {
+		return nil, p.errorf(op.pos, "%s の両辺の型が違います (%s と %s)", op.text, left.typ, right.typ)
+	}
+	l, r, negate := left.eval, right.eval, op.text == "!="
+	return &node{typ: TypeBool, pos: left.pos, eval: func(env *Env) any {
+		return (l(env) == r(env)) != negate
+	}}, nil
+}
+
+func (p *parser) order(op token, left, right *node) (*node, error) {
+	if left.typ != right.typ || (left.typ != TypeNumber && left.typ != TypeString) {
+		return nil, p.errorf(op.pos, "%s で比べられるのは number 同士か string 同士です (%s と %s)", op.text, left.typ, right.typ)
+	}
+	l, r := left.eval, right.eval
+	cmp := func(env *Env) int {
+		if left.typ == TypeNumber {
+			a, b := l(env).(float64), r(env).(float64)
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+		return strings.Compare(l(env).(string), r(env).(string))
+	}
+	var ok func(int) bool
+	switch op.text {
+	case "<":
+		ok = func(c int) bool { return c < 0 }
+	case "<=":
+		ok = func(c int) bool { return c <= 0 }
+	case ">":
+		ok = func(c int) bool { return c > 0 }
+	default:
+		ok = func(c int) bool { return c >= 0 }
+	}
+	return &node{typ: TypeBool, pos: left.pos, eval: func(env *Env) any {
+		return ok(cmp(env))
+	}}, nil
+}
+
+func (p *parser) match(op token, left, right *node) (*node, error) {
+	if left.typ != TypeString {
+		return nil, p.errorf(left.pos, "%s の左辺は string です (%s)", op.text, left.typ)
+	}
+	pattern, ok := right.lit.(string)
+	if !ok {
+		return nil, p.errorf(right.pos, "%s の右辺は文字列で書いた正規表現です", op.text)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, p.errorf(right.pos, "正規表現 %q を解釈できません: %v", pattern, err)
+	}
+	l, negate := left.eval, op.text == "!~"
+	return &node{typ: TypeBool, pos: left.pos, eval: func(env *Env) any {
+		return re.MatchString(l(env).(string)) != negate
+	}}, nil
+}
+
+// in はリストに含まれるか、文字列に含まれるかを大文字小文字を区別せずに調べます
+func (p *parser) in(op token, left, right *node) (*node, error) {
+	if left.typ != TypeString {
+		return nil, p.errorf(left.pos, "in の左辺は string です (%s)", left.typ)
+	}
+	l, r := left.eval, right.eval
+	switch right.typ {
+	case TypeList:
+		return &node{typ: TypeBool, pos: left.pos, eval: func(env *Env) any {
+			v := l(env).(string)
+			for _, item := range r(env).([]string) {
+				if strings.EqualFold(item, v) {
+					return true
+				}
+			}
+			return false
+		}}, nil
+	case TypeString:
+		return &node{typ: TypeBool, pos: left.pos, eval: func(env *Env) any {
+			return strings.Contains(strings.ToLower(r(env).(string)), strings.ToLower(l(env).(string)))
+		}}, nil
+	}
+	return nil, p.errorf(right.pos, "in の右辺は list か string です (%s)", right.typ)
+}
+
+// parsePrimary は括弧、リスト、リテラル、フィールドを読みます
+func (p *parser) parsePrimary() (*node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return literal(TypeString, t.pos, t.text), nil
+	case tokenNumber:
+		return literal(TypeNumber, t.pos, t.num), nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return literal(TypeBool, t.pos, t.text == "true"), nil
+		case "null", "nil":
+			return nil, p.errorf(t.pos, "%s は使えません(値がなければ空文字 \"\" か 0 になります)", t.text)
+		case "in":
+			return nil, p.errorf(t.pos, "in の左辺がありません")
+		}
+		f, ok := lookupField(t.text)
+		if !ok {
+			msg := fmt.Sprintf("フィールド %q はありません", t.text)
+			if s := suggest(t.text); s != "" {
+				msg += fmt.Sprintf("(%s のことですか?)", s)
+			}
+			return nil, p.errorf(t.pos, "%s", msg)
+		}
+		get := f.get
+		return &node{typ: f.Type, pos: t.pos, eval: get}, nil
+	case tokenOp:
+		switch t.text {
+		case "(":
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOp(")") {
+				return nil, p.errorf(p.peek().pos, "( に対応する ) がありません")
+			}
+			p.next()
+			inner.pos = t.pos
+			return inner, nil
+		case "[":
+			return p.parseList(t)
+		}
+		return nil, p.errorf(t.pos, "%q の前に値がありません", t.text)
+	}
+	return nil, p.errorf(t.pos, "式が途中で終わっています")
+}
+
+// parseList は ["a", "b"] のような文字列のリストを読みます
+func (p *parser) parseList(open token) (*node, error) {
+	items := make([]string, 0)
+	for !p.isOp("]") {
+		if len(items) > 0 {
+			if !p.isOp(",") {
+				return nil, p.errorf(p.peek().pos, "リストの要素は , で区切ります")
+			}
+			p.next()
+		}
+		t := p.next()
+		if t.kind != tokenString {
+			return nil, p.errorf(t.pos, "リストの要素は文字列です")
+		}
+		items = append(items, t.text)
+	}
+	p.next()
+	return literal(TypeList, open.pos, items), nil
+}
+
+func literal(typ Type, pos int, v any) *node {
+	return &node{typ: typ, pos: pos, lit: v, eval: func(*Env) any { return v }}
+}
@@ -0,0 +1,99 @@
+package expr_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/expr"
+)
+
+func newNote(text string) *misskey.Note {
+	return &misskey.Note{Body: misskey.NoteContainer{Body: misskey.NoteBody{
+		ID:         "1",
+		User:       misskey.NoteUser{Username: "alice", Host: "remote.example"},
+		Text:       text,
+		Visibility: "public",
+		Reactions:  map[string]int{"👍": 2, ":cat:": 1},
+	}}}
+}
+
+func TestMatch(t *testing.T) {
+	note := newNote("本番に deploy しました #Ops")
+	bot := newNote("deploy")
+	bot.Body.Body.User.IsBot = true
+	specified := newNote("deploy")
+	specified.Body.Body.Visibility = "specified"
+
+	program := expr.MustCompile(`user.isBot == false && (text =~ "deploy" || "#ops" in tags) && visibility != "specified"`)
+	assert.True(t, program.Match(note))
+	assert.False(t, program.Match(bot))
+	assert.False(t, program.Match(specified))
+	assert.False(t, program.Match(newNote("lunch")))
+
+	for src, want := range map[string]bool{
+		`"#OPS" in tags`:                               true,
+		`"DEPLOY" in text`:                             true,
+		`text !~ "^本番"`:                                false,
+		`user.acct == "alice@remote.example"`:          true,
+		`user.host in ["a.example", "remote.example"]`: true,
+		`reactionCount >= 3 && fileCount < 1`:          true,
+		`!(isRenote || isReply) && cw == ""`:           true,
+		`renote.user.acct == ""`:                       true,
+		`'it\'s' in "it's"`:                            true,
+		`user.name < "b"`:                              true,
+	} {
+		program, err := expr.Compile(src)
+		if assert.NoError(t, err, src) {
+			assert.Equal(t, want, program.Match(note), src)
+		}
+	}
+}
+
+func TestRenote(t *testing.T) {
+	note := newNote("")
+	note.Body.Body.RenoteID = "2"
+	note.Body.Body.Renote = misskey.RenoteContent{ID: "2", Text: "元のノート", User: misskey.NoteUser{Username: "bob", IsBot: true}}
+
+	assert.True(t, expr.MustCompile(`isRenote && !isQuote && renote.user.isBot`).Match(note))
+	assert.True(t, expr.MustCompile(`renote.text =~ "元の" && renote.user.acct == "bob"`).Match(note))
+}
+
+func TestCompileError(t *testing.T) {
+	for src, msg := range map[string]string{
+		``:                  "式が空です",
+		`text`:              "1文字目: 式の結果が bool ではありません (string)",
+		`text == 1`:         "6文字目: == の両辺の型が違います (string と number)",
+		`user.isbot`:        `1文字目: フィールド "user.isbot" はありません(user.isBot のことですか?)`,
+		`isBot`:             `(user.isBot のことですか?)`,
+		`text =~ "("`:       `9文字目: 正規表現 "(" を解釈できません`,
+		`text =~ cw`:        "9文字目: =~ の右辺は文字列で書いた正規表現です",
+		`(isReply`:          "9文字目: ( に対応する ) がありません",
+		`isReply isRenote`:  `9文字目: "isRenote" は余分です`,
+		`text == "abc`:      "9文字目: 文字列が閉じられていません",
+		`"本文" == text && 1`: "17文字目: && の右辺が bool ではありません (number)",
+		`fileCount in tags`: "1文字目: in の左辺は string です (number)",
+		`tags == ["a"]`:     "list は == で比べられません",
+		`isReply &&`:        "式が途中で終わっています",
+	} {
+		_, err := expr.Compile(src)
+		if assert.Error(t, err, src) {
+			assert.Contains(t, err.Error(), msg, src)
+		}
+	}
+}
+
+func TestErrorDetail(t *testing.T) {
+	_, err := expr.Compile(`本文 == "a"`)
+	var exprErr *expr.Error
+	if assert.True(t, errors.As(err, &exprErr)) {
+		assert.Equal(t, 1, exprErr.Column())
+		assert.Equal(t, "本文 == \"a\"\n^\n"+exprErr.Error(), exprErr.Detail())
+	}
+
+	_, err = expr.Compile(`text == 1`)
+	if assert.True(t, errors.As(err, &exprErr)) {
+		assert.Equal(t, "text == 1\n     ^\n"+exprErr.Error(), exprErr.Detail())
+	}
+}
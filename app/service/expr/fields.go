@@ -0,0 +1,186 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// Field は式から参照できるノートの値です
+	Field struct {
+		Name string
+		Type Type
+		Doc  string
+		get  func(env *Env) any
+	}
+
+	// Env は1件のノートを評価するときの値の取り出し元です
+	Env struct {
+		note *misskey.NoteBody
+		tags []string // 必要になったときに作る
+	}
+)
+
+var hashtagPattern = regexp.MustCompile(`#([^\s.,!?'"#:/\[\]【】()「」（）<>]+)`)
+
+var fields = []Field{
+	{Name: "id", Type: TypeString, Doc: "ノートのID", get: func(e *Env) any { return e.note.ID }},
+	{Name: "text", Type: TypeString, Doc: "本文", get: func(e *Env) any { return e.note.Text }},
+	{Name: "cw", Type: TypeString, Doc: "CW(注釈)。なければ空文字", get: func(e *Env) any { return stringValue(e.note.Cw) }},
+	{Name: "visibility", Type: TypeString, Doc: "公開範囲(public / home / followers / specified)", get: func(e *Env) any { return e.note.Visibility }},
+	{Name: "localOnly", Type: TypeBool, Doc: "連合なし", get: func(e *Env) any { return e.note.LocalOnly }},
+	{Name: "tags", Type: TypeList, Doc: "ハッシュタグ(\"#ops\" のように#付きの小文字)", get: func(e *Env) any { return e.hashtags() }},
+	{Name: "isRenote", Type: TypeBool, Doc: "リノート(引用を含む)", get: func(e *Env) any { return e.note.RenoteID != "" }},
+	{Name: "isQuote", Type: TypeBool, Doc: "引用リノート", get: func(e *Env) any { return e.note.RenoteID != "" && e.note.Text != "" }},
+	{Name: "isReply", Type: TypeBool, Doc: "返信", get: func(e *Env) any { return stringValue(e.note.ReplyID) != "" }},
+	{Name: "hasFiles", Type: TypeBool, Doc: "ファイルが添付されている", get: func(e *Env) any { return len(e.note.Files) > 0 }},
+	{Name: "fileCount", Type: TypeNumber, Doc: "添付ファイルの数", get: func(e *Env) any { return float64(len(e.note.Files)) }},
+	{Name: "isSensitive", Type: TypeBool, Doc: "センシティブなファイルが添付されている", get: func(e *Env) any { return e.sensitive() }},
+	{Name: "renoteCount", Type: TypeNumber, Doc: "リノート数", get: func(e *Env) any { return float64(e.note.RenoteCount) }},
+	{Name: "repliesCount", Type: TypeNumber, Doc: "返信数", get: func(e *Env) any { return float64(e.note.RepliesCount) }},
+	{Name: "reactionCount", Type: TypeNumber, Doc: "リアクションの合計", get: func(e *Env) any { return float64(e.reactionCount()) }},
+
+	{Name: "user.id", Type: TypeString, Doc: "投稿者のID", get: func(e *Env) any { return e.note.User.ID }},
+	{Name: "user.username", Type: TypeString, Doc: "投稿者のユーザー名", get: func(e *Env) any { return e.note.User.Username }},
+	{Name: "user.name", Type: TypeString, Doc: "投稿者の表示名", get: func(e *Env) any { return e.note.User.Name }},
+	{Name: "user.host", Type: TypeString, Doc: "投稿者のホスト。ローカルなら空文字", get: func(e *Env) any { return stringValue(e.note.User.Host) }},
+	{Name: "user.acct", Type: TypeString, Doc: "投稿者の username@host(ローカルなら username)", get: func(e *Env) any { return acct(e.note.User) }},
+	{Name: "user.isBot", Type: TypeBool, Doc: "投稿者がBot", get: func(e *Env) any { return e.note.User.IsBot }},
+	{Name: "user.isCat", Type: TypeBool, Doc: "投稿者がCat", get: func(e *Env) any { return e.note.User.IsCat }},
+
+	{Name: "renote.id", Type: TypeString, Doc: "リノート元のID", get: func(e *Env) any { return e.note.Renote.ID }},
+	{Name: "renote.text", Type: TypeString, Doc: "リノート元の本文", get: func(e *Env) any { return e.note.Renote.Text }},
+	{Name: "renote.cw", Type: TypeString, Doc: "リノート元のCW", get: func(e *Env) any { return stringValue(e.note.Renote.Cw) }},
+	{Name: "renote.user.username", Type: TypeString, Doc: "リノート元の投稿者のユーザー名", get: func(e *Env) any { return e.note.Renote.User.Username }},
+	{Name: "renote.user.host", Type: TypeString, Doc: "リノート元の投稿者のホスト", get: func(e *Env) any { return stringValue(e.note.Renote.User.Host) }},
+	{Name: "renote.user.acct", Type: TypeString, Doc: "リノート元の投稿者の username@host", get: func(e *Env) any { return acct(e.note.Renote.User) }},
+	{Name: "renote.user.isBot", Type: TypeBool, Doc: "リノート元の投稿者がBot", get: func(e *Env) any { return e.note.Renote.User.IsBot }},
+}
+
+// Fields は式から参照できるフィールドの一覧を返します
+func Fields() []Field {
+	return append([]Field(nil), fields...)
+}
+
+func newEnv(note *misskey.Note) *Env {
+	return &Env{note: &note.Body.Body}
+}
+
+func lookupField(name string) (Field, bool) {
+	for _, f := range fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// suggest は見つからなかったフィールド名に近い名前を返します(なければ空文字)
+func suggest(name string) string {
+	type candidate struct {
+		name string
+		dist int
+	}
+	candidates := make([]candidate, 0)
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, name) {
+			return f.Name
+		}
+		if d := distance(strings.ToLower(f.Name), strings.ToLower(name)); d <= max(1, len([]rune(name))/3) {
+			candidates = append(candidates, candidate{f.Name, d})
+		}
+		// "isBot" のように接頭辞を省いた場合
+		if strings.HasSuffix(f.Name, "."+name) && !strings.HasPrefix(f.Name, "renote.") {
+			candidates = append(candidates, candidate{f.Name, 0})
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	return candidates[0].name
+}
+
+// distance は2つの文字列の編集距離です
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// hashtags はノートのタグと本文中のハッシュタグを#付きの小文字で返します
+func (e *Env) hashtags() []string {
+	if e.tags != nil {
+		return e.tags
+	}
+	seen := make(map[string]bool)
+	e.tags = make([]string, 0)
+	add := func(tag string) {
+		tag = "#" + strings.ToLower(strings.TrimPrefix(tag, "#"))
+		if !seen[tag] {
+			seen[tag] = true
+			e.tags = append(e.tags, tag)
+		}
+	}
+	for _, tag := range e.note.Tags {
+		add(tag)
+	}
+	for _, m := range hashtagPattern.FindAllStringSubmatch(e.note.Text, -1) {
+		add(m[1])
+	}
+	return e.tags
+}
+
+func (e *Env) sensitive() bool {
+	for _, f := range e.note.Files {
+		if f.IsSensitive {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Env) reactionCount() int {
+	n := 0
+	for _, c := range e.note.Reactions {
+		n += c
+	}
+	return n
+}
+
+func acct(user misskey.NoteUser) string {
+	if host := stringValue(user.Host); host != "" {
+		return user.Username + "@" + host
+	}
+	return user.Username
+}
+
+// stringValue はJSONのnullや文字列以外の値を空文字として扱います
+func stringValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
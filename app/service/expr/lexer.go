@@ -0,0 +1,131 @@
+package expr
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type (
+	tokenKind int
+
+	// token は式を区切った最小の単位です
+	token struct {
+		kind tokenKind
+		text string // 識別子・演算子はそのまま、文字列はエスケープを解いた値
+		num  float64
+		pos  int // 式の先頭からのバイト位置
+	}
+)
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+// 2文字の演算子は1文字の演算子より先に調べる
+var operators = []string{"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","}
+
+// lex は式を字句に分けます
+func lex(src string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+
+		case r == '"' || r == '\'':
+			text, end, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i = end
+
+		case unicode.IsDigit(r):
+			end := i
+			for end < len(src) && (isDigit(src[end]) || src[end] == '.') {
+				end++
+			}
+			num, err := strconv.ParseFloat(src[i:end], 64)
+			if err != nil {
+				return nil, newError(src, i, "数値 %q を解釈できません", src[i:end])
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[i:end], num: num, pos: i})
+			i = end
+
+		case isIdentStart(r):
+			end := i
+			for end < len(src) {
+				r, size := utf8.DecodeRuneInString(src[end:])
+				if !isIdentStart(r) && !unicode.IsDigit(r) && r != '.' {
+					break
+				}
+				end += size
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[i:end], pos: i})
+			i = end
+
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				if r == '=' || r == '&' || r == '|' {
+					return nil, newError(src, i, "%q は使えません(==、&&、|| のように2文字で書きます)", string(r))
+				}
+				return nil, newError(src, i, "%q は使えません", string(r))
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+// lexString はstartから始まる引用符で囲まれた文字列を読み、値と終わりの位置を返します
+func lexString(src string, start int) (string, int, error) {
+	quote := src[start]
+	var b strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				// \" \\ のほか、正規表現の \d などはそのまま残す
+				if src[i] != quote && src[i] != '\\' {
+					b.WriteByte('\\')
+				}
+				b.WriteByte(src[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, newError(src, start, "文字列が閉じられていません")
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
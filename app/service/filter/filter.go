@@ -0,0 +1,257 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/expr"
+)
+
+type (
+	// Engine はアカウントのミュート設定でタイムラインのノートを絞り込みます
+	Engine struct {
+		mute      setting.Mute
+		regexps   []*regexp.Regexp
+		programs  []*expr.Program
+		languages map[string]bool
+	}
+
+	// Rule はノートを絞り込んだ条件の種類です
+	Rule string
+
+	// Match はノートが当てはまった条件です
+	Match struct {
+		Rule   Rule
+		Detail string // 当てはまった語やユーザーなど
+	}
+)
+
+const (
+	RuleWord      Rule = "word"
+	RuleRegexp    Rule = "regexp"
+	RuleUser      Rule = "user"
+	RuleHost      Rule = "host"
+	RuleBot       Rule = "bot"
+	RuleRenote    Rule = "renote"
+	RuleCw        Rule = "cw"
+	RuleSensitive Rule = "sensitive"
+	RuleLanguage  Rule = "language"
+	RuleExpr      Rule = "expr"
+)
+
+// New はミュート設定からEngineを生成します
+// 解釈できない正規表現や式はエラーにまとめて返し、それ以外の条件は有効にします
+func New(mute setting.Mute) (*Engine, error) {
+	e := &Engine{
+		mute:      mute,
+		languages: make(map[string]bool),
+	}
+	errs := make([]error, 0)
+	for _, expr := range mute.Regexps {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("正規表現 %q: %w", expr, err))
+			continue
+		}
+		e.regexps = append(e.regexps, re)
+	}
+	for _, src := range mute.Expressions {
+		program, err := expr.Compile(src)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("式 %q: %w", src, err))
+			continue
+		}
+		e.programs = append(e.programs, program)
+	}
+	for _, lang := range mute.Languages {
+		e.languages[strings.ToLower(lang)] = true
+	}
+	return e, errors.Join(errs...)
+}
+
+// Action は条件に当てはまったノートの扱いを返します
+func (e *Engine) Action() setting.MuteAction {
+	return e.mute.ActionMode()
+}
+
+// Match はノートが条件に当てはまるかを返します
+// リノートの場合はリノートしたユーザーとリノート元の両方を確認します
+func (e *Engine) Match(note *misskey.Note) (Match, bool) {
+	body := note.Body.Body
+	renote := body.RenoteID != ""
+
+	users := []misskey.NoteUser{body.User}
+	texts := []string{body.Text, stringValue(body.Cw)}
+	files := body.Files
+	if renote {
+		users = append(users, body.Renote.User)
+		texts = append(texts, body.Renote.Text, stringValue(body.Renote.Cw))
+		files = append(files, body.Renote.Files...)
+	}
+
+	for _, user := range users {
+		if m, ok := e.matchUser(user); ok {
+			return m, true
+		}
+	}
+	if renote && e.mute.Renotes && body.Text == "" {
+		return Match{Rule: RuleRenote, Detail: "@" + acct(body.User)}, true
+	}
+	if m, ok := e.matchText(texts); ok {
+		return m, true
+	}
+	if e.mute.Cw && (stringValue(body.Cw) != "" || (renote && stringValue(body.Renote.Cw) != "")) {
+		return Match{Rule: RuleCw}, true
+	}
+	if e.mute.Sensitive {
+		for _, f := range files {
+			if f.IsSensitive {
+				return Match{Rule: RuleSensitive, Detail: f.Name}, true
+			}
+		}
+	}
+	for _, program := range e.programs {
+		if program.Match(note) {
+			return Match{Rule: RuleExpr, Detail: program.String()}, true
+		}
+	}
+	if len(e.languages) > 0 {
+		text := body.Text
+		if renote && text == "" {
+			text = body.Renote.Text
+		}
+		if lang := DetectLanguage(text); lang != "" && !e.languages[lang] {
+			return Match{Rule: RuleLanguage, Detail: lang}, true
+		}
+	}
+	return Match{}, false
+}
+
+func (e *Engine) matchUser(user misskey.NoteUser) (Match, bool) {
+	if e.mute.Bots && user.IsBot {
+		return Match{Rule: RuleBot, Detail: "@" + acct(user)}, true
+	}
+	host := stringValue(user.Host)
+	name := acct(user)
+	for _, u := range e.mute.Users {
+		u = strings.TrimPrefix(u, "@")
+		if strings.EqualFold(u, name) || (host == "" && strings.EqualFold(u, user.Username)) {
+			return Match{Rule: RuleUser, Detail: "@" + name}, true
+		}
+	}
+	for _, h := range e.mute.Hosts {
+		if host != "" && strings.EqualFold(h, host) {
+			return Match{Rule: RuleHost, Detail: host}, true
+		}
+	}
+	return Match{}, false
+}
+
+func (e *Engine) matchText(texts []string) (Match, bool) {
+	for _, word := range e.mute.Words {
+		w := strings.ToLower(word)
+		if w == "" {
+			continue
+		}
+		for _, text := range texts {
+			if strings.Contains(strings.ToLower(text), w) {
+				return Match{Rule: RuleWord, Detail: word}, true
+			}
+		}
+	}
+	for _, re := range e.regexps {
+		for _, text := range texts {
+			if text != "" && re.MatchString(text) {
+				return Match{Rule: RuleRegexp, Detail: re.String()}, true
+			}
+		}
+	}
+	return Match{}, false
+}
+
+// Rules は有効な条件を説明する文の一覧を返します
+func (e *Engine) Rules() []string {
+	rules := make([]string, 0)
+	if len(e.mute.Words) > 0 {
+		rules = append(rules, "ミュートワード: "+strings.Join(e.mute.Words, ", "))
+	}
+	if len(e.regexps) > 0 {
+		exprs := make([]string, 0, len(e.regexps))
+		for _, re := range e.regexps {
+			exprs = append(exprs, "/"+re.String()+"/")
+		}
+		rules = append(rules, "正規表現: "+strings.Join(exprs, ", "))
+	}
+	for _, program := range e.programs {
+		rules = append(rules, "式: "+program.String())
+	}
+	if len(e.mute.Users) > 0 {
+		rules = append(rules, "ユーザー: "+strings.Join(e.mute.Users, ", "))
+	}
+	if len(e.mute.Hosts) > 0 {
+		rules = append(rules, "ホスト: "+strings.Join(e.mute.Hosts, ", "))
+	}
+	for _, flag := range []struct {
+		on   bool
+		text string
+	}{
+		{e.mute.Bots, "botのノート"},
+		{e.mute.Renotes, "本文のないリノート"},
+		{e.mute.Cw, "CW付きのノート"},
+		{e.mute.Sensitive, "閲覧注意のファイル付きのノート"},
+	} {
+		if flag.on {
+			rules = append(rules, flag.text)
+		}
+	}
+	if len(e.mute.Languages) > 0 {
+		rules = append(rules, "表示する言語: "+strings.Join(e.mute.Languages, ", "))
+	}
+	return rules
+}
+
+// String はノートを絞り込んだ理由を説明します
+func (m Match) String() string {
+	switch m.Rule {
+	case RuleWord:
+		return fmt.Sprintf("ミュートワード「%s」を含む", m.Detail)
+	case RuleRegexp:
+		return fmt.Sprintf("正規表現 /%s/ に一致", m.Detail)
+	case RuleUser:
+		return fmt.Sprintf("ミュートしたユーザー %s", m.Detail)
+	case RuleHost:
+		return fmt.Sprintf("ミュートしたホスト %s", m.Detail)
+	case RuleBot:
+		return fmt.Sprintf("botのノート (%s)", m.Detail)
+	case RuleRenote:
+		return fmt.Sprintf("%s のリノート", m.Detail)
+	case RuleCw:
+		return "CW付きのノート"
+	case RuleSensitive:
+		return fmt.Sprintf("閲覧注意のファイル %s", m.Detail)
+	case RuleLanguage:
+		return fmt.Sprintf("表示しない言語 (%s)", m.Detail)
+	case RuleExpr:
+		return fmt.Sprintf("式 %s に一致", m.Detail)
+	}
+	return string(m.Rule)
+}
+
+func acct(user misskey.NoteUser) string {
+	if host := stringValue(user.Host); host != "" {
+		return user.Username + "@" + host
+	}
+	return user.Username
+}
+
+// stringValue はJSONでnullまたは文字列になる値を文字列にします
+func stringValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package filter_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/filter"
+)
+
+func newNote(text string) *misskey.Note {
+	return &misskey.Note{Body: misskey.NoteContainer{Body: misskey.NoteBody{
+		ID:   "1",
+		User: misskey.NoteUser{Username: "user1", Host: "remote.example"},
+		Text: text,
+	}}}
+}
+
+func newRenote() *misskey.Note {
+	note := newNote("")
+	note.Body.Body.RenoteID = "2"
+	note.Body.Body.Renote = misskey.RenoteContent{
+		ID:   "2",
+		User: misskey.NoteUser{Username: "original_user"},
+		Text: "これはオリジナルノートです",
+	}
+	return note
+}
+
+func match(t *testing.T, mute setting.Mute, note *misskey.Note) (filter.Match, bool) {
+	engine, err := filter.New(mute)
+	assert.NoError(t, err)
+	return engine.Match(note)
+}
+
+func TestMuteWordsAndUsers(t *testing.T) {
+	note := newNote("これはテストノートです")
+
+	_, ok := match(t, setting.Mute{}, note)
+	assert.False(t, ok)
+	m, ok := match(t, setting.Mute{Words: []string{"テストノート"}}, note)
+	assert.True(t, ok)
+	assert.Equal(t, "ミュートワード「テストノート」を含む", m.String())
+	_, ok = match(t, setting.Mute{Users: []string{"@user1@remote.example"}}, note)
+	assert.True(t, ok)
+	_, ok = match(t, setting.Mute{Users: []string{"user1"}}, note) // ホストが違えば別ユーザー
+	assert.False(t, ok)
+	m, ok = match(t, setting.Mute{Hosts: []string{"REMOTE.example"}}, note)
+	assert.True(t, ok)
+	assert.Equal(t, filter.RuleHost, m.Rule)
+
+	// リノート元のユーザーと本文も対象になる
+	_, ok = match(t, setting.Mute{Users: []string{"original_user"}}, newRenote())
+	assert.True(t, ok)
+	_, ok = match(t, setting.Mute{Words: []string{"オリジナル"}}, newRenote())
+	assert.True(t, ok)
+}
+
+func TestRegexps(t *testing.T) {
+	m, ok := match(t, setting.Mute{Regexps: []string{`(?i)^hello\b`}}, newNote("Hello world"))
+	assert.True(t, ok)
+	assert.Equal(t, "正規表現 /(?i)^hello\\b/ に一致", m.String())
+
+	// 解釈できない正規表現だけを無視し、ほかの条件は使う
+	engine, err := filter.New(setting.Mute{Regexps: []string{"("}, Words: []string{"world"}})
+	assert.ErrorContains(t, err, `正規表現 "("`)
+	_, ok = engine.Match(newNote("Hello world"))
+	assert.True(t, ok)
+}
+
+func TestFlags(t *testing.T) {
+	bot := newNote("自動投稿")
+	bot.Body.Body.User.IsBot = true
+	m, ok := match(t, setting.Mute{Bots: true}, bot)
+	assert.True(t, ok)
+	assert.Equal(t, filter.RuleBot, m.Rule)
+
+	m, ok = match(t, setting.Mute{Renotes: true}, newRenote())
+	assert.True(t, ok)
+	assert.Equal(t, "@user1@remote.example のリノート", m.String())
+	// 引用リノートは対象外
+	quote := newRenote()
+	quote.Body.Body.Text = "引用"
+	_, ok = match(t, setting.Mute{Renotes: true}, quote)
+	assert.False(t, ok)
+
+	cw := newNote("本文")
+	cw.Body.Body.Cw = "ネタバレ"
+	m, ok = match(t, setting.Mute{Cw: true}, cw)
+	assert.True(t, ok)
+	assert.Equal(t, filter.RuleCw, m.Rule)
+
+	sensitive := newNote("画像")
+	sensitive.Body.Body.Files = []misskey.NoteFile{{Name: "a.png", IsSensitive: true}}
+	m, ok = match(t, setting.Mute{Sensitive: true}, sensitive)
+	assert.True(t, ok)
+	assert.Equal(t, "閲覧注意のファイル a.png", m.String())
+}
+
+func TestLanguages(t *testing.T) {
+	mute := setting.Mute{Languages: []string{"ja"}}
+	_, ok := match(t, mute, newNote("今日はいい天気ですね #misskey"))
+	assert.False(t, ok)
+	m, ok := match(t, mute, newNote("What a nice day"))
+	assert.True(t, ok)
+	assert.Equal(t, "表示しない言語 (en)", m.String())
+	// 文字のない本文は判定しない
+	_, ok = match(t, mute, newNote("🎉🎉"))
+	assert.False(t, ok)
+
+	assert.Equal(t, "ko", filter.DetectLanguage("안녕하세요"))
+	// 漢字だけでは日本語か中国語か分からないので判定しない
+	_, ok = match(t, mute, newNote("本日晴天"))
+	assert.False(t, ok)
+	assert.Equal(t, "", filter.DetectLanguage("草"))
+	assert.Equal(t, "", filter.DetectLanguage("今天天气很好"))
+	assert.Equal(t, "", filter.DetectLanguage("本日晴天 lol"))
+	assert.Equal(t, "ko", filter.DetectLanguage("韓國語 안녕하세요"))
+	assert.Equal(t, "ru", filter.DetectLanguage("Привет"))
+}
+
+func TestRules(t *testing.T) {
+	engine, _ := filter.New(setting.Mute{Words: []string{"a", "b"}, Bots: true, Action: setting.MuteActionCollapse})
+	assert.Equal(t, []string{"ミュートワード: a, b", "botのノート"}, engine.Rules())
+	assert.Equal(t, setting.MuteActionCollapse, engine.Action())
+
+	engine, _ = filter.New(setting.Mute{})
+	assert.Equal(t, setting.MuteActionHide, engine.Action())
+}
+
+func TestExpressions(t *testing.T) {
+	mute := setting.Mute{Expressions: []string{`user.host == "remote.example" && text =~ "(?i)deploy"`}}
+	m, ok := match(t, mute, newNote("Deploy done"))
+	assert.True(t, ok)
+	assert.Equal(t, filter.RuleExpr, m.Rule)
+	_, ok = match(t, mute, newNote("lunch"))
+	assert.False(t, ok)
+
+	// 誤りのある式だけを無視する
+	engine, err := filter.New(setting.Mute{Expressions: []string{"text ==", "isRenote"}})
+	assert.ErrorContains(t, err, `式 "text =="`)
+	_, ok = engine.Match(newRenote())
+	assert.True(t, ok)
+	assert.Contains(t, engine.Rules(), "式: isRenote")
+}
@@ -0,0 +1,44 @@
+package filter
+
+import "unicode"
+
+// DetectLanguage は本文の文字の種類から言語を推定します
+// かなを含めばja、ハングルならko、キリル文字ならru、ラテン文字ならenを返します
+// 漢字は日本語と中国語で共通なので、かなもハングルもなく漢字を含む本文は判定しません(空文字)
+// 文字を含まない本文(絵文字だけなど)も空文字を返します
+func DetectLanguage(text string) string {
+	counts := make(map[string]int)
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			counts["ja"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Han, r):
+			counts["han"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["ru"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Thai, r):
+			counts["th"]++
+		case unicode.Is(unicode.Latin, r):
+			counts["en"]++
+		}
+	}
+	// 日本語の文は漢字やラテン文字が混ざっていても、かながあれば日本語とみなす
+	if counts["ja"] > 0 {
+		return "ja"
+	}
+	// 「草」「本日晴天」のような漢字だけの日本語を中国語とみなさない
+	if counts["han"] > 0 && counts["ko"] == 0 {
+		return ""
+	}
+	lang, most := "", 0
+	for _, l := range []string{"ko", "ru", "ar", "th", "en"} {
+		if counts[l] > most {
+			lang, most = l, counts[l]
+		}
+	}
+	return lang
+}
@@ -0,0 +1,316 @@
+// Package forward はストリーミングのイベントをHTTPのwebhookに転送する仕組みです
+// 送れなかったイベントはディスクの待ち行列に残し、間隔を空けて送り直します
+package forward
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/domain/core"
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/expr"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+	"github.com/wasya-io/petit-misskey/service/outbox"
+)
+
+type (
+	// Forwarder はイベントを1つのURLへ順番に転送します
+	Forwarder struct {
+		url     string
+		opts    Options
+		client  *http.Client
+		journal *journal
+
+		mu      sync.Mutex
+		seq     int
+		queue   []Delivery // 古い順
+		dropped int
+		wake    chan struct{}
+	}
+
+	// Options は転送の設定です
+	Options struct {
+		Secret     string        // 署名に使う共有の秘密(空なら署名しない)
+		Where      *expr.Program // 転送するノートの条件(nilならすべてのイベントを転送する)
+		MaxQueue   int           // 待ち行列に溜めるイベントの上限(未設定なら1000。超えたら古いものから捨てる)
+		Timeout    time.Duration // 1回の送信を打ち切るまでの時間(未設定なら10秒)
+		MinBackoff time.Duration // 送り直すまでの最初の間隔(未設定なら1秒)
+		MaxBackoff time.Duration // 送り直すまでの最長の間隔(未設定なら5分)
+		Out        io.Writer     // 送信の失敗の書き出し先(nilなら書き出さない)
+		Logger     core.Logger
+	}
+
+	// Delivery は待ち行列に入っている転送前のイベントです
+	Delivery struct {
+		ID          string          `json:"id"`
+		Type        string          `json:"type"`
+		Body        json.RawMessage `json:"body"`
+		CreatedAt   time.Time       `json:"createdAt"`
+		Attempts    int             `json:"attempts"`
+		NextAttempt time.Time       `json:"nextAttempt"`
+		LastError   string          `json:"lastError,omitempty"`
+	}
+
+	// Status は待ち行列の状態です
+	Status struct {
+		Pending   int
+		Dropped   int // 上限を超えたか、送り直しても成功しないため捨てたイベントの数
+		LastError string
+	}
+)
+
+const (
+	// SignatureHeader は本文のHMAC-SHA256の署名("sha256=" + 16進数)を入れるヘッダーです
+	SignatureHeader = "X-Petit-Misskey-Signature"
+	// EventHeader はイベントの種類を入れるヘッダーです
+	EventHeader = "X-Petit-Misskey-Event"
+	// DeliveryHeader は転送ごとのIDを入れるヘッダーです。送り直しても変わりません
+	DeliveryHeader = "X-Petit-Misskey-Delivery"
+
+	defaultMaxQueue   = 1000
+	defaultTimeout    = 10 * time.Second
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = 5 * time.Minute
+)
+
+// New はurlへ転送するForwarderを生成します
+// fileに前回送れなかったイベントがあれば、それから送ります。fileがnilならディスクには保存しません
+// fileには待ち行列への変更を追記していき、待ち行列が空になったときや変更が溜まったときに書き直します
+func New(url string, file *cache.File, opts Options) (*Forwarder, error) {
+	if opts.MaxQueue <= 0 {
+		opts.MaxQueue = defaultMaxQueue
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(defaultMaxBackoff, opts.MinBackoff)
+	}
+	f := &Forwarder{
+		url:    url,
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		wake:   make(chan struct{}, 1),
+	}
+	if file != nil {
+		j, queue, err := openJournal(file.Path(), opts.MaxQueue)
+		f.journal, f.queue = j, queue
+		if err != nil {
+			return f, err
+		}
+	}
+	f.seq = len(f.queue)
+	return f, nil
+}
+
+// Match はイベントを転送するかどうかを返します
+// 条件があれば、条件に当てはまるノートを含むイベントだけを転送します
+func (f *Forwarder) Match(ev hooks.Event) bool {
+	if f.opts.Where == nil {
+		return true
+	}
+	if ev.Note == nil {
+		return false
+	}
+	return f.opts.Where.Match(&misskey.Note{Body: misskey.NoteContainer{Type: "note", Body: *ev.Note}})
+}
+
+// Enqueue はイベントを待ち行列に加えます
+// 条件に当てはまらないイベントは加えず、falseを返します
+func (f *Forwarder) Enqueue(ev hooks.Event) (bool, error) {
+	if !f.Match(ev) {
+		return false, nil
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	f.seq++
+	d := Delivery{
+		ID:          fmt.Sprintf("%d-%d", ev.At.UnixNano(), f.seq),
+		Type:        string(ev.Type),
+		Body:        body,
+		CreatedAt:   ev.At,
+		NextAttempt: ev.At,
+	}
+	f.queue = append(f.queue, d)
+	entries := []entry{{Op: opAdd, ID: d.ID, Delivery: &d}}
+	if over := len(f.queue) - f.opts.MaxQueue; over > 0 {
+		for _, old := range f.queue[:over] {
+			entries = append(entries, entry{Op: opDone, ID: old.ID})
+		}
+		f.queue = f.queue[over:]
+		f.dropped += over
+	}
+	err = f.record(entries...)
+	f.mu.Unlock()
+
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+	return true, err
+}
+
+// Run はctxが終了するまで、待ち行列のイベントを古い順に転送します
+// 送れなかったイベントは、間隔を倍にしながら送り直します。順番を保つため、後のイベントは待たせます
+func (f *Forwarder) Run(ctx context.Context) {
+	for {
+		wait := time.Duration(-1)
+		if d, ok := f.head(); ok {
+			wait = time.Until(d.NextAttempt)
+			if wait <= 0 {
+				f.deliver(ctx, d)
+				continue
+			}
+		}
+		var timer *time.Timer
+		var due <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-f.wake:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// head は次に転送するイベントを返します
+func (f *Forwarder) head() (Delivery, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.queue) == 0 {
+		return Delivery{}, false
+	}
+	return f.queue[0], true
+}
+
+// deliver はイベントを1件送り、結果を待ち行列に記録します
+func (f *Forwarder) deliver(ctx context.Context, d Delivery) {
+	err := f.post(ctx, d)
+	if ctx.Err() != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.queue) == 0 || f.queue[0].ID != d.ID {
+		return // 待ち行列が溢れて捨てられた
+	}
+	var e entry
+	switch {
+	case err == nil:
+		f.queue = f.queue[1:]
+		e = entry{Op: opDone, ID: d.ID}
+	case outbox.IsTransient(err):
+		item := &f.queue[0]
+		item.Attempts++
+		item.LastError = err.Error()
+		item.NextAttempt = time.Now().Add(f.backoff(item.Attempts))
+		e = entry{Op: opRetry, ID: d.ID, Attempts: item.Attempts, NextAttempt: item.NextAttempt, LastError: item.LastError}
+		f.logf("forward %s failed (attempt %d, retry in %s): %v", d.ID, item.Attempts, f.backoff(item.Attempts), err)
+	default:
+		// 送り直しても受け付けられないイベントは捨てる
+		f.queue = f.queue[1:]
+		f.dropped++
+		e = entry{Op: opDone, ID: d.ID}
+		f.logf("forward %s dropped: %v", d.ID, err)
+	}
+	if err := f.record(e); err != nil {
+		f.logf("forward queue error: %v", err)
+	}
+}
+
+// post はイベントをPOSTします
+func (f *Forwarder) post(ctx context.Context, d Delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, bytes.NewReader(d.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "petit-misskey")
+	req.Header.Set(EventHeader, d.Type)
+	req.Header.Set(DeliveryHeader, d.ID)
+	if f.opts.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(f.opts.Secret, d.Body))
+	}
+	res, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode/100 != 2 {
+		return &api.StatusError{StatusCode: res.StatusCode}
+	}
+	return nil
+}
+
+// backoff はattempts回失敗したあと送り直すまでの間隔を返します
+func (f *Forwarder) backoff(attempts int) time.Duration {
+	d := f.opts.MinBackoff
+	for i := 1; i < attempts && d < f.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, f.opts.MaxBackoff)
+}
+
+// Status は待ち行列の状態を返します
+func (f *Forwarder) Status() Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := Status{Pending: len(f.queue), Dropped: f.dropped}
+	if len(f.queue) > 0 {
+		status.LastError = f.queue[0].LastError
+	}
+	return status
+}
+
+// record は待ち行列への変更をファイルに追記します
+func (f *Forwarder) record(entries ...entry) error {
+	if f.journal == nil {
+		return nil
+	}
+	return f.journal.append(f.queue, entries...)
+}
+
+func (f *Forwarder) logf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if f.opts.Logger != nil {
+		f.opts.Logger.Log("forward", msg)
+	}
+	if f.opts.Out != nil {
+		fmt.Fprintln(f.opts.Out, msg)
+	}
+}
+
+// Sign は本文のHMAC-SHA256の署名を "sha256=" + 16進数 で返します
+// 受け取る側は同じ秘密で計算した値と hmac.Equal で比べます
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,198 @@
+package forward_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/expr"
+	"github.com/wasya-io/petit-misskey/service/forward"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+)
+
+// receiver はステータスを順に返し、受け取ったイベントを記録するwebhookです
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	received []hooks.Event
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	if status == http.StatusOK {
+		var ev hooks.Event
+		json.Unmarshal(body, &ev)
+		r.received = append(r.received, ev)
+		r.headers = append(r.headers, req.Header.Clone())
+		r.bodies = append(r.bodies, body)
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) ids() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.received))
+	for _, ev := range r.received {
+		ids = append(ids, ev.Note.ID)
+	}
+	return ids
+}
+
+func noteEvent(id string, text string) hooks.Event {
+	return hooks.Event{Type: setting.HookEventNote, Account: "io", At: time.Now(), Note: &misskey.NoteBody{ID: id, Text: text}}
+}
+
+func run(t *testing.T, f *forward.Forwarder) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestForward(t *testing.T) {
+	r := &receiver{statuses: []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusBadRequest}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	f, err := forward.New(server.URL, nil, forward.Options{Secret: "s3cret", MinBackoff: 10 * time.Millisecond})
+	require.NoError(t, err)
+	run(t, f)
+
+	// 1件目は一度失敗してから届き、後のイベントは順番を守って待つ
+	for _, id := range []string{"n1", "n2", "n3"} {
+		ok, err := f.Enqueue(noteEvent(id, "hello"))
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	// 2件目は400なので送り直さずに捨てる
+	assert.Eventually(t, func() bool { return len(r.ids()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"n1", "n3"}, r.ids())
+	assert.Equal(t, forward.Status{Pending: 0, Dropped: 1}, f.Status())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	header := r.headers[0]
+	assert.Equal(t, "note", header.Get(forward.EventHeader))
+	assert.NotEmpty(t, header.Get(forward.DeliveryHeader))
+	assert.True(t, hmac.Equal([]byte(forward.Sign("s3cret", r.bodies[0])), []byte(header.Get(forward.SignatureHeader))))
+	assert.Equal(t, "io", r.received[0].Account)
+}
+
+func TestQueue(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	file := cache.NewFileAt(filepath.Join(t.TempDir(), "forward.json"))
+
+	// 送る前に終了しても、待ち行列はディスクに残る。上限を超えたら古いものから捨てる
+	f, err := forward.New(server.URL, file, forward.Options{MaxQueue: 2})
+	require.NoError(t, err)
+	for _, id := range []string{"n1", "n2", "n3"} {
+		_, err := f.Enqueue(noteEvent(id, "hello"))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, forward.Status{Pending: 2, Dropped: 1}, f.Status())
+
+	restarted, err := forward.New(server.URL, file, forward.Options{})
+	require.NoError(t, err)
+	run(t, restarted)
+	assert.Eventually(t, func() bool { return len(r.ids()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"n2", "n3"}, r.ids())
+	// 送り終えたらファイルは空になる
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(file.Path())
+		return err == nil && info.Size() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestJournal(t *testing.T) {
+	r := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	file := cache.NewFileAt(filepath.Join(t.TempDir(), "forward.jsonl"))
+
+	// 送り直しの回数も再起動のあとに残る
+	f, err := forward.New(server.URL, file, forward.Options{MinBackoff: time.Hour})
+	require.NoError(t, err)
+	_, err = f.Enqueue(noteEvent("n1", "hello"))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return f.Status().LastError != "" }, 2*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	// イベントを加えても待ち行列全体は書き直さず、溜まったら書き直す
+	restarted, err := forward.New(server.URL, file, forward.Options{MaxQueue: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, restarted.Status().Pending)
+	assert.NotEmpty(t, restarted.Status().LastError)
+	lines := func() int {
+		raw, err := os.ReadFile(file.Path())
+		require.NoError(t, err)
+		return bytes.Count(raw, []byte("\n"))
+	}
+	peak := 0
+	for i := 0; i < 30; i++ {
+		_, err := restarted.Enqueue(noteEvent(fmt.Sprintf("m%d", i), "hello"))
+		require.NoError(t, err)
+		n := lines()
+		assert.LessOrEqual(t, n, 10+10)
+		peak = max(peak, n)
+	}
+	assert.Greater(t, peak, 10)
+
+	again, err := forward.New(server.URL, file, forward.Options{MaxQueue: 10})
+	require.NoError(t, err)
+	assert.Equal(t, forward.Status{Pending: 10}, again.Status())
+}
+
+func TestWhere(t *testing.T) {
+	where, err := expr.Compile(`text =~ "deploy"`)
+	require.NoError(t, err)
+	f, err := forward.New("http://localhost:0", nil, forward.Options{Where: where})
+	require.NoError(t, err)
+
+	assert.True(t, f.Match(noteEvent("n1", "deploy done")))
+	assert.False(t, f.Match(noteEvent("n2", "hello")))
+	// ノートを含まないイベントは条件があれば転送しない
+	assert.False(t, f.Match(hooks.Event{Type: setting.HookEventDisconnect}))
+	ok, err := f.Enqueue(noteEvent("n2", "hello"))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 0, f.Status().Pending)
+}
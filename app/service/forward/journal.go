@@ -0,0 +1,174 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// journal は待ち行列への変更を1行に1件ずつ追記するファイルです
+	// イベントのたびに待ち行列全体を書き直さないよう変更だけを追記し、
+	// 待ち行列が空になったときや行が溜まったときに今の待ち行列だけで書き直します
+	journal struct {
+		path  string
+		limit int // 待ち行列の件数よりこれだけ行が多くなったら書き直す
+		out   *os.File
+		lines int
+	}
+
+	// entry は待ち行列への1件の変更です
+	entry struct {
+		Op          op        `json:"op"`
+		ID          string    `json:"id"`
+		Delivery    *Delivery `json:"delivery,omitempty"` // opAddのときだけ
+		Attempts    int       `json:"attempts,omitempty"`
+		NextAttempt time.Time `json:"nextAttempt,omitempty"`
+		LastError   string    `json:"lastError,omitempty"`
+	}
+
+	op string
+)
+
+const (
+	opAdd   op = "add"   // イベントを加えた
+	opRetry op = "retry" // 送れなかったので送り直す
+	opDone  op = "done"  // 送れたか、捨てた
+)
+
+// openJournal はpathのファイルを読み、記録された変更を順に当てはめた待ち行列を返します
+// 読めない行(書き込みの途中で終了した行など)は読み飛ばします
+func openJournal(path string, limit int) (*journal, []Delivery, error) {
+	j := &journal{path: path, limit: limit}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return j, nil, nil
+	}
+	if err != nil {
+		return j, nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	queue := make([]Delivery, 0)
+	index := func(id string) int {
+		for i := range queue {
+			if queue[i].ID == id {
+				return i
+			}
+		}
+		return -1
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		j.lines++
+		switch e.Op {
+		case opAdd:
+			if e.Delivery != nil && index(e.Delivery.ID) < 0 {
+				queue = append(queue, *e.Delivery)
+			}
+		case opRetry:
+			if i := index(e.ID); i >= 0 {
+				queue[i].Attempts = e.Attempts
+				queue[i].NextAttempt = e.NextAttempt
+				queue[i].LastError = e.LastError
+			}
+		case opDone:
+			if i := index(e.ID); i >= 0 {
+				queue = append(queue[:i], queue[i+1:]...)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return j, queue, errors.WithStack(err)
+	}
+	return j, queue, nil
+}
+
+// append は変更を追記します。queueは変更を当てはめたあとの待ち行列です
+// 待ち行列が空になったか、行が溜まったらqueueだけで書き直します
+func (j *journal) append(queue []Delivery, entries ...entry) error {
+	if len(queue) == 0 && j.out != nil {
+		// 送れているあいだはここを通るので、書き直さずに切り詰めるだけにする
+		if err := j.out.Truncate(0); err != nil {
+			return errors.WithStack(err)
+		}
+		j.lines = 0
+		return nil
+	}
+	if len(queue) == 0 || j.lines+len(entries) > len(queue)+j.limit {
+		return j.compact(queue)
+	}
+	var buf bytes.Buffer
+	for _, e := range entries {
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		buf.Write(raw)
+		buf.WriteByte('\n')
+	}
+	if j.out == nil {
+		if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+			return errors.WithStack(err)
+		}
+		out, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		j.out = out
+	}
+	// 1回の書き込みで書き、途中で終了しても前の行までは読み出せるようにする
+	if _, err := j.out.Write(buf.Bytes()); err != nil {
+		return errors.WithStack(err)
+	}
+	j.lines += len(entries)
+	return nil
+}
+
+// compact はqueueのイベントを加える変更だけでファイルを書き直します
+func (j *journal) compact(queue []Delivery) error {
+	var buf bytes.Buffer
+	for i := range queue {
+		raw, err := json.Marshal(entry{Op: opAdd, ID: queue[i].ID, Delivery: &queue[i]})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		buf.Write(raw)
+		buf.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	// 書き込み途中で壊れないよう一時ファイル経由で置き換える
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if j.out != nil {
+		j.out.Close()
+		j.out = nil
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return errors.WithStack(err)
+	}
+	j.lines = len(queue)
+	return nil
+}
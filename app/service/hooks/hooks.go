@@ -0,0 +1,310 @@
+// Package hooks はストリームのイベントで、設定したコマンドを実行します
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/infrastructure/hook"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/expr"
+)
+
+type (
+	// Dispatcher はイベントに当てはまるフックを、同時に実行する数を制限して実行します
+	Dispatcher struct {
+		hooks   []entry
+		sem     chan struct{}
+		run     RunFunc
+		result  ResultFunc
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		seen    map[string]bool
+		order   []string // seenに加えた順(古いものから忘れる)
+		waiting int
+	}
+
+	entry struct {
+		setting.Hook
+		program *expr.Program
+	}
+
+	// Event はフックのコマンドに標準入力で渡すイベントです
+	Event struct {
+		Type         setting.HookEvent     `json:"type"`
+		Account      string                `json:"account"`
+		At           time.Time             `json:"at"`
+		Note         *misskey.NoteBody     `json:"note,omitempty"`
+		Notification *misskey.Notification `json:"notification,omitempty"`
+		Error        string                `json:"error,omitempty"`
+	}
+
+	// RunFunc はフックのコマンドを実行する関数です
+	RunFunc func(ctx context.Context, command string, env []string, stdin []byte) error
+
+	// ResultFunc はフックの実行結果を受け取る関数です
+	ResultFunc func(h setting.Hook, ev Event, err error)
+)
+
+const (
+	maxSeen    = 1000 // 重複を調べるために覚えておくイベントの数
+	maxWaiting = 100  // 実行を待つフックの上限(超えたら捨てる)
+)
+
+// ErrTooMany は実行を待つフックが多すぎて捨てたことを表します
+var ErrTooMany = errors.New("too many pending hooks")
+
+// New はフックの設定からDispatcherを生成します
+// 解釈できない設定はエラーにまとめて返し、それ以外のフックは有効にします
+func New(hooks []setting.Hook, concurrency int) (*Dispatcher, error) {
+	d := &Dispatcher{
+		sem:    make(chan struct{}, max(concurrency, 1)),
+		run:    hook.Run,
+		result: func(setting.Hook, Event, error) {},
+		seen:   make(map[string]bool),
+	}
+	errs := make([]error, 0)
+	for i, h := range hooks {
+		if !slices.Contains(setting.HookEvents(), h.Event) {
+			errs = append(errs, fmt.Errorf("hook %d: イベント %q には対応していません", i+1, h.Event))
+			continue
+		}
+		if h.Command == "" {
+			errs = append(errs, fmt.Errorf("hook %d: command がありません", i+1))
+			continue
+		}
+		e := entry{Hook: h}
+		if h.Where != "" {
+			program, err := expr.Compile(h.Where)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("hook %d: 式 %q: %w", i+1, h.Where, err))
+				continue
+			}
+			e.program = program
+		}
+		d.hooks = append(d.hooks, e)
+	}
+	return d, errors.Join(errs...)
+}
+
+// OnResult はフックを実行し終えたときに呼ぶ関数を設定します
+// 関数はフックを実行したgoroutineから呼ばれます
+func (d *Dispatcher) OnResult(f ResultFunc) {
+	d.result = f
+}
+
+// SetRunner はコマンドの実行方法を置き換えます(テスト用)
+func (d *Dispatcher) SetRunner(f RunFunc) {
+	d.run = f
+}
+
+// Len は有効なフックの数を返します
+func (d *Dispatcher) Len() int {
+	return len(d.hooks)
+}
+
+// NeedsNotifications は通知のイベントを使うフックがあるかを返します
+// 通知はmainチャンネルを購読しないと届きません
+func (d *Dispatcher) NeedsNotifications() bool {
+	for _, h := range d.hooks {
+		switch h.Event {
+		case setting.HookEventMention, setting.HookEventNotification, setting.HookEventFollowed, setting.HookEventReaction:
+			return true
+		}
+	}
+	return false
+}
+
+// Events はストリーミングのメッセージをフックのイベントに変換します
+// 1つの通知が複数の種類のイベントになることがあります
+func Events(account string, msg any, now time.Time) []Event {
+	switch msg := msg.(type) {
+	case websocket.NoteMessage:
+		if msg.Note == nil {
+			return nil
+		}
+		body := msg.Note.Body.Body
+		return []Event{{Type: setting.HookEventNote, Account: account, At: now, Note: &body}}
+
+	case websocket.NotificationMessage:
+		n := msg.Notification
+		if n == nil {
+			return nil
+		}
+		events := []Event{{Type: setting.HookEventNotification, Account: account, At: now, Note: n.Note, Notification: n}}
+		var typ setting.HookEvent
+		switch n.Type {
+		case "mention", "reply":
+			typ = setting.HookEventMention
+		case "follow":
+			typ = setting.HookEventFollowed
+		case "reaction":
+			typ = setting.HookEventReaction
+		}
+		if typ != "" {
+			events = append(events, Event{Type: typ, Account: account, At: now, Note: n.Note, Notification: n})
+		}
+		return events
+
+	case websocket.WebSocketDisconnectedMsg:
+		ev := Event{Type: setting.HookEventDisconnect, Account: account, At: now}
+		if msg.Err != nil {
+			ev.Error = msg.Err.Error()
+		}
+		return []Event{ev}
+
+	case websocket.WebSocketErrorMsg:
+		ev := Event{Type: setting.HookEventDisconnect, Account: account, At: now}
+		if msg.Err != nil {
+			ev.Error = msg.Err.Error()
+		}
+		return []Event{ev}
+	}
+	return nil
+}
+
+// Dispatch はイベントに当てはまるフックの実行を始めます
+// 実行を待たずに戻り、結果はOnResultの関数に渡します
+// 複数のアカウントやチャンネルから届いた同じノート・通知では一度だけ実行します
+func (d *Dispatcher) Dispatch(ctx context.Context, ev Event) {
+	if len(d.hooks) == 0 || d.duplicate(ev) {
+		return
+	}
+	for _, h := range d.hooks {
+		if h.match(ev) {
+			d.start(ctx, h, ev)
+		}
+	}
+}
+
+// Wait は実行中のフックが終わるまで待ちます
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+func (h entry) match(ev Event) bool {
+	if h.Event != ev.Type {
+		return false
+	}
+	if len(h.Keys) > 0 && !slices.Contains(h.Keys, ev.Account) {
+		return false
+	}
+	if h.program != nil {
+		if ev.Note == nil {
+			return false
+		}
+		return h.program.Match(&misskey.Note{Body: misskey.NoteContainer{Body: *ev.Note}})
+	}
+	return true
+}
+
+// duplicate は同じイベントを既に受け取っていればtrueを返します
+func (d *Dispatcher) duplicate(ev Event) bool {
+	var id string
+	switch {
+	case ev.Notification != nil:
+		id = ev.Account + "/notification/" + ev.Notification.ID
+	case ev.Note != nil:
+		id = ev.Note.Uri
+		if id == "" {
+			id = ev.Account + "/" + ev.Note.ID
+		}
+	default:
+		return false
+	}
+	id = string(ev.Type) + ":" + id
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen[id] {
+		return true
+	}
+	d.seen[id] = true
+	d.order = append(d.order, id)
+	if len(d.order) > maxSeen {
+		delete(d.seen, d.order[0])
+		d.order = d.order[1:]
+	}
+	return false
+}
+
+func (d *Dispatcher) start(ctx context.Context, h entry, ev Event) {
+	d.spawn(ctx, func(ctx context.Context) error {
+		return d.exec(ctx, h.Hook, ev)
+	}, func(err error) {
+		d.result(h.Hook, ev, err)
+	})
+}
+
+// Exec はイベントのフックとは別のコマンド(注目の条件のフックなど)を、同時に実行する数の制限の中で実行します
+// 実行を待たずに戻り、結果はdoneに渡します。実行を待つコマンドが多すぎる場合はErrTooManyを渡します
+func (d *Dispatcher) Exec(ctx context.Context, command string, env []string, stdin []byte, done func(error)) {
+	d.spawn(ctx, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, setting.Hook{}.TimeoutDuration())
+		defer cancel()
+		return d.run(ctx, command, env, stdin)
+	}, done)
+}
+
+// spawn は空きを待ってfを実行し、結果をdoneに渡します
+func (d *Dispatcher) spawn(ctx context.Context, f func(ctx context.Context) error, done func(error)) {
+	d.mu.Lock()
+	if d.waiting >= maxWaiting {
+		d.mu.Unlock()
+		done(ErrTooMany)
+		return
+	}
+	d.waiting++
+	d.mu.Unlock()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		select {
+		case d.sem <- struct{}{}:
+		case <-ctx.Done():
+			d.done()
+			return
+		}
+		defer func() { <-d.sem }()
+		d.done()
+
+		done(f(ctx))
+	}()
+}
+
+func (d *Dispatcher) done() {
+	d.mu.Lock()
+	d.waiting--
+	d.mu.Unlock()
+}
+
+func (d *Dispatcher) exec(ctx context.Context, h setting.Hook, ev Event) error {
+	stdin, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	env := []string{
+		"PETIT_MISSKEY_EVENT=" + string(ev.Type),
+		"PETIT_MISSKEY_ACCOUNT=" + ev.Account,
+	}
+	if ev.Note != nil {
+		env = append(env, "PETIT_MISSKEY_NOTE_ID="+ev.Note.ID, "PETIT_MISSKEY_USER="+ev.Note.User.Username, "PETIT_MISSKEY_TEXT="+ev.Note.Text)
+	}
+	if ev.Notification != nil {
+		env = append(env, "PETIT_MISSKEY_NOTIFICATION="+ev.Notification.Type)
+		if ev.Notification.User != nil {
+			env = append(env, "PETIT_MISSKEY_FROM="+ev.Notification.User.Username)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.TimeoutDuration())
+	defer cancel()
+	return d.run(ctx, h.Command, env, stdin)
+}
@@ -0,0 +1,174 @@
+package hooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func newNote(id string, text string) *misskey.Note {
+	return &misskey.Note{Body: misskey.NoteContainer{Body: misskey.NoteBody{
+		ID:   id,
+		User: misskey.NoteUser{Username: "alice"},
+		Text: text,
+	}}}
+}
+
+type call struct {
+	command string
+	env     []string
+	event   hooks.Event
+}
+
+// recorder は実行したコマンドを記録するRunFuncです
+type recorder struct {
+	mu    sync.Mutex
+	calls []call
+	err   error
+}
+
+func (r *recorder) run(ctx context.Context, command string, env []string, stdin []byte) error {
+	var ev hooks.Event
+	if err := json.Unmarshal(stdin, &ev); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call{command: command, env: env, event: ev})
+	return r.err
+}
+
+func TestEvents(t *testing.T) {
+	events := hooks.Events("io", websocket.NoteMessage{Note: newNote("1", "hello")}, now)
+	require.Len(t, events, 1)
+	assert.Equal(t, setting.HookEventNote, events[0].Type)
+	assert.Equal(t, "hello", events[0].Note.Text)
+
+	mention := &misskey.Notification{ID: "n1", Type: "reply", Note: &newNote("2", "@me hi").Body.Body}
+	events = hooks.Events("io", websocket.NotificationMessage{Notification: mention}, now)
+	require.Len(t, events, 2)
+	assert.Equal(t, setting.HookEventNotification, events[0].Type)
+	assert.Equal(t, setting.HookEventMention, events[1].Type)
+
+	events = hooks.Events("io", websocket.NotificationMessage{Notification: &misskey.Notification{Type: "follow"}}, now)
+	assert.Equal(t, setting.HookEventFollowed, events[1].Type)
+
+	events = hooks.Events("io", websocket.WebSocketDisconnectedMsg{Err: errors.New("closed")}, now)
+	assert.Equal(t, []hooks.Event{{Type: setting.HookEventDisconnect, Account: "io", At: now, Error: "closed"}}, events)
+
+	assert.Empty(t, hooks.Events("io", websocket.WebSocketConnectedMsg{}, now))
+}
+
+func TestDispatch(t *testing.T) {
+	d, err := hooks.New([]setting.Hook{
+		{Event: setting.HookEventNote, Where: `text =~ "deploy"`, Command: "deploy-hook"},
+		{Event: setting.HookEventNote, Keys: []string{"work"}, Command: "work-hook"},
+		{Event: setting.HookEventDisconnect, Command: "disconnect-hook"},
+	}, 2)
+	require.NoError(t, err)
+	r := &recorder{}
+	d.SetRunner(r.run)
+	assert.False(t, d.NeedsNotifications())
+
+	ctx := context.Background()
+	for _, ev := range hooks.Events("io", websocket.NoteMessage{Note: newNote("1", "deploy done")}, now) {
+		d.Dispatch(ctx, ev)
+	}
+	// 同じノートは一度だけ
+	for _, ev := range hooks.Events("io", websocket.NoteMessage{Note: newNote("1", "deploy done")}, now) {
+		d.Dispatch(ctx, ev)
+	}
+	for _, ev := range hooks.Events("work", websocket.NoteMessage{Note: newNote("2", "lunch")}, now) {
+		d.Dispatch(ctx, ev)
+	}
+	for _, ev := range hooks.Events("io", websocket.WebSocketErrorMsg{Err: errors.New("boom")}, now) {
+		d.Dispatch(ctx, ev)
+	}
+	d.Wait()
+
+	commands := make([]string, 0)
+	for _, c := range r.calls {
+		commands = append(commands, c.command)
+		if c.command == "deploy-hook" {
+			assert.Contains(t, c.env, "PETIT_MISSKEY_EVENT=note")
+			assert.Contains(t, c.env, "PETIT_MISSKEY_TEXT=deploy done")
+			assert.Equal(t, "1", c.event.Note.ID)
+		}
+	}
+	assert.ElementsMatch(t, []string{"deploy-hook", "work-hook", "disconnect-hook"}, commands)
+}
+
+func TestConcurrency(t *testing.T) {
+	d, err := hooks.New([]setting.Hook{{Event: setting.HookEventNote, Command: "slow", Timeout: 1}}, 2)
+	require.NoError(t, err)
+
+	var running, peak atomic.Int32
+	var timeouts atomic.Int32
+	d.SetRunner(func(ctx context.Context, command string, env []string, stdin []byte) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= time.Second {
+			timeouts.Add(1)
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	var mu sync.Mutex
+	results := 0
+	d.OnResult(func(h setting.Hook, ev hooks.Event, err error) {
+		assert.NoError(t, err)
+		mu.Lock()
+		results++
+		mu.Unlock()
+	})
+
+	for i := 0; i < 6; i++ {
+		d.Dispatch(context.Background(), hooks.Event{Type: setting.HookEventNote, Account: "io", Note: &newNote(string(rune('a'+i)), "x").Body.Body})
+	}
+	// イベントのフック以外のコマンドも同じ制限の中で実行する
+	for i := 0; i < 4; i++ {
+		d.Exec(context.Background(), "watch", nil, nil, func(err error) {
+			assert.NoError(t, err)
+			mu.Lock()
+			results++
+			mu.Unlock()
+		})
+	}
+	d.Wait()
+	assert.Equal(t, 10, results)
+	assert.Equal(t, int32(2), peak.Load())
+	assert.Equal(t, int32(6), timeouts.Load())
+}
+
+func TestInvalidHooks(t *testing.T) {
+	d, err := hooks.New([]setting.Hook{
+		{Event: "unknown", Command: "x"},
+		{Event: setting.HookEventMention},
+		{Event: setting.HookEventNote, Where: "text ==", Command: "x"},
+		{Event: setting.HookEventReaction, Command: "ok"},
+	}, 0)
+	assert.ErrorContains(t, err, `hook 1: イベント "unknown" には対応していません`)
+	assert.ErrorContains(t, err, "hook 2: command がありません")
+	assert.ErrorContains(t, err, `hook 3: 式 "text =="`)
+	assert.Equal(t, 1, d.Len())
+	assert.True(t, d.NeedsNotifications())
+}
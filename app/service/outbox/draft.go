@@ -0,0 +1,68 @@
+package outbox
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+)
+
+type (
+	// Drafts はアカウントごとの書きかけの投稿です
+	// 入力するたびに保存し、次に起動したときに投稿欄へ戻します
+	Drafts struct {
+		file   *cache.File
+		mu     sync.Mutex
+		drafts map[string]Draft
+	}
+
+	Draft struct {
+		Text      string    `json:"text"`
+		UpdatedAt time.Time `json:"updatedAt"`
+	}
+)
+
+// NewDrafts はfileに保存された下書きを読み込みます
+// fileがnilならディスクには保存しません
+func NewDrafts(file *cache.File) (*Drafts, error) {
+	d := &Drafts{
+		file:   file,
+		drafts: make(map[string]Draft),
+	}
+	if file != nil {
+		if _, err := file.Load(&d.drafts); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+// Get はアカウントの下書きを返します
+func (d *Drafts) Get(key string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.drafts[key].Text
+}
+
+// Save はアカウントの下書きを保存します。空なら下書きを消します
+func (d *Drafts) Save(key, text string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.drafts[key].Text == text {
+		return nil
+	}
+	if text == "" {
+		delete(d.drafts, key)
+	} else {
+		d.drafts[key] = Draft{Text: text, UpdatedAt: time.Now()}
+	}
+	if d.file == nil {
+		return nil
+	}
+	return d.file.Write(d.drafts)
+}
+
+// Clear はアカウントの下書きを消します
+func (d *Drafts) Clear(key string) error {
+	return d.Save(key, "")
+}
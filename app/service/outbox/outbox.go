@@ -0,0 +1,214 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// Outbox は送信できなかった投稿の待ち行列です
+	// 未接続のときの投稿やサーバーに届かずに失敗した投稿をディスクに残し、あとで送り直します
+	Outbox struct {
+		file  *cache.File
+		mu    sync.Mutex
+		seq   int
+		items []Item
+	}
+
+	// Item は送信待ちの投稿です
+	// アクセストークンは保存せず、送り直すときにアカウントのクライアントが付けます
+	Item struct {
+		ID          string             `json:"id"`
+		Key         string             `json:"key"`
+		Note        misskey.CreateNote `json:"note"`
+		CreatedAt   time.Time          `json:"createdAt"`
+		Attempts    int                `json:"attempts"`
+		NextAttempt time.Time          `json:"nextAttempt"`
+		LastError   string             `json:"lastError,omitempty"`
+		Failed      bool               `json:"failed,omitempty"`    // 送り直しても成功しない(もう送らない)
+		Uncertain   bool               `json:"uncertain,omitempty"` // 投稿できたか分からない(二重投稿を避けるためもう送らない)
+	}
+
+	// Status は待ち行列の状態です
+	Status struct {
+		Pending   int
+		Failed    int
+		Uncertain int
+		LastError string
+	}
+)
+
+const (
+	retryInterval = 30 * time.Second
+	maxRetryDelay = 30 * time.Minute
+)
+
+// New はfileに保存された待ち行列を読み込みます
+// fileがnilならディスクには保存しません
+func New(file *cache.File) (*Outbox, error) {
+	o := &Outbox{file: file}
+	if file != nil {
+		if _, err := file.Load(&o.items); err != nil {
+			return o, err
+		}
+	}
+	o.seq = len(o.items)
+	return o, nil
+}
+
+// Add は投稿を待ち行列に加えます
+func (o *Outbox) Add(key string, note misskey.CreateNote, now time.Time) (Item, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq++
+	note.AccessToken = ""
+	item := Item{
+		ID:          fmt.Sprintf("%d-%d", now.UnixNano(), o.seq),
+		Key:         key,
+		Note:        note,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+	o.items = append(o.items, item)
+	return item, o.save()
+}
+
+// Due はアカウントの送信待ちの投稿のうち、送り直す時刻になったものを古い順に返します
+func (o *Outbox) Due(key string, now time.Time) []Item {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	items := make([]Item, 0)
+	for _, item := range o.items {
+		if item.Key == key && !item.Failed && !item.NextAttempt.After(now) {
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	return items
+}
+
+// Items は待ち行列の投稿をすべて返します
+func (o *Outbox) Items() []Item {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Item(nil), o.items...)
+}
+
+// Done は送信できた投稿を待ち行列から取り除きます
+func (o *Outbox) Done(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, item := range o.items {
+		if item.ID == id {
+			o.items = append(o.items[:i], o.items[i+1:]...)
+			return o.save()
+		}
+	}
+	return nil
+}
+
+// Retry は送信に失敗した投稿を記録します
+// サーバーに届かなかったのなら間隔を空けて送り直し、そうでなければ失敗として残します
+// タイムアウトやサーバー側のエラーは投稿できている場合があるので、送り直さずに不明として残します
+func (o *Outbox) Retry(id string, cause error, now time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := range o.items {
+		item := &o.items[i]
+		if item.ID != id {
+			continue
+		}
+		item.Attempts++
+		item.LastError = cause.Error()
+		item.Failed = !IsUnsent(cause)
+		item.Uncertain = item.Failed && IsTransient(cause)
+		item.NextAttempt = now.Add(RetryDelay(item.Attempts))
+		return o.save()
+	}
+	return nil
+}
+
+// Status は待ち行列の状態を返します
+func (o *Outbox) Status() Status {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var status Status
+	for _, item := range o.items {
+		switch {
+		case item.Uncertain:
+			status.Uncertain++
+		case item.Failed:
+			status.Failed++
+		default:
+			status.Pending++
+		}
+		if item.LastError != "" {
+			status.LastError = item.LastError
+		}
+	}
+	return status
+}
+
+func (o *Outbox) save() error {
+	if o.file == nil {
+		return nil
+	}
+	return o.file.Write(o.items)
+}
+
+// RetryDelay はattempts回失敗したあと送り直すまでの間隔を返します。失敗するたびに倍にし、30分で頭打ちにします
+func RetryDelay(attempts int) time.Duration {
+	d := retryInterval
+	for i := 1; i < attempts && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryDelay)
+}
+
+// IsTransient は送り直せば成功するかもしれないエラーかどうかを返します
+// 通信エラーやタイムアウト、サーバー側のエラーが該当し、内容の誤りなどは該当しません
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var status *api.StatusError
+	if errors.As(err, &status) {
+		return status.Temporary()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// IsUnsent はリクエストがサーバーに届かなかったことが確かなエラーかどうかを返します
+// 名前解決や接続の失敗、レート制限が該当します
+// タイムアウトやサーバー側のエラーは処理済みのことがあるので該当しません(投稿を送り直すと二重投稿になります)
+func IsUnsent(err error) bool {
+	if err == nil {
+		return false
+	}
+	var status *api.StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusTooManyRequests
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
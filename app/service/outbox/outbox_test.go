@@ -0,0 +1,102 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/outbox"
+)
+
+func TestDrafts(t *testing.T) {
+	file := cache.NewFileAt(filepath.Join(t.TempDir(), "drafts.json"))
+	drafts, err := outbox.NewDrafts(file)
+	assert.NoError(t, err)
+	assert.NoError(t, drafts.Save("a", "書きかけ\n2行目"))
+	assert.NoError(t, drafts.Save("b", "別のアカウント"))
+
+	// 次に起動したときにも残っている
+	restored, err := outbox.NewDrafts(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "書きかけ\n2行目", restored.Get("a"))
+	assert.Equal(t, "別のアカウント", restored.Get("b"))
+
+	assert.NoError(t, restored.Clear("a"))
+	restored, _ = outbox.NewDrafts(file)
+	assert.Equal(t, "", restored.Get("a"))
+	assert.Equal(t, "別のアカウント", restored.Get("b"))
+}
+
+func TestOutbox(t *testing.T) {
+	file := cache.NewFileAt(filepath.Join(t.TempDir(), "outbox.json"))
+	box, err := outbox.New(file)
+	assert.NoError(t, err)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	first, err := box.Add("a", misskey.CreateNote{AccessToken: "secret", Text: "1"}, now)
+	assert.NoError(t, err)
+	_, err = box.Add("a", misskey.CreateNote{Text: "2"}, now.Add(time.Second))
+	assert.NoError(t, err)
+	_, err = box.Add("b", misskey.CreateNote{Text: "3"}, now)
+	assert.NoError(t, err)
+
+	// トークンは保存しない
+	box, _ = outbox.New(file)
+	due := box.Due("a", now.Add(time.Second))
+	assert.Len(t, due, 2)
+	assert.Equal(t, "1", due[0].Note.Text)
+	assert.Equal(t, misskey.AccessToken(""), due[0].Note.AccessToken)
+
+	// サーバーに届かなかったなら間隔を空けて送り直す
+	refused := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	assert.NoError(t, box.Retry(first.ID, refused, now))
+	assert.Len(t, box.Due("a", now.Add(time.Second)), 1)
+	assert.Len(t, box.Due("a", now.Add(30*time.Second)), 2)
+	assert.NoError(t, box.Retry(first.ID, &api.StatusError{StatusCode: 429}, now))
+	assert.Len(t, box.Due("a", now.Add(30*time.Second)), 1)
+	assert.Len(t, box.Due("a", now.Add(time.Minute)), 2)
+
+	// 内容の誤りは送り直さずに失敗として残す
+	assert.NoError(t, box.Retry(first.ID, &api.StatusError{StatusCode: 400}, now))
+	assert.Len(t, box.Due("a", now.Add(time.Hour)), 1)
+	assert.Equal(t, outbox.Status{Pending: 2, Failed: 1, LastError: "http bad status: 400"}, box.Status())
+
+	// タイムアウトやサーバー側のエラーは投稿できたか分からないので送り直さない
+	second := box.Due("a", now.Add(time.Hour))[0]
+	assert.NoError(t, box.Retry(second.ID, context.DeadlineExceeded, now))
+	assert.Empty(t, box.Due("a", now.Add(time.Hour)))
+	assert.Equal(t, 1, box.Status().Uncertain)
+
+	assert.NoError(t, box.Done(box.Due("b", now)[0].ID))
+	box, _ = outbox.New(file)
+	assert.Len(t, box.Items(), 2)
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, outbox.IsTransient(pkgerrors.WithStack(&api.StatusError{StatusCode: 502})))
+	assert.True(t, outbox.IsTransient(&api.StatusError{StatusCode: 429}))
+	assert.False(t, outbox.IsTransient(&api.StatusError{StatusCode: 400}))
+	assert.True(t, outbox.IsTransient(fmt.Errorf("post: %w", context.DeadlineExceeded)))
+	assert.True(t, outbox.IsTransient(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.False(t, outbox.IsTransient(errors.New("invalid")))
+	assert.False(t, outbox.IsTransient(nil))
+}
+
+func TestIsUnsent(t *testing.T) {
+	assert.True(t, outbox.IsUnsent(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.True(t, outbox.IsUnsent(fmt.Errorf("post: %w", &net.DNSError{Err: "no such host"})))
+	assert.True(t, outbox.IsUnsent(pkgerrors.WithStack(&api.StatusError{StatusCode: 429})))
+	assert.False(t, outbox.IsUnsent(&api.StatusError{StatusCode: 502}))
+	assert.False(t, outbox.IsUnsent(fmt.Errorf("post: %w", context.DeadlineExceeded)))
+	assert.False(t, outbox.IsUnsent(&net.OpError{Op: "read", Err: errors.New("connection reset")}))
+	assert.False(t, outbox.IsUnsent(nil))
+}
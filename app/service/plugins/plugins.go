@@ -0,0 +1,609 @@
+// Package plugins は外部のプログラムをプラグインとして起動し、標準入出力のJSON-RPCでやり取りします
+// プラグインはストリームのイベントの購読、投稿欄のコマンドとキー割り当ての登録、
+// ノートへの表示の追加と、許可したAPIの呼び出しができます
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/jsonrpc"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+)
+
+type (
+	// Host は設定したプラグインを起動し、呼び出しを仲介します
+	// プラグインが終了したり応答しなくなったりしても、呼び出し側にはエラーを返すだけにします
+	Host struct {
+		plugins  []*plugin
+		accounts []string // APIを呼び出せるインスタンスキー(先頭は既定のアカウント)
+		clients  ClientFunc
+		muClient sync.Mutex
+		message  MessageFunc
+		exit     ExitFunc
+		mu       sync.Mutex
+		closing  bool
+	}
+
+	plugin struct {
+		setting.Plugin
+		cmd      *exec.Cmd
+		conn     *jsonrpc.Conn
+		stderr   *tail
+		events   chan hooks.Event
+		exited   chan struct{}
+		mu       sync.Mutex
+		manifest Manifest
+		err      error // 停止した理由(動いている間はnil)
+	}
+
+	// Manifest はプラグインがinitializeの応答で登録する機能です
+	Manifest struct {
+		Events      []setting.HookEvent `json:"events"`      // 購読するイベント(フックと同じ種類)
+		Commands    []Command           `json:"commands"`    // 投稿欄から ":name 引数" で実行するコマンド
+		Keys        []Key               `json:"keys"`        // コマンドを実行するキー割り当て
+		Decorations bool                `json:"decorations"` // ノートに表示を追加するか
+	}
+
+	// Command はプラグインが登録したコマンドです
+	Command struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Plugin      string `json:"-"`
+	}
+
+	// Key はプラグインが登録したキー割り当てです
+	Key struct {
+		Key     string `json:"key"`     // 例: ctrl+t
+		Command string `json:"command"` // 実行するコマンドの名前
+		Plugin  string `json:"-"`
+	}
+
+	// Decoration はプラグインがノートに追加する表示です
+	Decoration struct {
+		Plugin string
+		Text   string
+	}
+
+	// Status はプラグインの状態です
+	Status struct {
+		Name     string
+		Running  bool
+		Err      error // 停止した理由
+		Manifest Manifest
+	}
+
+	// CommandParams はコマンドの実行でプラグインに渡す内容です
+	CommandParams struct {
+		Name    string            `json:"name"`
+		Args    []string          `json:"args"`
+		Account string            `json:"account"`
+		Note    *misskey.NoteBody `json:"note,omitempty"` // 選択中のノート
+	}
+
+	// ClientFunc はインスタンスキーからAPIクライアントを返す関数です
+	ClientFunc func(key string) (api.Client, error)
+
+	// MessageFunc はプラグインからの表示の依頼を受け取る関数です
+	MessageFunc func(plugin string, text string)
+
+	// ExitFunc はプラグインが止まったことを受け取る関数です
+	ExitFunc func(plugin string, err error)
+
+	initializeParams struct {
+		ProtocolVersion int      `json:"protocolVersion"`
+		Name            string   `json:"name"`
+		Accounts        []string `json:"accounts"`
+	}
+
+	commandResult struct {
+		Text string `json:"text"`
+	}
+
+	decorateParams struct {
+		Account string            `json:"account"`
+		Note    *misskey.NoteBody `json:"note"`
+	}
+
+	decorateResult struct {
+		Text string `json:"text"`
+	}
+
+	apiCallParams struct {
+		Account  string         `json:"account"`
+		Endpoint string         `json:"endpoint"`
+		Params   map[string]any `json:"params"`
+	}
+
+	messageParams struct {
+		Text string `json:"text"`
+	}
+)
+
+// ProtocolVersion はinitializeで伝えるプロトコルの版です
+const ProtocolVersion = 1
+
+// プラグインに送るメソッド
+const (
+	MethodInitialize = "initialize" // 起動直後。応答でManifestを返す
+	MethodEvent      = "event"      // 購読したイベント(通知)
+	MethodCommand    = "command"    // 登録したコマンドの実行
+	MethodDecorate   = "decorate"   // ノートに追加する表示の問い合わせ
+	MethodShutdown   = "shutdown"   // 終了の前触れ(通知)
+)
+
+// プラグインから呼び出せるメソッド
+const (
+	MethodAPICall = "api.call"   // 許可したAPIの呼び出し
+	MethodMessage = "ui.message" // ステータス欄への表示
+)
+
+// ホストが返すエラーコード
+const (
+	CodeForbidden = -32001 // 許可していないエンドポイントやアカウント
+	CodeAPIError  = -32002 // APIの呼び出しの失敗
+)
+
+const (
+	initializeTimeout = 5 * time.Second
+	decorateTimeout   = 2 * time.Second
+	apiTimeout        = 30 * time.Second
+	shutdownTimeout   = 2 * time.Second
+	maxQueuedEvents   = 100 // プラグインに送る前のイベントの上限(超えたら捨てる)
+	maxStderr         = 4096
+)
+
+// New はプラグインの設定からHostを生成します
+// accountsはプラグインがAPIを呼び出せるインスタンスキー、clientsはそのクライアントを返す関数です
+func New(plugins []setting.Plugin, accounts []string, clients ClientFunc) *Host {
+	h := &Host{
+		accounts: accounts,
+		clients:  clients,
+		message:  func(string, string) {},
+		exit:     func(string, error) {},
+	}
+	for _, p := range plugins {
+		h.plugins = append(h.plugins, &plugin{Plugin: p})
+	}
+	return h
+}
+
+// OnMessage はプラグインからの表示の依頼を受け取る関数を設定します
+func (h *Host) OnMessage(f MessageFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.message = f
+}
+
+// OnExit はプラグインが止まったことを受け取る関数を設定します
+// 起動した後に設定しても構いません
+func (h *Host) OnExit(f ExitFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.exit = f
+}
+
+// Len は設定したプラグインの数を返します
+func (h *Host) Len() int {
+	return len(h.plugins)
+}
+
+// Start はすべてのプラグインを起動し、initializeの応答を待ちます
+// 起動できなかったプラグインはエラーにまとめて返し、それ以外のプラグインは使えるようにします
+func (h *Host) Start(ctx context.Context) error {
+	errs := make([]error, len(h.plugins))
+	var wg sync.WaitGroup
+	for i, p := range h.plugins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.start(ctx, p); err != nil {
+				p.stop(err)
+				errs[i] = fmt.Errorf("プラグイン %s: %w", p.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (h *Host) start(ctx context.Context, p *plugin) error {
+	if p.Command == "" {
+		return errors.New("command がありません")
+	}
+	p.cmd = exec.Command(p.Command, p.Args...)
+	p.cmd.Env = append(os.Environ(), "PETIT_MISSKEY_PLUGIN="+p.Name)
+	p.stderr = &tail{}
+	p.cmd.Stderr = p.stderr
+	p.events = make(chan hooks.Event, maxQueuedEvents)
+	p.exited = make(chan struct{})
+
+	stdin, err := p.cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("起動できません: %w", err)
+	}
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("起動できません: %w", err)
+	}
+	if err := p.cmd.Start(); err != nil {
+		close(p.exited)
+		return fmt.Errorf("起動できません: %w", err)
+	}
+	p.conn = jsonrpc.NewConn(stdout, stdin, h.handler(p))
+	go h.wait(p)
+	go p.deliver()
+
+	ctx, cancel := context.WithTimeout(ctx, initializeTimeout)
+	defer cancel()
+	var manifest Manifest
+	params := initializeParams{ProtocolVersion: ProtocolVersion, Name: p.Name, Accounts: h.accounts}
+	if err := p.conn.Call(ctx, MethodInitialize, params, &manifest); err != nil {
+		err = fmt.Errorf("initialize に失敗しました: %w", p.reason(err))
+		p.stop(err)
+		p.kill()
+		return err
+	}
+	for i := range manifest.Commands {
+		manifest.Commands[i].Plugin = p.Name
+	}
+	for i := range manifest.Keys {
+		manifest.Keys[i].Plugin = p.Name
+	}
+	p.mu.Lock()
+	p.manifest = manifest
+	p.mu.Unlock()
+	return nil
+}
+
+// wait はプラグインの終了を待ち、止まった理由を記録します
+func (h *Host) wait(p *plugin) {
+	// 標準出力を読み終えてからWaitを呼ぶ
+	// 標準入力を読まなくなったプラグインは、動いていても止める
+	<-p.conn.Done()
+	if errors.Is(p.conn.Err(), jsonrpc.ErrStalled) {
+		p.kill()
+	}
+	err := p.cmd.Wait()
+	if err == nil {
+		err = errors.New("終了しました")
+	}
+	if errors.Is(p.conn.Err(), jsonrpc.ErrStalled) {
+		err = errors.New("標準入力を読まなくなったため停止しました")
+	}
+	if msg := p.stderr.last(); msg != "" {
+		err = fmt.Errorf("%w: %s", err, msg)
+	}
+	first := p.stop(err)
+	close(p.exited)
+
+	h.mu.Lock()
+	closing, exit := h.closing, h.exit
+	h.mu.Unlock()
+	if first && !closing {
+		exit(p.Name, err)
+	}
+}
+
+// Close はプラグインに終了を伝え、終わらなければ強制終了します
+func (h *Host) Close() {
+	h.mu.Lock()
+	h.closing = true
+	h.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range h.plugins {
+		if p.exited == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.running() {
+				// 標準入力を読まないプラグインでも待ち続けないよう、送るのを待たない
+				go func() {
+					p.conn.Notify(MethodShutdown, nil)
+					p.conn.CloseWrite()
+				}()
+			}
+			select {
+			case <-p.exited:
+			case <-time.After(shutdownTimeout):
+				p.kill()
+				<-p.exited
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Publish はイベントを購読しているプラグインに送ります
+// 送るのを待たずに戻り、プラグインが読み切れないイベントは捨てます
+func (h *Host) Publish(ev hooks.Event) {
+	for _, p := range h.plugins {
+		if !p.running() || !slices.Contains(p.manifestCopy().Events, ev.Type) {
+			continue
+		}
+		select {
+		case p.events <- ev:
+		default:
+		}
+	}
+}
+
+// NeedsNotifications は通知のイベントを購読するプラグインがあるかを返します
+// 通知はmainチャンネルを購読しないと届きません
+func (h *Host) NeedsNotifications() bool {
+	for _, p := range h.plugins {
+		for _, ev := range p.manifestCopy().Events {
+			switch ev {
+			case setting.HookEventMention, setting.HookEventNotification, setting.HookEventFollowed, setting.HookEventReaction:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Commands は動いているプラグインが登録したコマンドを返します
+func (h *Host) Commands() []Command {
+	commands := make([]Command, 0)
+	for _, p := range h.plugins {
+		if p.running() {
+			commands = append(commands, p.manifestCopy().Commands...)
+		}
+	}
+	return commands
+}
+
+// Command は名前のコマンドを返します
+// 止まったプラグインのコマンドも返し、実行すると止まった理由のエラーになります
+func (h *Host) Command(name string) (Command, bool) {
+	for _, p := range h.plugins {
+		for _, c := range p.manifestCopy().Commands {
+			if c.Name == name {
+				return c, true
+			}
+		}
+	}
+	return Command{}, false
+}
+
+// KeyCommand はキーに割り当てたコマンドを返します
+func (h *Host) KeyCommand(key string) (Command, bool) {
+	for _, p := range h.plugins {
+		for _, k := range p.manifestCopy().Keys {
+			if k.Key == key {
+				return h.Command(k.Command)
+			}
+		}
+	}
+	return Command{}, false
+}
+
+// RunCommand はコマンドを登録したプラグインで実行し、表示する結果を返します
+func (h *Host) RunCommand(ctx context.Context, params CommandParams) (string, error) {
+	command, ok := h.Command(params.Name)
+	if !ok {
+		return "", fmt.Errorf("コマンド %s はありません", params.Name)
+	}
+	p := h.find(command.Plugin)
+	if err := p.available(); err != nil {
+		return "", err
+	}
+	var result commandResult
+	if err := p.conn.Call(ctx, MethodCommand, params, &result); err != nil {
+		return "", fmt.Errorf("プラグイン %s: %w", p.Name, p.reason(err))
+	}
+	return result.Text, nil
+}
+
+// Decorate はノートに追加する表示をプラグインに問い合わせます
+// 応答しない・失敗したプラグインの表示は省きます
+func (h *Host) Decorate(ctx context.Context, account string, note *misskey.NoteBody) []Decoration {
+	decorations := make([]Decoration, 0)
+	for _, p := range h.plugins {
+		if !p.running() || !p.manifestCopy().Decorations {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, decorateTimeout)
+		var result decorateResult
+		err := p.conn.Call(ctx, MethodDecorate, decorateParams{Account: account, Note: note}, &result)
+		cancel()
+		if err == nil && strings.TrimSpace(result.Text) != "" {
+			decorations = append(decorations, Decoration{Plugin: p.Name, Text: result.Text})
+		}
+	}
+	return decorations
+}
+
+// Decorates はノートに表示を追加するプラグインがあるかを返します
+func (h *Host) Decorates() bool {
+	for _, p := range h.plugins {
+		if p.running() && p.manifestCopy().Decorations {
+			return true
+		}
+	}
+	return false
+}
+
+// Status はプラグインの状態の一覧を返します
+func (h *Host) Status() []Status {
+	statuses := make([]Status, 0, len(h.plugins))
+	for _, p := range h.plugins {
+		p.mu.Lock()
+		statuses = append(statuses, Status{Name: p.Name, Running: p.err == nil, Err: p.err, Manifest: p.manifest})
+		p.mu.Unlock()
+	}
+	return statuses
+}
+
+// handler はプラグインから届いたリクエストを処理します
+func (h *Host) handler(p *plugin) jsonrpc.Handler {
+	return func(ctx context.Context, method string, params json.RawMessage) (any, error) {
+		switch method {
+		case MethodAPICall:
+			return h.callAPI(ctx, p, params)
+		case MethodMessage:
+			var req messageParams
+			if err := json.Unmarshal(params, &req); err != nil {
+				return nil, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: err.Error()}
+			}
+			h.mu.Lock()
+			message := h.message
+			h.mu.Unlock()
+			message(p.Name, req.Text)
+			return nil, nil
+		}
+		return nil, &jsonrpc.Error{Code: jsonrpc.CodeMethodNotFound, Message: "method not found: " + method}
+	}
+}
+
+// callAPI はプラグインに許可したエンドポイントだけを、ホストのクライアントで呼び出します
+func (h *Host) callAPI(ctx context.Context, p *plugin, params json.RawMessage) (any, error) {
+	var req apiCallParams
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: err.Error()}
+	}
+	endpoint := strings.TrimPrefix(strings.Trim(req.Endpoint, "/"), "api/")
+	if !slices.Contains(p.Endpoints, endpoint) {
+		return nil, &jsonrpc.Error{Code: CodeForbidden, Message: fmt.Sprintf("endpoint %q is not allowed", endpoint)}
+	}
+	account := req.Account
+	if account == "" && len(h.accounts) > 0 {
+		account = h.accounts[0]
+	}
+	if !slices.Contains(h.accounts, account) {
+		return nil, &jsonrpc.Error{Code: CodeForbidden, Message: fmt.Sprintf("account %q is not allowed", account)}
+	}
+
+	h.muClient.Lock()
+	client, err := h.clients(account)
+	h.muClient.Unlock()
+	if err != nil {
+		return nil, &jsonrpc.Error{Code: CodeAPIError, Message: err.Error()}
+	}
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+	result, err := client.Call(ctx, endpoint, req.Params)
+	if err != nil {
+		return nil, &jsonrpc.Error{Code: CodeAPIError, Message: err.Error()}
+	}
+	return result, nil
+}
+
+func (h *Host) find(name string) *plugin {
+	for _, p := range h.plugins {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// deliver は購読したイベントを順にプラグインへ送ります
+func (p *plugin) deliver() {
+	for {
+		select {
+		case ev := <-p.events:
+			p.conn.Notify(MethodEvent, ev)
+		case <-p.exited:
+			return
+		}
+	}
+}
+
+// stop は止まった理由を記録し、初めて止まった場合はtrueを返します
+func (p *plugin) stop(err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return false
+	}
+	p.err = err
+	return true
+}
+
+func (p *plugin) kill() {
+	if p.cmd != nil && p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+}
+
+func (p *plugin) running() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err == nil && p.conn != nil
+}
+
+// available は呼び出せるプラグインならnil、そうでなければ理由を返します
+func (p *plugin) available() error {
+	if p == nil {
+		return errors.New("プラグインがありません")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return fmt.Errorf("プラグイン %s は停止しています: %w", p.Name, p.err)
+	}
+	return nil
+}
+
+// reason は呼び出しの失敗がプラグインの終了によるものなら、終了の理由を返します
+func (p *plugin) reason(err error) error {
+	if !errors.Is(err, jsonrpc.ErrClosed) {
+		return err
+	}
+	select {
+	case <-p.exited:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.err != nil {
+			return p.err
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+	return err
+}
+
+func (p *plugin) manifestCopy() Manifest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.manifest
+}
+
+// tail はプラグインの標準エラー出力の末尾を保持します
+type tail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *tail) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, b...)
+	if len(t.buf) > maxStderr {
+		t.buf = t.buf[len(t.buf)-maxStderr:]
+	}
+	return len(b), nil
+}
+
+// last は最後の空でない行を返します
+func (t *tail) last() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := bytes.Split(bytes.TrimSpace(t.buf), []byte("\n"))
+	return strings.TrimSpace(string(lines[len(lines)-1]))
+}
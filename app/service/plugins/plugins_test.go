@@ -0,0 +1,210 @@
+package plugins_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/jsonrpc"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+	"github.com/wasya-io/petit-misskey/service/plugins"
+)
+
+// テストのバイナリ自身をプラグインとして起動する
+func TestMain(m *testing.M) {
+	if name := os.Getenv("PETIT_MISSKEY_PLUGIN"); name != "" {
+		runFakePlugin(name)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runFakePlugin は名前に応じて振る舞うプラグインです
+// hang は initialize に応答しません。deaf は initialize に応答したあと標準入力を読みません
+func runFakePlugin(name string) {
+	if name == "deaf" {
+		line, _ := bufio.NewReader(os.Stdin).ReadBytes('\n')
+		var req struct {
+			ID json.RawMessage `json:"id"`
+		}
+		json.Unmarshal(line, &req)
+		fmt.Printf(`{"jsonrpc":"2.0","id":%s,"result":{"events":["note"],"decorations":true}}`+"\n", req.ID)
+		time.Sleep(time.Hour)
+	}
+	var conn *jsonrpc.Conn
+	handler := func(ctx context.Context, method string, params json.RawMessage) (any, error) {
+		if name == "hang" {
+			<-ctx.Done()
+			return nil, nil
+		}
+		switch method {
+		case plugins.MethodInitialize:
+			return plugins.Manifest{
+				Events:      []setting.HookEvent{setting.HookEventNote},
+				Commands:    []plugins.Command{{Name: "show", Description: "ノートを表示"}, {Name: "crash"}},
+				Keys:        []plugins.Key{{Key: "ctrl+t", Command: "show"}},
+				Decorations: true,
+			}, nil
+		case plugins.MethodEvent:
+			var ev hooks.Event
+			json.Unmarshal(params, &ev)
+			conn.Call(ctx, plugins.MethodMessage, map[string]string{"text": "event " + ev.Note.ID}, nil)
+			return nil, nil
+		case plugins.MethodDecorate:
+			var req struct{ Note misskey.NoteBody }
+			json.Unmarshal(params, &req)
+			return map[string]string{"text": "🌐 " + strings.ToUpper(req.Note.Text)}, nil
+		case plugins.MethodCommand:
+			var req plugins.CommandParams
+			json.Unmarshal(params, &req)
+			if req.Name == "crash" {
+				fmt.Fprintln(os.Stderr, "boom")
+				os.Exit(3)
+			}
+			endpoint := "notes/show"
+			if len(req.Args) > 0 {
+				endpoint = req.Args[0]
+			}
+			var note misskey.NoteBody
+			if err := conn.Call(ctx, plugins.MethodAPICall, map[string]any{"endpoint": endpoint, "params": map[string]any{"noteId": req.Note.ID}}, &note); err != nil {
+				return map[string]string{"text": err.Error()}, nil
+			}
+			return map[string]string{"text": req.Account + ": " + note.Text}, nil
+		}
+		return nil, nil
+	}
+	conn = jsonrpc.NewConn(os.Stdin, os.Stdout, handler)
+	<-conn.Done()
+}
+
+// apiMock は notes/show だけに応答するAPIクライアントです
+type apiMock struct {
+	api.Client
+}
+
+func (c *apiMock) Call(ctx context.Context, endpoint string, params map[string]any) (json.RawMessage, error) {
+	return json.RawMessage(fmt.Sprintf(`{"id":%q,"text":"hello"}`, params["noteId"])), nil
+}
+
+func newHost(names ...string) *plugins.Host {
+	settings := make([]setting.Plugin, 0, len(names))
+	for _, name := range names {
+		settings = append(settings, setting.Plugin{Name: name, Command: os.Args[0], Args: []string{"-test.run=^$"}, Endpoints: []string{"notes/show"}})
+	}
+	return plugins.New(settings, []string{"io"}, func(key string) (api.Client, error) { return &apiMock{}, nil })
+}
+
+func TestHost(t *testing.T) {
+	host := newHost("fake")
+	messages := make(chan string, 1)
+	host.OnMessage(func(plugin string, text string) { messages <- plugin + ": " + text })
+	require.NoError(t, host.Start(context.Background()))
+	defer host.Close()
+
+	assert.Equal(t, []plugins.Command{{Name: "show", Description: "ノートを表示", Plugin: "fake"}, {Name: "crash", Plugin: "fake"}}, host.Commands())
+	command, ok := host.KeyCommand("ctrl+t")
+	assert.True(t, ok)
+	assert.Equal(t, "show", command.Name)
+	assert.False(t, host.NeedsNotifications())
+
+	ctx := context.Background()
+	note := &misskey.NoteBody{ID: "n1", Text: "hi"}
+	assert.Equal(t, []plugins.Decoration{{Plugin: "fake", Text: "🌐 HI"}}, host.Decorate(ctx, "io", note))
+
+	text, err := host.RunCommand(ctx, plugins.CommandParams{Name: "show", Account: "io", Note: note})
+	assert.NoError(t, err)
+	assert.Equal(t, "io: hello", text)
+
+	// 許可していないエンドポイントは呼び出せない
+	text, err = host.RunCommand(ctx, plugins.CommandParams{Name: "show", Args: []string{"i/notifications"}, Note: note})
+	assert.NoError(t, err)
+	assert.Contains(t, text, `endpoint "i/notifications" is not allowed`)
+
+	host.Publish(hooks.Event{Type: setting.HookEventNote, Account: "io", Note: note})
+	select {
+	case msg := <-messages:
+		assert.Equal(t, "fake: event n1", msg)
+	case <-time.After(2 * time.Second):
+		t.Fatal("イベントが届きません")
+	}
+}
+
+func TestCrash(t *testing.T) {
+	host := newHost("fake")
+	exited := make(chan error, 1)
+	host.OnExit(func(plugin string, err error) { exited <- err })
+	require.NoError(t, host.Start(context.Background()))
+	defer host.Close()
+
+	_, err := host.RunCommand(context.Background(), plugins.CommandParams{Name: "crash"})
+	assert.ErrorContains(t, err, "boom")
+	select {
+	case err := <-exited:
+		assert.ErrorContains(t, err, "exit status 3: boom")
+	case <-time.After(2 * time.Second):
+		t.Fatal("終了が知らされません")
+	}
+
+	// 止まったプラグインの機能は使えなくなるだけ
+	assert.Empty(t, host.Commands())
+	_, err = host.RunCommand(context.Background(), plugins.CommandParams{Name: "show"})
+	assert.ErrorContains(t, err, "プラグイン fake は停止しています")
+	assert.Empty(t, host.Decorate(context.Background(), "io", &misskey.NoteBody{}))
+	host.Publish(hooks.Event{Type: setting.HookEventNote})
+	assert.False(t, host.Status()[0].Running)
+}
+
+func TestStartFailure(t *testing.T) {
+	host := newHost("hang", "fake")
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err := host.Start(ctx)
+	assert.ErrorContains(t, err, "プラグイン hang: initialize に失敗しました")
+	defer host.Close()
+
+	statuses := host.Status()
+	assert.False(t, statuses[0].Running)
+	assert.True(t, statuses[1].Running)
+
+	missing := plugins.New([]setting.Plugin{{Name: "missing", Command: "/nonexistent/plugin"}}, nil, nil)
+	assert.ErrorContains(t, missing.Start(context.Background()), "起動できません")
+	missing.Close()
+}
+
+func TestStalledPlugin(t *testing.T) {
+	host := newHost("deaf")
+	exited := make(chan error, 1)
+	host.OnExit(func(plugin string, err error) { exited <- err })
+	require.NoError(t, host.Start(context.Background()))
+	defer host.Close()
+
+	// 標準入力を読まないプラグインにイベントを送り続けても、呼び出しはctxで打ち切れる
+	note := &misskey.NoteBody{ID: "n1", Text: strings.Repeat("あ", 1000)}
+	deadline := time.After(15 * time.Second)
+	for {
+		host.Publish(hooks.Event{Type: setting.HookEventNote, Account: "io", Note: note})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		host.Decorate(ctx, "io", note)
+		cancel()
+		select {
+		case err := <-exited:
+			// 書き出し待ちがいっぱいのままなら止める
+			assert.ErrorContains(t, err, "標準入力を読まなくなったため停止しました")
+			assert.False(t, host.Status()[0].Running)
+			return
+		case <-deadline:
+			t.Fatal("読まないプラグインが止まりません")
+		default:
+		}
+	}
+}
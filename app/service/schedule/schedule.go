@@ -0,0 +1,264 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/outbox"
+)
+
+type (
+	// Queue は予約投稿の待ち行列です
+	// post --at と schedule run のように別のプロセスから使うため、操作のたびにファイルを読み直します
+	// 書き換えはファイルのロックを取ってから行い、送信は1つのプロセスに限ります
+	Queue struct {
+		file   *cache.File
+		mu     sync.Mutex
+		runner *cache.Lock // Acquireで取った送信のロック
+	}
+
+	// Post は予約した投稿です
+	// アクセストークンは保存せず、送るときにアカウントのクライアントが付けます
+	Post struct {
+		ID          string             `json:"id"`
+		Key         string             `json:"key"`
+		Note        misskey.CreateNote `json:"note"`
+		At          time.Time          `json:"at"` // 投稿する時刻
+		CreatedAt   time.Time          `json:"createdAt"`
+		Attempts    int                `json:"attempts,omitempty"`
+		NextAttempt time.Time          `json:"nextAttempt"`
+		LastError   string             `json:"lastError,omitempty"`
+		Failed      bool               `json:"failed,omitempty"`    // 送り直しても成功しない(もう送らない)
+		Uncertain   bool               `json:"uncertain,omitempty"` // 投稿できたか分からない(二重投稿を避けるためもう送らない)
+	}
+
+	// Result は予約投稿を送った結果です
+	Result struct {
+		Post Post
+		Err  error
+	}
+
+	// ClientFunc はインスタンスキーに対応するAPIクライアントを返します
+	ClientFunc func(key string) (api.Client, error)
+)
+
+var (
+	ErrNotFound = errors.New("予約投稿が見つかりません")
+	ErrRunning  = errors.New("ほかのプロセスが予約投稿を送信しています")
+)
+
+const sendTimeout = 30 * time.Second
+
+// 時刻の指定に使える書式(タイムゾーンがなければローカル時刻)
+var timeLayouts = []string{
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	"2006/01/02 15:04",
+}
+
+func New(file *cache.File) *Queue {
+	return &Queue{file: file}
+}
+
+// ParseTime は投稿する時刻を解釈します
+// "2026-10-20 09:00" のような日時のほか、RFC3339と "15:04"(次にその時刻になるとき)を受け付けます
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation("15:04", value, now.Location()); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	return time.Time{}, fmt.Errorf("時刻を解釈できません: %q (例: \"2026-10-20 09:00\")", value)
+}
+
+// Add は投稿を予約します
+func (q *Queue) Add(key string, note misskey.CreateNote, at, now time.Time) (Post, error) {
+	note.AccessToken = ""
+	post := Post{
+		ID:          strconv.FormatInt(now.UnixNano(), 36),
+		Key:         key,
+		Note:        note,
+		At:          at,
+		CreatedAt:   now,
+		NextAttempt: at,
+	}
+	err := q.update(func(posts []Post) []Post {
+		return append(posts, post)
+	})
+	return post, err
+}
+
+// List は予約投稿を投稿する時刻の順に返します
+func (q *Queue) List() ([]Post, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.load()
+}
+
+// Cancel は予約投稿を取り消します
+func (q *Queue) Cancel(id string) error {
+	found := false
+	err := q.update(func(posts []Post) []Post {
+		for i, post := range posts {
+			if post.ID == id {
+				found = true
+				return append(posts[:i], posts[i+1:]...)
+			}
+		}
+		return posts
+	})
+	if err == nil && !found {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Due は投稿する時刻になった予約投稿を時刻の順に返します
+// 止まっている間に時刻を過ぎたものも含みます
+func (q *Queue) Due(now time.Time) ([]Post, error) {
+	posts, err := q.List()
+	if err != nil {
+		return nil, err
+	}
+	due := make([]Post, 0)
+	for _, post := range posts {
+		if !post.Failed && !post.NextAttempt.After(now) {
+			due = append(due, post)
+		}
+	}
+	return due, nil
+}
+
+// Acquire は予約投稿を送るプロセスをこのプロセスだけにします
+// ほかのプロセスが送信中ならErrRunningを返します。返した関数でロックを解放します
+func (q *Queue) Acquire() (func(), error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.runner != nil {
+		return nil, ErrRunning
+	}
+	l, err := q.file.TryLock("run")
+	if errors.Is(err, cache.ErrLocked) {
+		return nil, ErrRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	q.runner = l
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.runner.Unlock()
+		q.runner = nil
+	}, nil
+}
+
+// Send は投稿する時刻になった予約投稿を送り、送れたものを待ち行列から取り除きます
+// サーバーに届かずに失敗したものは間隔を空けて送り直し、そうでなければ失敗として残します
+// Acquireしていなければ、送るあいだだけロックを取ります(ほかのプロセスが送信中ならErrRunning)
+func (q *Queue) Send(ctx context.Context, now time.Time, client ClientFunc) ([]Result, error) {
+	q.mu.Lock()
+	held := q.runner != nil
+	q.mu.Unlock()
+	if !held {
+		release, err := q.Acquire()
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	due, err := q.Due(now)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(due))
+	for _, post := range due {
+		err := send(ctx, client, post)
+		results = append(results, Result{Post: post, Err: err})
+		if err != nil {
+			err = q.retry(post.ID, err, now)
+		} else {
+			err = q.Cancel(post.ID)
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func send(ctx context.Context, client ClientFunc, post Post) error {
+	c, err := client(post.Key)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	_, err = c.CreateNote(ctx, post.Note)
+	return err
+}
+
+// retry は送れなかった予約投稿を記録します
+func (q *Queue) retry(id string, cause error, now time.Time) error {
+	return q.update(func(posts []Post) []Post {
+		for i := range posts {
+			post := &posts[i]
+			if post.ID == id {
+				post.Attempts++
+				post.LastError = cause.Error()
+				post.Failed = !outbox.IsUnsent(cause)
+				post.Uncertain = post.Failed && outbox.IsTransient(cause)
+				post.NextAttempt = now.Add(outbox.RetryDelay(post.Attempts))
+			}
+		}
+		return posts
+	})
+}
+
+// update はファイルをロックして読み直してから、fで書き換えて保存します
+func (q *Queue) update(f func([]Post) []Post) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l, err := q.file.Lock()
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	posts, err := q.load()
+	if err != nil {
+		return err
+	}
+	return q.file.Write(f(posts))
+}
+
+func (q *Queue) load() ([]Post, error) {
+	posts := make([]Post, 0)
+	if _, err := q.file.Load(&posts); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].At.Before(posts[j].At)
+	})
+	return posts, nil
+}
@@ -0,0 +1,170 @@
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/schedule"
+)
+
+type fakeClient struct {
+	api.Client
+	errs  []error
+	notes []misskey.CreateNote
+}
+
+func (c *fakeClient) CreateNote(ctx context.Context, contents misskey.CreateNote) (*misskey.CreateNoteResponse, error) {
+	c.notes = append(c.notes, contents)
+	var err error
+	if len(c.errs) > 0 {
+		err, c.errs = c.errs[0], c.errs[1:]
+	}
+	return &misskey.CreateNoteResponse{}, err
+}
+
+func TestParseTime(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, jst)
+
+	at, err := schedule.ParseTime("2026-10-20 09:00", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 20, 9, 0, 0, 0, jst), at)
+
+	at, err = schedule.ParseTime("2026-10-20T09:00:00Z", now)
+	assert.NoError(t, err)
+	assert.True(t, at.Equal(time.Date(2026, 10, 20, 18, 0, 0, 0, jst)))
+
+	// 時刻だけなら次にその時刻になるとき
+	at, err = schedule.ParseTime("13:30", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 18, 13, 30, 0, 0, jst), at)
+	at, err = schedule.ParseTime("09:00", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 0, 0, 0, jst), at)
+
+	_, err = schedule.ParseTime("tomorrow", now)
+	assert.Error(t, err)
+}
+
+func TestQueue(t *testing.T) {
+	file := cache.NewFileAt(filepath.Join(t.TempDir(), "schedule.json"))
+	queue := schedule.New(file)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	later, err := queue.Add("a", misskey.CreateNote{Text: "later", AccessToken: "secret"}, now.Add(2*time.Hour), now)
+	assert.NoError(t, err)
+	_, err = queue.Add("a", misskey.CreateNote{Text: "sooner"}, now.Add(time.Hour), now.Add(time.Second))
+	assert.NoError(t, err)
+
+	// 別のプロセスから追加したものも読み直す
+	posts, err := schedule.New(file).List()
+	assert.NoError(t, err)
+	assert.Equal(t, "sooner", posts[0].Note.Text)
+	assert.Equal(t, misskey.AccessToken(""), posts[1].Note.AccessToken)
+
+	assert.NoError(t, queue.Cancel(later.ID))
+	assert.ErrorIs(t, queue.Cancel(later.ID), schedule.ErrNotFound)
+	posts, _ = queue.List()
+	assert.Len(t, posts, 1)
+}
+
+func TestSend(t *testing.T) {
+	queue := schedule.New(cache.NewFileAt(filepath.Join(t.TempDir(), "schedule.json")))
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	client := &fakeClient{errs: []error{&net.OpError{Op: "dial", Err: errors.New("connection refused")}}}
+	clients := func(key string) (api.Client, error) { return client, nil }
+
+	queue.Add("a", misskey.CreateNote{Text: "missed"}, now.Add(-time.Hour), now.Add(-2*time.Hour))
+	queue.Add("a", misskey.CreateNote{Text: "future"}, now.Add(time.Hour), now)
+
+	// 止まっている間に過ぎたものも送る。サーバーに届かなかったなら残して送り直す
+	results, err := queue.Send(context.Background(), now, clients)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Error(t, results[0].Err)
+	posts, _ := queue.List()
+	assert.Len(t, posts, 2)
+	assert.Equal(t, 1, posts[0].Attempts)
+
+	results, err = queue.Send(context.Background(), now.Add(time.Minute), clients)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, []string{"missed", "missed"}, []string{client.notes[0].Text, client.notes[1].Text})
+
+	// 内容の誤りは送り直さない
+	client.errs = []error{&api.StatusError{StatusCode: 400}}
+	queue.Send(context.Background(), now.Add(time.Hour), clients)
+	results, _ = queue.Send(context.Background(), now.Add(48*time.Hour), clients)
+	assert.Empty(t, results)
+	posts, _ = queue.List()
+	assert.True(t, posts[0].Failed)
+	assert.Equal(t, "http bad status: 400", posts[0].LastError)
+
+	// タイムアウトは投稿できていることがあるので送り直さない
+	client.errs = []error{context.DeadlineExceeded}
+	queue.Add("a", misskey.CreateNote{Text: "timeout"}, now, now)
+	queue.Send(context.Background(), now.Add(48*time.Hour), clients)
+	results, _ = queue.Send(context.Background(), now.Add(96*time.Hour), clients)
+	assert.Empty(t, results)
+	posts, _ = queue.List()
+	assert.True(t, posts[0].Uncertain)
+}
+
+func TestSendRunsInOneProcess(t *testing.T) {
+	file := cache.NewFileAt(filepath.Join(t.TempDir(), "schedule.json"))
+	queue := schedule.New(file)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	client := &fakeClient{}
+	clients := func(key string) (api.Client, error) { return client, nil }
+	queue.Add("a", misskey.CreateNote{Text: "once"}, now, now)
+
+	release, err := queue.Acquire()
+	assert.NoError(t, err)
+
+	// 別のプロセスの schedule run は送らない
+	other := schedule.New(file)
+	_, err = other.Send(context.Background(), now, clients)
+	assert.ErrorIs(t, err, schedule.ErrRunning)
+	_, err = other.Acquire()
+	assert.ErrorIs(t, err, schedule.ErrRunning)
+
+	results, err := queue.Send(context.Background(), now, clients)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	release()
+
+	results, err = other.Send(context.Background(), now, clients)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+	assert.Len(t, client.notes, 1)
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	file := cache.NewFileAt(filepath.Join(t.TempDir(), "schedule.json"))
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	// 別々のQueue(別のプロセス相当)から同時に追加しても失われない
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := schedule.New(file).Add("a", misskey.CreateNote{Text: "note"}, now, now.Add(time.Duration(i)))
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	posts, err := schedule.New(file).List()
+	assert.NoError(t, err)
+	assert.Len(t, posts, 20)
+}
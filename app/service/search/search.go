@@ -0,0 +1,139 @@
+// Package search はインスタンスのノートの検索とハッシュタグのノートを、ページごとに取得します
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// Query は検索の条件です。TextかTagのどちらかを指定します
+	Query struct {
+		Text    string    // 検索する語
+		Tag     string    // ハッシュタグ(# はなくてもよい)
+		User    string    // 投稿者(@username か @username@host、またはユーザーID)
+		Host    string    // 投稿者のホスト(ローカルは ".")
+		Channel string    // チャンネルのID
+		Since   time.Time // これ以降に作成されたもの
+		Limit   int       // 1ページの件数(未設定なら20)
+	}
+
+	// Pager は検索の結果を新しい順に1ページずつ取得します
+	Pager struct {
+		client  api.Client
+		query   Query
+		userId  string
+		untilId string
+		done    bool
+	}
+)
+
+const defaultLimit = 20
+
+// ErrNoQuery は検索する語もハッシュタグも指定されていないことを表します
+var ErrNoQuery = errors.New("検索する語かハッシュタグを指定してください")
+
+// NewPager はqueryを確かめ、clientで検索するPagerを返します
+func NewPager(client api.Client, query Query) (*Pager, error) {
+	query.Text = strings.TrimSpace(query.Text)
+	query.Tag = strings.TrimPrefix(strings.TrimSpace(query.Tag), "#")
+	switch {
+	case query.Text == "" && query.Tag == "":
+		return nil, ErrNoQuery
+	case query.Text != "" && query.Tag != "":
+		return nil, errors.New("検索する語とハッシュタグは同時に指定できません")
+	case query.Tag != "" && (query.User != "" || query.Host != "" || query.Channel != ""):
+		return nil, errors.New("ハッシュタグの検索では投稿者・ホスト・チャンネルを指定できません")
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultLimit
+	}
+	return &Pager{client: client, query: query}, nil
+}
+
+// Query は検索の条件を返します
+func (p *Pager) Query() Query {
+	return p.query
+}
+
+// Done は最後のページまで取得したかを返します
+func (p *Pager) Done() bool {
+	return p.done
+}
+
+// Next は次のページを取得します。最後のページの後は空を返します
+// Sinceより古いノートが含まれていたら、そこで最後のページにします
+func (p *Pager) Next(ctx context.Context) ([]misskey.NoteBody, error) {
+	if p.done {
+		return nil, nil
+	}
+	if p.query.User != "" && p.userId == "" {
+		id, err := resolveUser(ctx, p.client, p.query.User)
+		if err != nil {
+			return nil, fmt.Errorf("ユーザー %s が見つかりません: %w", p.query.User, err)
+		}
+		p.userId = id
+	}
+
+	var notes []misskey.NoteBody
+	var err error
+	if p.query.Tag != "" {
+		notes, err = p.client.SearchNotesByTag(ctx, misskey.SearchNotesByTag{
+			Tag:     p.query.Tag,
+			UntilId: p.untilId,
+			Limit:   p.query.Limit,
+		})
+	} else {
+		notes, err = p.client.SearchNotes(ctx, misskey.SearchNotes{
+			Query:     p.query.Text,
+			UserId:    p.userId,
+			Host:      p.query.Host,
+			ChannelId: p.query.Channel,
+			UntilId:   p.untilId,
+			Limit:     p.query.Limit,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(notes) < p.query.Limit {
+		p.done = true
+	}
+	if len(notes) > 0 {
+		p.untilId = notes[len(notes)-1].ID
+	}
+	if !p.query.Since.IsZero() {
+		for i, n := range notes {
+			if n.CreatedAt.Before(p.query.Since) {
+				notes, p.done = notes[:i], true
+				break
+			}
+		}
+	}
+	return notes, nil
+}
+
+// resolveUser は@username形式の指定をユーザーIDに変換します
+func resolveUser(ctx context.Context, client api.Client, user string) (string, error) {
+	if !strings.HasPrefix(user, "@") {
+		return user, nil
+	}
+	contents := misskey.ShowUser{}
+	username, host, remote := strings.Cut(strings.TrimPrefix(user, "@"), "@")
+	contents.Username = username
+	if remote {
+		contents.Host = &host
+	}
+	ret, err := client.ShowUser(ctx, contents)
+	if err != nil {
+		return "", err
+	}
+	return ret.Id, nil
+}
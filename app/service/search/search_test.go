@@ -0,0 +1,107 @@
+package search_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/search"
+)
+
+var base = time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+
+// apiMock は n5 から n1 までのノートを新しい順に返すクライアントです
+type apiMock struct {
+	api.Client
+	searches []misskey.SearchNotes
+	tags     []misskey.SearchNotesByTag
+	users    []misskey.ShowUser
+}
+
+func page(untilId string, limit int) []misskey.NoteBody {
+	notes := make([]misskey.NoteBody, 0)
+	for i := 5; i >= 1; i-- {
+		id := fmt.Sprintf("n%d", i)
+		if untilId != "" && id >= untilId {
+			continue
+		}
+		notes = append(notes, misskey.NoteBody{ID: id, CreatedAt: base.Add(time.Duration(i) * time.Hour)})
+		if len(notes) == limit {
+			break
+		}
+	}
+	return notes
+}
+
+func (c *apiMock) SearchNotes(ctx context.Context, contents misskey.SearchNotes) ([]misskey.NoteBody, error) {
+	c.searches = append(c.searches, contents)
+	return page(contents.UntilId, contents.Limit), nil
+}
+
+func (c *apiMock) SearchNotesByTag(ctx context.Context, contents misskey.SearchNotesByTag) ([]misskey.NoteBody, error) {
+	c.tags = append(c.tags, contents)
+	return page(contents.UntilId, contents.Limit), nil
+}
+
+func (c *apiMock) ShowUser(ctx context.Context, contents misskey.ShowUser) (*misskey.User, error) {
+	c.users = append(c.users, contents)
+	return &misskey.User{Id: "user-" + contents.Username}, nil
+}
+
+func ids(notes []misskey.NoteBody) []string {
+	ret := make([]string, 0, len(notes))
+	for _, n := range notes {
+		ret = append(ret, n.ID)
+	}
+	return ret
+}
+
+func TestPager(t *testing.T) {
+	client := &apiMock{}
+	p, err := search.NewPager(client, search.Query{Text: "misskey", User: "@alice@example.com", Host: ".", Channel: "ch", Limit: 2})
+	require.NoError(t, err)
+
+	var got [][]string
+	for !p.Done() {
+		notes, err := p.Next(context.Background())
+		require.NoError(t, err)
+		got = append(got, ids(notes))
+	}
+	assert.Equal(t, [][]string{{"n5", "n4"}, {"n3", "n2"}, {"n1"}}, got)
+	// ユーザーは最初に一度だけ解決し、前のページの最後のノートより古いものを取得する
+	require.Len(t, client.users, 1)
+	assert.Equal(t, "alice", client.users[0].Username)
+	assert.Equal(t, "example.com", *client.users[0].Host)
+	assert.Equal(t, misskey.SearchNotes{Query: "misskey", UserId: "user-alice", Host: ".", ChannelId: "ch", UntilId: "n4", Limit: 2}, client.searches[1])
+
+	notes, err := p.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, notes)
+	assert.Len(t, client.searches, 3)
+}
+
+func TestPagerTag(t *testing.T) {
+	client := &apiMock{}
+	// Since より古いノートが出てきたら最後のページにする
+	p, err := search.NewPager(client, search.Query{Tag: "#dev", Since: base.Add(3 * time.Hour)})
+	require.NoError(t, err)
+	notes, err := p.Next(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"n5", "n4", "n3"}, ids(notes))
+	assert.True(t, p.Done())
+	assert.Equal(t, misskey.SearchNotesByTag{Tag: "dev", Limit: 20}, client.tags[0])
+}
+
+func TestPagerQuery(t *testing.T) {
+	_, err := search.NewPager(&apiMock{}, search.Query{User: "@alice"})
+	assert.ErrorIs(t, err, search.ErrNoQuery)
+	_, err = search.NewPager(&apiMock{}, search.Query{Text: "a", Tag: "b"})
+	assert.Error(t, err)
+	_, err = search.NewPager(&apiMock{}, search.Query{Tag: "b", Channel: "ch"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,203 @@
+// Package watch はノートが注目の条件に当てはまるかを調べます
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/expr"
+)
+
+type (
+	// Watcher はアカウントの注目の条件でノートを調べます
+	Watcher struct {
+		rules []rule
+	}
+
+	rule struct {
+		setting.Watch
+		name    string
+		regexps []*regexp.Regexp
+		mention *regexp.Regexp
+		program *expr.Program
+	}
+
+	// Me はメンションを調べるときの自分のアカウントです
+	Me struct {
+		Username string
+		Host     string // 接続先のインスタンスのホスト
+	}
+
+	// Hit はノートが当てはまった条件です
+	Hit struct {
+		Name   string             // 条件の名前
+		Reason string             // 当てはまった語やユーザーなど
+		Terms  []string           // 本文の中で強調する語
+		Alert  setting.WatchAlert // 端末で知らせる方法
+		Hook   string             // 実行するシェルのコマンド
+	}
+)
+
+// New は注目の条件からWatcherを生成します
+// 解釈できない正規表現や式はエラーにまとめて返し、それ以外の条件は有効にします
+func New(watches []setting.Watch, me Me) (*Watcher, error) {
+	w := &Watcher{}
+	errs := make([]error, 0)
+	for i, watch := range watches {
+		r := rule{Watch: watch, name: watch.Name}
+		if r.name == "" {
+			r.name = fmt.Sprintf("watch%d", i+1)
+		}
+		for _, src := range watch.Regexps {
+			re, err := regexp.Compile(src)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: 正規表現 %q: %w", r.name, src, err))
+				continue
+			}
+			r.regexps = append(r.regexps, re)
+		}
+		if watch.Expression != "" {
+			program, err := expr.Compile(watch.Expression)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: 式 %q: %w", r.name, watch.Expression, err))
+			} else {
+				r.program = program
+			}
+		}
+		if watch.Mentions && me.Username != "" {
+			r.mention = mentionPattern(me)
+		}
+		w.rules = append(w.rules, r)
+	}
+	return w, errors.Join(errs...)
+}
+
+// mentionPattern は @me と @me@host に一致し、@me@other や @meme には一致しない正規表現を返します
+// グループ1がメンションの部分です
+func mentionPattern(me Me) *regexp.Regexp {
+	pattern := `(?i)(?:^|[^\w@])(@` + regexp.QuoteMeta(me.Username)
+	if me.Host != "" {
+		pattern += `(?:@` + regexp.QuoteMeta(me.Host) + `)?`
+	}
+	return regexp.MustCompile(pattern + `)(?:[^\w@]|$)`)
+}
+
+// Match はノートが当てはまる最初の条件を返します
+// 本文のないリノートはリノート元の本文と投稿者を調べます
+func (w *Watcher) Match(note *misskey.Note) (Hit, bool) {
+	body := note.Body.Body
+	user := body.User
+	texts := []string{body.Text, stringValue(body.Cw)}
+	if body.RenoteID != "" && body.Text == "" {
+		user = body.Renote.User
+		texts = []string{body.Renote.Text, stringValue(body.Renote.Cw)}
+	}
+
+	for _, r := range w.rules {
+		if hit, ok := r.match(note, user, texts); ok {
+			hit.Name = r.name
+			hit.Alert = r.Alert
+			hit.Hook = r.Hook
+			return hit, true
+		}
+	}
+	return Hit{}, false
+}
+
+func (r rule) match(note *misskey.Note, user misskey.NoteUser, texts []string) (Hit, bool) {
+	if r.mention != nil {
+		if terms := findAll(r.mention, texts, 1); len(terms) > 0 {
+			return Hit{Reason: "自分へのメンション", Terms: terms}, true
+		}
+	}
+	for _, word := range r.Words {
+		if word == "" {
+			continue
+		}
+		for _, text := range texts {
+			if strings.Contains(strings.ToLower(text), strings.ToLower(word)) {
+				return Hit{Reason: fmt.Sprintf("「%s」を含む", word), Terms: []string{word}}, true
+			}
+		}
+	}
+	for _, re := range r.regexps {
+		if terms := findAll(re, texts, 0); len(terms) > 0 {
+			return Hit{Reason: fmt.Sprintf("/%s/ に一致", re), Terms: terms}, true
+		}
+	}
+	name := acct(user)
+	for _, u := range r.Users {
+		u = strings.TrimPrefix(u, "@")
+		if strings.EqualFold(u, name) || (stringValue(user.Host) == "" && strings.EqualFold(u, user.Username)) {
+			return Hit{Reason: "@" + name + " のノート"}, true
+		}
+	}
+	if r.program != nil && r.program.Match(note) {
+		return Hit{Reason: "式 " + r.program.String() + " に一致"}, true
+	}
+	return Hit{}, false
+}
+
+// findAll はtextsの中で正規表現に一致した部分(groupのグループ)を重複なく返します
+func findAll(re *regexp.Regexp, texts []string, group int) []string {
+	terms := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, text := range texts {
+		for _, m := range re.FindAllStringSubmatch(text, -1) {
+			if term := m[group]; term != "" && !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// Rules は条件ごとの説明の一覧を返します
+func (w *Watcher) Rules() []string {
+	rules := make([]string, 0, len(w.rules))
+	for _, r := range w.rules {
+		parts := make([]string, 0)
+		if r.mention != nil {
+			parts = append(parts, "自分へのメンション")
+		}
+		if len(r.Words) > 0 {
+			parts = append(parts, "語: "+strings.Join(r.Words, ", "))
+		}
+		for _, re := range r.regexps {
+			parts = append(parts, "/"+re.String()+"/")
+		}
+		if len(r.Users) > 0 {
+			parts = append(parts, "ユーザー: "+strings.Join(r.Users, ", "))
+		}
+		if r.program != nil {
+			parts = append(parts, "式: "+r.program.String())
+		}
+		rules = append(rules, r.name+" ("+strings.Join(parts, " / ")+")")
+	}
+	return rules
+}
+
+// String は当てはまった条件を説明します
+func (h Hit) String() string {
+	return fmt.Sprintf("%s: %s", h.Name, h.Reason)
+}
+
+func acct(user misskey.NoteUser) string {
+	if host := stringValue(user.Host); host != "" {
+		return user.Username + "@" + host
+	}
+	return user.Username
+}
+
+// stringValue はJSONでnullまたは文字列になる値を文字列にします
+func stringValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
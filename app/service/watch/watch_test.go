@@ -0,0 +1,87 @@
+package watch_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/watch"
+)
+
+var me = watch.Me{Username: "me", Host: "misskey.example"}
+
+func newNote(username string, text string) *misskey.Note {
+	return &misskey.Note{Body: misskey.NoteContainer{Body: misskey.NoteBody{
+		ID:   "1",
+		User: misskey.NoteUser{Username: username},
+		Text: text,
+	}}}
+}
+
+func TestMatch(t *testing.T) {
+	watcher, err := watch.New([]setting.Watch{
+		{Name: "service", Words: []string{"Petit"}, Regexps: []string{`(?i)misskey-\w+`}, Alert: setting.WatchAlertBell},
+		{Users: []string{"@boss"}, Hook: "notify-send boss"},
+		{Name: "ops", Expression: `"#ops" in tags`},
+	}, me)
+	assert.NoError(t, err)
+
+	hit, ok := watcher.Match(newNote("alice", "petit-misskey を使っています"))
+	assert.True(t, ok)
+	assert.Equal(t, "service: 「Petit」を含む", hit.String())
+	assert.Equal(t, []string{"Petit"}, hit.Terms)
+	assert.Equal(t, setting.WatchAlertBell, hit.Alert)
+
+	hit, ok = watcher.Match(newNote("alice", "Misskey-Go と misskey-go"))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"Misskey-Go", "misskey-go"}, hit.Terms)
+
+	hit, ok = watcher.Match(newNote("boss", "会議です"))
+	assert.True(t, ok)
+	assert.Equal(t, "watch2: @boss のノート", hit.String())
+	assert.Equal(t, "notify-send boss", hit.Hook)
+
+	hit, ok = watcher.Match(newNote("alice", "障害対応 #ops"))
+	assert.True(t, ok)
+	assert.Equal(t, "ops", hit.Name)
+
+	_, ok = watcher.Match(newNote("alice", "こんにちは"))
+	assert.False(t, ok)
+
+	// 本文のないリノートはリノート元を調べる
+	renote := newNote("alice", "")
+	renote.Body.Body.RenoteID = "2"
+	renote.Body.Body.Renote = misskey.RenoteContent{User: misskey.NoteUser{Username: "boss"}}
+	_, ok = watcher.Match(renote)
+	assert.True(t, ok)
+}
+
+func TestMentions(t *testing.T) {
+	watcher, err := watch.New([]setting.Watch{{Mentions: true}}, me)
+	assert.NoError(t, err)
+
+	for text, want := range map[string]bool{
+		"@me こんにちは":               true,
+		"cc: @ME@misskey.example": true,
+		"(@me)":                   true,
+		"@me@other.example":       false,
+		"@meme":                   false,
+		"mail@me.example":         false,
+	} {
+		hit, ok := watcher.Match(newNote("alice", text))
+		assert.Equal(t, want, ok, text)
+		if ok {
+			assert.Equal(t, "watch1: 自分へのメンション", hit.String())
+		}
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	watcher, err := watch.New([]setting.Watch{{Name: "bad", Regexps: []string{"("}, Expression: "text ==", Words: []string{"deploy"}}}, me)
+	assert.ErrorContains(t, err, `bad: 正規表現 "("`)
+	assert.ErrorContains(t, err, `bad: 式 "text =="`)
+	_, ok := watcher.Match(newNote("alice", "deploy"))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"bad (語: deploy)"}, watcher.Rules())
+}
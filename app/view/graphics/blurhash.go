@@ -0,0 +1,115 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// blurhashの文字はbase83で数値を表します
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// DecodeBlurhash はblurhashをwidth x heightの画像に展開します
+// punchはコントラストの強さで、通常は1です
+func DecodeBlurhash(hash string, width int, height int, punch float64) (image.Image, error) {
+	if len(hash) < 6 {
+		return nil, errors.Errorf("blurhash too short: %q", hash)
+	}
+	if width <= 0 || height <= 0 {
+		return nil, errors.Errorf("invalid blurhash size: %dx%d", width, height)
+	}
+
+	sizeFlag, err := decode83(hash[0:1])
+	if err != nil {
+		return nil, err
+	}
+	numX, numY := sizeFlag%9+1, sizeFlag/9+1
+	if len(hash) != 4+2*numX*numY {
+		return nil, errors.Errorf("invalid blurhash length: %q", hash)
+	}
+
+	quantMax, err := decode83(hash[1:2])
+	if err != nil {
+		return nil, err
+	}
+	maxValue := float64(quantMax+1) / 166 * punch
+
+	colors := make([][3]float64, numX*numY)
+	for i := range colors {
+		if i == 0 {
+			v, err := decode83(hash[2:6])
+			if err != nil {
+				return nil, err
+			}
+			colors[i] = decodeDC(v)
+			continue
+		}
+		v, err := decode83(hash[4+i*2 : 6+i*2])
+		if err != nil {
+			return nil, err
+		}
+		colors[i] = decodeAC(v, maxValue)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var r, g, b float64
+			for j := 0; j < numY; j++ {
+				for i := 0; i < numX; i++ {
+					basis := math.Cos(math.Pi*float64(x*i)/float64(width)) *
+						math.Cos(math.Pi*float64(y*j)/float64(height))
+					c := colors[i+j*numX]
+					r += c[0] * basis
+					g += c[1] * basis
+					b += c[2] * basis
+				}
+			}
+			img.SetRGBA(x, y, color.RGBA{R: linearToSRGB(r), G: linearToSRGB(g), B: linearToSRGB(b), A: 255})
+		}
+	}
+	return img, nil
+}
+
+func decode83(s string) (int, error) {
+	v := 0
+	for _, c := range s {
+		i := strings.IndexRune(base83Chars, c)
+		if i < 0 {
+			return 0, errors.Errorf("invalid blurhash character: %q", c)
+		}
+		v = v*83 + i
+	}
+	return v, nil
+}
+
+func decodeDC(v int) [3]float64 {
+	return [3]float64{sRGBToLinear(v >> 16), sRGBToLinear((v >> 8) & 255), sRGBToLinear(v & 255)}
+}
+
+func decodeAC(v int, maxValue float64) [3]float64 {
+	quant := func(q int) float64 {
+		f := float64(q-9) / 9
+		return math.Copysign(f*f, f) * maxValue
+	}
+	return [3]float64{quant(v / (19 * 19)), quant((v / 19) % 19), quant(v % 19)}
+}
+
+func sRGBToLinear(v int) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(f float64) uint8 {
+	f = math.Max(0, math.Min(1, f))
+	if f <= 0.0031308 {
+		return uint8(math.Round(f * 12.92 * 255))
+	}
+	return uint8(math.Round((1.055*math.Pow(f, 1/2.4) - 0.055) * 255))
+}
@@ -0,0 +1,166 @@
+package graphics
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+type (
+	// Protocol は端末が対応している画像表示の方式です
+	Protocol string
+)
+
+const (
+	ProtocolNone  Protocol = "none"
+	ProtocolKitty Protocol = "kitty"
+	ProtocolITerm Protocol = "iterm"
+	ProtocolSixel Protocol = "sixel"
+)
+
+// ProtocolEnv は画像表示の方式を明示する環境変数です(kitty / iterm / sixel / none)
+const ProtocolEnv = "PETIT_MISSKEY_GRAPHICS"
+
+const (
+	// kittyの転送は4096バイトごとに分割する
+	kittyChunkSize = 4096
+
+	// Sixelで描くときの1セルの大きさ(ピクセル)
+	// 端末に問い合わせると応答が入力に混ざるため、一般的な値で決め打ちする
+	cellWidth  = 10
+	cellHeight = 20
+)
+
+// Detect は環境変数から端末の画像表示の方式を判断します
+func Detect() Protocol {
+	switch Protocol(strings.ToLower(os.Getenv(ProtocolEnv))) {
+	case ProtocolKitty:
+		return ProtocolKitty
+	case ProtocolITerm:
+		return ProtocolITerm
+	case ProtocolSixel:
+		return ProtocolSixel
+	case ProtocolNone:
+		return ProtocolNone
+	}
+
+	if os.Getenv("KITTY_WINDOW_ID") != "" || strings.HasPrefix(os.Getenv("TERM"), "xterm-kitty") {
+		return ProtocolKitty
+	}
+	switch os.Getenv("TERM_PROGRAM") {
+	case "ghostty":
+		return ProtocolKitty
+	case "iTerm.app", "WezTerm":
+		return ProtocolITerm
+	}
+	if os.Getenv("LC_TERMINAL") == "iTerm2" {
+		return ProtocolITerm
+	}
+	term := os.Getenv("TERM")
+	for _, prefix := range []string{"foot", "mlterm", "yaft", "contour"} {
+		if strings.HasPrefix(term, prefix) {
+			return ProtocolSixel
+		}
+	}
+	if strings.Contains(term, "sixel") {
+		return ProtocolSixel
+	}
+	return ProtocolNone
+}
+
+// Inline は画像をcols x rowsセルに収めて、カーソルの位置から表示するエスケープシーケンスを返します
+// bubbleteaは行を画面幅で切り詰めるときにシーケンスの途中で切るので、Viewの文字列には含めず、
+// Overlayで描画したあとに書き出してください
+func Inline(p Protocol, data []byte, cols int, rows int) (string, error) {
+	if p == ProtocolITerm {
+		return fmt.Sprintf("\x1b]1337;File=inline=1;width=%d;height=%d;preserveAspectRatio=1:%s\a",
+			cols, rows, base64.StdEncoding.EncodeToString(data)), nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	switch p {
+	case ProtocolKitty:
+		return kittyTransmit(0, img, cols, rows)
+	case ProtocolSixel:
+		return Sixel(Fit(img, cols*cellWidth, rows*cellHeight)), nil
+	default:
+		return "", errors.Errorf("unsupported graphics protocol: %s", p)
+	}
+}
+
+// Resize は画像をwidth x heightに拡大・縮小します(縦横比は保ちません)
+func Resize(img image.Image, width int, height int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	return dst
+}
+
+// Fit は縦横比を保ったまま、画像をwidth x heightに収まる大きさにします
+func Fit(img image.Image, width int, height int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return img
+	}
+	scale := min(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy()))
+	return Resize(img, max(int(float64(bounds.Dx())*scale), 1), max(int(float64(bounds.Dy())*scale), 1))
+}
+
+// KittyTransmit は画像をidの画像としてkittyに転送するエスケープシーケンスを返します
+// 転送するだけで表示はしないので、表示するときはKittyPlaceを書き出します
+func KittyTransmit(id uint32, data []byte, cols int, rows int) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return kittyTransmit(id, img, cols, rows)
+}
+
+// KittyPlace は転送したidの画像をカーソルの位置から cols x rows セルで表示するエスケープシーケンスを返します
+// カーソルは動かしません
+func KittyPlace(id uint32, cols int, rows int) string {
+	return fmt.Sprintf("\x1b_Ga=p,i=%d,q=2,C=1,c=%d,r=%d\x1b\\", id, cols, rows)
+}
+
+// KittyClear は表示している画像をすべて消すエスケープシーケンスです。転送した画像は残します
+const KittyClear = "\x1b_Ga=d,d=a,q=2\x1b\\"
+
+// kittyTransmit はPNGにした画像を4096バイトずつに分けて転送します
+// idが0なら転送してすぐにカーソルの位置に表示します。応答が入力に混ざらないよう q=2 を指定します
+func kittyTransmit(id uint32, img image.Image, cols int, rows int) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, Fit(img, cols*cellWidth, rows*cellHeight)); err != nil {
+		return "", errors.WithStack(err)
+	}
+	payload := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	var b strings.Builder
+	for i := 0; i < len(payload); i += kittyChunkSize {
+		end := min(i+kittyChunkSize, len(payload))
+		more := 0
+		if end < len(payload) {
+			more = 1
+		}
+		switch {
+		case i > 0:
+			fmt.Fprintf(&b, "\x1b_Gm=%d;%s\x1b\\", more, payload[i:end])
+		case id == 0:
+			fmt.Fprintf(&b, "\x1b_Ga=T,f=100,q=2,c=%d,r=%d,m=%d;%s\x1b\\", cols, rows, more, payload[i:end])
+		default:
+			fmt.Fprintf(&b, "\x1b_Ga=t,f=100,q=2,i=%d,m=%d;%s\x1b\\", id, more, payload[i:end])
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,106 @@
+package graphics_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/muesli/termenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/view/graphics"
+)
+
+func TestDecodeBlurhash(t *testing.T) {
+	img, err := graphics.DecodeBlurhash("LEHV6nWB2yk8pyo0adR*.7kCMdnj", 32, 32, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 32, 32), img.Bounds())
+
+	// 左上は明るい灰色がかった色になる
+	r, g, b, _ := img.At(0, 0).RGBA()
+	assert.Greater(t, r>>8, uint32(100))
+	assert.Greater(t, g>>8, uint32(100))
+	assert.Greater(t, b>>8, uint32(100))
+
+	for _, hash := range []string{"", "LEHV6n", "LEHV6nWB2yk8pyo0adR*.7kCMdn!"} {
+		_, err := graphics.DecodeBlurhash(hash, 8, 8, 1)
+		assert.Error(t, err, hash)
+	}
+}
+
+func TestBlurhashBlock(t *testing.T) {
+	s, err := graphics.BlurhashBlock("LEHV6nWB2yk8pyo0adR*.7kCMdnj", 6, 3, termenv.TrueColor)
+	assert.NoError(t, err)
+	lines := strings.Split(s, "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, 6, strings.Count(lines[0], "▀"))
+
+	s, err = graphics.BlurhashBlock("LEHV6nWB2yk8pyo0adR*.7kCMdnj", 6, 3, termenv.Ascii)
+	assert.NoError(t, err)
+	assert.Empty(t, s)
+}
+
+func redPNG(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestEncode(t *testing.T) {
+	data := redPNG(t)
+
+	sixel, err := graphics.Inline(graphics.ProtocolSixel, data, 2, 1)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sixel, "\x1bP0;1;0q"))
+	assert.True(t, strings.HasSuffix(sixel, "-\x1b\\"))
+
+	// kittyは転送と表示を分けられる
+	transmit, err := graphics.KittyTransmit(7, data, 4, 3)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(transmit, "\x1b_Ga=t,f=100,q=2,i=7,"))
+	assert.Equal(t, "\x1b_Ga=p,i=7,q=2,C=1,c=4,r=3\x1b\\", graphics.KittyPlace(7, 4, 3))
+
+	_, err = graphics.Inline(graphics.ProtocolNone, data, 2, 1)
+	assert.Error(t, err)
+}
+
+func TestOverlay(t *testing.T) {
+	var out bytes.Buffer
+	o := graphics.NewOverlay(graphics.ProtocolKitty, &out)
+
+	placeholder, err := o.Add(redPNG(t), 4, 2, " ")
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "a=t,f=100,q=2,i=1,")
+	lines := strings.Split(placeholder, "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "    ", lines[1])
+
+	// 目印は空白に置き換わり、目印の位置に画像を描く
+	view, seq := o.Render("header\nあ "+lines[0]+"|\n   "+lines[1]+"|", 20, 10)
+	assert.Equal(t, "header\nあ     |\n       |", view)
+	assert.Equal(t, "\x1b7"+graphics.KittyClear+"\x1b[2;4H"+graphics.KittyPlace(1, 4, 2)+"\x1b8", seq)
+
+	// 画面からはみ出す画像は描かず、前に描いた画像は消す
+	view, seq = o.Render("header\n"+placeholder, 3, 3)
+	assert.Equal(t, "header\n    \n    ", view)
+	assert.Equal(t, "\x1b7"+graphics.KittyClear+"\x1b8", seq)
+	_, seq = o.Render("header\n"+placeholder, 20, 1)
+	assert.Equal(t, "\x1b7"+graphics.KittyClear+"\x1b8", seq)
+
+	// 画面の上からはみ出した行は数えない
+	_, seq = o.Render("header\nheader\n"+placeholder, 20, 2)
+	assert.Contains(t, seq, "\x1b[1;1H")
+
+	// kitty以外は目印がなければ何も描かない
+	sixel := graphics.NewOverlay(graphics.ProtocolSixel, &out)
+	_, seq = sixel.Render("header", 20, 2)
+	assert.Empty(t, seq)
+}
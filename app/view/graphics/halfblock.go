@@ -0,0 +1,63 @@
+package graphics
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/muesli/termenv"
+	"github.com/pkg/errors"
+)
+
+// HalfBlock は画像を「▀」の前景色と背景色で cols x rows セルに描画します
+// 1セルに上下2ピクセル分の色を使うので、画像は cols x rows*2 に縮小します
+// 色を使えない端末(Ascii)では空文字列を返します
+func HalfBlock(img image.Image, cols int, rows int, profile termenv.Profile) string {
+	if profile == termenv.Ascii || cols <= 0 || rows <= 0 {
+		return ""
+	}
+	scaled := Resize(img, cols, rows*2)
+
+	var b strings.Builder
+	for y := 0; y < rows; y++ {
+		if y > 0 {
+			b.WriteString("\n")
+		}
+		for x := 0; x < cols; x++ {
+			top := hexColor(scaled, x, y*2)
+			bottom := hexColor(scaled, x, y*2+1)
+			b.WriteString(termenv.String("▀").
+				Foreground(profile.Color(top)).
+				Background(profile.Color(bottom)).
+				String())
+		}
+	}
+	return b.String()
+}
+
+// DecodeHalfBlock は画像のデータを読み込み、HalfBlockで描画します
+// 色付きの文字だけで描くので、行ごとに切り詰められる画面の中にも置けます
+func DecodeHalfBlock(data []byte, cols int, rows int, profile termenv.Profile) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return HalfBlock(img, cols, rows, profile), nil
+}
+
+// BlurhashBlock はblurhashを cols x rows セルの半角ブロックで描画します
+// ネットワークを使わずに画像のおおまかな色を表示できます
+func BlurhashBlock(hash string, cols int, rows int, profile termenv.Profile) (string, error) {
+	img, err := DecodeBlurhash(hash, cols, rows*2, 1)
+	if err != nil {
+		return "", err
+	}
+	return HalfBlock(img, cols, rows, profile), nil
+}
+
+func hexColor(img image.Image, x int, y int) string {
+	bounds := img.Bounds()
+	r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
@@ -0,0 +1,137 @@
+package graphics
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+type (
+	// Overlay は描画した画面に重ねて描く画像です
+	// bubbleteaは行を画面幅で切り詰めるときにエスケープシーケンスの途中で切るため、画像は画面の文字列に含めません
+	// 代わりに画像を置く場所に目印の文字と空白を置き、描画したあとで目印の位置へカーソルを動かして画像を描きます
+	Overlay struct {
+		protocol Protocol
+		out      io.Writer // kittyの画像の転送先
+
+		mu     sync.Mutex
+		next   rune
+		images map[rune]overlayImage // 目印ごとの画像
+	}
+
+	overlayImage struct {
+		seq  string // 画像を描くエスケープシーケンス
+		cols int
+		rows int
+	}
+)
+
+// 目印には補助私用面(U+F0000〜)の文字を使い、画像ごとに1文字を割り当てます
+// 画面の文字列を返す前に空白に置き換えるので、端末には書き出しません
+const (
+	firstMarker rune = 0xf0000
+	lastMarker  rune = 0xffffd
+)
+
+// NewOverlay はpで画像を描くOverlayを返します
+// kittyでは画像を登録したときにoutへ転送しておき、描くときは表示する場所だけを書き出します
+func NewOverlay(p Protocol, out io.Writer) *Overlay {
+	return &Overlay{protocol: p, out: out, next: firstMarker, images: make(map[rune]overlayImage)}
+}
+
+// Add は画像を登録し、画面の中で画像の代わりに置く cols x rows セルの文字列を返します
+// fillは目印のあとを埋める1セルの文字です(行の途中に置く絵文字では、折り返されないよう改行しない空白を使います)
+func (o *Overlay) Add(data []byte, cols int, rows int, fill string) (string, error) {
+	o.mu.Lock()
+	marker := o.next
+	if o.next++; o.next > lastMarker {
+		// 使い切ったら最初から使い直す(古い画像は画面に残っていないはず)
+		o.next = firstMarker
+	}
+	o.mu.Unlock()
+
+	var seq string
+	var err error
+	if o.protocol == ProtocolKitty {
+		id := uint32(marker-firstMarker) + 1
+		var transmit string
+		if transmit, err = KittyTransmit(id, data, cols, rows); err == nil {
+			_, err = io.WriteString(o.out, transmit)
+		}
+		seq = KittyPlace(id, cols, rows)
+	} else {
+		seq, err = Inline(o.protocol, data, cols, rows)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	o.mu.Lock()
+	o.images[marker] = overlayImage{seq: seq, cols: cols, rows: rows}
+	o.mu.Unlock()
+	return placeholder(marker, cols, rows, fill), nil
+}
+
+// placeholder は先頭に目印を置いた cols x rows セルの文字列を返します
+func placeholder(marker rune, cols int, rows int, fill string) string {
+	lines := make([]string, rows)
+	for i := range lines {
+		n := cols
+		if i == 0 {
+			lines[i] = string(marker)
+			n -= lipgloss.Width(string(marker))
+		}
+		lines[i] += strings.Repeat(fill, max(n, 0))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Render は画面の文字列から目印を探して空白に置き換え、置き換えた画面と、目印の位置に画像を描くエスケープシーケンスを返します
+// 画面は width x height の端末の左上から描かれるものとし、端末からはみ出す画像は描きません
+// エスケープシーケンスはカーソルの位置を保存して戻すので、描画のあとにそのまま書き出せます
+func (o *Overlay) Render(view string, width int, height int) (string, string) {
+	lines := strings.Split(view, "\n")
+	// bubbleteaは画面より行が多いと上の行を捨てる
+	top := max(len(lines)-height, 0)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var b strings.Builder
+	for i, line := range lines {
+		if strings.IndexFunc(line, isMarker) < 0 {
+			continue
+		}
+		var l strings.Builder
+		for _, r := range line {
+			if !isMarker(r) {
+				l.WriteRune(r)
+				continue
+			}
+			col := lipgloss.Width(l.String())
+			row := i - top
+			img, ok := o.images[r]
+			if ok && row >= 0 && row+img.rows <= height && col+img.cols <= width {
+				fmt.Fprintf(&b, "\x1b[%d;%dH%s", row+1, col+1, img.seq)
+			}
+			l.WriteString(strings.Repeat(" ", lipgloss.Width(string(r))))
+		}
+		lines[i] = l.String()
+	}
+
+	seq := b.String()
+	if o.protocol == ProtocolKitty {
+		// 前に描いた場所の画像は消えないので、描き直す前に消す
+		seq = KittyClear + seq
+	}
+	if seq != "" {
+		seq = "\x1b7" + seq + "\x1b8"
+	}
+	return strings.Join(lines, "\n"), seq
+}
+
+func isMarker(r rune) bool {
+	return r >= firstMarker && r <= lastMarker
+}
@@ -0,0 +1,92 @@
+package graphics
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"strings"
+)
+
+// Sixel は画像をSixelで表示するエスケープシーケンスを返します
+// 色はWebセーフの216色に減色し、透明な部分は描画しません
+func Sixel(img image.Image) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	paletted := image.NewPaletted(image.Rect(0, 0, width, height), palette.WebSafe)
+	draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), img, bounds.Min)
+
+	var b strings.Builder
+	// P2=1: 描画しないピクセルは背景のまま残す
+	fmt.Fprintf(&b, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+	for i, c := range palette.WebSafe {
+		r, g, bl, _ := c.RGBA()
+		fmt.Fprintf(&b, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, bl*100/0xffff)
+	}
+
+	// 6行ずつの帯ごとに、使っている色を1色ずつ重ねて描く
+	for top := 0; top < height; top += 6 {
+		used := make(map[uint8]bool)
+		for y := top; y < min(top+6, height); y++ {
+			for x := 0; x < width; x++ {
+				if opaque(img, bounds.Min.X+x, bounds.Min.Y+y) {
+					used[paletted.ColorIndexAt(x, y)] = true
+				}
+			}
+		}
+		first := true
+		for idx := 0; idx < len(palette.WebSafe); idx++ {
+			if !used[uint8(idx)] {
+				continue
+			}
+			if !first {
+				b.WriteString("$")
+			}
+			first = false
+			fmt.Fprintf(&b, "#%d", idx)
+			writeSixelRow(&b, img, paletted, uint8(idx), top)
+		}
+		b.WriteString("-")
+	}
+	b.WriteString("\x1b\\")
+	return b.String()
+}
+
+// writeSixelRow は帯の中で指定した色のピクセルを連長圧縮して書き出します
+func writeSixelRow(b *strings.Builder, img image.Image, paletted *image.Paletted, idx uint8, top int) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	var prev byte
+	count := 0
+	flush := func() {
+		switch {
+		case count == 0:
+		case count > 3:
+			fmt.Fprintf(b, "!%d%c", count, prev)
+		default:
+			b.WriteString(strings.Repeat(string(prev), count))
+		}
+	}
+	for x := 0; x < width; x++ {
+		var bits byte
+		for dy := 0; dy < 6 && top+dy < height; dy++ {
+			y := top + dy
+			if paletted.ColorIndexAt(x, y) == idx && opaque(img, bounds.Min.X+x, bounds.Min.Y+y) {
+				bits |= 1 << dy
+			}
+		}
+		ch := bits + 63
+		if ch == prev {
+			count++
+			continue
+		}
+		flush()
+		prev, count = ch, 1
+	}
+	flush()
+}
+
+func opaque(img image.Image, x int, y int) bool {
+	_, _, _, a := img.At(x, y).RGBA()
+	return a >= 0x8000
+}
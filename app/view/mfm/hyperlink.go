@@ -0,0 +1,44 @@
+package mfm
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HyperlinkEnv はハイパーリンクを使うかを明示する環境変数です("0"なら使わない)
+const HyperlinkEnv = "FORCE_HYPERLINK"
+
+// Hyperlink はOSC 8でurlへのリンクにしたテキストを返します
+func Hyperlink(url string, text string) string {
+	return "\x1b]8;;" + url + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
+
+// SupportsHyperlinks は端末がOSC 8のハイパーリンクに対応していそうかを環境変数から判断します
+func SupportsHyperlinks() bool {
+	if v, ok := os.LookupEnv(HyperlinkEnv); ok {
+		return v != "0" && v != "false"
+	}
+	term := os.Getenv("TERM")
+	if term == "dumb" {
+		return false
+	}
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "vscode", "ghostty", "Hyper":
+		return true
+	}
+	for _, env := range []string{"KITTY_WINDOW_ID", "WT_SESSION", "KONSOLE_VERSION", "DOMTERM"} {
+		if os.Getenv(env) != "" {
+			return true
+		}
+	}
+	if v, err := strconv.Atoi(os.Getenv("VTE_VERSION")); err == nil && v >= 5000 {
+		return true
+	}
+	for _, prefix := range []string{"xterm-kitty", "foot", "alacritty", "wezterm"} {
+		if strings.HasPrefix(term, prefix) {
+			return true
+		}
+	}
+	return false
+}
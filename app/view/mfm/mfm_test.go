@@ -0,0 +1,74 @@
+package mfm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/view/mfm"
+)
+
+func TestParseInline(t *testing.T) {
+	nodes := mfm.Parse("**太字** と `code` @ai @syuilo@misskey.io #misskey :blobcat: https://example.com/a_(b).")
+
+	types := make([]mfm.NodeType, 0)
+	for _, n := range nodes {
+		if n.Type != mfm.NodeText {
+			types = append(types, n.Type)
+		}
+	}
+	assert.Equal(t, []mfm.NodeType{
+		mfm.NodeBold, mfm.NodeInlineCode, mfm.NodeMention, mfm.NodeMention,
+		mfm.NodeHashtag, mfm.NodeEmoji, mfm.NodeUrl,
+	}, types)
+	assert.Equal(t, "misskey.io", nodes[6].Host)
+	assert.Equal(t, "https://example.com/a_(b)", nodes[len(nodes)-2].Value)
+	assert.Equal(t, ".", nodes[len(nodes)-1].Value)
+}
+
+func TestParseNotMarkup(t *testing.T) {
+	// メールアドレス、数字だけのハッシュタグ、閉じていない記法はテキストのまま
+	for _, text := range []string{"mail@example.com", "#123", "**open", "$[x2 open", "a*b*c"} {
+		nodes := mfm.Parse(text)
+		assert.Len(t, nodes, 1, text)
+		assert.Equal(t, mfm.NodeText, nodes[0].Type, text)
+		assert.Equal(t, text, mfm.PlainText(nodes), text)
+	}
+}
+
+func TestParseFn(t *testing.T) {
+	nodes := mfm.Parse("$[fg.color=f00 赤い$[x2 大きい]文字]")
+	assert.Len(t, nodes, 1)
+	fn := nodes[0]
+	assert.Equal(t, mfm.NodeFn, fn.Type)
+	assert.Equal(t, "fg", fn.Value)
+	assert.Equal(t, map[string]string{"color": "f00"}, fn.Args)
+	assert.Equal(t, "x2", fn.Children[1].Value)
+	assert.Equal(t, "赤い大きい文字", mfm.PlainText(nodes))
+}
+
+func TestParseBlocks(t *testing.T) {
+	nodes := mfm.Parse("前\n```go\nfmt.Println(1)\n```\n> 引用\n> **続き**\n<center>中央</center>\nmisskey 検索")
+
+	types := make([]mfm.NodeType, 0)
+	for _, n := range nodes {
+		types = append(types, n.Type)
+	}
+	assert.Equal(t, []mfm.NodeType{mfm.NodeText, mfm.NodeCodeBlock, mfm.NodeQuote, mfm.NodeCenter, mfm.NodeSearch}, types)
+	assert.Equal(t, "go", nodes[1].Lang)
+	assert.Equal(t, "fmt.Println(1)", nodes[1].Value)
+	assert.Equal(t, "引用\n続き", mfm.PlainText(nodes[2].Children))
+	assert.Equal(t, "misskey", nodes[4].Value)
+}
+
+func TestRender(t *testing.T) {
+	r := mfm.Renderer{Styles: mfm.PlainStyles()}
+
+	assert.Equal(t, "太字 と @ai", r.Render("**太字** と @ai"))
+	assert.Equal(t, "漢字(かんじ) ぷるぷる", r.Render("$[ruby 漢字 かんじ] $[jelly ぷるぷる]"))
+	assert.Equal(t, "公式 <https://misskey-hub.net>", r.Render("[公式](https://misskey-hub.net)"))
+	assert.Equal(t, "前\n│ code\n後", r.Render("前\n```\ncode\n```\n後"))
+	assert.Equal(t, "▍ 引用", r.Render("> 引用"))
+
+	r.Hyperlinks = true
+	assert.Equal(t, mfm.Hyperlink("https://misskey-hub.net", "公式"), r.Render("[公式](https://misskey-hub.net)"))
+}
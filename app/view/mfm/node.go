@@ -0,0 +1,78 @@
+package mfm
+
+import "strings"
+
+type (
+	// Node はMFMの構文木の要素です
+	// 種類によって使うフィールドが異なります
+	Node struct {
+		Type     NodeType
+		Value    string            // テキスト、コード、URL、ハッシュタグ、絵文字名、ユーザー名、検索語、関数名など
+		Lang     string            // NodeCodeBlock: 言語
+		Host     string            // NodeMention: リモートユーザーのホスト
+		Silent   bool              // NodeLink: ?[label](url) 形式(プレビューなし)
+		Args     map[string]string // NodeFn: $[name.key=value ...] の引数
+		Children []*Node
+	}
+
+	// NodeType はNodeの種類です
+	NodeType string
+)
+
+const (
+	// インライン要素
+	NodeText       NodeType = "text"
+	NodeBold       NodeType = "bold"
+	NodeItalic     NodeType = "italic"
+	NodeStrike     NodeType = "strike"
+	NodeSmall      NodeType = "small"
+	NodeInlineCode NodeType = "inlineCode"
+	NodeMathInline NodeType = "mathInline"
+	NodeMention    NodeType = "mention"
+	NodeHashtag    NodeType = "hashtag"
+	NodeEmoji      NodeType = "emojiCode"
+	NodeUrl        NodeType = "url"
+	NodeLink       NodeType = "link"
+	NodeFn         NodeType = "fn"
+	NodePlain      NodeType = "plain"
+
+	// ブロック要素(前後で改行する)
+	NodeCenter    NodeType = "center"
+	NodeQuote     NodeType = "quote"
+	NodeCodeBlock NodeType = "blockCode"
+	NodeMathBlock NodeType = "mathBlock"
+	NodeSearch    NodeType = "search"
+)
+
+// IsBlock はブロック要素かどうかを返します
+func (n *Node) IsBlock() bool {
+	switch n.Type {
+	case NodeCenter, NodeQuote, NodeCodeBlock, NodeMathBlock, NodeSearch:
+		return true
+	default:
+		return false
+	}
+}
+
+// PlainText は装飾を除いたテキストを返します
+func PlainText(nodes []*Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.Type {
+		case NodeMention:
+			b.WriteString("@" + n.Value)
+			if n.Host != "" {
+				b.WriteString("@" + n.Host)
+			}
+		case NodeHashtag:
+			b.WriteString("#" + n.Value)
+		case NodeEmoji:
+			b.WriteString(":" + n.Value + ":")
+		case NodeLink, NodeFn, NodeBold, NodeItalic, NodeStrike, NodeSmall, NodeCenter, NodeQuote:
+			b.WriteString(PlainText(n.Children))
+		default:
+			b.WriteString(n.Value)
+		}
+	}
+	return b.String()
+}
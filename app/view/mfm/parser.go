@@ -0,0 +1,412 @@
+package mfm
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	mentionPattern = regexp.MustCompile(`^@([a-zA-Z0-9_]+)(?:@([a-zA-Z0-9_-]+(?:\.[a-zA-Z0-9_-]+)*))?`)
+	hashtagPattern = regexp.MustCompile(`^#([^\s.,!?'"#:/\[\]【】()「」（）<>]+)`)
+	emojiPattern   = regexp.MustCompile(`^:([a-zA-Z0-9_+-]+):`)
+	urlPattern     = regexp.MustCompile(`^https?://[\w/:%#@$&?!()\[\]~.,=+\-]+`)
+	fnNamePattern  = regexp.MustCompile(`^[a-z0-9_]+$`)
+	alnumPattern   = regexp.MustCompile(`^[a-zA-Z0-9 ]+$`)
+	searchPattern  = regexp.MustCompile(`^(.+?)[ 　](?:検索|\[検索\]|Search|\[Search\])$`)
+
+	// 単純に囲むだけのタグ
+	tagNodes = map[string]NodeType{
+		"b":      NodeBold,
+		"i":      NodeItalic,
+		"s":      NodeStrike,
+		"small":  NodeSmall,
+		"center": NodeCenter,
+	}
+)
+
+// Parse はMFMのテキストを構文木にします
+// 解釈できない記法はそのままテキストとして残します
+func Parse(text string) []*Node {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return parseBlocks(strings.Split(text, "\n"))
+}
+
+// parseBlocks は行単位でブロック要素を取り出し、残りをインライン要素として解釈します
+func parseBlocks(lines []string) []*Node {
+	nodes := make([]*Node, 0)
+	paragraph := make([]string, 0)
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		nodes = append(nodes, parseInline(strings.Join(paragraph, "\n"))...)
+		paragraph = paragraph[:0]
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "```"):
+			end := findLine(lines, i+1, func(l string) bool { return strings.TrimSpace(l) == "```" })
+			if end < 0 {
+				paragraph = append(paragraph, line)
+				continue
+			}
+			flush()
+			nodes = append(nodes, &Node{
+				Type:  NodeCodeBlock,
+				Lang:  strings.TrimSpace(line[3:]),
+				Value: strings.Join(lines[i+1:end], "\n"),
+			})
+			i = end
+
+		case strings.HasPrefix(line, ">"):
+			end := i
+			inner := make([]string, 0)
+			for ; end < len(lines) && strings.HasPrefix(lines[end], ">"); end++ {
+				l := strings.TrimPrefix(lines[end], ">")
+				inner = append(inner, strings.TrimPrefix(l, " "))
+			}
+			flush()
+			nodes = append(nodes, &Node{Type: NodeQuote, Children: parseBlocks(inner)})
+			i = end - 1
+
+		case strings.HasPrefix(line, `\[`):
+			end := findLine(lines, i, func(l string) bool { return strings.HasSuffix(l, `\]`) })
+			if end < 0 || (end == i && len(line) < 4) {
+				paragraph = append(paragraph, line)
+				continue
+			}
+			flush()
+			formula := strings.Join(lines[i:end+1], "\n")
+			formula = strings.TrimSuffix(strings.TrimPrefix(formula, `\[`), `\]`)
+			nodes = append(nodes, &Node{Type: NodeMathBlock, Value: strings.TrimSpace(formula)})
+			i = end
+
+		case strings.HasPrefix(line, "<center>"):
+			end := findLine(lines, i, func(l string) bool { return strings.HasSuffix(l, "</center>") })
+			if end < 0 {
+				paragraph = append(paragraph, line)
+				continue
+			}
+			flush()
+			inner := strings.Join(lines[i:end+1], "\n")
+			inner = strings.TrimSuffix(strings.TrimPrefix(inner, "<center>"), "</center>")
+			nodes = append(nodes, &Node{Type: NodeCenter, Children: parseInline(strings.Trim(inner, "\n"))})
+			i = end
+
+		case searchPattern.MatchString(line):
+			flush()
+			query := searchPattern.FindStringSubmatch(line)[1]
+			nodes = append(nodes, &Node{Type: NodeSearch, Value: query})
+
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+	return nodes
+}
+
+// findLine はfrom行目以降でmatchに当てはまる最初の行の位置を返します(なければ-1)
+func findLine(lines []string, from int, match func(string) bool) int {
+	for i := from; i < len(lines); i++ {
+		if match(lines[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseInline はインライン要素を解釈します
+func parseInline(s string) []*Node {
+	nodes := make([]*Node, 0)
+	var text strings.Builder
+	flush := func() {
+		if text.Len() == 0 {
+			return
+		}
+		nodes = append(nodes, &Node{Type: NodeText, Value: text.String()})
+		text.Reset()
+	}
+
+	for i := 0; i < len(s); {
+		if node, n := matchInline(s, i); node != nil {
+			flush()
+			nodes = append(nodes, node)
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		text.WriteRune(r)
+		i += size
+	}
+	flush()
+	return nodes
+}
+
+// matchInline はs[i:]の先頭にあるインライン要素と、その長さを返します
+func matchInline(s string, i int) (*Node, int) {
+	rest := s[i:]
+	switch rest[0] {
+	case '*':
+		if node, n := matchEnclosed(rest, "**", "**", NodeBold, true); node != nil {
+			return node, n
+		}
+		if !afterAlnum(s, i) {
+			return matchEnclosed(rest, "*", "*", NodeItalic, false)
+		}
+	case '_':
+		if node, n := matchEnclosed(rest, "__", "__", NodeBold, false); node != nil {
+			return node, n
+		}
+		if !afterAlnum(s, i) {
+			return matchEnclosed(rest, "_", "_", NodeItalic, false)
+		}
+	case '~':
+		return matchEnclosed(rest, "~~", "~~", NodeStrike, true)
+	case '`':
+		return matchCode(rest)
+	case '\\':
+		return matchMath(rest)
+	case '$':
+		return matchFn(rest)
+	case '<':
+		return matchTag(rest)
+	case '@':
+		if !afterWord(s, i) {
+			return matchMention(rest)
+		}
+	case '#':
+		if !afterAlnum(s, i) {
+			return matchHashtag(rest)
+		}
+	case ':':
+		if !afterAlnum(s, i) {
+			if m := emojiPattern.FindStringSubmatch(rest); m != nil {
+				return &Node{Type: NodeEmoji, Value: m[1]}, len(m[0])
+			}
+		}
+	case 'h':
+		if !afterAlnum(s, i) {
+			return matchUrl(rest)
+		}
+	case '[':
+		return matchLink(rest, false)
+	case '?':
+		if strings.HasPrefix(rest, "?[") {
+			node, n := matchLink(rest[1:], true)
+			if node != nil {
+				return node, n + 1
+			}
+		}
+	}
+	return nil, 0
+}
+
+// matchEnclosed はopenとcloseで囲まれた要素を解釈します
+// nestedがfalseなら中身は英数字と空白に限ります(*italic* や __bold__ の記法)
+func matchEnclosed(rest string, open string, close string, t NodeType, nested bool) (*Node, int) {
+	if !strings.HasPrefix(rest, open) {
+		return nil, 0
+	}
+	end := strings.Index(rest[len(open):], close)
+	if end <= 0 {
+		return nil, 0
+	}
+	inner := rest[len(open) : len(open)+end]
+	n := len(open) + end + len(close)
+	if !nested {
+		if !alnumPattern.MatchString(inner) {
+			return nil, 0
+		}
+		return &Node{Type: t, Children: []*Node{{Type: NodeText, Value: inner}}}, n
+	}
+	if t == NodeStrike && strings.Contains(inner, "\n") {
+		return nil, 0
+	}
+	return &Node{Type: t, Children: parseInline(inner)}, n
+}
+
+func matchCode(rest string) (*Node, int) {
+	end := strings.IndexAny(rest[1:], "`\n")
+	if end <= 0 || rest[1+end] != '`' {
+		return nil, 0
+	}
+	return &Node{Type: NodeInlineCode, Value: rest[1 : 1+end]}, end + 2
+}
+
+func matchMath(rest string) (*Node, int) {
+	if !strings.HasPrefix(rest, `\(`) {
+		return nil, 0
+	}
+	end := strings.Index(rest[2:], `\)`)
+	if end <= 0 || strings.Contains(rest[2:2+end], "\n") {
+		return nil, 0
+	}
+	return &Node{Type: NodeMathInline, Value: rest[2 : 2+end]}, end + 4
+}
+
+// matchFn は $[name.key=value,key 中身] 形式の関数を解釈します
+func matchFn(rest string) (*Node, int) {
+	if !strings.HasPrefix(rest, "$[") {
+		return nil, 0
+	}
+	head, _, found := strings.Cut(rest[2:], " ")
+	if !found || strings.ContainsAny(head, "\n]") {
+		return nil, 0
+	}
+	name, params, _ := strings.Cut(head, ".")
+	if !fnNamePattern.MatchString(name) {
+		return nil, 0
+	}
+
+	// 入れ子の [ ] を数えて対応する ] を探す
+	start := 2 + len(head) + 1
+	depth := 0
+	for j := start; j < len(rest); j++ {
+		switch rest[j] {
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			args := make(map[string]string)
+			if params != "" {
+				for _, arg := range strings.Split(params, ",") {
+					k, v, _ := strings.Cut(arg, "=")
+					args[k] = v
+				}
+			}
+			return &Node{
+				Type:     NodeFn,
+				Value:    name,
+				Args:     args,
+				Children: parseInline(rest[start:j]),
+			}, j + 1
+		}
+	}
+	return nil, 0
+}
+
+// matchTag は <b> などのタグと <https://...> 形式のURLを解釈します
+func matchTag(rest string) (*Node, int) {
+	if strings.HasPrefix(rest, "<https://") || strings.HasPrefix(rest, "<http://") {
+		end := strings.IndexAny(rest, ">\n ")
+		if end < 0 || rest[end] != '>' {
+			return nil, 0
+		}
+		return &Node{Type: NodeUrl, Value: rest[1:end]}, end + 1
+	}
+
+	name, _, found := strings.Cut(rest[1:], ">")
+	if !found {
+		return nil, 0
+	}
+	close := "</" + name + ">"
+	open := "<" + name + ">"
+	end := strings.Index(rest[len(open):], close)
+	if end < 0 {
+		return nil, 0
+	}
+	inner := rest[len(open) : len(open)+end]
+	n := len(open) + end + len(close)
+
+	if name == "plain" {
+		return &Node{Type: NodePlain, Value: inner}, n
+	}
+	t, ok := tagNodes[name]
+	if !ok || inner == "" {
+		return nil, 0
+	}
+	return &Node{Type: t, Children: parseInline(inner)}, n
+}
+
+func matchMention(rest string) (*Node, int) {
+	m := mentionPattern.FindStringSubmatch(rest)
+	if m == nil {
+		return nil, 0
+	}
+	return &Node{Type: NodeMention, Value: m[1], Host: m[2]}, len(m[0])
+}
+
+func matchHashtag(rest string) (*Node, int) {
+	m := hashtagPattern.FindStringSubmatch(rest)
+	if m == nil || isDigits(m[1]) {
+		return nil, 0
+	}
+	return &Node{Type: NodeHashtag, Value: m[1]}, len(m[0])
+}
+
+func matchUrl(rest string) (*Node, int) {
+	url := urlPattern.FindString(rest)
+	if url == "" {
+		return nil, 0
+	}
+	// 文末の句読点や、対応しない閉じ括弧はURLに含めない
+	for {
+		trimmed := strings.TrimRight(url, ".,")
+		if strings.HasSuffix(trimmed, ")") && strings.Count(trimmed, "(") < strings.Count(trimmed, ")") {
+			trimmed = trimmed[:len(trimmed)-1]
+		}
+		if trimmed == url {
+			break
+		}
+		url = trimmed
+	}
+	if strings.HasSuffix(url, "://") {
+		return nil, 0
+	}
+	return &Node{Type: NodeUrl, Value: url}, len(url)
+}
+
+// matchLink は [label](url) 形式のリンクを解釈します
+func matchLink(rest string, silent bool) (*Node, int) {
+	label, after, found := strings.Cut(rest[1:], "](")
+	if !found || label == "" || strings.ContainsAny(label, "\n[]") {
+		return nil, 0
+	}
+	url := urlPattern.FindString(after)
+	end := strings.Index(url, ")")
+	if url == "" || end < 0 {
+		return nil, 0
+	}
+	url = url[:end]
+	return &Node{
+		Type:     NodeLink,
+		Value:    url,
+		Silent:   silent,
+		Children: parseInline(label),
+	}, 1 + len(label) + 2 + len(url) + 1
+}
+
+// afterAlnum はs[i]の直前が英数字かどうかを返します(単語の途中の記号は記法として扱わない)
+func afterAlnum(s string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// afterWord はs[i]の直前がユーザー名に使える文字かどうかを返します(メールアドレスを除くため)
+func afterWord(s string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return r == '_' || afterAlnum(s, i)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,334 @@
+package mfm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+type (
+	// Styles は要素ごとの表示スタイルです
+	Styles struct {
+		Bold    lipgloss.Style
+		Italic  lipgloss.Style
+		Strike  lipgloss.Style
+		Small   lipgloss.Style
+		Code    lipgloss.Style // インラインコードとコードブロックの枠
+		Math    lipgloss.Style
+		Mention lipgloss.Style
+		Hashtag lipgloss.Style
+		Emoji   lipgloss.Style
+		Link    lipgloss.Style
+		Quote   lipgloss.Style // 引用の行頭
+		Search  lipgloss.Style
+	}
+
+	// Renderer はMFMを端末で表示できる文字列にします
+	Renderer struct {
+		Styles     Styles
+		Hyperlinks bool              // リンクをOSC 8のハイパーリンクにする
+		Highlight  string            // コードブロックのハイライトに使うchromaのフォーマッタ名(空ならハイライトしない)
+		CodeStyle  string            // chromaのスタイル名
+		Width      int               // 中央寄せに使う幅(0なら寄せない)
+		Emoji      EmojiResolver     // カスタム絵文字の表示(nilなら:name:のまま)
+		EmojiUrls  map[string]string // ノートに含まれる絵文字の画像URL(リモートの絵文字など)
+	}
+
+	// EmojiResolver は :name: の絵文字を表示する文字列に置き換えます
+	// urlはノートに画像URLが含まれていればその値です。置き換えない場合はfalseを返します
+	EmojiResolver interface {
+		Resolve(name string, url string) (string, bool)
+	}
+)
+
+var hexColorPattern = regexp.MustCompile(`^[0-9a-fA-F]{3}(?:[0-9a-fA-F]{3})?$`)
+
+// DefaultStyles は色付きのスタイルです
+func DefaultStyles() Styles {
+	return Styles{
+		Bold:    lipgloss.NewStyle().Bold(true),
+		Italic:  lipgloss.NewStyle().Italic(true),
+		Strike:  lipgloss.NewStyle().Strikethrough(true),
+		Small:   lipgloss.NewStyle().Faint(true),
+		Code:    lipgloss.NewStyle().Foreground(lipgloss.Color("215")),
+		Math:    lipgloss.NewStyle().Italic(true).Foreground(lipgloss.Color("183")),
+		Mention: lipgloss.NewStyle().Foreground(lipgloss.Color("39")),
+		Hashtag: lipgloss.NewStyle().Foreground(lipgloss.Color("43")),
+		Emoji:   lipgloss.NewStyle().Foreground(lipgloss.Color("221")),
+		Link:    lipgloss.NewStyle().Foreground(lipgloss.Color("75")).Underline(true),
+		Quote:   lipgloss.NewStyle().Foreground(lipgloss.Color("244")),
+		Search:  lipgloss.NewStyle().Foreground(lipgloss.Color("75")),
+	}
+}
+
+// PlainStyles は色を使わないスタイルです(太字などの装飾のみ)
+func PlainStyles() Styles {
+	return Styles{
+		Bold:    lipgloss.NewStyle().Bold(true),
+		Italic:  lipgloss.NewStyle().Italic(true),
+		Strike:  lipgloss.NewStyle().Strikethrough(true),
+		Small:   lipgloss.NewStyle(),
+		Code:    lipgloss.NewStyle(),
+		Math:    lipgloss.NewStyle(),
+		Mention: lipgloss.NewStyle(),
+		Hashtag: lipgloss.NewStyle(),
+		Emoji:   lipgloss.NewStyle(),
+		Link:    lipgloss.NewStyle().Underline(true),
+		Quote:   lipgloss.NewStyle(),
+		Search:  lipgloss.NewStyle(),
+	}
+}
+
+// NewRenderer は端末の対応状況に合わせたRendererを作ります
+func NewRenderer(styles Styles) Renderer {
+	return Renderer{
+		Styles:     styles,
+		Hyperlinks: SupportsHyperlinks(),
+		Highlight:  highlightFormatter(lipgloss.ColorProfile()),
+		CodeStyle:  "monokai",
+	}
+}
+
+// highlightFormatter は端末の色数に合わせたchromaのフォーマッタ名を返します
+func highlightFormatter(profile termenv.Profile) string {
+	switch profile {
+	case termenv.TrueColor:
+		return "terminal16m"
+	case termenv.ANSI256:
+		return "terminal256"
+	case termenv.ANSI:
+		return "terminal"
+	default:
+		return ""
+	}
+}
+
+// Render はMFMのテキストを解釈して表示用の文字列にします
+func (r Renderer) Render(text string) string {
+	return r.RenderNodes(Parse(text))
+}
+
+// RenderNodes は構文木を表示用の文字列にします
+func (r Renderer) RenderNodes(nodes []*Node) string {
+	var b strings.Builder
+	r.renderNodes(&b, nodes, lipgloss.NewStyle())
+	return b.String()
+}
+
+func (r Renderer) renderNodes(b *strings.Builder, nodes []*Node, style lipgloss.Style) {
+	for i, n := range nodes {
+		if !n.IsBlock() {
+			r.renderInline(b, n, style)
+			continue
+		}
+		// ブロック要素は前後で改行する
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+		r.renderBlock(b, n, style)
+		if i < len(nodes)-1 {
+			b.WriteString("\n")
+		}
+	}
+}
+
+func (r Renderer) renderBlock(b *strings.Builder, n *Node, style lipgloss.Style) {
+	switch n.Type {
+	case NodeCodeBlock:
+		border := r.Styles.Code.Render("│")
+		if n.Lang != "" {
+			b.WriteString(r.Styles.Code.Render("┌ "+n.Lang) + "\n")
+		}
+		lines := strings.Split(r.highlight(n.Value, n.Lang), "\n")
+		for i, line := range lines {
+			b.WriteString(border + " " + line)
+			if i < len(lines)-1 {
+				b.WriteString("\n")
+			}
+		}
+	case NodeMathBlock:
+		writeStyled(b, n.Value, r.Styles.Math.Copy().Inherit(style))
+	case NodeQuote:
+		var inner strings.Builder
+		r.renderNodes(&inner, n.Children, r.Styles.Quote.Copy().Inherit(style))
+		lines := strings.Split(inner.String(), "\n")
+		for i, line := range lines {
+			b.WriteString(r.Styles.Quote.Render("▍") + " " + line)
+			if i < len(lines)-1 {
+				b.WriteString("\n")
+			}
+		}
+	case NodeCenter:
+		var inner strings.Builder
+		r.renderNodes(&inner, n.Children, style)
+		if r.Width <= 0 {
+			b.WriteString(inner.String())
+			return
+		}
+		lines := strings.Split(inner.String(), "\n")
+		for i, line := range lines {
+			b.WriteString(lipgloss.PlaceHorizontal(r.Width, lipgloss.Center, line))
+			if i < len(lines)-1 {
+				b.WriteString("\n")
+			}
+		}
+	case NodeSearch:
+		writeStyled(b, "🔍 "+n.Value, r.Styles.Search.Copy().Inherit(style))
+	}
+}
+
+func (r Renderer) renderInline(b *strings.Builder, n *Node, style lipgloss.Style) {
+	switch n.Type {
+	case NodeText, NodePlain:
+		writeStyled(b, n.Value, style)
+	case NodeBold:
+		r.renderNodes(b, n.Children, r.Styles.Bold.Copy().Inherit(style))
+	case NodeItalic:
+		r.renderNodes(b, n.Children, r.Styles.Italic.Copy().Inherit(style))
+	case NodeStrike:
+		r.renderNodes(b, n.Children, r.Styles.Strike.Copy().Inherit(style))
+	case NodeSmall:
+		r.renderNodes(b, n.Children, r.Styles.Small.Copy().Inherit(style))
+	case NodeInlineCode:
+		writeStyled(b, n.Value, r.Styles.Code.Copy().Inherit(style))
+	case NodeMathInline:
+		writeStyled(b, n.Value, r.Styles.Math.Copy().Inherit(style))
+	case NodeMention, NodeHashtag, NodeEmoji:
+		r.renderToken(b, n, style)
+	case NodeUrl:
+		r.renderLink(b, n.Value, []*Node{{Type: NodeText, Value: n.Value}}, style, false)
+	case NodeLink:
+		r.renderLink(b, n.Value, n.Children, style, true)
+	case NodeFn:
+		r.renderFn(b, n, style)
+	}
+}
+
+func (r Renderer) renderToken(b *strings.Builder, n *Node, style lipgloss.Style) {
+	text := PlainText([]*Node{n})
+	switch n.Type {
+	case NodeMention:
+		writeStyled(b, text, r.Styles.Mention.Copy().Inherit(style))
+	case NodeHashtag:
+		writeStyled(b, text, r.Styles.Hashtag.Copy().Inherit(style))
+	case NodeEmoji:
+		if r.Emoji != nil {
+			if s, ok := r.Emoji.Resolve(n.Value, r.EmojiUrls[n.Value]); ok {
+				b.WriteString(s)
+				return
+			}
+		}
+		writeStyled(b, text, r.Styles.Emoji.Copy().Inherit(style))
+	}
+}
+
+// renderLink はリンクを描画します
+// ハイパーリンクに対応しない端末では、ラベルとURLが異なればURLを後ろに添えます
+func (r Renderer) renderLink(b *strings.Builder, url string, label []*Node, style lipgloss.Style, showUrl bool) {
+	var text strings.Builder
+	r.renderNodes(&text, label, r.Styles.Link.Copy().Inherit(style))
+	if r.Hyperlinks {
+		b.WriteString(Hyperlink(url, text.String()))
+		return
+	}
+	b.WriteString(text.String())
+	if showUrl {
+		writeStyled(b, " <"+url+">", style)
+	}
+}
+
+// renderFn は $[...] 関数を描画します
+// 端末で表現できないアニメーションなどは中身だけを表示します
+func (r Renderer) renderFn(b *strings.Builder, n *Node, style lipgloss.Style) {
+	switch n.Value {
+	case "x2", "x3", "x4":
+		r.renderNodes(b, n.Children, r.Styles.Bold.Copy().Inherit(style))
+	case "fg":
+		if color := n.Args["color"]; hexColorPattern.MatchString(color) {
+			style = style.Copy().Foreground(lipgloss.Color("#" + expandHex(color)))
+		}
+		r.renderNodes(b, n.Children, style)
+	case "bg":
+		if color := n.Args["color"]; hexColorPattern.MatchString(color) {
+			style = style.Copy().Background(lipgloss.Color("#" + expandHex(color)))
+		}
+		r.renderNodes(b, n.Children, style)
+	case "blur":
+		r.renderNodes(b, n.Children, r.Styles.Small.Copy().Inherit(style))
+	case "ruby":
+		base, ruby, _ := strings.Cut(strings.TrimSpace(PlainText(n.Children)), " ")
+		writeStyled(b, base, style)
+		if ruby != "" {
+			writeStyled(b, "("+strings.TrimSpace(ruby)+")", r.Styles.Small.Copy().Inherit(style))
+		}
+	case "unixtime":
+		value := strings.TrimSpace(PlainText(n.Children))
+		if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+			value = time.Unix(sec, 0).Local().Format("2006/01/02 15:04:05")
+		}
+		writeStyled(b, value, style)
+	default:
+		r.renderNodes(b, n.Children, style)
+	}
+}
+
+// highlight はコードをシンタックスハイライトします(できなければそのまま返します)
+func (r Renderer) highlight(code string, lang string) string {
+	if r.Highlight == "" {
+		return code
+	}
+	var lexer chroma.Lexer
+	if lang != "" {
+		lexer = lexers.Get(lang)
+	}
+	if lexer == nil {
+		lexer = lexers.Analyse(code)
+	}
+	if lexer == nil {
+		return code
+	}
+	formatter := formatters.Get(r.Highlight)
+	if formatter == nil {
+		return code
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return code
+	}
+	var b strings.Builder
+	if err := formatter.Format(&b, styles.Get(r.CodeStyle), iterator); err != nil {
+		return code
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// writeStyled は行ごとにスタイルを適用して書き込みます
+// (lipglossは複数行をまとめて渡すと行の幅を揃えてしまうため)
+func writeStyled(b *strings.Builder, text string, style lipgloss.Style) {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			b.WriteString(style.Render(line))
+		}
+		if i < len(lines)-1 {
+			b.WriteString("\n")
+		}
+	}
+}
+
+// expandHex は3桁の色指定を6桁にします
+func expandHex(color string) string {
+	if len(color) != 3 {
+		return color
+	}
+	return fmt.Sprintf("%c%c%c%c%c%c", color[0], color[0], color[1], color[1], color[2], color[2])
+}
@@ -0,0 +1,218 @@
+package postnote
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type (
+	// Candidate は補完候補です
+	Candidate struct {
+		Label string // 一覧に表示する文字列
+		Value string // 確定したときに入力中の語と置き換える文字列
+	}
+
+	// Completer はトリガー文字に続けて入力中の語(トリガー文字を除く)から補完候補を探します
+	Completer func(ctx context.Context, query string) ([]Candidate, error)
+
+	// CompletionMsg は補完候補の検索結果です
+	CompletionMsg struct {
+		seq   int
+		items []Candidate
+		err   error
+	}
+
+	// completion は入力中の語の補完候補の一覧です
+	completion struct {
+		completers map[rune]Completer
+		open       bool
+		trigger    rune
+		query      string
+		row        int // 置き換える語の行
+		start      int // 置き換える語の行内の開始位置(トリガー文字の位置)
+		end        int // 置き換える語の行内の終了位置(カーソルの位置)
+		items      []Candidate
+		cursor     int
+		seq        int // 古い検索結果を捨てるための番号
+	}
+
+	// CompletionKeyMap は補完候補の一覧を開いているときのキー操作です
+	CompletionKeyMap struct {
+		Next   key.Binding
+		Prev   key.Binding
+		Accept key.Binding
+		Close  key.Binding
+	}
+)
+
+const (
+	maxCompletionItems = 5 // 一覧に表示する候補の数
+	completionTimeout  = 5 * time.Second
+)
+
+var (
+	completionStyle         = lipgloss.NewStyle().PaddingLeft(2)
+	selectedCompletionStyle = lipgloss.NewStyle().PaddingLeft(2).Reverse(true)
+)
+
+func newCompletionKeyMap() CompletionKeyMap {
+	return CompletionKeyMap{
+		Next:   key.NewBinding(key.WithKeys("down", "ctrl+n")),
+		Prev:   key.NewBinding(key.WithKeys("up", "ctrl+p", "shift+tab")),
+		Accept: key.NewBinding(key.WithKeys("tab", "enter")),
+		Close:  key.NewBinding(key.WithKeys("esc")),
+	}
+}
+
+// SetCompleter はtriggerで始まる語の補完に使う関数を登録します(nilなら登録を外します)
+func (pt *PostTextarea) SetCompleter(trigger rune, c Completer) {
+	if c == nil {
+		delete(pt.completion.completers, trigger)
+		return
+	}
+	pt.completion.completers[trigger] = c
+}
+
+// CompletionOpen は補完候補の一覧を開いているかを返します
+func (pt PostTextarea) CompletionOpen() bool {
+	return pt.completion.open
+}
+
+// updateCompletionKey は一覧を開いているときのキー操作を処理します
+// 処理した場合はtrueを返します
+func (pt *PostTextarea) updateCompletionKey(msg tea.KeyMsg) bool {
+	c := pt.completion
+	if !c.open {
+		return false
+	}
+	switch {
+	case key.Matches(msg, pt.completionKeys.Next):
+		c.cursor = (c.cursor + 1) % len(c.items)
+	case key.Matches(msg, pt.completionKeys.Prev):
+		c.cursor = (c.cursor - 1 + len(c.items)) % len(c.items)
+	case key.Matches(msg, pt.completionKeys.Accept):
+		pt.accept(c.items[c.cursor])
+		c.close()
+	case key.Matches(msg, pt.completionKeys.Close):
+		c.close()
+	default:
+		return false
+	}
+	return true
+}
+
+// accept は入力中の語を候補で置き換えます
+func (pt *PostTextarea) accept(item Candidate) {
+	c := pt.completion
+	lines := strings.Split(pt.Value(), "\n")
+	if c.row >= len(lines) {
+		return
+	}
+	line := []rune(lines[c.row])
+	if c.end > len(line) || c.start > c.end {
+		return
+	}
+	replaced := string(line[:c.start]) + item.Value + " "
+	lines[c.row] = replaced + string(line[c.end:])
+	pt.SetValue(strings.Join(lines, "\n"))
+
+	// SetValueでカーソルが末尾に移るので、置き換えた語の後ろに戻す
+	for i := len(lines) - 1; i > c.row; i-- {
+		pt.CursorUp()
+	}
+	pt.SetCursor(len([]rune(replaced)))
+}
+
+// refreshCompletion はカーソルの直前の語を調べ、補完の対象なら候補を検索するコマンドを返します
+func (pt *PostTextarea) refreshCompletion() tea.Cmd {
+	c := pt.completion
+	row, start, end, word := pt.currentWord()
+	if word == "" {
+		c.close()
+		return nil
+	}
+	trigger := []rune(word)[0]
+	completer, ok := c.completers[trigger]
+	query := string([]rune(word)[1:])
+	if !ok || query == "" {
+		c.close()
+		return nil
+	}
+	if c.trigger == trigger && c.query == query && c.row == row && c.start == start {
+		return nil
+	}
+
+	c.seq++
+	c.trigger, c.query, c.row, c.start, c.end = trigger, query, row, start, end
+	seq := c.seq
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+		defer cancel()
+		items, err := completer(ctx, query)
+		return CompletionMsg{seq: seq, items: items, err: err}
+	}
+}
+
+// updateCompletionResult は検索結果を一覧に反映します
+func (pt *PostTextarea) updateCompletionResult(msg CompletionMsg) {
+	c := pt.completion
+	if msg.seq != c.seq || c.query == "" {
+		return
+	}
+	if msg.err != nil {
+		pt.logger.Log("postarea", "completion error: "+msg.err.Error())
+	}
+	c.items = msg.items
+	if len(c.items) > maxCompletionItems {
+		c.items = c.items[:maxCompletionItems]
+	}
+	c.cursor = 0
+	c.open = len(c.items) > 0
+}
+
+// currentWord はカーソルの直前にある空白を含まない語と、その位置を返します
+func (pt PostTextarea) currentWord() (row int, start int, end int, word string) {
+	lines := strings.Split(pt.Value(), "\n")
+	row = pt.Line()
+	if row >= len(lines) {
+		return row, 0, 0, ""
+	}
+	info := pt.LineInfo()
+	line := []rune(lines[row])
+	end = min(info.StartColumn+info.ColumnOffset, len(line))
+	start = end
+	for start > 0 && !unicode.IsSpace(line[start-1]) {
+		start--
+	}
+	return row, start, end, string(line[start:end])
+}
+
+func (c *completion) close() {
+	c.open = false
+	c.items = nil
+	c.cursor = 0
+	c.query = ""
+	c.trigger = 0
+}
+
+// view は候補の一覧を表示します
+func (c *completion) view() string {
+	if !c.open {
+		return ""
+	}
+	lines := make([]string, 0, len(c.items))
+	for i, item := range c.items {
+		if i == c.cursor {
+			lines = append(lines, selectedCompletionStyle.Render(item.Label))
+		} else {
+			lines = append(lines, completionStyle.Render(item.Label))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,56 @@
+package postnote_test
+
+import (
+	"context"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/view/postnote"
+)
+
+// completionMsg はコマンドの実行結果から補完候補の検索結果を探します
+func completionMsg(cmd tea.Cmd) (postnote.CompletionMsg, bool) {
+	if cmd == nil {
+		return postnote.CompletionMsg{}, false
+	}
+	switch msg := cmd().(type) {
+	case postnote.CompletionMsg:
+		return msg, true
+	case tea.BatchMsg:
+		for _, c := range msg {
+			if m, ok := completionMsg(c); ok {
+				return m, true
+			}
+		}
+	}
+	return postnote.CompletionMsg{}, false
+}
+
+func TestCompletion(t *testing.T) {
+	pt := postnote.NewPostTextarea(nil, logger.New(false))
+	pt.SetCompleter(':', func(ctx context.Context, query string) ([]postnote.Candidate, error) {
+		return []postnote.Candidate{{Label: ":" + query + "cat:", Value: ":" + query + "cat:"}}, nil
+	})
+
+	var cmd tea.Cmd
+	for _, r := range "hi :blob" {
+		pt, cmd = pt.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	msg, ok := completionMsg(cmd)
+	assert.True(t, ok)
+	pt, _ = pt.Update(msg)
+	assert.True(t, pt.CompletionOpen())
+	assert.Contains(t, pt.View(), ":blobcat:")
+
+	// tabで入力中の語を置き換える
+	pt, _ = pt.Update(tea.KeyMsg{Type: tea.KeyTab})
+	assert.False(t, pt.CompletionOpen())
+	assert.Equal(t, "hi :blobcat: ", pt.Value())
+
+	// トリガー文字がなければ補完しない
+	pt, cmd = pt.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	_, ok = completionMsg(cmd)
+	assert.False(t, ok)
+}
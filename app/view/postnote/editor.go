@@ -0,0 +1,78 @@
+package postnote
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type (
+	// EditorFinishedMsg は外部エディタでの編集結果です
+	EditorFinishedMsg struct {
+		text string
+		err  error
+	}
+)
+
+// editorCommand は $VISUAL、$EDITOR の順にエディタのコマンドを決めます(未設定ならvi)
+// "code --wait" のような引数付きの指定にも対応します
+func editorCommand() (string, []string) {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields[0], fields[1:]
+		}
+	}
+	return "vi", nil
+}
+
+// openEditor は入力中の本文を一時ファイルに書き出し、外部エディタで開くコマンドを返します
+// エディタを終了すると、一時ファイルの内容をEditorFinishedMsgで返します
+func (pt *PostTextarea) openEditor() tea.Cmd {
+	f, err := os.CreateTemp("", "petit-misskey-*.txt")
+	if err != nil {
+		return editorError(fmt.Errorf("一時ファイルを作成できません: %w", err))
+	}
+	path := f.Name()
+	_, err = f.WriteString(pt.Value())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return editorError(fmt.Errorf("一時ファイルに書き込めません: %w", err))
+	}
+
+	name, args := editorCommand()
+	cmd := exec.Command(name, append(args, path)...)
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		defer os.Remove(path)
+		if err != nil {
+			return EditorFinishedMsg{err: fmt.Errorf("エディタ %s を実行できません: %w", name, err)}
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return EditorFinishedMsg{err: fmt.Errorf("一時ファイルを読み込めません: %w", err)}
+		}
+		// エディタが末尾に付ける改行は取り除く
+		return EditorFinishedMsg{text: strings.TrimRight(string(b), "\r\n")}
+	})
+}
+
+// updateEditorResult は編集結果を入力欄に反映します
+// 失敗した場合は入力中の本文をそのまま残します
+func (pt *PostTextarea) updateEditorResult(msg EditorFinishedMsg) {
+	if msg.err != nil {
+		pt.logger.Log("postarea", "editor error: "+msg.err.Error())
+		return
+	}
+	pt.Restore(msg.text)
+}
+
+func editorError(err error) tea.Cmd {
+	return func() tea.Msg {
+		return EditorFinishedMsg{err: err}
+	}
+}
@@ -2,27 +2,50 @@ package postnote
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textarea"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/wasya-io/petit-misskey/domain/core"
+	"github.com/wasya-io/petit-misskey/view/mfm"
 )
 
 type (
 	PostTextarea struct {
 		textarea.Model
 		logger         core.Logger
+		keyMap         PostKeyMap
 		CallbackSubmit func(content string) tea.Cmd
+		completion     *completion
+		completionKeys CompletionKeyMap
+		renderer       *mfm.Renderer // プレビューの描画(nilならプレビューしない)
+		showPreview    bool
 	}
 
 	PostKeyMap struct {
 		textarea.KeyMap
-		Submit key.Binding
+		Submit  key.Binding
+		Editor  key.Binding // 外部エディタで編集する
+		Preview key.Binding // プレビューの表示を切り替える
 	}
 )
 
+const (
+	minHeight = 3  // 入力欄の最小の高さ
+	maxHeight = 10 // 入力欄はこの高さまで行数に合わせて伸ばす
+)
+
+var (
+	counterStyle = lipgloss.NewStyle().Faint(true)
+	previewStyle = lipgloss.NewStyle().
+			BorderStyle(lipgloss.NormalBorder()).
+			BorderLeft(true).
+			BorderForeground(lipgloss.Color("240")).
+			PaddingLeft(1)
+)
+
 // 新しいPostKeyMapを生成します
 func NewPostKeyMap() PostKeyMap {
 	return PostKeyMap{
@@ -30,6 +53,14 @@ func NewPostKeyMap() PostKeyMap {
 			key.WithKeys("ctrl+s", "cmd+s"),
 			key.WithHelp("Ctrl+s/Cmd+s", "送信"),
 		),
+		Editor: key.NewBinding(
+			key.WithKeys("ctrl+x"),
+			key.WithHelp("ctrl+x", "エディタ"),
+		),
+		Preview: key.NewBinding(
+			key.WithKeys("alt+p"),
+			key.WithHelp("alt+p", "プレビュー"),
+		),
 	}
 }
 
@@ -42,21 +73,54 @@ func NewPostTextarea(submitCallback func(content string) tea.Cmd, logger core.Lo
 	ta.Prompt = "┃ "
 	ta.CharLimit = 280
 	ta.SetWidth(lipgloss.Width(placeholder) + 8)
-	ta.SetHeight(3)
+	ta.SetHeight(minHeight)
+	// 表示の高さは行数に合わせて変えるので、入力できる行数は制限しない
+	ta.MaxHeight = 0
 	ta.FocusedStyle.CursorLine = lipgloss.NewStyle()
 	ta.ShowLineNumbers = false
-	ta.KeyMap.InsertNewline.SetEnabled(false)
 
 	return PostTextarea{
 		Model:          ta,
 		logger:         logger,
+		keyMap:         NewPostKeyMap(),
 		CallbackSubmit: submitCallback,
+		completion:     &completion{completers: map[rune]Completer{}},
+		completionKeys: newCompletionKeyMap(),
+		showPreview:    true,
 	}
 }
 
 // PostKeyMap は現在のキーマップを返します
 func (pt PostTextarea) PostKeyMap() PostKeyMap {
-	return NewPostKeyMap()
+	return pt.keyMap
+}
+
+// SetSubmitKeys は送信キーを置き換えます(空の場合は既定のまま)
+func (pt *PostTextarea) SetSubmitKeys(keys []string) {
+	overrideKeys(&pt.keyMap.Submit, keys)
+}
+
+// SetEditorKeys は外部エディタを開くキーを置き換えます(空の場合は既定のまま)
+func (pt *PostTextarea) SetEditorKeys(keys []string) {
+	overrideKeys(&pt.keyMap.Editor, keys)
+}
+
+// SetPreviewKeys はプレビューの表示を切り替えるキーを置き換えます(空の場合は既定のまま)
+func (pt *PostTextarea) SetPreviewKeys(keys []string) {
+	overrideKeys(&pt.keyMap.Preview, keys)
+}
+
+// SetPreviewRenderer はMFMのプレビューに使うrendererを設定します
+func (pt *PostTextarea) SetPreviewRenderer(renderer mfm.Renderer) {
+	pt.renderer = &renderer
+}
+
+func overrideKeys(b *key.Binding, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	b.SetKeys(keys...)
+	b.SetHelp(strings.Join(keys, "/"), b.Help().Desc)
 }
 
 // Update はキーイベントを処理します
@@ -64,7 +128,23 @@ func (pt PostTextarea) Update(msg tea.Msg) (PostTextarea, tea.Cmd) {
 	var cmds []tea.Cmd
 	pt.logger.Log("postarea", fmt.Sprintf("updated %T", msg))
 	switch msg := msg.(type) {
+	case CompletionMsg:
+		pt.updateCompletionResult(msg)
+		return pt, nil
+	case EditorFinishedMsg:
+		pt.updateEditorResult(msg)
+		return pt, nil
 	case tea.KeyMsg:
+		if pt.updateCompletionKey(msg) {
+			return pt, nil
+		}
+		switch {
+		case key.Matches(msg, pt.keyMap.Editor):
+			return pt, pt.openEditor()
+		case key.Matches(msg, pt.keyMap.Preview):
+			pt.showPreview = !pt.showPreview
+			return pt, nil
+		}
 		// Command+Enterが押されたかチェック
 		// キー情報をより詳細にログ出力する例
 		pt.logger.Log("postarea", fmt.Sprintf("key message: %s, Alt: %v", msg.String(), msg.Alt))
@@ -72,10 +152,9 @@ func (pt PostTextarea) Update(msg tea.Msg) (PostTextarea, tea.Cmd) {
 			content := pt.Value()
 			pt.logger.Log("postarea", fmt.Sprintf("content: %s", content))
 			if content != "" && pt.CallbackSubmit != nil {
-				cmds = append(cmds, pt.CallbackSubmit(content))
-				// 入力をクリア
-				pt.Reset()
-				return pt, tea.Batch(cmds...)
+				// 送信できたかどうかが分かるまで入力は残しておき、呼び出し側がClearで消す
+				pt.completion.close()
+				return pt, pt.CallbackSubmit(content)
 			}
 		}
 	default:
@@ -86,6 +165,69 @@ func (pt PostTextarea) Update(msg tea.Msg) (PostTextarea, tea.Cmd) {
 	mdl, cmd := pt.Model.Update(msg)
 	pt.Model = mdl
 	cmds = append(cmds, cmd)
+	if _, ok := msg.(tea.KeyMsg); ok {
+		pt.fitHeight()
+		cmds = append(cmds, pt.refreshCompletion())
+	}
 
 	return pt, tea.Batch(cmds...)
 }
+
+// View は入力欄と、補完候補の一覧、残りの文字数、MFMのプレビューを表示します
+func (pt PostTextarea) View() string {
+	parts := []string{pt.Model.View()}
+	if popup := pt.completion.view(); popup != "" {
+		parts = append(parts, popup)
+	}
+	parts = append(parts, counterStyle.Render(pt.counter()))
+	if preview := pt.preview(); preview != "" {
+		parts = append(parts, preview)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// counter は残りの文字数とキー操作の説明を返します
+func (pt PostTextarea) counter() string {
+	text := fmt.Sprintf("残り %d 文字", pt.CharLimit-pt.Length())
+	if pt.CharLimit <= 0 {
+		text = fmt.Sprintf("%d 文字", pt.Length())
+	}
+	for _, b := range []key.Binding{pt.keyMap.Submit, pt.keyMap.Editor, pt.keyMap.Preview} {
+		text += fmt.Sprintf(" [%s] %s", b.Help().Key, b.Help().Desc)
+	}
+	return text
+}
+
+// preview は入力中の本文をMFMとして描画します
+func (pt PostTextarea) preview() string {
+	if pt.renderer == nil || !pt.showPreview || strings.TrimSpace(pt.Value()) == "" {
+		return ""
+	}
+	renderer := *pt.renderer
+	renderer.Width = pt.Width()
+	return previewStyle.Render(renderer.Render(pt.Value()))
+}
+
+// Clear は入力を消します
+func (pt *PostTextarea) Clear() {
+	pt.Reset()
+	pt.completion.close()
+	pt.fitHeight()
+}
+
+// Restore は下書きなどの本文を入力欄に戻します
+func (pt *PostTextarea) Restore(text string) {
+	pt.SetValue(text)
+	pt.completion.close()
+	pt.fitHeight()
+}
+
+// fitHeight は折り返しを含めた行数に合わせて入力欄の高さを変えます
+func (pt *PostTextarea) fitHeight() {
+	width := max(pt.Width(), 1)
+	lines := 0
+	for _, line := range strings.Split(pt.Value(), "\n") {
+		lines += max((lipgloss.Width(line)+width-1)/width, 1)
+	}
+	pt.SetHeight(min(max(lines, minHeight), maxHeight))
+}
@@ -0,0 +1,47 @@
+package postnote_test
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/view/mfm"
+	"github.com/wasya-io/petit-misskey/view/postnote"
+)
+
+func TestMultiline(t *testing.T) {
+	var submitted string
+	pt := postnote.NewPostTextarea(func(content string) tea.Cmd {
+		submitted = content
+		return nil
+	}, logger.New(false))
+	pt.CharLimit = 100
+	pt.SetPreviewRenderer(mfm.Renderer{Styles: mfm.PlainStyles()})
+
+	// enterで改行し、行数に合わせて入力欄を伸ばす
+	for i, line := range []string{"**1**", "2", "3", "4"} {
+		if i > 0 {
+			pt, _ = pt.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		}
+		pt, _ = pt.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(line)})
+	}
+	assert.Equal(t, "**1**\n2\n3\n4", pt.Value())
+	assert.Equal(t, 4, pt.Height())
+
+	// 残りの文字数とプレビュー
+	view := pt.View()
+	assert.Contains(t, view, "残り 89 文字")
+	assert.Contains(t, view, "│ 1\n")
+
+	pt, _ = pt.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p"), Alt: true})
+	assert.NotContains(t, pt.View(), "│ 1\n")
+
+	pt, _ = pt.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+	assert.Equal(t, "**1**\n2\n3\n4", submitted)
+	// 送信の結果が分かるまでは入力を残し、Clearで消す
+	assert.Equal(t, "**1**\n2\n3\n4", pt.Value())
+	pt.Clear()
+	assert.Equal(t, "", pt.Value())
+	assert.Equal(t, 3, pt.Height())
+}
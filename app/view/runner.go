@@ -14,7 +14,8 @@ type Model interface {
 }
 
 func Run(model Model, logger core.Logger) {
-	p := tea.NewProgram(model, tea.WithAltScreen())
+	p := tea.NewProgram(model, tea.WithAltScreen(), tea.WithOutput(Terminal))
+	Terminal.watchSize(p)
 	msgCh := model.MsgChannel()
 
 	go func() {
@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/media"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/service/emoji"
+	"github.com/wasya-io/petit-misskey/service/filter"
+	"github.com/wasya-io/petit-misskey/service/watch"
+	"github.com/wasya-io/petit-misskey/view/mfm"
+)
+
+type (
+	// Account はタイムラインに接続するアカウントと、その接続に使うクライアントです
+	Account struct {
+		Key       string
+		Instance  *setting.Instance
+		Client    websocket.Client
+		APIClient api.Client
+		MsgCh     chan tea.Msg   // Clientがメッセージを送るチャネル
+		Emojis    *emoji.Catalog // カスタム絵文字の一覧(nilなら:name:のまま表示)
+		Media     *media.Fetcher // 絵文字などの画像の取得(nilなら画像を表示しない)
+
+		gen       int // 接続ごとの世代番号(切り替え前の接続から届いたメッセージを捨てるため)
+		cancel    context.CancelFunc
+		connected bool
+		timeline  websocket.ChannelType
+		emoji     *emojiResolver
+		filter    *filter.Engine
+		watcher   *watch.Watcher
+		images    *imageCache
+	}
+
+	// AccountFactory はインスタンスキーからAccountを組み立てます
+	AccountFactory func(key string) (*Account, error)
+
+	// accountMsg はアカウントのクライアントから届いたメッセージです
+	accountMsg struct {
+		key string
+		gen int
+		msg tea.Msg
+	}
+
+	// accountSwitchedMsg は切り替え先のアカウントを組み立て終えたことを表します
+	accountSwitchedMsg struct {
+		key     string
+		gen     int // 切り替えを始めたときの世代番号
+		account *Account
+		err     error
+	}
+
+	// accountState はアカウントを切り替えたときに復元する表示状態です
+	accountState struct {
+		timeline websocket.ChannelType
+		notes    []*timelineNote
+	}
+)
+
+// EnableAccountSwitch は実行中のアカウント切り替えを有効にします
+// keysは切り替え候補のインスタンスキー、factoryは切り替え先の接続を組み立てる関数です
+func (m *Model) EnableAccountSwitch(keys []string, factory AccountFactory) {
+	m.accountKeys = keys
+	m.accountFactory = factory
+}
+
+// JoinAccounts は同時に接続するアカウントを追加します
+// 追加したアカウントのノートは主アカウントのタイムラインにまとめて表示します
+func (m *Model) JoinAccounts(accounts ...*Account) {
+	m.accounts = append(m.accounts, accounts...)
+}
+
+// findAccount はメッセージを送ってきた接続のアカウントを返します
+// 切り替えなどで既に切断した接続であればnilを返します
+func (m *Model) findAccount(key string, gen int) *Account {
+	for _, account := range m.accounts {
+		if account.Key == key && account.gen == gen {
+			return account
+		}
+	}
+	return nil
+}
+
+// accountByKey はキーに対応する接続中のアカウントを返します
+func (m *Model) accountByKey(key string) *Account {
+	for _, account := range m.accounts {
+		if account.Key == key {
+			return account
+		}
+	}
+	return nil
+}
+
+// isMulti は複数のアカウントのタイムラインをまとめて表示しているかを返します
+func (m *Model) isMulti() bool {
+	return len(m.accounts) > 1
+}
+
+// startAccount はアカウントの接続を開始するコマンドを返します
+// 世代番号はUpdateの中で決めておき、goroutineからはmを書き換えないようにします
+func (m *Model) startAccount(account *Account) tea.Cmd {
+	m.generation++
+	account.gen = m.generation
+	ctx, cancel := context.WithCancel(m.ctx)
+	account.cancel = cancel
+
+	connect := func() tea.Msg {
+		// 別goroutineでWebSocket接続を開始
+		go func() {
+			if err := account.Client.Start(); err != nil {
+				m.msgCh <- accountMsg{key: account.Key, gen: account.gen, msg: websocket.WebSocketErrorMsg{Err: err}}
+			}
+		}()
+		// クライアントからのメッセージに世代番号を付けてモデルに転送する
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-account.MsgCh:
+					select {
+					case m.msgCh <- accountMsg{key: account.Key, gen: account.gen, msg: msg}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+		return nil
+	}
+	return tea.Batch(connect, m.loadEmojis(account), m.loadMeta(account))
+}
+
+// stopAccount はアカウントの接続を終了します
+func (m *Model) stopAccount(account *Account) {
+	account.Client.Stop()
+	if account.cancel != nil {
+		account.cancel()
+	}
+}
+
+// switchAccount は接続中のアカウントを切断し、keyのアカウントで接続し直します
+// 複数アカウントをまとめて表示している場合は、選んだアカウントだけの表示になります
+// アカウントの組み立て(トークンの読み出しなど)には時間がかかることがあるので、別goroutineで行います
+func (m *Model) switchAccount(key string) tea.Cmd {
+	if key == m.account.Key && !m.isMulti() {
+		return nil
+	}
+	// 組み立てている間に別の切り替えを始めたら、古い結果は世代番号で捨てる
+	m.generation++
+	gen := m.generation
+	factory := m.accountFactory
+	return func() tea.Msg {
+		next, err := factory(key)
+		return accountSwitchedMsg{key: key, gen: gen, account: next, err: err}
+	}
+}
+
+// completeSwitch は組み立てたアカウントに切り替えます
+func (m *Model) completeSwitch(msg accountSwitchedMsg) tea.Cmd {
+	if msg.gen != m.generation {
+		m.logger.Log("stream", fmt.Sprintf("drop stale account: %s", msg.key))
+		if msg.account != nil {
+			msg.account.Client.Stop()
+		}
+		return nil
+	}
+	key, next := msg.key, msg.account
+	if msg.err != nil {
+		m.err = fmt.Errorf("アカウント %s に切り替えられません: %w", key, msg.err)
+		m.refreshStatusView()
+		return nil
+	}
+
+	// 切り替え前のアカウントの表示状態を保存する
+	if !m.isMulti() {
+		m.states[m.account.Key] = accountState{timeline: m.account.timeline, notes: m.mainColumn().notes}
+	}
+	for _, account := range m.accounts {
+		m.stopAccount(account)
+	}
+	m.logger.Log("stream", fmt.Sprintf("switch account: %s -> %s", m.account.Key, key))
+
+	// 書きかけの投稿は切り替え前のアカウントの下書きとして残す
+	m.saveDraft()
+	m.useAccount(next)
+	m.restoreDraft()
+	// 以前に表示していたタイムラインとノートを復元する
+	if state, ok := m.states[key]; ok {
+		m.mainColumn().notes = state.notes
+		next.Client.SetTimeline(state.timeline)
+	}
+	m.refreshViewBuffer()
+
+	return tea.Batch(m.startAccount(next), m.startColumns())
+}
+
+// useAccount はアカウントの設定を表示と投稿欄に反映します
+func (m *Model) useAccount(account *Account) {
+	prefs := account.Instance.Preferences
+	m.account = account
+	m.accounts = []*Account{account}
+	m.err = nil
+	m.replyTo = nil
+	m.reactions.open = false
+	m.filters.open = false
+	m.watchView.open = false
+	m.searchView.open = false
+	m.explore.open = false
+	m.keyMap = NewKeyMap(prefs.Keybindings)
+	m.theme = themeByName(prefs.Theme)
+	m.renderer = mfm.NewRenderer(m.theme.Markup)
+	m.setupComposer(prefs)
+	m.buildColumns(account)
+}
@@ -0,0 +1,83 @@
+package stream
+
+import (
+	"fmt"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+)
+
+// timelineMockClient はSetTimelineの呼び出しを記録するモッククライアントです
+type timelineMockClient struct {
+	MockWebSocketClient
+	timeline   websocket.ChannelType
+	subscribed []websocket.ChannelType
+}
+
+func (c *timelineMockClient) SetTimeline(t websocket.ChannelType) error {
+	c.timeline = t
+	return nil
+}
+
+func (c *timelineMockClient) Subscribe(channel websocket.ChannelType, params map[string]string) (string, error) {
+	c.subscribed = append(c.subscribed, channel)
+	return fmt.Sprintf("channel-%d", len(c.subscribed)), nil
+}
+
+func newTestAccount(key string) *Account {
+	return &Account{
+		Key:      key,
+		Instance: &setting.Instance{BaseUrl: "https://" + key + ".example", UserName: key},
+		Client:   &timelineMockClient{},
+		MsgCh:    make(chan tea.Msg, 10),
+	}
+}
+
+func TestSwitchAccount(t *testing.T) {
+	accounts := map[string]*Account{"a": newTestAccount("a"), "b": newTestAccount("b")}
+	model := NewAccountModel(accounts["a"], logger.New(false))
+	model.EnableAccountSwitch([]string{"a", "b"}, func(key string) (*Account, error) {
+		next := newTestAccount(key)
+		accounts[key] = next
+		return next, nil
+	})
+	model.Init()
+
+	model.Update(accountMsg{key: "a", gen: accounts["a"].gen, msg: websocket.WebSocketConnectedMsg{Timeline: websocket.ChannelTypeLocal}})
+	model.Update(accountMsg{key: "a", gen: accounts["a"].gen, msg: websocket.NoteMessage{Note: createTestNote(1)}})
+	assert.Len(t, model.mainColumn().notes, 1)
+
+	// ピッカーを開いて b を選ぶ
+	old := accounts["a"]
+	model.Update(tea.KeyMsg{Type: tea.KeyCtrlA})
+	assert.True(t, model.picker.open)
+	model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	_, cmd := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	// アカウントはコマンドの中で組み立てる
+	assert.Equal(t, "a", model.account.Key)
+	model.Update(cmd())
+	assert.Equal(t, "b", model.account.Key)
+	assert.True(t, old.Client.(*timelineMockClient).stopCalled)
+	assert.Empty(t, model.mainColumn().notes)
+
+	// 切り替え前の接続から届いたメッセージは捨てられる
+	model.Update(accountMsg{key: "a", gen: old.gen, msg: websocket.NoteMessage{Note: createTestNote(2)}})
+	assert.Empty(t, model.mainColumn().notes)
+
+	// 組み立てている間に切り替え直したら、古い結果は捨てる
+	stale := model.switchAccount("a")()
+	latest := model.switchAccount("a")()
+	model.Update(stale)
+	assert.Equal(t, "b", model.account.Key)
+
+	// a に戻るとタイムラインとノートが復元される
+	model.Update(latest)
+	assert.Equal(t, "a", model.account.Key)
+	assert.Len(t, model.mainColumn().notes, 1)
+	assert.Equal(t, websocket.ChannelTypeLocal, accounts["a"].Client.(*timelineMockClient).timeline)
+}
@@ -0,0 +1,410 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+type (
+	// column はデッキ表示の1カラムです
+	// メインのタイムライン以外は、主アカウントで購読したチャンネルかポーリングの結果を表示します
+	column struct {
+		spec          setting.Column
+		account       *Account
+		main          bool   // メインのタイムライン
+		channel       string // 購読しているチャンネルのID
+		userId        string // type=user: 解決済みのユーザーID
+		sinceId       string // type=user: 最後に取得したノートのID
+		width         int    // 幅(0なら残りを等分)
+		notes         []*timelineNote
+		notifications []*misskey.Notification
+		selected      string          // 選択中のノートのURI
+		seen          map[string]bool // 最近追加したノートのURI(保持しなくなったノートを再び追加しないため)
+		seenOrder     []string        // seenのURIを追加した順
+	}
+
+	// userNotesMsg はユーザーカラムのポーリング結果です
+	userNotesMsg struct {
+		column *column
+		userId string
+		notes  []misskey.NoteBody
+		err    error
+	}
+)
+
+const (
+	minColumnWidth    = 20               // カラムの最小幅
+	columnResizeStep  = 4                // 幅を変えるキー1回あたりの変化量
+	userPollInterval  = 30 * time.Second // ユーザーカラムのポーリング間隔
+	userPollTimeout   = 10 * time.Second
+	defaultDeckHeight = 10
+)
+
+var (
+	columnStyle = lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("62"))
+	focusedColumnStyle = columnStyle.Copy().
+				BorderForeground(lipgloss.Color("205"))
+)
+
+// buildColumns はアカウントの設定からカラムを組み立て、必要なチャンネルを購読します
+// timelineカラムがなければ、メインのタイムラインを先頭に置きます
+func (m *Model) buildColumns(account *Account) {
+	columns := make([]*column, 0, len(account.Instance.Preferences.Deck)+1)
+	hasMain := false
+	for _, spec := range account.Instance.Preferences.Deck {
+		c := &column{spec: spec, account: account, width: spec.Width}
+		c.clear()
+		if spec.Type == setting.ColumnTimeline && !hasMain {
+			c.main = true
+			hasMain = true
+		} else if err := c.subscribe(); err != nil {
+			m.err = fmt.Errorf("カラム %s を表示できません: %w", c.title(), err)
+			continue
+		}
+		columns = append(columns, c)
+	}
+	if !hasMain {
+		c := &column{spec: setting.Column{Type: setting.ColumnTimeline}, account: account, main: true}
+		c.clear()
+		columns = append([]*column{c}, columns...)
+	}
+
+	m.columns = columns
+	m.focus = 0
+	for i, c := range columns {
+		if c.main {
+			m.focus = i
+		}
+	}
+}
+
+// subscribe はカラムの種類に応じたチャンネルを購読します
+// ユーザーカラムはストリーミングがないためポーリングで取得します
+func (c *column) subscribe() error {
+	var channel websocket.ChannelType
+	var params map[string]string
+	switch c.spec.Type {
+	case setting.ColumnTimeline:
+		timeline, err := websocket.ParseChannelType(c.spec.Timeline)
+		if err != nil {
+			return err
+		}
+		channel = timeline
+	case setting.ColumnChannel:
+		channel, params = websocket.ChannelTypeChannel, map[string]string{"channelId": c.spec.Id}
+	case setting.ColumnList:
+		channel, params = websocket.ChannelTypeUserList, map[string]string{"listId": c.spec.Id}
+	case setting.ColumnAntenna:
+		channel, params = websocket.ChannelTypeAntenna, map[string]string{"antennaId": c.spec.Id}
+	case setting.ColumnNotifications:
+		channel = websocket.ChannelTypeMain
+	case setting.ColumnUser:
+		if c.spec.User == "" {
+			return fmt.Errorf("user is required")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown column type: %s", c.spec.Type)
+	}
+
+	id, err := c.account.Client.Subscribe(channel, params)
+	if err != nil {
+		return err
+	}
+	c.channel = id
+	return nil
+}
+
+// title はカラムの見出しです
+func (c *column) title() string {
+	if c.spec.Title != "" {
+		return c.spec.Title
+	}
+	switch c.spec.Type {
+	case setting.ColumnTimeline:
+		if c.main {
+			if c.account.timeline != "" {
+				return c.account.timeline.String()
+			}
+			return "タイムライン"
+		}
+		timeline, _ := websocket.ParseChannelType(c.spec.Timeline)
+		return timeline.String()
+	case setting.ColumnChannel:
+		return "チャンネル " + c.spec.Id
+	case setting.ColumnList:
+		return "リスト " + c.spec.Id
+	case setting.ColumnAntenna:
+		return "アンテナ " + c.spec.Id
+	case setting.ColumnNotifications:
+		return "通知"
+	case setting.ColumnUser:
+		return c.spec.User
+	default:
+		return string(c.spec.Type)
+	}
+}
+
+// mainColumn はメインのタイムラインのカラムを返します
+func (m *Model) mainColumn() *column {
+	for _, c := range m.columns {
+		if c.main {
+			return c
+		}
+	}
+	return m.columns[0]
+}
+
+// focusedColumn は選択やリアクションの対象になるカラムを返します
+func (m *Model) focusedColumn() *column {
+	return m.columns[m.focus]
+}
+
+// isDeck はカラムを横に並べて表示しているかを返します
+func (m *Model) isDeck() bool {
+	return len(m.columns) > 1
+}
+
+// columnFor はチャンネルIDに対応するカラムを返します
+// 購読したチャンネル以外(メインのタイムライン)から届いたものはメインのカラムに入れます
+func (m *Model) columnFor(account *Account, channel string) *column {
+	for _, c := range m.columns {
+		if !c.main && c.account == account && c.channel != "" && c.channel == channel {
+			return c
+		}
+	}
+	return m.mainColumn()
+}
+
+func (m *Model) hasColumn(target *column) bool {
+	for _, c := range m.columns {
+		if c == target {
+			return true
+		}
+	}
+	return false
+}
+
+// moveFocus はフォーカスをdeltaだけ隣のカラムに移します
+func (m *Model) moveFocus(delta int) {
+	m.focus = min(max(m.focus+delta, 0), len(m.columns)-1)
+}
+
+// moveColumn はフォーカス中のカラムをdeltaだけ移動します
+func (m *Model) moveColumn(delta int) {
+	to := m.focus + delta
+	if to < 0 || len(m.columns) <= to {
+		return
+	}
+	m.columns[m.focus], m.columns[to] = m.columns[to], m.columns[m.focus]
+	m.focus = to
+}
+
+// resizeColumn はフォーカス中のカラムの幅をdeltaだけ変えます
+// 幅が自動のカラムは、いまの表示幅を起点にします
+func (m *Model) resizeColumn(delta int) {
+	widths := columnWidths(m.columns, m.width)
+	c := m.focusedColumn()
+	c.width = max(widths[m.focus]+delta, minColumnWidth)
+}
+
+// startColumns はポーリングで取得するカラムの取得を開始するコマンドを返します
+func (m *Model) startColumns() tea.Cmd {
+	cmds := make([]tea.Cmd, 0)
+	for _, c := range m.columns {
+		if c.spec.Type == setting.ColumnUser {
+			cmds = append(cmds, c.pollUser(m.ctx, 0))
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+// pollUser はdelay後にユーザーのノートを取得するコマンドを返します
+func (c *column) pollUser(ctx context.Context, delay time.Duration) tea.Cmd {
+	client := c.account.APIClient
+	user, userId, sinceId := c.spec.User, c.userId, c.sinceId
+	fetch := func() tea.Msg {
+		ctx, cancel := context.WithTimeout(ctx, userPollTimeout)
+		defer cancel()
+
+		if userId == "" {
+			id, err := resolveUser(ctx, client, user)
+			if err != nil {
+				return userNotesMsg{column: c, err: err}
+			}
+			userId = id
+		}
+		notes, err := client.UserNotes(ctx, misskey.UserNotes{UserId: userId, SinceId: sinceId, Limit: maxKeptNotes})
+		return userNotesMsg{column: c, userId: userId, notes: notes, err: err}
+	}
+	if delay == 0 {
+		return fetch
+	}
+	return tea.Tick(delay, func(time.Time) tea.Msg { return fetch() })
+}
+
+// updateUserColumn はユーザーカラムのポーリング結果を反映し、次の取得を予約します
+func (m *Model) updateUserColumn(msg userNotesMsg) tea.Cmd {
+	c := msg.column
+	if !m.hasColumn(c) || m.quitting {
+		// アカウント切り替えなどで無くなったカラム
+		return nil
+	}
+	if msg.err != nil {
+		m.err = fmt.Errorf("%s のノートを取得できません: %w", c.title(), msg.err)
+	} else {
+		c.userId = msg.userId
+		for _, body := range msg.notes {
+			c.addNote(c.account, &misskey.Note{
+				Type: "channel",
+				Body: misskey.NoteContainer{Type: "note", Body: body},
+			})
+		}
+		if len(msg.notes) > 0 {
+			// users/notes は新しい順に返す
+			c.sinceId = msg.notes[0].ID
+		}
+	}
+	m.refreshViewBuffer()
+	return c.pollUser(m.ctx, userPollInterval)
+}
+
+// resolveUser は@username形式の指定をユーザーIDに変換します
+func resolveUser(ctx context.Context, client api.Client, user string) (string, error) {
+	if !strings.HasPrefix(user, "@") {
+		return user, nil
+	}
+	contents := misskey.ShowUser{}
+	username, host, remote := strings.Cut(strings.TrimPrefix(user, "@"), "@")
+	contents.Username = username
+	if remote {
+		contents.Host = &host
+	}
+	ret, err := client.ShowUser(ctx, contents)
+	if err != nil {
+		return "", err
+	}
+	return ret.Id, nil
+}
+
+// addNotification は通知を新しい順に追加します
+func (c *column) addNotification(n *misskey.Notification) {
+	c.notifications = append([]*misskey.Notification{n}, c.notifications...)
+	if len(c.notifications) > maxKeptNotes {
+		c.notifications = c.notifications[:maxKeptNotes]
+	}
+}
+
+// columnWidths は画面の幅を各カラムに割り当てます
+// 幅を指定したカラムを先に割り当て、残りを自動のカラムで等分します
+func columnWidths(columns []*column, total int) []int {
+	widths := make([]int, len(columns))
+	rest, auto := total, 0
+	for i, c := range columns {
+		if c.width > 0 {
+			widths[i] = max(c.width, minColumnWidth)
+			rest -= widths[i]
+		} else {
+			auto++
+		}
+	}
+	for i, c := range columns {
+		if c.width == 0 {
+			widths[i] = max(rest/auto, minColumnWidth)
+		}
+	}
+	return widths
+}
+
+// renderDeck はカラムを横に並べて描画します
+func (m *Model) renderDeck() string {
+	height := m.viewMain.Height - 2
+	if height <= 0 {
+		height = defaultDeckHeight
+	}
+	widths := columnWidths(m.columns, m.width)
+	views := make([]string, 0, len(m.columns))
+	for i, c := range m.columns {
+		views = append(views, m.renderColumn(c, widths[i], height, i == m.focus))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, views...)
+}
+
+// renderColumn は見出しと新しい順のノートを枠で囲んで描画します
+func (m *Model) renderColumn(c *column, width int, height int, focused bool) string {
+	inner := max(width-2, 1)
+	wrap := lipgloss.NewStyle().Width(inner)
+	// 折り返しの幅計算がOSC 8を扱えないため、カラム内ではハイパーリンクにしない
+	render := func(entry *timelineNote) string {
+		renderer := m.rendererFor(entry.account(m))
+		renderer.Hyperlinks = false
+		renderer.Width = inner
+		if text, ok := m.collapsed(entry); ok {
+			return text
+		}
+		// 画像のエスケープシーケンスも折り返せないので、カラム内ではblurhashで表示する
+		return m.decorated(entry, formatNote(entry.note, m.theme, renderer, m.previewFor(entry, inner, false), entry.watched))
+	}
+
+	var b strings.Builder
+	title := c.title()
+	if focused {
+		title = m.theme.Account(title)
+	}
+	b.WriteString(title + "\n")
+
+	if c.spec.Type == setting.ColumnNotifications {
+		for _, n := range c.notifications {
+			b.WriteString(wrap.Render(formatNotification(n, m.theme)) + "\n")
+		}
+	}
+	for _, entry := range c.notes {
+		text := render(entry)
+		if c.main && m.isMulti() {
+			text = m.theme.Account("via "+entry.receiverKeys()) + "\n" + text
+		}
+		if focused && entry.uri == c.selected {
+			text = selectedStyle.Width(max(inner-2, 1)).Render(text)
+		} else {
+			text = wrap.Render(text)
+		}
+		b.WriteString(text + "\n")
+	}
+
+	style := columnStyle
+	if focused {
+		style = focusedColumnStyle
+	}
+	return style.Width(inner).Height(height).MaxHeight(height + 2).Render(b.String())
+}
+
+// formatNotification は通知を1行で表示できる形にします
+func formatNotification(n *misskey.Notification, theme Theme) string {
+	from := ""
+	if n.User != nil {
+		from = fmt.Sprintf("%s @%s", theme.Name(n.User.Name), theme.Username(n.User.Username))
+	}
+	text := ""
+	if n.Note != nil {
+		text = n.Note.Text
+	}
+	switch n.Type {
+	case "reaction":
+		return fmt.Sprintf("%s %s: %s", n.Reaction, from, text)
+	case "follow":
+		return fmt.Sprintf("フォローされました: %s", from)
+	default:
+		return fmt.Sprintf("[%s] %s: %s", n.Type, from, text)
+	}
+}
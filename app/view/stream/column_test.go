@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+func TestDeckColumns(t *testing.T) {
+	account := newTestAccount("a")
+	account.Instance.Preferences.Deck = []setting.Column{
+		{Type: setting.ColumnChannel, Id: "ch"},
+		{Type: setting.ColumnTimeline, Timeline: "local"},
+		{Type: setting.ColumnNotifications, Width: 30},
+	}
+	model := NewAccountModel(account, logger.New(false))
+	client := account.Client.(*timelineMockClient)
+
+	// 最初のtimelineカラムはメインのタイムラインなので購読しない
+	assert.Len(t, model.columns, 3)
+	assert.Equal(t, []websocket.ChannelType{websocket.ChannelTypeChannel, websocket.ChannelTypeMain}, client.subscribed)
+	assert.Equal(t, 1, model.focus)
+	assert.True(t, model.columns[1].main)
+
+	// チャンネルIDでカラムに振り分ける
+	model.Init()
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{ChannelId: "channel-1", Note: createTestNote(1)}})
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{ChannelId: "timeline", Note: createTestNote(2)}})
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NotificationMessage{ChannelId: "channel-2", Notification: &misskey.Notification{Type: "follow"}}})
+	assert.Len(t, model.columns[0].notes, 1)
+	assert.Len(t, model.columns[1].notes, 1)
+	assert.Len(t, model.columns[2].notifications, 1)
+
+	// フォーカスの移動、並べ替え、幅の変更
+	model.Update(tea.KeyMsg{Type: tea.KeyCtrlRight})
+	assert.Equal(t, 2, model.focus)
+	model.Update(tea.KeyMsg{Type: tea.KeyCtrlShiftLeft})
+	assert.Equal(t, 1, model.focus)
+	assert.Equal(t, setting.ColumnNotifications, model.columns[1].spec.Type)
+	model.Update(tea.KeyMsg{Type: tea.KeyShiftRight})
+	assert.Equal(t, 30+columnResizeStep, model.columns[1].width)
+}
+
+func TestColumnWidths(t *testing.T) {
+	columns := []*column{{}, {width: 30}, {}}
+	assert.Equal(t, []int{45, 30, 45}, columnWidths(columns, 120))
+
+	// 幅が足りなくても最小幅は確保する
+	assert.Equal(t, []int{minColumnWidth, 30, minColumnWidth}, columnWidths(columns, 40))
+}
@@ -0,0 +1,51 @@
+package stream
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type (
+	// commandDoneMsg は投稿欄から実行したコマンドが終わったことを表します
+	commandDoneMsg struct {
+		text string
+	}
+)
+
+// runCommand は投稿欄に入力された ":filters" や ":search 語" のようなコマンドを実行します
+// コマンドでなければfalseを返し、通常の投稿として扱います
+func (m *Model) runCommand(text string) (tea.Cmd, bool) {
+	if !strings.HasPrefix(text, ":") {
+		return nil, false
+	}
+	fields := strings.Fields(strings.TrimPrefix(text, ":"))
+	if len(fields) == 0 {
+		return nil, false
+	}
+
+	done := func() tea.Msg { return commandDoneMsg{text: text} }
+	switch fields[0] {
+	case "filters":
+		m.openFilters()
+	case "highlights":
+		m.openHighlights()
+	case "plugins":
+		m.openPlugins()
+	case "search":
+		return tea.Batch(m.openSearch(fields[1:]), done), true
+	case "find":
+		return tea.Batch(m.openFind(fields[1:]), done), true
+	case "tag":
+		return tea.Batch(m.openTag(fields[1:]), done), true
+	case "trends":
+		return tea.Batch(m.openTrends(), done), true
+	default:
+		command, ok := m.pluginCommand(fields[0])
+		if !ok {
+			return nil, false
+		}
+		return tea.Batch(m.runPluginCommand(command, fields[1:]), done), true
+	}
+	return done, true
+}
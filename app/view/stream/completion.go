@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/view/postnote"
+)
+
+type (
+	// metaMsg はインスタンスの情報の取得結果です
+	metaMsg struct {
+		meta *misskey.MetaResponse
+		err  error
+	}
+)
+
+const (
+	metaTimeout = 10 * time.Second
+	completions = 5 // 補完候補に出すユーザーやハッシュタグの数
+)
+
+// registerCompleters は投稿欄の @ # : の補完を登録します
+func (m *Model) registerCompleters() {
+	m.textarea.SetCompleter('@', m.completeMention)
+	m.textarea.SetCompleter('#', m.completeHashtag)
+	m.textarea.SetCompleter(':', m.completeEmoji)
+}
+
+// completeMention は @username または @username@host の補完候補をユーザー検索で探します
+func (m *Model) completeMention(ctx context.Context, query string) ([]postnote.Candidate, error) {
+	username, host, _ := strings.Cut(query, "@")
+	if username == "" {
+		return nil, nil
+	}
+	users, err := m.account.APIClient.SearchUsers(ctx, misskey.SearchUsers{
+		Username: username,
+		Host:     host,
+		Limit:    completions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]postnote.Candidate, 0, len(users))
+	for _, u := range users {
+		acct := "@" + u.UserName
+		if u.Host != nil {
+			acct += "@" + *u.Host
+		}
+		label := acct
+		if u.Name != "" {
+			label = fmt.Sprintf("%s %s", u.Name, acct)
+		}
+		candidates = append(candidates, postnote.Candidate{Label: label, Value: acct})
+	}
+	return candidates, nil
+}
+
+// completeHashtag は #tag の補完候補をハッシュタグ検索で探します
+func (m *Model) completeHashtag(ctx context.Context, query string) ([]postnote.Candidate, error) {
+	tags, err := m.account.APIClient.SearchHashtags(ctx, misskey.SearchHashtags{
+		Query: query,
+		Limit: completions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]postnote.Candidate, 0, len(tags))
+	for _, tag := range tags {
+		candidates = append(candidates, postnote.Candidate{Label: "#" + tag, Value: "#" + tag})
+	}
+	return candidates, nil
+}
+
+// loadMeta は投稿の文字数制限を決めるため、主アカウントのインスタンスの情報を取得するコマンドを返します
+func (m *Model) loadMeta(account *Account) tea.Cmd {
+	if account != m.account || account.APIClient == nil {
+		return nil
+	}
+	key, gen := account.Key, account.gen
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(m.ctx, metaTimeout)
+		defer cancel()
+		meta, err := account.APIClient.Meta(ctx, misskey.Meta{})
+		return accountMsg{key: key, gen: gen, msg: metaMsg{meta: meta, err: err}}
+	}
+}
+
+// updateMeta はインスタンスの最大文字数を投稿欄に反映します
+func (m *Model) updateMeta(account *Account, msg metaMsg) {
+	if msg.err != nil {
+		m.logger.Log("stream", fmt.Sprintf("meta error: %v", msg.err))
+		return
+	}
+	if account == m.account && msg.meta.MaxNoteLength > 0 {
+		m.textarea.CharLimit = msg.meta.MaxNoteLength
+	}
+}
@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+// searchMockClient は補完とmetaに使うAPIだけを返すクライアントです
+type searchMockClient struct {
+	api.Client
+	users    misskey.SearchUsers
+	hashtags misskey.SearchHashtags
+}
+
+func (c *searchMockClient) Meta(ctx context.Context, contents misskey.Meta) (*misskey.MetaResponse, error) {
+	return &misskey.MetaResponse{MaxNoteLength: 3000}, nil
+}
+
+func (c *searchMockClient) SearchUsers(ctx context.Context, contents misskey.SearchUsers) ([]misskey.User, error) {
+	c.users = contents
+	host := "misskey.io"
+	return []misskey.User{{Name: "しゅいろ", UserName: "syuilo", Host: &host}, {UserName: "ai"}}, nil
+}
+
+func (c *searchMockClient) SearchHashtags(ctx context.Context, contents misskey.SearchHashtags) ([]string, error) {
+	c.hashtags = contents
+	return []string{"misskey", "misskeydev"}, nil
+}
+
+func TestCompleters(t *testing.T) {
+	account := newTestAccount("a")
+	client := &searchMockClient{}
+	account.APIClient = client
+	model := NewAccountModel(account, logger.New(false))
+
+	candidates, err := model.completeMention(context.Background(), "syu@misskey.io")
+	assert.NoError(t, err)
+	assert.Equal(t, misskey.SearchUsers{Username: "syu", Host: "misskey.io", Limit: completions}, client.users)
+	assert.Equal(t, "しゅいろ @syuilo@misskey.io", candidates[0].Label)
+	assert.Equal(t, "@syuilo@misskey.io", candidates[0].Value)
+	assert.Equal(t, "@ai", candidates[1].Value)
+
+	candidates, err = model.completeHashtag(context.Background(), "missk")
+	assert.NoError(t, err)
+	assert.Equal(t, "missk", client.hashtags.Query)
+	assert.Equal(t, "#misskeydev", candidates[1].Value)
+}
+
+func TestCharLimitFromMeta(t *testing.T) {
+	account := newTestAccount("a")
+	account.APIClient = &searchMockClient{}
+	model := NewAccountModel(account, logger.New(false))
+	model.Init()
+	assert.Equal(t, 280, model.textarea.CharLimit)
+
+	msg := model.loadMeta(account)()
+	model.Update(msg)
+	assert.Equal(t, 3000, model.textarea.CharLimit)
+}
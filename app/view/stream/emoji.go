@@ -0,0 +1,148 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/service/emoji"
+	"github.com/wasya-io/petit-misskey/view/mfm"
+	"github.com/wasya-io/petit-misskey/view/postnote"
+)
+
+type (
+	// emojiResolver はアカウントのカスタム絵文字を表示する文字列に置き換えます
+	// 設定した代わりの絵文字を優先し、画像を表示できる端末では画像を非同期に読み込みます
+	// 2セルの半角ブロックでは絵柄が分からないため、画像を重ねて描けない端末では :name: のまま表示します
+	emojiResolver struct {
+		prefs   setting.Emoji
+		catalog *emoji.Catalog
+		images  *imageCache // nilなら画像を表示しない
+	}
+
+	// emojiCatalogMsg は絵文字の一覧の読み込み結果です
+	emojiCatalogMsg struct {
+		err error
+	}
+
+	// imageLoadedMsg は絵文字や添付ファイルの画像を読み込み終えたことを知らせます
+	imageLoadedMsg struct{}
+)
+
+const (
+	emojiLoadTimeout = 30 * time.Second
+	emojiCompletions = 5 // 補完候補に出す絵文字の数
+)
+
+func newEmojiResolver(account *Account, images *imageCache) *emojiResolver {
+	return &emojiResolver{
+		prefs:   account.Instance.Preferences.Emoji,
+		catalog: account.Emojis,
+		images:  images,
+	}
+}
+
+// Resolve は mfm.EmojiResolver の実装です
+func (r *emojiResolver) Resolve(name string, url string) (string, bool) {
+	if s, ok := r.prefs.Fallback[name]; ok {
+		return s, true
+	}
+	if !r.prefs.Images || r.images == nil || r.images.overlay == nil {
+		return "", false
+	}
+	if url == "" && r.catalog != nil {
+		if e, ok := r.catalog.Lookup(name); ok {
+			url = e.Url
+		}
+	}
+	if url == "" {
+		return "", false
+	}
+	// 行の途中に置くので、折り返されないよう改行しない空白で場所を空ける
+	return r.images.get(url, 2, 1, "\u00a0")
+}
+
+// loadEmojis はアカウントの絵文字の一覧を読み込むコマンドを返します
+func (m *Model) loadEmojis(account *Account) tea.Cmd {
+	if account.Emojis == nil {
+		return nil
+	}
+	key, gen := account.Key, account.gen
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(m.ctx, emojiLoadTimeout)
+		defer cancel()
+		return accountMsg{key: key, gen: gen, msg: emojiCatalogMsg{err: account.Emojis.Load(ctx)}}
+	}
+}
+
+// rendererFor はアカウントのカスタム絵文字を表示するrendererを返します
+func (m *Model) rendererFor(account *Account) mfm.Renderer {
+	renderer := m.renderer
+	if account == nil {
+		return renderer
+	}
+	if account.emoji == nil {
+		account.emoji = newEmojiResolver(account, m.imagesFor(account))
+	}
+	renderer.Emoji = account.emoji
+	return renderer
+}
+
+// completeEmoji は投稿欄の :name の補完候補を絵文字の一覧から探します
+func (m *Model) completeEmoji(ctx context.Context, query string) ([]postnote.Candidate, error) {
+	catalog := m.account.Emojis
+	if catalog == nil {
+		return nil, nil
+	}
+	emojis := catalog.Search(query, emojiCompletions)
+	candidates := make([]postnote.Candidate, 0, len(emojis))
+	for _, e := range emojis {
+		candidates = append(candidates, postnote.Candidate{
+			Label: fmt.Sprintf(":%s:", e.Name),
+			Value: fmt.Sprintf(":%s:", e.Name),
+		})
+	}
+	return candidates, nil
+}
+
+// formatReactions はリアクションを多い順に並べて表示します
+// カスタム絵文字のリアクションは :name@host: (ローカルは :name@.:) の形で届きます
+func formatReactions(reactions map[string]int, urls map[string]string, renderer mfm.Renderer) string {
+	if len(reactions) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(reactions))
+	for k := range reactions {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if reactions[keys[i]] != reactions[keys[j]] {
+			return reactions[keys[i]] > reactions[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s %d", renderReaction(k, urls, renderer), reactions[k]))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// renderReaction はリアクション1つを絵文字として表示します
+func renderReaction(reaction string, urls map[string]string, renderer mfm.Renderer) string {
+	if len(reaction) < 2 || !strings.HasPrefix(reaction, ":") || !strings.HasSuffix(reaction, ":") {
+		return reaction
+	}
+	inner := strings.Trim(reaction, ":")
+	name, host, _ := strings.Cut(inner, "@")
+	renderer.EmojiUrls = nil
+	if host != "" && host != "." {
+		renderer.EmojiUrls = map[string]string{name: urls[inner]}
+	}
+	return renderer.Render(":" + name + ":")
+}
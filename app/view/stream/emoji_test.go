@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/emoji"
+	"github.com/wasya-io/petit-misskey/view/mfm"
+)
+
+func TestEmojiResolver(t *testing.T) {
+	account := newTestAccount("a")
+	account.Instance.Preferences.Emoji = setting.Emoji{Fallback: map[string]string{"blobcat": "🐱"}}
+	resolver := newEmojiResolver(account, nil)
+
+	renderer := mfm.Renderer{Styles: mfm.PlainStyles(), Emoji: resolver}
+	assert.Equal(t, "🐱 と :unknown:", renderer.Render(":blobcat: と :unknown:"))
+
+	// リモートの絵文字は :name@host: で届き、画像URLはreactionEmojisに含まれる
+	reactions := map[string]int{":blobcat@.:": 1, "👍": 3, ":remote@misskey.io:": 1}
+	assert.Equal(t, "👍 3  🐱 1  :remote: 1", formatReactions(reactions, nil, renderer))
+}
+
+func TestEmojiCatalogMessages(t *testing.T) {
+	account := newTestAccount("a")
+	account.Emojis = emoji.NewCatalog(nil, nil, 0)
+	model := NewAccountModel(account, logger.New(false))
+	model.Init()
+
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.EmojiAddedMessage{Emoji: misskey.Emoji{Name: "blobcat"}}})
+	_, ok := account.Emojis.Lookup("blobcat")
+	assert.True(t, ok)
+
+	candidates, err := model.completeEmoji(context.Background(), "blob")
+	assert.NoError(t, err)
+	assert.Equal(t, ":blobcat:", candidates[0].Value)
+}
+
+func TestReactionPicker(t *testing.T) {
+	catalog := emoji.NewCatalog(nil, nil, 0)
+	for _, name := range []string{"blobcat", "blobfox", "cat"} {
+		catalog.Add(misskey.Emoji{Name: name})
+	}
+
+	var p reactionPicker
+	p.Open([]string{"👍", ":cat:"}, catalog)
+	assert.Equal(t, []string{"👍", ":cat:"}, p.items)
+
+	// 入力した文字で絞り込み、前方一致を先に並べる
+	p.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("cat")})
+	assert.Equal(t, []string{":cat:", ":blobcat:"}, p.items)
+	p.Update(tea.KeyMsg{Type: tea.KeyDown})
+	assert.Equal(t, ":blobcat:", p.Update(tea.KeyMsg{Type: tea.KeyEnter}))
+	assert.False(t, p.open)
+
+	p.Open(nil, catalog)
+	assert.Equal(t, "", p.Update(tea.KeyMsg{Type: tea.KeyEsc}))
+	assert.False(t, p.open)
+}
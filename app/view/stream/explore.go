@@ -0,0 +1,215 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/search"
+)
+
+type (
+	// exploreView は :find と :tag で開くインスタンスの検索結果と、:trends で開くハッシュタグの一覧です
+	exploreView struct {
+		open    bool
+		title   string
+		account *Account
+		pager   *search.Pager // ノートの検索(nilならハッシュタグの一覧)
+		notes   []*timelineNote
+		trends  []misskey.HashtagTrend
+		cursor  int
+		loading bool
+		done    bool // 最後のページまで取得した
+		seq     int  // 古い検索の結果を捨てるための番号
+	}
+
+	// exploreNotesMsg は検索結果の1ページです
+	exploreNotesMsg struct {
+		seq   int
+		notes []misskey.NoteBody
+		done  bool
+		err   error
+	}
+
+	// exploreTrendsMsg はトレンドのハッシュタグの一覧です
+	exploreTrendsMsg struct {
+		seq    int
+		trends []misskey.HashtagTrend
+		err    error
+	}
+)
+
+const explorePage = 20 // 1回に取得する検索結果の数
+
+// openFind は主アカウントのインスタンスでノートを検索します
+// "@" で始まる語は投稿者の指定として扱います
+func (m *Model) openFind(args []string) tea.Cmd {
+	q := search.Query{Limit: explorePage}
+	terms := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "@") && q.User == "" {
+			q.User = arg
+			continue
+		}
+		terms = append(terms, arg)
+	}
+	q.Text = strings.Join(terms, " ")
+	return m.openExploreNotes("検索: "+strings.Join(args, " "), q)
+}
+
+// openTag はハッシュタグのノートを表示します
+func (m *Model) openTag(args []string) tea.Cmd {
+	if len(args) == 0 {
+		return m.showToast("ハッシュタグを指定してください")
+	}
+	tag := strings.TrimPrefix(args[0], "#")
+	return m.openExploreNotes("#"+tag, search.Query{Tag: tag, Limit: explorePage})
+}
+
+// openExploreNotes は検索結果の一覧を開き、最初のページを取得します
+func (m *Model) openExploreNotes(title string, q search.Query) tea.Cmd {
+	pager, err := search.NewPager(m.account.APIClient, q)
+	if err != nil {
+		return m.showToast(err.Error())
+	}
+	m.explore = exploreView{open: true, title: title, account: m.account, pager: pager, seq: m.explore.seq + 1}
+	m.refreshViewBuffer()
+	return m.loadExplore()
+}
+
+// openTrends はトレンドのハッシュタグの一覧を開きます
+func (m *Model) openTrends() tea.Cmd {
+	m.explore = exploreView{open: true, title: "トレンド", account: m.account, loading: true, seq: m.explore.seq + 1}
+	m.refreshViewBuffer()
+	client, seq := m.account.APIClient, m.explore.seq
+	return m.request("トレンドを取得中", func(ctx context.Context) tea.Msg {
+		trends, err := client.TrendHashtags(ctx)
+		return exploreTrendsMsg{seq: seq, trends: trends, err: err}
+	})
+}
+
+// loadExplore は検索結果の次のページを取得するコマンドを返します
+func (m *Model) loadExplore() tea.Cmd {
+	v := &m.explore
+	if v.pager == nil || v.loading || v.done {
+		return nil
+	}
+	v.loading = true
+	pager, seq := v.pager, v.seq
+	return m.request("検索中", func(ctx context.Context) tea.Msg {
+		notes, err := pager.Next(ctx)
+		return exploreNotesMsg{seq: seq, notes: notes, done: pager.Done(), err: err}
+	})
+}
+
+// updateExploreNotes は取得した検索結果を一覧に加えます
+func (m *Model) updateExploreNotes(msg exploreNotesMsg) tea.Cmd {
+	v := &m.explore
+	if msg.seq != v.seq {
+		return nil
+	}
+	v.loading, v.done = false, msg.done
+	if msg.err != nil {
+		m.logger.Log("stream", fmt.Sprintf("search error: %v", msg.err))
+		if errors.Is(msg.err, context.Canceled) {
+			return nil
+		}
+		return m.showToast(fmt.Sprintf("検索できませんでした: %v", msg.err))
+	}
+	for _, body := range msg.notes {
+		note := &misskey.Note{Type: "note", Body: misskey.NoteContainer{Type: "note", Body: body}}
+		v.notes = append(v.notes, &timelineNote{
+			note:      note,
+			uri:       noteURI(v.account.Instance.BaseUrl, note),
+			receivers: []receiver{{key: v.account.Key, noteId: targetNoteId(note)}},
+		})
+	}
+	m.refreshViewBuffer()
+	return nil
+}
+
+// updateExploreTrends はトレンドのハッシュタグの一覧を表示します
+func (m *Model) updateExploreTrends(msg exploreTrendsMsg) tea.Cmd {
+	v := &m.explore
+	if msg.seq != v.seq {
+		return nil
+	}
+	v.loading = false
+	if msg.err != nil {
+		m.logger.Log("stream", fmt.Sprintf("trend error: %v", msg.err))
+		return m.showToast(fmt.Sprintf("トレンドを取得できませんでした: %v", msg.err))
+	}
+	v.trends = msg.trends
+	m.refreshViewBuffer()
+	return nil
+}
+
+// updateExplore は検索結果の一覧を開いている間のキー操作を処理します
+// 最後のノートより下に移動すると、次のページを取得します
+func (m *Model) updateExplore(msg tea.KeyMsg) tea.Cmd {
+	v := &m.explore
+	size := len(v.notes)
+	if v.pager == nil {
+		size = len(v.trends)
+	}
+	var cmd tea.Cmd
+	switch {
+	case key.Matches(msg, m.keyMap.Cancel, m.keyMap.Quit):
+		v.open = false
+	case key.Matches(msg, m.keyMap.SelectPrev) || msg.String() == "up":
+		v.cursor = max(v.cursor-1, 0)
+	case key.Matches(msg, m.keyMap.SelectNext) || msg.String() == "down":
+		if v.cursor+1 < size {
+			v.cursor++
+		} else {
+			cmd = m.loadExplore()
+		}
+	case msg.String() == "enter" && v.pager == nil && v.cursor < size:
+		return m.openTag([]string{v.trends[v.cursor].Tag})
+	}
+	m.refreshViewBuffer()
+	return cmd
+}
+
+// renderExplore は検索結果を選択中のノートから、タイムラインと同じ形で表示します
+func (m *Model) renderExplore() string {
+	v := m.explore
+	var b strings.Builder
+	if v.pager == nil {
+		b.WriteString(fmt.Sprintf("%s [↑/↓] 移動 [enter] ハッシュタグのノート [%s] 閉じる\n\n", v.title, m.keyMap.Cancel.Help().Key))
+		if len(v.trends) == 0 && !v.loading {
+			b.WriteString("  なし\n")
+		}
+		for i, t := range v.trends {
+			cursor := "  "
+			if i == v.cursor {
+				cursor = "> "
+			}
+			b.WriteString(fmt.Sprintf("%s%s (%d人)\n", cursor, m.theme.Highlight("#%s", t.Tag), t.UsersCount))
+		}
+		return b.String()
+	}
+
+	more := ""
+	if !v.done {
+		more = "+"
+	}
+	b.WriteString(fmt.Sprintf("%s (%d%s件) [↑/↓] 移動 [%s] 閉じる\n\n", v.title, len(v.notes), more, m.keyMap.Cancel.Help().Key))
+	if len(v.notes) == 0 && !v.loading {
+		b.WriteString("  見つかりませんでした\n")
+	}
+	// 選択中のノートが画面に収まるよう、少し前のノートから表示する
+	for i := max(v.cursor-2, 0); i < len(v.notes); i++ {
+		entry := v.notes[i]
+		text := formatNote(entry.note, m.theme, m.rendererFor(v.account), m.previewFor(entry, m.width, true), nil)
+		if i == v.cursor {
+			text = selectedStyle.Render(text)
+		}
+		b.WriteString(text + "\n")
+	}
+	return b.String()
+}
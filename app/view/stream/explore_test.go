@@ -0,0 +1,96 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+// exploreMockClient は検索のたびに limit 件、全部で total 件のノートを返すクライアントです
+type exploreMockClient struct {
+	api.Client
+	total    int
+	searches []misskey.SearchNotes
+	tags     []misskey.SearchNotesByTag
+}
+
+func (c *exploreMockClient) page(untilId string, limit int) []misskey.NoteBody {
+	start := 0
+	if untilId != "" {
+		fmt.Sscanf(untilId, "found-%d", &start)
+	}
+	notes := make([]misskey.NoteBody, 0)
+	for i := start + 1; i <= c.total && len(notes) < limit; i++ {
+		notes = append(notes, misskey.NoteBody{ID: fmt.Sprintf("found-%d", i), Text: fmt.Sprintf("検索結果%d", i)})
+	}
+	return notes
+}
+
+func (c *exploreMockClient) SearchNotes(ctx context.Context, contents misskey.SearchNotes) ([]misskey.NoteBody, error) {
+	c.searches = append(c.searches, contents)
+	return c.page(contents.UntilId, contents.Limit), nil
+}
+
+func (c *exploreMockClient) SearchNotesByTag(ctx context.Context, contents misskey.SearchNotesByTag) ([]misskey.NoteBody, error) {
+	c.tags = append(c.tags, contents)
+	return c.page(contents.UntilId, contents.Limit), nil
+}
+
+func (c *exploreMockClient) TrendHashtags(ctx context.Context) ([]misskey.HashtagTrend, error) {
+	return []misskey.HashtagTrend{{Tag: "misskey", UsersCount: 10}, {Tag: "dev", UsersCount: 3}}, nil
+}
+
+func (c *exploreMockClient) ShowUser(ctx context.Context, contents misskey.ShowUser) (*misskey.User, error) {
+	return &misskey.User{Id: "id-" + contents.Username}, nil
+}
+
+func TestExplore(t *testing.T) {
+	account := newTestAccount("a")
+	client := &exploreMockClient{total: explorePage + 1}
+	account.APIClient = client
+	model := NewAccountModel(account, logger.New(false))
+	model.Init()
+
+	submit(model, ":find @alice 検索")
+	require.True(t, model.explore.open)
+	assert.Equal(t, misskey.SearchNotes{Query: "検索", UserId: "id-alice", Limit: explorePage}, client.searches[0])
+	require.Len(t, model.explore.notes, explorePage)
+	assert.False(t, model.explore.done)
+	assert.Contains(t, model.renderExplore(), "検索結果1")
+
+	// 最後のノートより下に移動すると次のページを取得する
+	for range explorePage - 1 {
+		model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	}
+	assert.Len(t, client.searches, 1)
+	_, cmd := model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	deliver(model, cmd)
+	assert.Equal(t, "found-20", client.searches[1].UntilId)
+	assert.Len(t, model.explore.notes, explorePage+1)
+	assert.True(t, model.explore.done)
+	_, cmd = model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	assert.Nil(t, cmd)
+	assert.Equal(t, explorePage, model.explore.cursor)
+	assert.Contains(t, model.renderExplore(), "検索結果21")
+
+	model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, model.explore.open)
+
+	// トレンドのハッシュタグを選ぶと、そのハッシュタグのノートを表示する
+	submit(model, ":trends")
+	require.Len(t, model.explore.trends, 2)
+	assert.Contains(t, model.renderExplore(), "#misskey")
+	model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	_, cmd = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	deliver(model, cmd)
+	assert.Equal(t, misskey.SearchNotesByTag{Tag: "dev", Limit: explorePage}, client.tags[0])
+	assert.Equal(t, "#dev", model.explore.title)
+	assert.Len(t, model.explore.notes, explorePage)
+}
@@ -0,0 +1,144 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/expr"
+	"github.com/wasya-io/petit-misskey/service/filter"
+)
+
+type (
+	// filteredNote は絞り込んだノートの記録です(:filtersで理由を表示する)
+	filteredNote struct {
+		at     time.Time
+		key    string
+		user   string
+		text   string
+		match  filter.Match
+		hidden bool
+	}
+
+	// filterView は :filters で開く、絞り込みの条件と最近絞り込んだノートの一覧です
+	filterView struct {
+		open bool
+	}
+)
+
+const (
+	maxFilteredLog  = 50 // 記録しておく絞り込んだノートの数
+	maxFilteredText = 30 // 一覧に表示する本文の文字数
+)
+
+// SetWhere はタイムラインに表示するノートを式で絞り込みます
+// 式に当てはまらないノートはミュートの設定にかかわらず表示しません
+func (m *Model) SetWhere(program *expr.Program) {
+	m.where = program
+}
+
+// filterFor はアカウントのミュート設定から作った絞り込みを返します
+func (m *Model) filterFor(account *Account) *filter.Engine {
+	if account.filter == nil {
+		engine, err := filter.New(account.Instance.Preferences.Mute)
+		if err != nil {
+			m.err = fmt.Errorf("ミュートの設定を一部使えません: %w", err)
+		}
+		account.filter = engine
+	}
+	return account.filter
+}
+
+// applyFilter はノートが絞り込みの条件に当てはまるかを確かめ、当てはまれば記録します
+// matchがnilでなければ折りたたんで表示し、hideがtrueなら表示しません
+func (m *Model) applyFilter(account *Account, note *misskey.Note) (match *filter.Match, hide bool) {
+	engine := m.filterFor(account)
+	found, ok := engine.Match(note)
+	if !ok {
+		return nil, false
+	}
+	hide = engine.Action() != setting.MuteActionCollapse
+	m.logger.Log("stream", fmt.Sprintf("filtered: %s (%s)", note.Body.Body.ID, found))
+
+	body := note.Body.Body
+	text := body.Text
+	if text == "" && body.RenoteID != "" {
+		text = body.Renote.Text
+	}
+	if r := []rune(strings.ReplaceAll(text, "\n", " ")); len(r) > maxFilteredText {
+		text = string(r[:maxFilteredText]) + "…"
+	}
+	m.filtered = append([]filteredNote{{
+		at:     time.Now(),
+		key:    account.Key,
+		user:   body.User.Username,
+		text:   text,
+		match:  found,
+		hidden: hide,
+	}}, m.filtered...)
+	if len(m.filtered) > maxFilteredLog {
+		m.filtered = m.filtered[:maxFilteredLog]
+	}
+	return &found, hide
+}
+
+// collapsed は折りたたんで表示するノートの1行を返します
+// 絞り込んでいないノートや、表示に切り替えたノートならfalseを返します
+func (m *Model) collapsed(entry *timelineNote) (string, bool) {
+	if entry.filtered == nil || m.revealed[entry.uri] {
+		return "", false
+	}
+	user := entry.note.Body.Body.User
+	return m.theme.Renoter("[フィルタ済み] @%s: %s [%s] 表示", user.Username, entry.filtered, m.keyMap.Reveal.Help().Key), true
+}
+
+// openFilters は絞り込みの条件と最近絞り込んだノートの一覧を開きます
+func (m *Model) openFilters() {
+	m.filters.open = true
+	m.refreshViewBuffer()
+}
+
+// renderFilters はアカウントごとの絞り込みの条件と、最近絞り込んだノートを理由とともに表示します
+func (m *Model) renderFilters() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("絞り込みの条件 [%s] 閉じる\n", m.keyMap.Cancel.Help().Key))
+	if m.where != nil {
+		b.WriteString("表示する条件 (--where)\n  - " + m.where.String() + "\n")
+	}
+	for _, account := range m.accounts {
+		engine := m.filterFor(account)
+		action := "非表示"
+		if engine.Action() == setting.MuteActionCollapse {
+			action = "折りたたみ"
+		}
+		b.WriteString(fmt.Sprintf("%s (%s)\n", m.theme.Account(account.Key), action))
+		rules := engine.Rules()
+		if len(rules) == 0 {
+			b.WriteString("  なし\n")
+		}
+		for _, rule := range rules {
+			b.WriteString("  - " + rule + "\n")
+		}
+	}
+
+	b.WriteString("\n最近絞り込んだノート\n")
+	if len(m.filtered) == 0 {
+		b.WriteString("  なし\n")
+	}
+	for _, f := range m.filtered {
+		action := "折りたたみ"
+		if f.hidden {
+			action = "非表示"
+		}
+		b.WriteString(fmt.Sprintf("  %s [%s] @%s %s: %s — %s\n",
+			f.at.Format("15:04"),
+			f.key,
+			m.theme.Username(f.user),
+			action,
+			f.match,
+			f.text))
+	}
+	return b.String()
+}
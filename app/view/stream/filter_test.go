@@ -0,0 +1,75 @@
+package stream
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/service/expr"
+)
+
+func TestFilterNotes(t *testing.T) {
+	account := newTestAccount("a")
+	account.Instance.Preferences.Mute = setting.Mute{Words: []string{"ノート1"}}
+	model := NewAccountModel(account, logger.New(false))
+	model.Init()
+
+	// 既定では表示しない
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(1)}})
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(2)}})
+	assert.Len(t, model.mainColumn().notes, 1)
+	assert.True(t, model.filtered[0].hidden)
+
+	// 折りたたむ設定では1行だけ表示し、表示に切り替えられる
+	account.Instance.Preferences.Mute.Action = setting.MuteActionCollapse
+	account.filter = nil
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(11)}})
+	entry := model.mainColumn().notes[0]
+	line, ok := model.collapsed(entry)
+	assert.True(t, ok)
+	assert.Equal(t, "[フィルタ済み] @user11: ミュートワード「ノート1」を含む [ctrl+o] 表示", line)
+
+	model.Update(tea.KeyMsg{Type: tea.KeyDown, Alt: true})
+	model.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+	_, ok = model.collapsed(entry)
+	assert.False(t, ok)
+}
+
+func TestFiltersCommand(t *testing.T) {
+	account := newTestAccount("a")
+	account.Instance.Preferences.Mute = setting.Mute{Words: []string{"ノート1"}, Bots: true}
+	model := NewAccountModel(account, logger.New(false))
+	model.Init()
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(1)}})
+
+	model.textarea.SetValue(":filters")
+	_, cmd := model.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+	deliver(model, cmd)
+	assert.True(t, model.filters.open)
+	assert.Equal(t, "", model.textarea.Value())
+
+	view := model.renderFilters()
+	assert.Contains(t, view, "- ミュートワード: ノート1")
+	assert.Contains(t, view, "- botのノート")
+	assert.True(t, strings.Contains(view, "非表示: ミュートワード「ノート1」を含む — これはテストノート1です"), view)
+
+	model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, model.filters.open)
+}
+
+func TestWhere(t *testing.T) {
+	account := newTestAccount("a")
+	model := NewAccountModel(account, logger.New(false))
+	model.Init()
+	model.SetWhere(expr.MustCompile(`text =~ "ノート2です$"`))
+
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(1)}})
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(2)}})
+	assert.Len(t, model.mainColumn().notes, 1)
+	assert.Equal(t, "user2", model.mainColumn().notes[0].note.Body.Body.User.Username)
+	assert.Contains(t, model.renderFilters(), "- text =~ \"ノート2です$\"")
+}
@@ -0,0 +1,50 @@
+package stream
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+)
+
+// EnableHooks はストリームのイベントで設定したコマンドを実行します
+// 失敗したフックは一時的な表示で知らせます
+func (m *Model) EnableHooks(d *hooks.Dispatcher) {
+	m.hooks = d
+	d.OnResult(func(h setting.Hook, ev hooks.Event, err error) {
+		if err == nil {
+			return
+		}
+		select {
+		case m.msgCh <- hookResultMsg{name: fmt.Sprintf("%s (%s)", h.Event, h.Command), err: err}:
+		case <-m.ctx.Done():
+		}
+	})
+}
+
+// hookDispatcher はフックを実行するDispatcherを返します
+// EnableHooksしていなければ、注目の条件のフックのために1つずつ実行するものを作ります
+func (m *Model) hookDispatcher() *hooks.Dispatcher {
+	if m.hooks == nil {
+		m.hooks, _ = hooks.New(nil, 1)
+	}
+	return m.hooks
+}
+
+// dispatchHooks はアカウントに届いたメッセージをフックとプラグインに渡します
+// ミュートや --where に関係なく、届いたすべてのイベントが対象です
+func (m *Model) dispatchHooks(account *Account, msg tea.Msg) {
+	if m.hooks == nil && m.plugins == nil {
+		return
+	}
+	for _, ev := range hooks.Events(account.Key, msg, time.Now()) {
+		if m.hooks != nil {
+			m.hooks.Dispatch(m.ctx, ev)
+		}
+		if m.plugins != nil {
+			m.plugins.Publish(ev)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+)
+
+func TestHooks(t *testing.T) {
+	account := newTestAccount("a")
+	account.Instance.Preferences.Mute = setting.Mute{Words: []string{"ノート1"}}
+	model := NewAccountModel(account, logger.New(false))
+
+	d, err := hooks.New([]setting.Hook{{Event: setting.HookEventNote, Command: "notify"}}, 1)
+	require.NoError(t, err)
+	var mu sync.Mutex
+	ids := make([]string, 0)
+	d.SetRunner(func(ctx context.Context, command string, env []string, stdin []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ids = append(ids, env[len(env)-3])
+		return errors.New("exit status 1")
+	})
+	model.EnableHooks(d)
+	model.Init()
+
+	// ミュートしたノートもフックには渡す
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(1)}})
+	d.Wait()
+	assert.Equal(t, []string{"PETIT_MISSKEY_NOTE_ID=note-id-1"}, ids)
+	assert.Empty(t, model.mainColumn().notes)
+
+	// 失敗はメッセージで届き、一時的に表示する
+	msg := <-model.msgCh
+	model.Update(msg)
+	assert.Contains(t, model.requestStatus(), "note (notify) のフックが失敗しました: exit status 1")
+}
@@ -0,0 +1,171 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+type (
+	// KeyMap はタイムライン画面のキー割り当てです
+	KeyMap struct {
+		Quit          key.Binding
+		HomeTimeline  key.Binding
+		LocalTimeline key.Binding
+		SwitchAccount key.Binding
+		SelectPrev    key.Binding
+		SelectNext    key.Binding
+		Reply         key.Binding
+		React         key.Binding
+		Reveal        key.Binding
+		Cancel        key.Binding
+
+		// デッキ表示のカラム操作
+		FocusPrev       key.Binding
+		FocusNext       key.Binding
+		MoveColumnLeft  key.Binding
+		MoveColumnRight key.Binding
+		Narrow          key.Binding
+		Widen           key.Binding
+	}
+)
+
+// 設定ファイルのkeybindingsで上書きできる操作名
+const (
+	ActionQuit            = "quit"
+	ActionHomeTimeline    = "home_timeline"
+	ActionLocalTimeline   = "local_timeline"
+	ActionSwitchAccount   = "switch_account"
+	ActionSelectPrev      = "select_prev"
+	ActionSelectNext      = "select_next"
+	ActionReply           = "reply"
+	ActionReact           = "react"
+	ActionReveal          = "reveal"
+	ActionCancel          = "cancel"
+	ActionFocusPrev       = "focus_prev"
+	ActionFocusNext       = "focus_next"
+	ActionMoveColumnLeft  = "move_column_left"
+	ActionMoveColumnRight = "move_column_right"
+	ActionNarrow          = "narrow_column"
+	ActionWiden           = "widen_column"
+	ActionSubmit          = "submit"  // 投稿欄の送信キー
+	ActionEditor          = "editor"  // 投稿欄を外部エディタで開くキー
+	ActionPreview         = "preview" // 投稿欄のプレビューを切り替えるキー
+)
+
+// NewKeyMap は既定のキー割り当てに設定ファイルの上書きを適用したKeyMapを生成します
+func NewKeyMap(overrides map[string][]string) KeyMap {
+	km := KeyMap{
+		Quit: key.NewBinding(
+			key.WithKeys("ctrl+c"),
+			key.WithHelp("ctrl+c", "終了"),
+		),
+		HomeTimeline: key.NewBinding(
+			key.WithKeys("ctrl+h"),
+			key.WithHelp("ctrl+h", "ホームTL"),
+		),
+		LocalTimeline: key.NewBinding(
+			key.WithKeys("ctrl+l"),
+			key.WithHelp("ctrl+l", "ローカルTL"),
+		),
+		SwitchAccount: key.NewBinding(
+			key.WithKeys("ctrl+a"),
+			key.WithHelp("ctrl+a", "アカウント切替"),
+		),
+		SelectPrev: key.NewBinding(
+			key.WithKeys("alt+up"),
+			key.WithHelp("alt+↑", "前のノート"),
+		),
+		SelectNext: key.NewBinding(
+			key.WithKeys("alt+down"),
+			key.WithHelp("alt+↓", "次のノート"),
+		),
+		Reply: key.NewBinding(
+			key.WithKeys("ctrl+r"),
+			key.WithHelp("ctrl+r", "返信"),
+		),
+		React: key.NewBinding(
+			key.WithKeys("ctrl+g"),
+			key.WithHelp("ctrl+g", "リアクション"),
+		),
+		Reveal: key.NewBinding(
+			key.WithKeys("ctrl+o"),
+			key.WithHelp("ctrl+o", "閲覧注意を表示"),
+		),
+		Cancel: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "キャンセル"),
+		),
+		FocusPrev: key.NewBinding(
+			key.WithKeys("ctrl+left"),
+			key.WithHelp("ctrl+←", "左のカラム"),
+		),
+		FocusNext: key.NewBinding(
+			key.WithKeys("ctrl+right"),
+			key.WithHelp("ctrl+→", "右のカラム"),
+		),
+		MoveColumnLeft: key.NewBinding(
+			key.WithKeys("ctrl+shift+left"),
+			key.WithHelp("ctrl+shift+←", "カラムを左へ"),
+		),
+		MoveColumnRight: key.NewBinding(
+			key.WithKeys("ctrl+shift+right"),
+			key.WithHelp("ctrl+shift+→", "カラムを右へ"),
+		),
+		Narrow: key.NewBinding(
+			key.WithKeys("shift+left"),
+			key.WithHelp("shift+←", "幅を狭く"),
+		),
+		Widen: key.NewBinding(
+			key.WithKeys("shift+right"),
+			key.WithHelp("shift+→", "幅を広く"),
+		),
+	}
+
+	overrideBinding(&km.Quit, overrides[ActionQuit])
+	overrideBinding(&km.HomeTimeline, overrides[ActionHomeTimeline])
+	overrideBinding(&km.LocalTimeline, overrides[ActionLocalTimeline])
+	overrideBinding(&km.SwitchAccount, overrides[ActionSwitchAccount])
+	overrideBinding(&km.SelectPrev, overrides[ActionSelectPrev])
+	overrideBinding(&km.SelectNext, overrides[ActionSelectNext])
+	overrideBinding(&km.Reply, overrides[ActionReply])
+	overrideBinding(&km.React, overrides[ActionReact])
+	overrideBinding(&km.Reveal, overrides[ActionReveal])
+	overrideBinding(&km.Cancel, overrides[ActionCancel])
+	overrideBinding(&km.FocusPrev, overrides[ActionFocusPrev])
+	overrideBinding(&km.FocusNext, overrides[ActionFocusNext])
+	overrideBinding(&km.MoveColumnLeft, overrides[ActionMoveColumnLeft])
+	overrideBinding(&km.MoveColumnRight, overrides[ActionMoveColumnRight])
+	overrideBinding(&km.Narrow, overrides[ActionNarrow])
+	overrideBinding(&km.Widen, overrides[ActionWiden])
+
+	return km
+}
+
+// HelpLine はステータス欄に表示するキー操作の説明を返します
+// switchableがfalseならアカウント切り替えの説明を、deckがfalseならカラム操作の説明を省きます
+func (k KeyMap) HelpLine(switchable bool, deck bool) string {
+	bindings := []key.Binding{k.HomeTimeline, k.LocalTimeline, k.SelectPrev, k.SelectNext, k.Reply, k.React, k.Reveal}
+	if deck {
+		bindings = append(bindings, k.FocusPrev, k.FocusNext, k.MoveColumnLeft, k.MoveColumnRight, k.Narrow, k.Widen)
+	}
+	if switchable {
+		bindings = append(bindings, k.SwitchAccount)
+	}
+	bindings = append(bindings, k.Quit)
+	helps := make([]string, 0, len(bindings))
+	for _, b := range bindings {
+		helps = append(helps, fmt.Sprintf("[%s] %s", b.Help().Key, b.Help().Desc))
+	}
+	return strings.Join(helps, " ")
+}
+
+// overrideBinding はキーの指定があればbindingのキーとヘルプ表示を置き換えます
+func overrideBinding(b *key.Binding, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	b.SetKeys(keys...)
+	b.SetHelp(strings.Join(keys, "/"), b.Help().Desc)
+}
@@ -0,0 +1,253 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/wasya-io/petit-misskey/infrastructure/media"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/view"
+	"github.com/wasya-io/petit-misskey/view/graphics"
+)
+
+type (
+	// imageCache は取得した画像を表示用の文字列にして覚えておきます
+	// 画像は別goroutineで読み込み、読み込み終えたらnotifyで再描画を依頼します
+	//
+	// kitty / iTerm2 / Sixel に対応した端末では、画面の中には画像の場所の目印だけを置き、
+	// 描画したあとにoverlayで画像を重ねて描きます。それ以外の端末では半角ブロックで描きます
+	imageCache struct {
+		fetcher *media.Fetcher
+		profile termenv.Profile
+		overlay *graphics.Overlay // nilなら半角ブロックで描く
+		notify  func()
+
+		mu      sync.Mutex
+		images  map[string]string // URLと大きさごとの表示用の文字列(失敗した場合は空文字列)
+		pending map[string]bool   // 読み込み中のキー
+	}
+
+	// filePreview は添付ファイルの表示方法です
+	filePreview struct {
+		mode      setting.MediaPreview
+		revealed  bool        // 閲覧注意のファイルも表示する
+		images    *imageCache // nilなら画像は表示しない
+		profile   termenv.Profile
+		width     int // プレビューに使える幅(0なら既定の幅)
+		theme     Theme
+		revealKey string
+	}
+)
+
+const (
+	imageFetchTimeout = 10 * time.Second
+	previewCols       = 24 // プレビューの幅(文字数)
+	previewMaxRows    = 8
+	maxPreviewFiles   = 4 // 1つのノートで表示する添付ファイルの数
+)
+
+func newImageCache(fetcher *media.Fetcher, profile termenv.Profile, overlay *graphics.Overlay, notify func()) *imageCache {
+	return &imageCache{
+		fetcher: fetcher,
+		profile: profile,
+		overlay: overlay,
+		notify:  notify,
+		images:  make(map[string]string),
+		pending: make(map[string]bool),
+	}
+}
+
+// get はurlの画像を cols x rows セルで表示する文字列を返します
+// fillは画像を重ねて描くときに場所を空けておく文字です
+// まだ読み込んでいない場合は読み込みを始めてfalseを返します
+func (c *imageCache) get(url string, cols int, rows int, fill string) (string, bool) {
+	key := fmt.Sprintf("%s#%dx%d:%q", url, cols, rows, fill)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.images[key]; ok {
+		return s, s != ""
+	}
+	if !c.pending[key] {
+		c.pending[key] = true
+		go c.fetch(key, url, cols, rows, fill)
+	}
+	return "", false
+}
+
+// fetch は画像を読み込んで表示用の文字列にします
+// 読み込めなかった画像は空文字列として覚え、以降は画像なしで表示します
+func (c *imageCache) fetch(key string, url string, cols int, rows int, fill string) {
+	ctx, cancel := context.WithTimeout(context.Background(), imageFetchTimeout)
+	defer cancel()
+
+	s := ""
+	if data, err := c.fetcher.Fetch(ctx, url); err == nil {
+		var encoded string
+		if c.overlay != nil {
+			encoded, err = c.overlay.Add(data, cols, rows, fill)
+		} else {
+			encoded, err = graphics.DecodeHalfBlock(data, cols, rows, c.profile)
+		}
+		if err == nil {
+			s = encoded
+		}
+	}
+
+	c.mu.Lock()
+	c.images[key] = s
+	delete(c.pending, key)
+	c.mu.Unlock()
+	if s != "" && c.notify != nil {
+		c.notify()
+	}
+}
+
+// newOverlay は端末が画像の表示に対応していれば、画像を重ねて描くOverlayを返します
+// 対応しているかは環境変数で判断し、PETIT_MISSKEY_GRAPHICS で上書きできます
+func newOverlay() *graphics.Overlay {
+	p := graphics.Detect()
+	if p == graphics.ProtocolNone {
+		return nil
+	}
+	return graphics.NewOverlay(p, view.Terminal)
+}
+
+// imagesFor はアカウントの画像の読み込みに使うimageCacheを返します
+// 画像も色も使えない端末やFetcherがない場合はnilを返します
+func (m *Model) imagesFor(account *Account) *imageCache {
+	profile := lipgloss.ColorProfile()
+	if account == nil || account.Media == nil || (m.graphics == nil && profile == termenv.Ascii) {
+		return nil
+	}
+	if account.images == nil {
+		account.images = newImageCache(account.Media, profile, m.graphics, func() {
+			select {
+			case m.msgCh <- imageLoadedMsg{}:
+			default:
+			}
+		})
+	}
+	return account.images
+}
+
+// previewFor はノートの添付ファイルの表示方法を返します
+// inlineがfalseなら(デッキのカラム内など)画像は使わずblurhashで表示します
+func (m *Model) previewFor(entry *timelineNote, width int, inline bool) filePreview {
+	account := entry.account(m)
+	p := filePreview{
+		mode:      setting.MediaPreviewAuto,
+		revealed:  m.revealed[entry.uri],
+		profile:   lipgloss.ColorProfile(),
+		width:     width,
+		theme:     m.theme,
+		revealKey: m.keyMap.Reveal.Help().Key,
+	}
+	if account != nil {
+		prefs := account.Instance.Preferences.Media
+		p.mode = prefs.PreviewMode()
+		p.revealed = p.revealed || prefs.Sensitive
+		if inline {
+			p.images = m.imagesFor(account)
+		}
+	}
+	if !m.theme.Preview {
+		p.mode = setting.MediaPreviewNone
+	}
+	return p
+}
+
+// toggleReveal は選択中のノートの閲覧注意のファイルの表示を切り替えます
+func (m *Model) toggleReveal() {
+	entry := m.focusedColumn().selectedNote()
+	if entry == nil {
+		return
+	}
+	if m.revealed[entry.uri] {
+		delete(m.revealed, entry.uri)
+	} else {
+		m.revealed[entry.uri] = true
+	}
+}
+
+// render は添付ファイルを1つずつ、ファイル名とプレビューで表示します
+func (p filePreview) render(files []misskey.NoteFile) string {
+	if len(files) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, min(len(files), maxPreviewFiles)+1)
+	for i, f := range files {
+		if i == maxPreviewFiles {
+			parts = append(parts, fmt.Sprintf("ほか%d件のファイル", len(files)-maxPreviewFiles))
+			break
+		}
+		parts = append(parts, p.renderFile(f))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (p filePreview) renderFile(f misskey.NoteFile) string {
+	hidden := f.IsSensitive && !p.revealed
+	label := "📎 " + f.Name
+	if f.IsSensitive {
+		label += " " + p.theme.Alert("閲覧注意")
+		if hidden {
+			label += fmt.Sprintf(" [%s] 表示", p.revealKey)
+		}
+	}
+
+	preview := ""
+	if p.mode != setting.MediaPreviewNone && hasThumbnail(f) {
+		cols, rows := p.previewSize(f)
+		// 閲覧注意のファイルは表示するまでblurhashのぼかしだけにする
+		if !hidden && p.mode == setting.MediaPreviewAuto && p.images != nil && f.ThumbnailURL != "" {
+			preview, _ = p.images.get(f.ThumbnailURL, cols, rows, " ")
+		}
+		if preview == "" && f.Blurhash != "" {
+			preview, _ = graphics.BlurhashBlock(f.Blurhash, cols, rows, p.profile)
+		}
+	}
+	if preview == "" {
+		return label
+	}
+	return label + "\n" + preview
+}
+
+// previewSize は画像の縦横比からプレビューの大きさ(セル数)を決めます
+// 1セルの縦横比はおよそ2:1とします
+func (p filePreview) previewSize(f misskey.NoteFile) (int, int) {
+	cols := previewCols
+	if p.width > 0 {
+		cols = min(cols, p.width)
+	}
+	w, h := f.Properties.Width, f.Properties.Height
+	if w <= 0 || h <= 0 {
+		return cols, max(cols/4, 1)
+	}
+	rows := int(math.Round(float64(cols) * float64(h) / float64(w) / 2))
+	return cols, min(max(rows, 1), previewMaxRows)
+}
+
+// hasThumbnail はプレビューを表示できる種類のファイルかを返します
+func hasThumbnail(f misskey.NoteFile) bool {
+	return strings.HasPrefix(f.Type, "image/") || strings.HasPrefix(f.Type, "video/")
+}
+
+// avatar はアバターのblurhashを、名前の前に置く小さな色の塊にします
+func avatar(user misskey.NoteUser, p filePreview) string {
+	if p.mode == setting.MediaPreviewNone || user.AvatarBlurhash == "" {
+		return ""
+	}
+	s, err := graphics.BlurhashBlock(user.AvatarBlurhash, 2, 1, p.profile)
+	if err != nil || s == "" {
+		return ""
+	}
+	return s + " "
+}
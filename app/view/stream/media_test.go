@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/termenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+const testBlurhash = "LEHV6nWB2yk8pyo0adR*.7kCMdnj"
+
+func TestFilePreview(t *testing.T) {
+	file := misskey.NoteFile{
+		Name:        "cat.png",
+		Type:        "image/png",
+		Blurhash:    testBlurhash,
+		IsSensitive: true,
+		Properties:  misskey.FileProperties{Width: 400, Height: 200},
+	}
+	p := filePreview{
+		mode:      setting.MediaPreviewAuto,
+		profile:   termenv.TrueColor,
+		theme:     themeByName("mono"),
+		revealKey: "ctrl+o",
+	}
+
+	// 閲覧注意のファイルは表示するまでぼかしだけにする
+	lines := strings.Split(p.render([]misskey.NoteFile{file}), "\n")
+	assert.Equal(t, "📎 cat.png 閲覧注意 [ctrl+o] 表示", lines[0])
+	assert.Len(t, lines, 1+6) // 24文字幅で縦横比2:1なら6行
+	assert.Equal(t, previewCols, strings.Count(lines[1], "▀"))
+
+	p.revealed = true
+	assert.Equal(t, "📎 cat.png 閲覧注意", strings.Split(p.render([]misskey.NoteFile{file}), "\n")[0])
+
+	// 画像以外やプレビューなしの設定では名前だけ
+	p.mode = setting.MediaPreviewNone
+	assert.Equal(t, "📎 cat.png 閲覧注意", p.render([]misskey.NoteFile{file}))
+	p.mode = setting.MediaPreviewBlurhash
+	assert.Equal(t, "📎 a.zip", p.render([]misskey.NoteFile{{Name: "a.zip", Type: "application/zip"}}))
+
+	files := make([]misskey.NoteFile, 6)
+	assert.True(t, strings.HasSuffix(p.render(files), "ほか2件のファイル"))
+}
+
+func TestRevealSensitive(t *testing.T) {
+	account := newTestAccount("a")
+	model := NewAccountModel(account, logger.New(false))
+	model.Init()
+
+	note := createTestNote(1)
+	note.Body.Body.Files = []misskey.NoteFile{{Name: "a.png", Type: "image/png", IsSensitive: true}}
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: note}})
+	model.Update(tea.KeyMsg{Type: tea.KeyDown, Alt: true})
+	uri := model.mainColumn().selected
+
+	model.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+	assert.True(t, model.revealed[uri])
+	assert.True(t, model.previewFor(model.mainColumn().notes[0], 80, true).revealed)
+
+	model.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+	assert.False(t, model.revealed[uri])
+}
@@ -0,0 +1,250 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/outbox"
+)
+
+type (
+	// postResultMsg は投稿欄からの投稿の結果です
+	postResultMsg struct {
+		key     string // 投稿したアカウント
+		text    string // 投稿欄に入力されていた本文
+		note    misskey.CreateNote
+		replyTo *timelineNote
+		created *misskey.CreateNoteResponse
+		err     error
+		offline bool // 未接続だったため送らずに送信待ちにする
+	}
+
+	// draftSaveMsg は入力が落ち着いたら下書きを保存するためのメッセージです
+	draftSaveMsg struct {
+		seq int
+	}
+
+	// outboxTickMsg は送信待ちの投稿を送り直すタイミングです
+	outboxTickMsg struct{}
+
+	// outboxResultMsg は送信待ちの投稿を送り直した結果です
+	outboxResultMsg struct {
+		results []outboxResult
+	}
+
+	outboxResult struct {
+		id  string
+		err error
+	}
+)
+
+const (
+	draftDelay     = time.Second      // 最後の入力から下書きを保存するまでの時間
+	outboxInterval = 30 * time.Second // 送信待ちの投稿を確認する間隔
+)
+
+// errSkipped は前の投稿を送れなかったため送らなかったことを表します
+var errSkipped = errors.New("skipped")
+
+// EnableOutbox は下書きの保存と送信待ちの投稿の送り直しを有効にします
+// 主アカウントの下書きがあれば投稿欄に戻します
+func (m *Model) EnableOutbox(drafts *outbox.Drafts, box *outbox.Outbox) {
+	m.drafts = drafts
+	m.outbox = box
+	m.sending = make(map[string]bool)
+	m.restoreDraft()
+}
+
+// updateTextarea はメッセージを投稿欄で処理し、本文が変わったら下書きの保存を予約します
+func (m *Model) updateTextarea(msg tea.Msg) tea.Cmd {
+	before := m.textarea.Value()
+	t, cmd := m.textarea.Update(msg)
+	m.textarea = t
+	if m.drafts == nil || m.textarea.Value() == before {
+		return cmd
+	}
+	m.draftSeq++
+	seq := m.draftSeq
+	return tea.Batch(cmd, tea.Tick(draftDelay, func(time.Time) tea.Msg {
+		return draftSaveMsg{seq: seq}
+	}))
+}
+
+// saveDraft は投稿欄の本文を主アカウントの下書きとして保存します
+func (m *Model) saveDraft() {
+	if m.drafts == nil {
+		return
+	}
+	if err := m.drafts.Save(m.account.Key, m.textarea.Value()); err != nil {
+		m.logger.Log("stream", fmt.Sprintf("draft error: %v", err))
+	}
+}
+
+// restoreDraft は主アカウントの下書きを投稿欄に戻します
+func (m *Model) restoreDraft() {
+	if m.drafts == nil {
+		return
+	}
+	m.textarea.Restore(m.drafts.Get(m.account.Key))
+}
+
+// sendNote は投稿するコマンドを返します
+// 送信待ちが有効で未接続の場合は、送らずに送信待ちにします
+func (m *Model) sendNote(account *Account, text string, note misskey.CreateNote, replyTo *timelineNote) tea.Cmd {
+	result := postResultMsg{key: account.Key, text: text, note: note, replyTo: replyTo}
+	if m.outbox != nil && !account.connected {
+		result.offline = true
+		return func() tea.Msg { return result }
+	}
+	client := account.APIClient
+	return m.request("投稿中", func(ctx context.Context) tea.Msg {
+		result.created, result.err = client.CreateNote(ctx, note)
+		return result
+	})
+}
+
+// updatePostResult は投稿の結果を反映します
+// 投稿できたか送信待ちにした場合は投稿欄と下書きを消し、失敗した場合は本文を残してエラーを表示します
+func (m *Model) updatePostResult(msg postResultMsg) tea.Cmd {
+	var toast string
+	switch {
+	case msg.err == nil && !msg.offline:
+		m.logger.Log("stream", fmt.Sprintf("note: %s", msg.created.CreatedNote.ID))
+		toast = fmt.Sprintf("投稿しました: %s", msg.created.CreatedNote.ID)
+	case m.outbox != nil && (msg.offline || outbox.IsUnsent(msg.err)):
+		if msg.err != nil {
+			m.logger.Log("stream", fmt.Sprintf("note error (queued): %v", msg.err))
+		}
+		if _, err := m.outbox.Add(msg.key, msg.note, time.Now()); err != nil {
+			m.err = fmt.Errorf("送信待ちに追加できません: %w", err)
+			m.refreshStatusView()
+			return nil
+		}
+		toast = "送信できなかったため送信待ちにしました"
+	default:
+		m.logger.Log("stream", fmt.Sprintf("note error: %v", msg.err))
+		m.err = fmt.Errorf("投稿できませんでした: %w", msg.err)
+		if outbox.IsTransient(msg.err) {
+			// 送信後のタイムアウトなどは投稿できていることがあるので、自動では送り直さない
+			m.err = fmt.Errorf("投稿できたか分かりません。タイムラインを確認してから送り直してください: %w", msg.err)
+		}
+		if m.replyTo == nil {
+			m.replyTo = msg.replyTo
+		}
+		m.refreshStatusView()
+		return nil
+	}
+
+	// 結果を待つ間に書き換えた本文は消さない
+	if m.textarea.Value() == msg.text {
+		m.textarea.Clear()
+		m.saveDraft()
+	}
+	return m.showToast(toast)
+}
+
+// outboxTick は次に送信待ちの投稿を確認するコマンドを返します
+func outboxTick() tea.Cmd {
+	return tea.Tick(outboxInterval, func(time.Time) tea.Msg {
+		return outboxTickMsg{}
+	})
+}
+
+// flushOutbox は接続中のアカウントの送信待ちの投稿を送り直すコマンドを返します
+// 順番が入れ替わらないよう、アカウントごとに古いものから1件ずつ送ります
+func (m *Model) flushOutbox() tea.Cmd {
+	if m.outbox == nil {
+		return nil
+	}
+	cmds := make([]tea.Cmd, 0, len(m.accounts))
+	now := time.Now()
+	for _, account := range m.accounts {
+		if !account.connected || account.APIClient == nil {
+			continue
+		}
+		items := make([]outbox.Item, 0)
+		for _, item := range m.outbox.Due(account.Key, now) {
+			if !m.sending[item.ID] {
+				m.sending[item.ID] = true
+				items = append(items, item)
+			}
+		}
+		if len(items) > 0 {
+			cmds = append(cmds, m.resend(account.APIClient, items))
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+// resend はitemsを順に送り直すコマンドを返します
+// 通信やサーバーのエラーで失敗したら、残りは次の機会に送ります
+func (m *Model) resend(client api.Client, items []outbox.Item) tea.Cmd {
+	return m.request("送信待ちの投稿を送信中", func(ctx context.Context) tea.Msg {
+		results := make([]outboxResult, 0, len(items))
+		for i, item := range items {
+			_, err := client.CreateNote(ctx, item.Note)
+			results = append(results, outboxResult{id: item.ID, err: err})
+			if outbox.IsTransient(err) {
+				for _, rest := range items[i+1:] {
+					results = append(results, outboxResult{id: rest.ID, err: errSkipped})
+				}
+				break
+			}
+		}
+		return outboxResultMsg{results: results}
+	})
+}
+
+// updateOutboxResult は送り直した結果を送信待ちの一覧に反映します
+func (m *Model) updateOutboxResult(msg outboxResultMsg) tea.Cmd {
+	sent := 0
+	for _, result := range msg.results {
+		delete(m.sending, result.id)
+		var err error
+		switch result.err {
+		case nil:
+			m.logger.Log("stream", fmt.Sprintf("outbox sent: %s", result.id))
+			err = m.outbox.Done(result.id)
+			sent++
+		case errSkipped:
+		default:
+			m.logger.Log("stream", fmt.Sprintf("outbox error: %s: %v", result.id, result.err))
+			err = m.outbox.Retry(result.id, result.err, time.Now())
+		}
+		if err != nil {
+			m.logger.Log("stream", fmt.Sprintf("outbox error: %v", err))
+		}
+	}
+	m.refreshStatusView()
+	if sent == 0 {
+		return nil
+	}
+	return m.showToast(fmt.Sprintf("送信待ちの投稿を%d件送信しました", sent))
+}
+
+// outboxStatus はステータス欄に表示する送信待ちの件数です
+func (m *Model) outboxStatus() string {
+	if m.outbox == nil {
+		return ""
+	}
+	status := m.outbox.Status()
+	if status.Pending == 0 && status.Failed == 0 && status.Uncertain == 0 {
+		return ""
+	}
+	text := fmt.Sprintf("送信待ち: %d件", status.Pending)
+	if status.Failed > 0 {
+		text += " " + m.theme.Alert(fmt.Sprintf("送信失敗: %d件", status.Failed))
+	}
+	if status.Uncertain > 0 {
+		text += " " + m.theme.Alert(fmt.Sprintf("送信不明: %d件", status.Uncertain))
+	}
+	if status.LastError != "" {
+		text += fmt.Sprintf(" (%s)", status.LastError)
+	}
+	return text + "\n"
+}
@@ -0,0 +1,166 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/cache"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/outbox"
+)
+
+// postMockClient は投稿の結果を順に返すクライアントです
+type postMockClient struct {
+	api.Client
+	errs  []error
+	notes []misskey.CreateNote
+}
+
+func (c *postMockClient) CreateNote(ctx context.Context, contents misskey.CreateNote) (*misskey.CreateNoteResponse, error) {
+	c.notes = append(c.notes, contents)
+	var err error
+	if len(c.errs) > 0 {
+		err, c.errs = c.errs[0], c.errs[1:]
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &misskey.CreateNoteResponse{CreatedNote: misskey.NoteBody{ID: fmt.Sprintf("note%d", len(c.notes))}}, nil
+}
+
+func newOutboxModel(t *testing.T, client *postMockClient) (*Model, *outbox.Drafts, *outbox.Outbox) {
+	dir := t.TempDir()
+	drafts, err := outbox.NewDrafts(cache.NewFileAt(filepath.Join(dir, "drafts.json")))
+	assert.NoError(t, err)
+	box, err := outbox.New(cache.NewFileAt(filepath.Join(dir, "outbox.json")))
+	assert.NoError(t, err)
+
+	account := newTestAccount("a")
+	account.APIClient = client
+	model := NewAccountModel(account, logger.New(false))
+	model.EnableOutbox(drafts, box)
+	model.Init()
+	return model, drafts, box
+}
+
+// deliver はcmdを実行し、返ってきたメッセージをモデルに渡します
+func deliver(model *Model, cmd tea.Cmd) {
+	if cmd == nil {
+		return
+	}
+	switch msg := cmd().(type) {
+	case tea.BatchMsg:
+		for _, c := range msg {
+			deliver(model, c)
+		}
+	default:
+		model.Update(msg)
+	}
+}
+
+// submit は投稿欄にtextを入力して送信し、投稿の結果をモデルに渡します
+func submit(model *Model, text string) {
+	model.textarea.SetValue(text)
+	_, cmd := model.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+	deliver(model, cmd)
+}
+
+func TestPostFailureKeepsText(t *testing.T) {
+	client := &postMockClient{errs: []error{&api.StatusError{StatusCode: 400}}}
+	model, _, box := newOutboxModel(t, client)
+	model.Update(accountMsg{key: "a", gen: model.account.gen, msg: websocket.WebSocketConnectedMsg{}})
+
+	submit(model, "hello")
+	assert.Equal(t, "hello", model.textarea.Value())
+	assert.ErrorContains(t, model.err, "投稿できませんでした")
+	assert.Empty(t, box.Items())
+
+	submit(model, "hello")
+	assert.Equal(t, "", model.textarea.Value())
+	assert.Len(t, client.notes, 2)
+}
+
+func TestOutbox(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	client := &postMockClient{errs: []error{refused}}
+	model, _, box := newOutboxModel(t, client)
+
+	// 未接続のときは送らずに送信待ちにする
+	submit(model, "offline")
+	assert.Equal(t, "", model.textarea.Value())
+	assert.Empty(t, client.notes)
+	assert.Len(t, box.Items(), 1)
+	assert.Contains(t, model.outboxStatus(), "送信待ち: 1件")
+
+	// 接続したら送り直す。サーバーに届かなかったなら次の機会まで残す
+	_, cmd := model.Update(accountMsg{key: "a", gen: model.account.gen, msg: websocket.WebSocketConnectedMsg{}})
+	deliver(model, cmd)
+	assert.Len(t, client.notes, 1)
+	assert.Equal(t, 1, box.Items()[0].Attempts)
+	assert.Contains(t, model.outboxStatus(), "connection refused")
+
+	// 接続できずに失敗した投稿も送信待ちにする
+	client.errs = []error{refused}
+	submit(model, "refused")
+	assert.Equal(t, "", model.textarea.Value())
+	assert.Len(t, box.Items(), 2)
+
+	for _, item := range box.Items() {
+		box.Retry(item.ID, refused, item.CreatedAt.Add(-outboxInterval*100))
+	}
+	deliver(model, model.flushOutbox())
+	assert.Empty(t, box.Items())
+	assert.Equal(t, "offline", client.notes[2].Text)
+	assert.Equal(t, "refused", client.notes[3].Text)
+	assert.Equal(t, "", model.outboxStatus())
+}
+
+func TestOutboxUncertain(t *testing.T) {
+	client := &postMockClient{errs: []error{context.DeadlineExceeded}}
+	model, _, box := newOutboxModel(t, client)
+	model.Update(accountMsg{key: "a", gen: model.account.gen, msg: websocket.WebSocketConnectedMsg{}})
+
+	// 送信後のタイムアウトは投稿できていることがあるので、送信待ちにせず本文を残す
+	submit(model, "timeout")
+	assert.Equal(t, "timeout", model.textarea.Value())
+	assert.ErrorContains(t, model.err, "投稿できたか分かりません")
+	assert.Empty(t, box.Items())
+
+	// 送り直してサーバー側のエラーになったものは、もう自動では送らない
+	item, err := box.Add("a", misskey.CreateNote{Text: "queued"}, time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	client.errs = []error{&api.StatusError{StatusCode: 503}}
+	deliver(model, model.flushOutbox())
+	assert.True(t, box.Items()[0].Uncertain)
+	assert.Empty(t, box.Due("a", item.CreatedAt.Add(time.Hour)))
+	assert.Contains(t, model.outboxStatus(), "送信不明: 1件")
+}
+
+func TestDraft(t *testing.T) {
+	model, drafts, _ := newOutboxModel(t, &postMockClient{})
+
+	_, cmd := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("hi")})
+	assert.NotNil(t, cmd)
+	model.Update(draftSaveMsg{seq: model.draftSeq})
+	assert.Equal(t, "hi", drafts.Get("a"))
+
+	// 古い予約では保存しない
+	model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("!")})
+	model.Update(draftSaveMsg{seq: model.draftSeq - 1})
+	assert.Equal(t, "hi", drafts.Get("a"))
+
+	// 次に起動したときは下書きを投稿欄に戻す
+	restored := NewAccountModel(newTestAccount("a"), logger.New(false))
+	restored.EnableOutbox(drafts, nil)
+	assert.Equal(t, "hi", restored.textarea.Value())
+}
@@ -0,0 +1,70 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type (
+	// accountPicker は切り替え先のアカウントを選ぶ一覧です
+	accountPicker struct {
+		keys   []string
+		cursor int
+		open   bool
+	}
+)
+
+// Open は一覧を表示し、現在のアカウントにカーソルを合わせます
+func (p *accountPicker) Open(keys []string, current string) {
+	p.keys = keys
+	p.cursor = 0
+	for i, k := range keys {
+		if k == current {
+			p.cursor = i
+		}
+	}
+	p.open = true
+}
+
+// Update はキー操作を処理し、決定されたキーを返します(未決定なら空文字)
+func (p *accountPicker) Update(msg tea.KeyMsg) string {
+	switch msg.String() {
+	case "up", "ctrl+p", "k":
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case "down", "ctrl+n", "j":
+		if p.cursor < len(p.keys)-1 {
+			p.cursor++
+		}
+	case "enter":
+		p.open = false
+		if len(p.keys) == 0 {
+			return ""
+		}
+		return p.keys[p.cursor]
+	case "esc", "q":
+		p.open = false
+	}
+	return ""
+}
+
+// View は一覧を描画します
+func (p *accountPicker) View(current string, theme Theme) string {
+	var b strings.Builder
+	b.WriteString("アカウントを選択 [↑/↓] 移動 [enter] 切り替え [esc] キャンセル\n\n")
+	for i, k := range p.keys {
+		cursor := "  "
+		if i == p.cursor {
+			cursor = "> "
+		}
+		label := k
+		if k == current {
+			label = theme.Account(k) + " (接続中)"
+		}
+		b.WriteString(fmt.Sprintf("%s%s\n", cursor, label))
+	}
+	return b.String()
+}
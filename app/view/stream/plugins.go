@@ -0,0 +1,170 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/service/plugins"
+)
+
+type (
+	// pluginMsg はプラグインからの表示の依頼や、プラグインが止まったことの知らせです
+	pluginMsg struct {
+		text string
+	}
+
+	// pluginCommandMsg はプラグインのコマンドの結果です
+	pluginCommandMsg struct {
+		name string
+		text string
+		err  error
+	}
+
+	// decorationMsg はプラグインがノートに追加する表示です
+	decorationMsg struct {
+		uri         string
+		decorations []plugins.Decoration
+	}
+
+	// pluginView は :plugins で開く、プラグインの状態の一覧です
+	pluginView struct {
+		open bool
+	}
+)
+
+// EnablePlugins はプラグインにイベントを送り、登録されたコマンドとキー割り当て、ノートの表示を使えるようにします
+// プラグインが止まっても、一時的な表示で知らせるだけでタイムラインはそのまま使えます
+func (m *Model) EnablePlugins(host *plugins.Host) {
+	m.plugins = host
+	send := func(text string) {
+		select {
+		case m.msgCh <- pluginMsg{text: text}:
+		case <-m.ctx.Done():
+		}
+	}
+	host.OnMessage(func(plugin string, text string) {
+		send(fmt.Sprintf("[%s] %s", plugin, text))
+	})
+	host.OnExit(func(plugin string, err error) {
+		send(fmt.Sprintf("プラグイン %s が停止しました: %v", plugin, err))
+	})
+}
+
+// pluginCommand は投稿欄のコマンドやキーに対応する、プラグインのコマンドを返します
+func (m *Model) pluginCommand(name string) (plugins.Command, bool) {
+	if m.plugins == nil {
+		return plugins.Command{}, false
+	}
+	return m.plugins.Command(name)
+}
+
+// pluginKey はキーに割り当てられたプラグインのコマンドを返します
+func (m *Model) pluginKey(msg tea.KeyMsg) (plugins.Command, bool) {
+	if m.plugins == nil {
+		return plugins.Command{}, false
+	}
+	return m.plugins.KeyCommand(msg.String())
+}
+
+// runPluginCommand はプラグインのコマンドを、選択中のノートとともに実行します
+func (m *Model) runPluginCommand(command plugins.Command, args []string) tea.Cmd {
+	params := plugins.CommandParams{Name: command.Name, Args: args, Account: m.account.Key}
+	if entry := m.focusedColumn().selectedNote(); entry != nil {
+		body := entry.note.Body.Body
+		params.Note = &body
+		params.Account = entry.receivers[0].key
+	}
+	host := m.plugins
+	return m.request(fmt.Sprintf("%s (%s)", command.Name, command.Plugin), func(ctx context.Context) tea.Msg {
+		text, err := host.RunCommand(ctx, params)
+		return pluginCommandMsg{name: command.Name, text: text, err: err}
+	})
+}
+
+// updatePluginCommand はプラグインのコマンドの結果を表示します
+func (m *Model) updatePluginCommand(msg pluginCommandMsg) tea.Cmd {
+	if msg.err != nil {
+		m.logger.Log("stream", fmt.Sprintf("plugin command error: %s: %v", msg.name, msg.err))
+		return m.showToast(fmt.Sprintf("%s に失敗しました: %v", msg.name, msg.err))
+	}
+	if msg.text == "" {
+		return nil
+	}
+	return m.showToast(msg.text)
+}
+
+// decorate はノートに追加する表示をプラグインに問い合わせるコマンドを返します
+func (m *Model) decorate(account *Account, entry *timelineNote) tea.Cmd {
+	if m.plugins == nil || !m.plugins.Decorates() {
+		return nil
+	}
+	host, key, uri, body := m.plugins, account.Key, entry.uri, entry.note.Body.Body
+	return func() tea.Msg {
+		return decorationMsg{uri: uri, decorations: host.Decorate(m.ctx, key, &body)}
+	}
+}
+
+// updateDecoration はプラグインの表示をノートに付けます
+func (m *Model) updateDecoration(msg decorationMsg) {
+	if len(msg.decorations) == 0 {
+		return
+	}
+	for _, c := range m.columns {
+		for _, entry := range c.notes {
+			if entry.uri == msg.uri {
+				entry.decorations = msg.decorations
+			}
+		}
+	}
+	m.refreshViewBuffer()
+}
+
+// decorated はノートの表示の後にプラグインの表示を加えます
+func (m *Model) decorated(entry *timelineNote, text string) string {
+	for _, d := range entry.decorations {
+		text = strings.TrimRight(text, "\n") + "\n" + m.theme.Renoter("[%s] %s", d.Plugin, d.Text)
+	}
+	return text
+}
+
+// openPlugins はプラグインの状態の一覧を開きます
+func (m *Model) openPlugins() {
+	m.pluginView.open = true
+	m.refreshViewBuffer()
+}
+
+// renderPlugins はプラグインごとの状態と、登録されたコマンドとキー割り当てを表示します
+func (m *Model) renderPlugins() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("プラグイン [%s] 閉じる\n", m.keyMap.Cancel.Help().Key))
+	if m.plugins == nil || m.plugins.Len() == 0 {
+		b.WriteString("  なし\n")
+		return b.String()
+	}
+	for _, s := range m.plugins.Status() {
+		state := m.theme.Connected("動作中")
+		if !s.Running {
+			state = m.theme.Alert("停止: %v", s.Err)
+		}
+		b.WriteString(fmt.Sprintf("%s (%s)\n", m.theme.Account(s.Name), state))
+		for _, c := range s.Manifest.Commands {
+			b.WriteString(fmt.Sprintf("  :%s %s\n", c.Name, c.Description))
+		}
+		for _, k := range s.Manifest.Keys {
+			b.WriteString(fmt.Sprintf("  [%s] :%s\n", k.Key, k.Command))
+		}
+		if len(s.Manifest.Events) > 0 {
+			events := make([]string, 0, len(s.Manifest.Events))
+			for _, ev := range s.Manifest.Events {
+				events = append(events, string(ev))
+			}
+			b.WriteString("  イベント: " + strings.Join(events, ", ") + "\n")
+		}
+		if s.Manifest.Decorations {
+			b.WriteString("  ノートに表示を追加\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/service/plugins"
+)
+
+// shPlugin はシェルで書いたプラグインです
+// "crash" を引数にコマンドを実行すると終了します
+const shPlugin = `
+while IFS= read -r line; do
+  id=$(printf '%s' "$line" | sed -n 's/^{"jsonrpc":"2.0","id":\([0-9]*\),.*/\1/p')
+  case "$line" in
+  *'"method":"initialize"'*)
+    printf '{"jsonrpc":"2.0","id":%s,"result":{"commands":[{"name":"hello"}],"keys":[{"key":"ctrl+t","command":"hello"}],"decorations":true}}\n' "$id" ;;
+  *'"method":"decorate"'*)
+    printf '{"jsonrpc":"2.0","id":%s,"result":{"text":"decorated"}}\n' "$id" ;;
+  *'"method":"command"'*'"args":["crash"]'*)
+    echo crashed >&2; exit 1 ;;
+  *'"method":"command"'*)
+    printf '{"jsonrpc":"2.0","id":%s,"result":{"text":"hello from sh"}}\n' "$id" ;;
+  esac
+done
+`
+
+func TestPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh が必要です")
+	}
+	host := plugins.New([]setting.Plugin{{Name: "sh", Command: "sh", Args: []string{"-c", shPlugin}}}, []string{"a"}, nil)
+	require.NoError(t, host.Start(context.Background()))
+	defer host.Close()
+
+	account := newTestAccount("a")
+	model := NewAccountModel(account, logger.New(false))
+	model.EnablePlugins(host)
+	model.Init()
+
+	// ノートに表示を追加する
+	_, cmd := model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(1)}})
+	deliver(model, cmd)
+	entry := model.mainColumn().notes[0]
+	assert.Equal(t, []plugins.Decoration{{Plugin: "sh", Text: "decorated"}}, entry.decorations)
+	assert.Equal(t, "note\n[sh] decorated", model.decorated(entry, "note\n"))
+
+	// 投稿欄のコマンドとキー割り当て
+	submit(model, ":hello")
+	assert.Contains(t, model.requestStatus(), "hello from sh")
+	assert.Equal(t, "", model.textarea.Value())
+	model.toast = ""
+	_, cmd = model.Update(tea.KeyMsg{Type: tea.KeyCtrlT})
+	deliver(model, cmd)
+	assert.Contains(t, model.requestStatus(), "hello from sh")
+
+	// プラグインが止まっても、知らせるだけでタイムラインは使える
+	submit(model, ":hello crash")
+	assert.Contains(t, model.requestStatus(), "hello に失敗しました")
+	select {
+	case msg := <-model.msgCh:
+		model.Update(msg)
+	case <-time.After(2 * time.Second):
+		t.Fatal("停止が知らされません")
+	}
+	assert.Contains(t, model.requestStatus(), "プラグイン sh が停止しました: exit status 1: crashed")
+	assert.Contains(t, model.renderPlugins(), "停止: exit status 1: crashed")
+
+	_, cmd = model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(2)}})
+	deliver(model, cmd)
+	assert.Len(t, model.mainColumn().notes, 2)
+	assert.Empty(t, model.mainColumn().notes[0].decorations)
+
+	// 止まったプラグインのコマンドは投稿せずに失敗を表示する
+	submit(model, ":hello")
+	assert.Contains(t, model.requestStatus(), "プラグイン sh は停止しています")
+}
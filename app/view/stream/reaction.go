@@ -0,0 +1,115 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/service/emoji"
+	"github.com/wasya-io/petit-misskey/view/mfm"
+)
+
+type (
+	// reactionPicker はリアクションに使う絵文字を選ぶ一覧です
+	// 入力した文字で絵文字の一覧を絞り込みます
+	reactionPicker struct {
+		favorites []string
+		catalog   *emoji.Catalog
+		query     string
+		items     []string
+		cursor    int
+		open      bool
+	}
+
+	// reactionResultMsg はリアクションの結果です
+	reactionResultMsg struct {
+		noteId   string
+		reaction string
+		err      error
+	}
+)
+
+const maxReactionItems = 10 // 一覧に表示する絵文字の数
+
+// Open は一覧を表示します
+// favoritesは絞り込んでいないときに表示する絵文字です
+func (p *reactionPicker) Open(favorites []string, catalog *emoji.Catalog) {
+	p.favorites = favorites
+	p.catalog = catalog
+	p.query = ""
+	p.open = true
+	p.filter()
+}
+
+// Update はキー操作を処理し、決定されたリアクションを返します(未決定なら空文字)
+func (p *reactionPicker) Update(msg tea.KeyMsg) string {
+	switch msg.Type {
+	case tea.KeyUp, tea.KeyCtrlP:
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case tea.KeyDown, tea.KeyCtrlN:
+		if p.cursor < len(p.items)-1 {
+			p.cursor++
+		}
+	case tea.KeyEnter:
+		p.open = false
+		if len(p.items) == 0 {
+			return ""
+		}
+		return p.items[p.cursor]
+	case tea.KeyEsc:
+		p.open = false
+	case tea.KeyBackspace:
+		if r := []rune(p.query); len(r) > 0 {
+			p.query = string(r[:len(r)-1])
+			p.filter()
+		}
+	case tea.KeyRunes:
+		p.query += string(msg.Runes)
+		p.filter()
+	}
+	return ""
+}
+
+// filter は入力した文字で一覧を絞り込みます
+func (p *reactionPicker) filter() {
+	p.cursor = 0
+	query := strings.Trim(p.query, ":")
+	if query == "" {
+		p.items = p.favorites
+		return
+	}
+	p.items = make([]string, 0, maxReactionItems)
+	if p.catalog == nil {
+		return
+	}
+	for _, e := range p.catalog.Search(query, maxReactionItems) {
+		p.items = append(p.items, ":"+e.Name+":")
+	}
+}
+
+// View は一覧を描画します
+func (p *reactionPicker) View(renderer mfm.Renderer) string {
+	var b strings.Builder
+	b.WriteString("リアクションを選択 [入力] 絞り込み [↑/↓] 移動 [enter] 決定 [esc] キャンセル\n")
+	b.WriteString(fmt.Sprintf("> %s\n\n", p.query))
+	if len(p.items) == 0 {
+		b.WriteString("  (見つかりません)\n")
+	}
+	for i, item := range p.items {
+		cursor := "  "
+		if i == p.cursor {
+			cursor = "> "
+		}
+		label := renderer.Render(item)
+		if renderer.Emoji != nil && strings.HasPrefix(item, ":") {
+			// 絵文字に置き換えられた場合も名前が分かるようにする
+			if s, ok := renderer.Emoji.Resolve(strings.Trim(item, ":"), ""); ok {
+				label = s + " " + item
+			}
+		}
+		b.WriteString(fmt.Sprintf("%s%s\n", cursor, label))
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type (
+	// requestDoneMsg はAPI呼び出しが終わったことを表し、結果のメッセージを包みます
+	requestDoneMsg struct {
+		id  int
+		msg tea.Msg
+	}
+
+	// toastExpiredMsg はトーストを消すタイミングです
+	toastExpiredMsg struct {
+		seq int
+	}
+)
+
+const (
+	requestTimeout = 30 * time.Second
+	toastDuration  = 4 * time.Second
+)
+
+// request はAPI呼び出しをUpdateの外で実行するコマンドを返します
+// 終わるまではステータス欄にlabelとスピナーを表示します
+// 呼び出しはタイムアウトか終了操作で取り消し、callの結果はそのままUpdateに渡します
+func (m *Model) request(label string, call func(ctx context.Context) tea.Msg) tea.Cmd {
+	m.requestSeq++
+	id := m.requestSeq
+	m.pending[id] = label
+	m.refreshStatusView()
+
+	cmd := func() tea.Msg {
+		ctx, cancel := context.WithTimeout(m.ctx, requestTimeout)
+		defer cancel()
+		return requestDoneMsg{id: id, msg: call(ctx)}
+	}
+	if len(m.pending) == 1 {
+		// スピナーは実行中の呼び出しがある間だけ回す
+		return tea.Batch(cmd, m.spinner.Tick)
+	}
+	return cmd
+}
+
+// updateSpinner はスピナーを進めます。実行中の呼び出しがなければ止めます
+func (m *Model) updateSpinner(msg spinner.TickMsg) tea.Cmd {
+	if len(m.pending) == 0 {
+		return nil
+	}
+	var cmd tea.Cmd
+	m.spinner, cmd = m.spinner.Update(msg)
+	m.refreshStatusView()
+	return cmd
+}
+
+// showToast はステータス欄にtextをしばらく表示します
+func (m *Model) showToast(text string) tea.Cmd {
+	m.toastSeq++
+	seq := m.toastSeq
+	m.toast = text
+	m.refreshStatusView()
+	return tea.Tick(toastDuration, func(time.Time) tea.Msg {
+		return toastExpiredMsg{seq: seq}
+	})
+}
+
+// requestStatus はステータス欄に表示する実行中の呼び出しとトーストです
+func (m *Model) requestStatus() string {
+	var b strings.Builder
+	if len(m.pending) > 0 {
+		ids := make([]int, 0, len(m.pending))
+		for id := range m.pending {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		labels := make([]string, 0, len(ids))
+		for _, id := range ids {
+			labels = append(labels, m.pending[id])
+		}
+		b.WriteString(fmt.Sprintf("%s %s\n", m.spinner.View(), strings.Join(labels, "、")))
+	}
+	if m.toast != "" {
+		b.WriteString(m.theme.Connected("%s", m.toast) + "\n")
+	}
+	return b.String()
+}
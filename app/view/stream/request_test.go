@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/domain/api"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+)
+
+// reactionMockClient はリアクションの結果を返すクライアントです
+type reactionMockClient struct {
+	api.Client
+	err error
+}
+
+func (c *reactionMockClient) CreateReaction(ctx context.Context, contents misskey.CreateReaction) error {
+	return c.err
+}
+
+func TestPostRequest(t *testing.T) {
+	account := newTestAccount("a")
+	account.APIClient = &postMockClient{}
+	model := NewAccountModel(account, logger.New(false))
+	model.Init()
+
+	// 結果が届くまでは実行中として表示する
+	model.textarea.SetValue("hello")
+	_, cmd := model.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+	assert.Contains(t, model.requestStatus(), "投稿中")
+	assert.Equal(t, "hello", model.textarea.Value())
+
+	deliver(model, cmd)
+	assert.Empty(t, model.pending)
+	assert.Equal(t, "", model.textarea.Value())
+	assert.Contains(t, model.requestStatus(), "投稿しました: note1")
+
+	// 別の表示に置き換わったあとの期限切れでは消さない
+	model.Update(toastExpiredMsg{seq: model.toastSeq - 1})
+	assert.NotEmpty(t, model.toast)
+	model.Update(toastExpiredMsg{seq: model.toastSeq})
+	assert.Equal(t, "", model.requestStatus())
+}
+
+func TestReactionRequest(t *testing.T) {
+	account := newTestAccount("a")
+	client := &reactionMockClient{err: errors.New("rate limit")}
+	account.APIClient = client
+	model := NewAccountModel(account, logger.New(false))
+	model.Init()
+	model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(1)}})
+	model.Update(tea.KeyMsg{Type: tea.KeyDown, Alt: true})
+
+	deliver(model, model.react("👍"))
+	assert.ErrorContains(t, model.err, "リアクションできませんでした: rate limit")
+
+	client.err = nil
+	deliver(model, model.react("👍"))
+	assert.Equal(t, "リアクションしました: 👍", model.toast)
+}
@@ -0,0 +1,179 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/infrastructure/store"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/archive"
+)
+
+type (
+	// searchView は :search で開く、保存したノートと通知の検索結果です
+	searchView struct {
+		open   bool
+		query  archive.Query
+		hits   []store.Record
+		cursor int
+		detail bool // タイムラインに残っていないノートを表示している
+	}
+)
+
+const maxSearchHits = 50 // 検索結果に表示する件数
+
+// EnableArchive は受信したノートと通知を保存し、:search で検索できるようにします
+func (m *Model) EnableArchive(a *archive.Archive) {
+	m.archive = a
+}
+
+// archiveMessage はアカウントに届いたノートと通知を保存します
+// ミュートや --where に関係なく、届いたものはすべて保存します
+func (m *Model) archiveMessage(account *Account, msg tea.Msg) {
+	if m.archive == nil {
+		return
+	}
+	if _, err := m.archive.Add(account.Key, msg, time.Now()); err != nil {
+		m.logger.Log("stream", fmt.Sprintf("archive error: %v", err))
+	}
+}
+
+// openSearch は保存したノートと通知を検索し、結果の一覧を開きます
+// "@" で始まる語は投稿者の指定として扱います
+func (m *Model) openSearch(args []string) tea.Cmd {
+	if m.archive == nil {
+		return m.showToast("ローカル検索は使えません")
+	}
+	q := archive.Query{Limit: maxSearchHits}
+	terms := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "@") && q.User == "" {
+			q.User = arg
+			continue
+		}
+		terms = append(terms, arg)
+	}
+	q.Text = strings.Join(terms, " ")
+	hits, err := m.archive.Search(q)
+	if err != nil {
+		return m.showToast(fmt.Sprintf("検索できませんでした: %v", err))
+	}
+	m.searchView = searchView{open: true, query: q, hits: hits}
+	m.refreshViewBuffer()
+	return nil
+}
+
+// updateSearch は検索結果の一覧を開いている間のキー操作を処理します
+func (m *Model) updateSearch(msg tea.KeyMsg) {
+	v := &m.searchView
+	switch {
+	case key.Matches(msg, m.keyMap.Cancel, m.keyMap.Quit):
+		if v.detail {
+			v.detail = false
+		} else {
+			v.open = false
+		}
+	case v.detail:
+	case key.Matches(msg, m.keyMap.SelectPrev) || msg.String() == "up":
+		v.cursor = max(v.cursor-1, 0)
+	case key.Matches(msg, m.keyMap.SelectNext) || msg.String() == "down":
+		v.cursor = max(min(v.cursor+1, len(v.hits)-1), 0)
+	case msg.String() == "enter" && len(v.hits) > 0:
+		m.jumpTo(v.hits[v.cursor])
+	}
+	m.refreshViewBuffer()
+}
+
+// jumpTo は検索結果のノートがカラムに残っていれば、そのカラムで選択します
+// 残っていなければ検索結果の一覧の中でノート全体を表示します
+func (m *Model) jumpTo(r store.Record) {
+	if note := archive.Note(r); note != nil {
+		for i, c := range m.columns {
+			for _, entry := range c.notes {
+				body := entry.note.Body.Body
+				if (note.Uri != "" && entry.uri == note.Uri) || (body.ID == note.ID && entry.receivedBy(r.Account)) {
+					m.focus = i
+					c.selected = entry.uri
+					m.searchView.open = false
+					return
+				}
+			}
+		}
+	}
+	m.searchView.detail = true
+}
+
+// renderSearch は検索結果の一覧か、選択したノートの全体を表示します
+func (m *Model) renderSearch() string {
+	v := m.searchView
+	var b strings.Builder
+	if v.detail {
+		b.WriteString(fmt.Sprintf("検索結果 [%s] 一覧に戻る\n\n", m.keyMap.Cancel.Help().Key))
+		b.WriteString(m.renderRecord(v.hits[v.cursor]))
+		return b.String()
+	}
+
+	condition := v.query.Text
+	if v.query.User != "" {
+		condition = strings.TrimSpace(v.query.User + " " + condition)
+	}
+	b.WriteString(fmt.Sprintf("検索: %s (%d件) [↑/↓] 移動 [enter] 表示 [%s] 閉じる\n\n",
+		m.theme.Highlight("%s", condition), len(v.hits), m.keyMap.Cancel.Help().Key))
+	if len(v.hits) == 0 {
+		b.WriteString("  見つかりませんでした\n")
+	}
+	terms := strings.Fields(v.query.Text)
+	for i, r := range v.hits {
+		cursor := "  "
+		if i == v.cursor {
+			cursor = "> "
+		}
+		user := ""
+		if u := archive.User(r); u != nil {
+			user = "@" + m.theme.Username(u.Username)
+		}
+		text := ""
+		if note := archive.Note(r); note != nil {
+			text = note.Text
+			if note.RenoteID != "" && text == "" {
+				text = "RN: " + note.Renote.Text
+			}
+		}
+		if r.Kind == store.KindNotification {
+			user = fmt.Sprintf("[%s] %s", r.Notification.Type, user)
+		}
+		if t := []rune(strings.ReplaceAll(text, "\n", " ")); len(t) > 80 {
+			text = string(t[:80]) + "…"
+		} else {
+			text = string(t)
+		}
+		b.WriteString(fmt.Sprintf("%s%s [%s] %s\n    %s\n",
+			cursor,
+			r.CreatedAt.Local().Format("01/02 15:04"),
+			r.Account,
+			user,
+			highlightTerms(text, terms, m.theme.Highlight)))
+	}
+	return b.String()
+}
+
+// renderRecord は保存したノートを、タイムラインと同じ形で表示します
+func (m *Model) renderRecord(r store.Record) string {
+	note := archive.Note(r)
+	if note == nil {
+		return formatNotification(r.Notification, m.theme) + "\n"
+	}
+	entry := &timelineNote{
+		note:      &misskey.Note{Type: "note", Body: misskey.NoteContainer{Type: "note", Body: *note}},
+		uri:       note.Uri,
+		receivers: []receiver{{key: r.Account, noteId: note.ID}},
+	}
+	text := formatNote(entry.note, m.theme, m.rendererFor(entry.account(m)), m.previewFor(entry, m.width, true), nil)
+	if r.Kind == store.KindNotification {
+		text = formatNotification(r.Notification, m.theme) + "\n" + text
+	}
+	return text
+}
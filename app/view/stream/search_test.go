@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wasya-io/petit-misskey/infrastructure/store"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+	"github.com/wasya-io/petit-misskey/service/archive"
+)
+
+func TestSearch(t *testing.T) {
+	s, err := store.Open(t.TempDir(), store.Options{})
+	require.NoError(t, err)
+	a, err := archive.Open(s, nil)
+	require.NoError(t, err)
+	defer a.Close()
+
+	account := newTestAccount("a")
+	model := NewAccountModel(account, logger.New(false))
+	model.EnableArchive(a)
+	model.Init()
+
+	// タイムラインに残るのは新しい maxKeptNotes 件だけだが、保存はすべてする
+	for i := 1; i <= maxKeptNotes+1; i++ {
+		note := createTestNote(i)
+		note.Body.Body.CreatedAt = time.Now().Add(time.Duration(i) * time.Minute)
+		model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: note}})
+	}
+	saved, err := a.Search(archive.Query{Limit: 100})
+	require.NoError(t, err)
+	assert.Len(t, saved, maxKeptNotes+1)
+	assert.Len(t, model.mainColumn().notes, maxKeptNotes)
+
+	submit(model, ":search @user11 テストノート")
+	require.True(t, model.searchView.open)
+	assert.Equal(t, "", model.textarea.Value())
+	require.Len(t, model.searchView.hits, 1)
+	assert.Contains(t, model.renderSearch(), "これはテストノート11です")
+
+	// タイムラインに残っているノートはカラムで選択する
+	model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.False(t, model.searchView.open)
+	assert.Equal(t, "note-id-11", model.mainColumn().selectedNote().note.Body.Body.ID)
+
+	// 流れてしまったノートはノート全体を表示する
+	submit(model, ":search テストノート1")
+	require.Len(t, model.searchView.hits, 3) // 11, 10, 1
+	model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.True(t, model.searchView.detail)
+	assert.Contains(t, model.renderSearch(), "これはテストノート1です")
+
+	model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, model.searchView.detail)
+	assert.True(t, model.searchView.open)
+	model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, model.searchView.open)
+}
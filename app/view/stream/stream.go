@@ -4,23 +4,34 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
+	"io"
 	"log"
 	"strings"
 	"sync"
 	"text/template"
 	"time"
 
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/fatih/color"
 	"github.com/wasya-io/petit-misskey/domain/api"
 	"github.com/wasya-io/petit-misskey/domain/core"
 	"github.com/wasya-io/petit-misskey/infrastructure/bubbles"
 	"github.com/wasya-io/petit-misskey/infrastructure/setting"
 	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
 	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/archive"
+	"github.com/wasya-io/petit-misskey/service/expr"
+	"github.com/wasya-io/petit-misskey/service/hooks"
+	"github.com/wasya-io/petit-misskey/service/outbox"
+	"github.com/wasya-io/petit-misskey/service/plugins"
+	"github.com/wasya-io/petit-misskey/service/watch"
+	"github.com/wasya-io/petit-misskey/view"
+	"github.com/wasya-io/petit-misskey/view/graphics"
+	"github.com/wasya-io/petit-misskey/view/mfm"
 	"github.com/wasya-io/petit-misskey/view/postnote"
 )
 
@@ -32,20 +43,54 @@ type Model struct {
 	viewMain     viewport.Model
 	viewStatus   viewport.Model
 	textarea     postnote.PostTextarea
-	client       websocket.Client
-	apiClient    api.Client
-	notes        []*misskey.Note
+	account      *Account      // 投稿や表示設定に使う主アカウント
+	accounts     []*Account    // 接続中のすべてのアカウント(先頭は主アカウント)
+	columns      []*column     // 横に並べるカラム(デッキ表示でなければメインのタイムラインのみ)
+	focus        int           // フォーカス中のカラムの位置
+	replyTo      *timelineNote // 返信先のノート
 	quitting     bool
-	connected    bool
 	err          error
-	instance     *setting.Instance
 	viewBuffer   strings.Builder
 	width        int
 	height       int
 	initialized  bool
-	timeline     string
+	keyMap       KeyMap
+	theme        Theme
+	renderer     mfm.Renderer      // 本文のMFMの描画
+	graphics     *graphics.Overlay // 画像を重ねて描く(nilなら端末が画像に対応していない)
+	reactions    reactionPicker
+	filters      filterView
+	watchView    highlightView
+	highlights   []highlight     // 注目のノート(新しい順)
+	unseenWatch  int             // 一覧を開いてから増えた注目のノートの数
+	alertOut     io.Writer       // 端末での通知の書き出し先(nilなら通知しない)
+	filtered     []filteredNote  // 最近絞り込んだノート(新しい順)
+	where        *expr.Program   // 表示するノートの条件(nilならすべて)
+	revealed     map[string]bool // 閲覧注意のファイルを表示しているノートのURI
+	drafts       *outbox.Drafts  // 書きかけの投稿(nilなら保存しない)
+	draftSeq     int
+	outbox       *outbox.Outbox  // 送信待ちの投稿(nilなら失敗した投稿は捨てる)
+	sending      map[string]bool // 送り直している最中の送信待ちの投稿のID
+	spinner      spinner.Model
+	pending      map[int]string // 実行中のAPI呼び出しの表示名
+	requestSeq   int
+	toast        string // 操作の結果の一時的な表示
+	toastSeq     int
 	muViewAll    sync.Mutex
 	muViewStatus sync.Mutex
+	hooks        *hooks.Dispatcher // イベントで実行するコマンド(nilなら実行しない)
+	plugins      *plugins.Host     // 起動したプラグイン(nilなら使わない)
+	pluginView   pluginView
+	archive      *archive.Archive // 受信したノートと通知の保存先(nilなら保存しない)
+	searchView   searchView
+	explore      exploreView
+
+	// アカウント切り替え
+	accountKeys    []string
+	accountFactory AccountFactory
+	picker         accountPicker
+	states         map[string]accountState
+	generation     int
 }
 
 var (
@@ -53,116 +98,348 @@ var (
 	NoteTmpl string
 	//go:embed template/renote.tmpl
 	RenoteTmpl string
+
+	// 選択中のノートの表示
+	selectedStyle = lipgloss.NewStyle().
+			BorderStyle(lipgloss.ThickBorder()).
+			BorderLeft(true).
+			BorderForeground(lipgloss.Color("205")).
+			PaddingLeft(1)
 )
 
 func NewModel(instance *setting.Instance, client websocket.Client, apiClient api.Client, logger core.Logger, msgCh chan tea.Msg) *Model {
+	return NewAccountModel(&Account{
+		Instance:  instance,
+		Client:    client,
+		APIClient: apiClient,
+		MsgCh:     msgCh,
+	}, logger)
+}
+
+// NewAccountModel はアカウントを指定してModelを生成します
+func NewAccountModel(account *Account, logger core.Logger) *Model {
 	ctx, cancel := context.WithCancel(context.Background())
+	instance := account.Instance
 
 	m := &Model{
 		ctx:          ctx,
 		logger:       logger,
 		cancel:       cancel,
-		msgCh:        msgCh,
+		msgCh:        make(chan tea.Msg, 100),
 		viewMain:     bubbles.NewViewportFactory().StreamView(),
 		viewStatus:   bubbles.NewViewportFactory().SystemView(),
-		client:       client,
-		apiClient:    apiClient,
-		notes:        make([]*misskey.Note, 0, 100),
+		account:      account,
+		accounts:     []*Account{account},
 		quitting:     false,
-		connected:    false,
-		instance:     instance,
 		viewBuffer:   strings.Builder{},
 		width:        120,
 		height:       20,
 		initialized:  false,
-		timeline:     "",
+		keyMap:       NewKeyMap(instance.Preferences.Keybindings),
+		theme:        themeByName(instance.Preferences.Theme),
+		renderer:     mfm.NewRenderer(themeByName(instance.Preferences.Theme).Markup),
+		graphics:     newOverlay(),
 		muViewAll:    sync.Mutex{},
 		muViewStatus: sync.Mutex{},
+		states:       make(map[string]accountState),
+		revealed:     make(map[string]bool),
+		spinner:      spinner.New(spinner.WithSpinner(spinner.Dot)),
+		pending:      make(map[int]string),
+		alertOut:     view.Terminal,
 	}
 	m.textarea = bubbles.NewViewportFactory().PostView(m.postnoteCallback, logger)
+	m.setupComposer(instance.Preferences)
+	m.registerCompleters()
+	m.buildColumns(account)
 	return m
 }
 
 func (m *Model) Init() tea.Cmd {
 	// WebSocketクライアントのgoroutine起動コマンドを返す
-	return func() tea.Msg {
-		// 別goroutineでWebSocket接続を開始
-		go func() {
-			if err := m.client.Start(); err != nil {
-				m.msgCh <- tea.Msg(websocket.WebSocketErrorMsg{Err: err})
-			}
-		}()
-
-		// 初期化完了を通知
-		return textarea.Blink()
+	cmds := make([]tea.Cmd, 0, len(m.accounts)+1)
+	for _, account := range m.accounts {
+		cmds = append(cmds, m.startAccount(account))
+	}
+	cmds = append(cmds, m.startColumns(), textarea.Blink)
+	if m.outbox != nil {
+		cmds = append(cmds, outboxTick())
 	}
+	return tea.Batch(cmds...)
 }
 
 func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	m.logger.Log("stream", fmt.Sprintf("msg: %T", msg))
 
 	switch msg := msg.(type) {
+	case accountMsg:
+		// 切り替え前の接続から遅れて届いたメッセージは捨てる
+		account := m.findAccount(msg.key, msg.gen)
+		if account == nil {
+			m.logger.Log("stream", fmt.Sprintf("drop stale message: %T", msg.msg))
+			return m, nil
+		}
+		return m.updateAccount(account, msg.msg)
+
+	case accountSwitchedMsg:
+		return m, m.completeSwitch(msg)
+
+	case userNotesMsg:
+		return m, m.updateUserColumn(msg)
+
+	case imageLoadedMsg:
+		m.refreshViewBuffer()
+		return m, nil
+
+	case postnote.CompletionMsg, postnote.EditorFinishedMsg:
+		return m, m.updateTextarea(msg)
+
+	case requestDoneMsg:
+		delete(m.pending, msg.id)
+		m.refreshStatusView()
+		return m.Update(msg.msg)
+
+	case spinner.TickMsg:
+		return m, m.updateSpinner(msg)
+
+	case toastExpiredMsg:
+		if msg.seq == m.toastSeq {
+			m.toast = ""
+			m.refreshStatusView()
+		}
+		return m, nil
+
+	case commandDoneMsg:
+		if m.textarea.Value() == msg.text {
+			m.textarea.Clear()
+			m.saveDraft()
+		}
+		return m, nil
+
+	case postResultMsg:
+		return m, m.updatePostResult(msg)
+
+	case reactionResultMsg:
+		return m, m.updateReactionResult(msg)
+
+	case hookResultMsg:
+		return m, m.updateHookResult(msg)
+
+	case pluginMsg:
+		return m, m.showToast(msg.text)
+
+	case pluginCommandMsg:
+		return m, m.updatePluginCommand(msg)
+
+	case exploreNotesMsg:
+		return m, m.updateExploreNotes(msg)
+
+	case exploreTrendsMsg:
+		return m, m.updateExploreTrends(msg)
+
+	case decorationMsg:
+		m.updateDecoration(msg)
+		return m, nil
+
+	case draftSaveMsg:
+		if msg.seq == m.draftSeq {
+			m.saveDraft()
+		}
+		return m, nil
+
+	case outboxTickMsg:
+		return m, tea.Batch(m.flushOutbox(), outboxTick())
+
+	case outboxResultMsg:
+		return m, m.updateOutboxResult(msg)
+
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c":
-			m.quitting = true
-			m.client.Stop()
-			m.logger.Log("stream", "終了処理を開始します")
-			// ロガーを正しく終了し、残りのログをフラッシュします
-			m.logger.Close()
-			return m, tea.Quit
-
-		case "ctrl+h":
-			err := m.client.ToggleTimeline()
-			if err != nil {
-				m.logger.Log("stream", fmt.Sprintf("timeline error: %v", err))
-				return m, nil
-			}
-			m.notes = make([]*misskey.Note, 0, 100)
+		return m.updateKey(msg)
+
+	case tea.WindowSizeMsg:
+
+		m.width = msg.Width
+		m.height = msg.Height
+		m.textarea.SetWidth(max(m.width-4, 20))
+		m.refreshViewBuffer()
+		return m, nil
+	}
+
+	// アカウントの区別がないメッセージは主アカウントに届いたものとして扱う
+	return m.updateAccount(m.account, msg)
+}
+
+// updateKey はキー操作を処理します
+func (m *Model) updateKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.picker.open {
+		if selected := m.picker.Update(msg); selected != "" {
+			return m, m.switchAccount(selected)
+		}
+		m.refreshViewBuffer()
+		return m, nil
+	}
+	if m.filters.open {
+		if key.Matches(msg, m.keyMap.Cancel, m.keyMap.Quit) {
+			m.filters.open = false
 			m.refreshViewBuffer()
-			return m, nil
-		case "ctrl+l":
-			err := m.client.ToggleTimeline()
-			if err != nil {
-				m.logger.Log("stream", fmt.Sprintf("timeline error: %v", err))
-				return m, nil
-			}
-			m.notes = make([]*misskey.Note, 0, 100)
+		}
+		return m, nil
+	}
+	if m.watchView.open {
+		if key.Matches(msg, m.keyMap.Cancel, m.keyMap.Quit) {
+			m.watchView.open = false
 			m.refreshViewBuffer()
-			return m, nil
-		default:
-			t, cmd := m.textarea.Update(msg)
-			m.textarea = t
+		}
+		return m, nil
+	}
+	if m.pluginView.open {
+		if key.Matches(msg, m.keyMap.Cancel, m.keyMap.Quit) {
+			m.pluginView.open = false
+			m.refreshViewBuffer()
+		}
+		return m, nil
+	}
+	if m.searchView.open {
+		m.updateSearch(msg)
+		return m, nil
+	}
+	if m.explore.open {
+		return m, m.updateExplore(msg)
+	}
+	if m.reactions.open {
+		reaction := m.reactions.Update(msg)
+		m.refreshViewBuffer()
+		if reaction != "" {
+			return m, m.react(reaction)
+		}
+		return m, nil
+	}
+	// 補完候補の一覧を開いている間は、終了以外のキーを投稿欄で処理する
+	if m.textarea.CompletionOpen() && !key.Matches(msg, m.keyMap.Quit) {
+		return m, m.updateTextarea(msg)
+	}
 
-			return m, cmd
+	switch {
+	case key.Matches(msg, m.keyMap.Quit):
+		m.quitting = true
+		m.saveDraft()
+		for _, account := range m.accounts {
+			m.stopAccount(account)
 		}
+		// 実行中のAPI呼び出しを取り消す
+		m.cancel()
+		m.logger.Log("stream", "終了処理を開始します")
+		// ロガーを正しく終了し、残りのログをフラッシュします
+		m.logger.Close()
+		return m, tea.Quit
+
+	case key.Matches(msg, m.keyMap.HomeTimeline):
+		return m, m.changeTimeline(websocket.ChannelTypeHome)
+	case key.Matches(msg, m.keyMap.LocalTimeline):
+		return m, m.changeTimeline(websocket.ChannelTypeLocal)
+	case key.Matches(msg, m.keyMap.SwitchAccount) && m.accountFactory != nil:
+		m.picker.Open(m.accountKeys, m.account.Key)
+		m.refreshViewBuffer()
+		return m, nil
+	case key.Matches(msg, m.keyMap.SelectPrev):
+		m.focusedColumn().moveSelection(-1)
+		m.refreshViewBuffer()
+		return m, nil
+	case key.Matches(msg, m.keyMap.SelectNext):
+		m.focusedColumn().moveSelection(1)
+		m.refreshViewBuffer()
+		return m, nil
+	case key.Matches(msg, m.keyMap.FocusPrev):
+		m.moveFocus(-1)
+		m.refreshViewBuffer()
+		return m, nil
+	case key.Matches(msg, m.keyMap.FocusNext):
+		m.moveFocus(1)
+		m.refreshViewBuffer()
+		return m, nil
+	case key.Matches(msg, m.keyMap.MoveColumnLeft):
+		m.moveColumn(-1)
+		m.refreshViewBuffer()
+		return m, nil
+	case key.Matches(msg, m.keyMap.MoveColumnRight):
+		m.moveColumn(1)
+		m.refreshViewBuffer()
+		return m, nil
+	case key.Matches(msg, m.keyMap.Narrow) && m.isDeck():
+		m.resizeColumn(-columnResizeStep)
+		m.refreshViewBuffer()
+		return m, nil
+	case key.Matches(msg, m.keyMap.Widen) && m.isDeck():
+		m.resizeColumn(columnResizeStep)
+		m.refreshViewBuffer()
+		return m, nil
+	case key.Matches(msg, m.keyMap.Reply):
+		m.replyTo = m.focusedColumn().selectedNote()
+		m.refreshStatusView()
+		return m, nil
+	case key.Matches(msg, m.keyMap.React):
+		m.openReactions()
+		return m, nil
+	case key.Matches(msg, m.keyMap.Reveal):
+		m.toggleReveal()
+		m.refreshViewBuffer()
+		return m, nil
+	case key.Matches(msg, m.keyMap.Cancel) && m.replyTo != nil:
+		m.replyTo = nil
+		m.refreshStatusView()
+		return m, nil
+	default:
+		// プラグインのキー割り当ては、組み込みの操作に使っていないキーだけ
+		if command, ok := m.pluginKey(msg); ok {
+			return m, m.runPluginCommand(command, nil)
+		}
+		return m, m.updateTextarea(msg)
+	}
+}
 
+// updateAccount はアカウントのクライアントから届いたメッセージを処理します
+func (m *Model) updateAccount(account *Account, msg tea.Msg) (tea.Model, tea.Cmd) {
+	m.dispatchHooks(account, msg)
+	m.archiveMessage(account, msg)
+	switch msg := msg.(type) {
 	case websocket.NoteMessage:
+		if m.where != nil && !m.where.Match(msg.Note) {
+			return m, nil
+		}
+		match, hide := m.applyFilter(account, msg.Note)
+		if hide {
+			return m, nil
+		}
 		if msg.Note.Body.Body.RenoteID != "" {
 			m.logger.Log("stream", fmt.Sprintf("renote: %s", msg.Note.Body.Body.Renote.Text))
 		} else {
 			m.logger.Log("stream", fmt.Sprintf("note: %s", msg.Note.Body.Body.Text))
 		}
-		m.notes = append([]*misskey.Note{msg.Note}, m.notes...)
-		if len(m.notes) > 10 {
-			m.notes = m.notes[:10]
+		var cmds []tea.Cmd
+		if entry := m.columnFor(account, msg.ChannelId).addNote(account, msg.Note); entry != nil {
+			entry.filtered = match
+			// 折りたたんだノートは知らせない
+			if match == nil {
+				cmds = append(cmds, m.applyWatch(account, entry))
+			}
+			cmds = append(cmds, m.decorate(account, entry))
 		}
 		m.refreshViewBuffer()
-		return m, nil
+		return m, tea.Batch(cmds...)
 
-	case tea.WindowSizeMsg:
-
-		m.width = msg.Width
-		m.height = msg.Height
-		m.refreshViewBuffer()
+	case websocket.NotificationMessage:
+		if c := m.columnFor(account, msg.ChannelId); c.spec.Type == setting.ColumnNotifications {
+			c.addNotification(msg.Notification)
+			m.refreshViewBuffer()
+		}
 		return m, nil
 
 	case websocket.WebSocketConnectedMsg:
-		m.connected = true
+		account.connected = true
+		account.timeline = msg.Timeline
 		m.err = nil
-		m.timeline = msg.Timeline.String()
 		m.refreshStatusView()
-		return m, nil
+		// 接続できたら送信待ちの投稿を送り直す
+		return m, m.flushOutbox()
 
 	case websocket.WebSocketPingReceivedMsg:
 		// m.viewFooter.SetContent("")
@@ -171,22 +448,47 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case websocket.WebSocketDisconnectedMsg:
-		m.connected = false
+		account.connected = false
 		if msg.Err != nil {
 			m.err = msg.Err
 		}
+		if m.isMulti() {
+			m.refreshStatusView()
+			return m, nil
+		}
 		m.viewStatus.SetContent("")
 		m.viewMain.SetContent("Disconnected")
 		return m, nil
 
 	case websocket.WebSocketErrorMsg:
 		m.err = msg.Err
+		if m.isMulti() {
+			m.refreshStatusView()
+			return m, nil
+		}
 		m.viewStatus.SetContent("")
 		m.viewMain.SetContent(msg.Err.Error())
 		return m, nil
 
+	case metaMsg:
+		m.updateMeta(account, msg)
+		return m, nil
+
+	case emojiCatalogMsg:
+		if msg.err != nil {
+			m.logger.Log("stream", fmt.Sprintf("emoji error: %v", msg.err))
+		}
+		m.refreshViewBuffer()
+		return m, nil
+
+	case websocket.EmojiAddedMessage:
+		if account.Emojis != nil {
+			account.Emojis.Add(msg.Emoji)
+		}
+		return m, nil
+
 	case websocket.TimelineChangedMsg:
-		m.timeline = msg.NewTimeline.String()
+		account.timeline = msg.NewTimeline
 		m.refreshStatusView()
 		return m, nil
 	}
@@ -203,6 +505,12 @@ func (m *Model) View() string {
 		m.viewMain.View(),
 		m.textarea.View(),
 	)
+	if m.graphics != nil {
+		// 画像の目印を空白に置き換え、描画したあとに画像を重ねて描く
+		var overlay string
+		joinedView, overlay = m.graphics.Render(joinedView, m.width, m.height)
+		view.Terminal.SetOverlay(overlay)
+	}
 	return joinedView
 }
 
@@ -216,23 +524,43 @@ func (m *Model) refreshStatusView() {
 
 	m.logger.Log("stream", "refresh status started")
 	var b strings.Builder
-	if m.connected {
-		b.WriteString(fmt.Sprintf("接続中: %s (@%s) [%s]\n",
-			color.GreenString(m.instance.BaseUrl),
-			color.CyanString(m.instance.UserName),
-			m.timeline))
-	} else {
-		b.WriteString(fmt.Sprintf("切断: %s [ - ]\n",
-			color.RedString(m.instance.BaseUrl)))
+	for _, account := range m.accounts {
+		instance := account.Instance
+		if account.Key != "" {
+			b.WriteString(fmt.Sprintf("[%s] ", m.theme.Account(account.Key)))
+		}
+		if account.connected {
+			b.WriteString(fmt.Sprintf("接続中: %s (@%s) [%s]\n",
+				m.theme.Connected(instance.BaseUrl),
+				m.theme.Account(instance.UserName),
+				account.timeline))
+		} else {
+			b.WriteString(fmt.Sprintf("切断: %s [ - ]\n",
+				m.theme.Alert(instance.BaseUrl)))
+		}
 	}
 
 	if m.err != nil {
-		b.WriteString(fmt.Sprintf("エラー: %s\n", color.RedString(m.err.Error())))
+		b.WriteString(fmt.Sprintf("エラー: %s\n", m.theme.Alert(m.err.Error())))
+	}
+	if m.unseenWatch > 0 {
+		b.WriteString(m.theme.Highlight("注目のノート: %d件", m.unseenWatch) + " (:highlights で一覧)\n")
+	}
+	b.WriteString(m.outboxStatus())
+	b.WriteString(m.requestStatus())
+
+	if m.replyTo != nil {
+		user := m.replyTo.note.Body.Body.User
+		b.WriteString(fmt.Sprintf("返信先: %s @%s (%s) [%s] キャンセル\n",
+			m.theme.Name(user.Name),
+			m.theme.Username(user.Username),
+			m.replyTo.receivers[0].key,
+			m.keyMap.Cancel.Help().Key))
 	}
 
 	// ヘルプ表示
 	b.WriteString("--------------------------------\n")
-	b.WriteString("[ctrl+h] ホームTL [ctrl+l] ローカルTL [ctrl+c] 終了\n")
+	b.WriteString(m.keyMap.HelpLine(m.accountFactory != nil, m.isDeck()) + "\n")
 	b.WriteString("--------------------------------\n\n")
 
 	m.viewStatus.SetContent(b.String())
@@ -248,19 +576,66 @@ func (m *Model) refreshViewBuffer() {
 
 	m.viewBuffer.Reset()
 
+	if m.picker.open {
+		m.viewMain.SetContent(m.picker.View(m.account.Key, m.theme))
+		return
+	}
+	if m.reactions.open {
+		m.viewMain.SetContent(m.reactions.View(m.rendererFor(m.account)))
+		return
+	}
+	if m.filters.open {
+		m.viewMain.SetContent(m.renderFilters())
+		return
+	}
+	if m.watchView.open {
+		m.viewMain.SetContent(m.renderHighlights())
+		return
+	}
+	if m.pluginView.open {
+		m.viewMain.SetContent(m.renderPlugins())
+		return
+	}
+	if m.searchView.open {
+		m.viewMain.SetContent(m.renderSearch())
+		return
+	}
+	if m.explore.open {
+		m.viewMain.SetContent(m.renderExplore())
+		return
+	}
+
+	if m.isDeck() {
+		m.viewMain.SetContent(m.renderDeck())
+		m.logger.Log("stream", "refresh finished")
+		return
+	}
+
+	main := m.mainColumn()
 	maxNotes := m.height - 6
 	if maxNotes < 0 {
 		maxNotes = 10
 	}
 
-	startIdx := len(m.notes) - maxNotes
+	startIdx := len(main.notes) - maxNotes
 	if startIdx < 0 {
 		startIdx = 0
 	}
 
-	for i := startIdx; i < len(m.notes); i++ {
-		note := m.notes[i]
-		m.viewBuffer.WriteString(formatNote(note))
+	for i := startIdx; i < len(main.notes); i++ {
+		entry := main.notes[i]
+		text, ok := m.collapsed(entry)
+		if !ok {
+			text = m.decorated(entry, formatNote(entry.note, m.theme, m.rendererFor(entry.account(m)), m.previewFor(entry, m.width, true), entry.watched))
+		}
+		if m.isMulti() {
+			// どのインスタンスから届いたノートかを表示する
+			text = m.theme.Account("via "+entry.receiverKeys()) + "\n" + text
+		}
+		if entry.uri == main.selected {
+			text = selectedStyle.Render(text)
+		}
+		m.viewBuffer.WriteString(text)
 		m.viewBuffer.WriteString("\n")
 	}
 
@@ -271,48 +646,155 @@ func (m *Model) refreshViewBuffer() {
 	m.logger.Log("stream", "refresh finished")
 }
 
+// changeTimeline はすべてのアカウントのタイムラインを切り替えて表示中のノートをクリアします
+func (m *Model) changeTimeline(timeline websocket.ChannelType) tea.Cmd {
+	for _, account := range m.accounts {
+		if err := account.Client.SetTimeline(timeline); err != nil {
+			m.logger.Log("stream", fmt.Sprintf("timeline error: %v", err))
+			return nil
+		}
+	}
+	m.mainColumn().clear()
+	m.replyTo = nil
+	m.refreshViewBuffer()
+	return nil
+}
+
+// setupComposer は投稿欄のキー割り当てとプレビューをアカウントの設定に合わせます
+func (m *Model) setupComposer(prefs setting.Preferences) {
+	m.textarea.SetSubmitKeys(prefs.Keybindings[ActionSubmit])
+	m.textarea.SetEditorKeys(prefs.Keybindings[ActionEditor])
+	m.textarea.SetPreviewKeys(prefs.Keybindings[ActionPreview])
+	m.textarea.SetPreviewRenderer(m.rendererFor(m.account))
+}
+
 // PostnoteCallback は投稿ノートのコールバック関数です
+// 返信の場合は、返信先のノートを受信したアカウントから投稿します
+// 投稿はコマンドとして送り、結果はpostResultMsgで受け取ります
 func (m *Model) postnoteCallback(content string) tea.Cmd {
+	if cmd, ok := m.runCommand(content); ok {
+		return cmd
+	}
+	account := m.account
+	contents := misskey.CreateNote{Text: content}
+	replyTo := m.replyTo
+	if m.replyTo != nil {
+		r := m.replyTo.receivers[0]
+		if a := m.accountByKey(r.key); a != nil {
+			account = a
+			contents.ReplyId = r.noteId
+		}
+		m.replyTo = nil
+		m.refreshStatusView()
+	}
+
+	prefs := account.Instance.Preferences
+	contents.Visibility = prefs.DefaultVisibility()
+	contents.Cw = prefs.DefaultCw()
+	contents.LocalOnly = prefs.LocalOnly
+	return m.sendNote(account, content, contents, replyTo)
+}
+
+// openReactions は選択中のノートに付けるリアクションの一覧を開きます
+func (m *Model) openReactions() {
+	entry := m.focusedColumn().selectedNote()
+	if entry == nil {
+		return
+	}
+	account := entry.account(m)
+	if account == nil {
+		return
+	}
+	prefs := account.Instance.Preferences
+	favorites := []string{prefs.DefaultReaction()}
+	for _, f := range prefs.Emoji.Favorites {
+		if f != favorites[0] {
+			favorites = append(favorites, f)
+		}
+	}
+	m.reactions.Open(favorites, account.Emojis)
+	m.refreshViewBuffer()
+}
 
-	ret, err := m.apiClient.CreateNote(context.Background(), misskey.VisibilityHome, content)
-	if err != nil {
-		m.logger.Log("stream", fmt.Sprintf("note error: %v", err))
+// react は選択中のノートに、受信したアカウントからリアクションを付けます
+func (m *Model) react(reaction string) tea.Cmd {
+	entry := m.focusedColumn().selectedNote()
+	if entry == nil {
+		return nil
+	}
+	r := entry.receivers[0]
+	account := m.accountByKey(r.key)
+	if account == nil {
 		return nil
 	}
-	m.logger.Log("stream", fmt.Sprintf("note: %s", ret.CreatedNote.Body.ID))
 
-	return nil
+	client, noteId := account.APIClient, r.noteId
+	return m.request("リアクション中", func(ctx context.Context) tea.Msg {
+		err := client.CreateReaction(ctx, misskey.CreateReaction{
+			NoteId:   noteId,
+			Reaction: reaction,
+		})
+		return reactionResultMsg{noteId: noteId, reaction: reaction, err: err}
+	})
+}
+
+// updateReactionResult はリアクションの結果を表示します
+func (m *Model) updateReactionResult(msg reactionResultMsg) tea.Cmd {
+	if msg.err != nil {
+		m.logger.Log("stream", fmt.Sprintf("reaction error: %v", msg.err))
+		m.err = fmt.Errorf("リアクションできませんでした: %w", msg.err)
+		m.refreshStatusView()
+		return nil
+	}
+	m.logger.Log("stream", fmt.Sprintf("reaction: %s %s", msg.noteId, msg.reaction))
+	return m.showToast(fmt.Sprintf("リアクションしました: %s", msg.reaction))
 }
 
 // formatNote はノートを表示用にフォーマットします
-func formatNote(note *misskey.Note) string {
+// 本文のMFMとリアクションの絵文字はrendererで、添付ファイルはpreviewで表示します
+// hitがnilでなければ、当てはまった条件を見出しに表示して本文の語を強調します
+func formatNote(note *misskey.Note, theme Theme, renderer mfm.Renderer, preview filePreview, hit *watch.Hit) string {
 	var buf strings.Builder
 	var data map[string]interface{}
+	var terms []string
+	if hit != nil {
+		terms = hit.Terms
+		buf.WriteString(theme.Highlight("★ %s", hit) + "\n")
+	}
 	if note.Body.Body.RenoteID != "" {
+		// リモートのユーザーの絵文字は画像URLがノートに含まれる
+		renderer.EmojiUrls = note.Body.Body.Renote.User.Emojis
 		t, err := template.New("note").Parse(RenoteTmpl)
 		if err != nil {
 			log.Printf("template error: %v", err)
 		}
 		data = map[string]interface{}{
-			"renotedName":     color.HiBlackString(note.Body.Body.User.Name),
-			"renotedUsername": color.HiBlackString(note.Body.Body.User.Username),
-			"name":            color.HiGreenString(note.Body.Body.Renote.User.Name),
-			"username":        color.HiBlueString(note.Body.Body.Renote.User.Username),
-			"text":            note.Body.Body.Renote.Text,
+			"renotedName":     theme.Renoter(note.Body.Body.User.Name),
+			"renotedUsername": theme.Renoter(note.Body.Body.User.Username),
+			"name":            theme.Name(note.Body.Body.Renote.User.Name),
+			"username":        theme.Username(note.Body.Body.Renote.User.Username),
+			"avatar":          avatar(note.Body.Body.Renote.User, preview),
+			"text":            highlightTerms(renderer.Render(note.Body.Body.Renote.Text), terms, theme.Highlight),
+			"files":           preview.render(note.Body.Body.Renote.Files),
+			"reactions":       formatReactions(note.Body.Body.Renote.Reactions, note.Body.Body.Renote.ReactionEmojis, renderer),
 			"createdAt":       note.Body.Body.Renote.CreatedAt.Format(time.RFC3339),
 		}
 		if err := t.Execute(&buf, data); err != nil {
 			log.Printf("template execute error: %v", err)
 		}
 	} else {
+		renderer.EmojiUrls = note.Body.Body.User.Emojis
 		t, err := template.New("note").Parse(NoteTmpl)
 		if err != nil {
 			log.Printf("template error: %v", err)
 		}
 		data = map[string]interface{}{
-			"name":      color.HiGreenString(note.Body.Body.User.Name),
-			"username":  color.HiBlueString(note.Body.Body.User.Username),
-			"text":      note.Body.Body.Text,
+			"name":      theme.Name(note.Body.Body.User.Name),
+			"username":  theme.Username(note.Body.Body.User.Username),
+			"avatar":    avatar(note.Body.Body.User, preview),
+			"text":      highlightTerms(renderer.Render(note.Body.Body.Text), terms, theme.Highlight),
+			"files":     preview.render(note.Body.Body.Files),
+			"reactions": formatReactions(note.Body.Body.Reactions, note.Body.Body.ReactionEmojis, renderer),
 			"createdAt": note.Body.Body.CreatedAt.String(),
 		}
 		if err := t.Execute(&buf, data); err != nil {
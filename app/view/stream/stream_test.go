@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
@@ -17,6 +18,7 @@ import (
 	"github.com/wasya-io/petit-misskey/logger"
 	model "github.com/wasya-io/petit-misskey/model/misskey"
 	"github.com/wasya-io/petit-misskey/test"
+	"github.com/wasya-io/petit-misskey/view/mfm"
 )
 
 // TestStreamFunctionality はStreamモデルの機能をテストします
@@ -254,8 +256,9 @@ func processModelUpdates(ctx context.Context, model *Model, msgCh chan tea.Msg)
 // TestFormatNote はformatNote関数の単体テスト
 func TestFormatNote(t *testing.T) {
 	// 1. 通常の投稿のテスト
+	renderer := mfm.Renderer{Styles: mfm.PlainStyles()}
 	normalNote := createTestNote(1)
-	formatted := formatNote(normalNote)
+	formatted := formatNote(normalNote, themeByName(defaultThemeName), renderer, filePreview{}, nil)
 	if formatted == "" {
 		t.Error("フォーマットされた通常ノートが空です")
 	}
@@ -263,9 +266,21 @@ func TestFormatNote(t *testing.T) {
 
 	// 2. リノートのテスト
 	renoteNote := createTestRenote()
-	formatted = formatNote(renoteNote)
+	formatted = formatNote(renoteNote, themeByName(defaultThemeName), renderer, filePreview{}, nil)
 	if formatted == "" {
 		t.Error("フォーマットされたリノートが空です")
 	}
 	t.Logf("リノートのフォーマット結果:\n%s", formatted)
 }
+
+// TestThemeKeepsPercent はユーザーの文字列に含まれる % がどのテーマでも崩れないことを確認します
+func TestThemeKeepsPercent(t *testing.T) {
+	for _, name := range []string{defaultThemeName, "light", "mono"} {
+		theme := themeByName(name)
+		for _, f := range []func(string, ...interface{}) string{theme.Name, theme.Alert, theme.Highlight} {
+			if got := f("100%わかる"); !strings.Contains(got, "100%わかる") {
+				t.Errorf("%s: %q", name, got)
+			}
+		}
+	}
+}
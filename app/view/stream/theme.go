@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/wasya-io/petit-misskey/view/mfm"
+)
+
+type (
+	// Theme はタイムライン表示の配色です
+	Theme struct {
+		Name      func(format string, a ...interface{}) string // 投稿者の表示名
+		Username  func(format string, a ...interface{}) string // 投稿者のユーザー名
+		Renoter   func(format string, a ...interface{}) string // リノートしたユーザー
+		Connected func(format string, a ...interface{}) string // 接続先URL
+		Account   func(format string, a ...interface{}) string // 接続中のアカウント
+		Alert     func(format string, a ...interface{}) string // 切断やエラー
+		Highlight func(format string, a ...interface{}) string // 注目の条件に当てはまった語
+		Markup    mfm.Styles                                   // 本文のMFMの装飾
+		Preview   bool                                         // 添付ファイルを画像やblurhashの色で表示する
+	}
+)
+
+const defaultThemeName = "default"
+
+var themes = map[string]Theme{
+	defaultThemeName: {
+		Name:      color.HiGreenString,
+		Username:  color.HiBlueString,
+		Renoter:   color.HiBlackString,
+		Connected: color.GreenString,
+		Account:   color.CyanString,
+		Alert:     color.RedString,
+		Highlight: colorFunc(color.New(color.FgBlack, color.BgHiYellow)),
+		Markup:    mfm.DefaultStyles(),
+		Preview:   true,
+	},
+	// 明るい背景の端末向け
+	"light": {
+		Name:      color.GreenString,
+		Username:  color.BlueString,
+		Renoter:   color.BlackString,
+		Connected: color.GreenString,
+		Account:   color.MagentaString,
+		Alert:     color.RedString,
+		Highlight: colorFunc(color.New(color.FgBlack, color.BgYellow)),
+		Markup:    mfm.DefaultStyles(),
+		Preview:   true,
+	},
+	// 色を使わない
+	"mono": {
+		Name:      plainString,
+		Username:  plainString,
+		Renoter:   plainString,
+		Connected: plainString,
+		Account:   plainString,
+		Alert:     plainString,
+		Highlight: plainString,
+		Markup:    mfm.PlainStyles(),
+	},
+}
+
+// plainString は色を付けずに文字列を組み立てます
+// fatih/colorの XString と同じく、引数が無いときは format をそのまま返すので
+// 表示名やエラーメッセージに含まれる % が崩れません
+func plainString(format string, a ...interface{}) string {
+	if len(a) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, a...)
+}
+
+// colorFunc は c で色付けする関数を返します
+// 引数が無いときの扱いは plainString と同じです
+func colorFunc(c *color.Color) func(format string, a ...interface{}) string {
+	return func(format string, a ...interface{}) string {
+		if len(a) == 0 {
+			return c.Sprint(format)
+		}
+		return c.Sprintf(format, a...)
+	}
+}
+
+// themeByName は名前に対応するテーマを返します
+// 見つからない場合は既定のテーマを返します
+func themeByName(name string) Theme {
+	if t, ok := themes[name]; ok {
+		return t
+	}
+	return themes[defaultThemeName]
+}
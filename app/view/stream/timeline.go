@@ -0,0 +1,179 @@
+package stream
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/filter"
+	"github.com/wasya-io/petit-misskey/service/plugins"
+	"github.com/wasya-io/petit-misskey/service/watch"
+)
+
+type (
+	// timelineNote はタイムラインに表示するノートと、それを受信したアカウントです
+	// 複数のインスタンスに連合したノートはURIで1つにまとめます
+	timelineNote struct {
+		note        *misskey.Note
+		uri         string
+		receivers   []receiver
+		filtered    *filter.Match        // 折りたたんで表示する場合の絞り込みの理由
+		watched     *watch.Hit           // 注目の条件に当てはまった場合はその条件
+		decorations []plugins.Decoration // プラグインが追加した表示
+	}
+
+	// receiver はノートを受信したアカウントと、そのインスタンスでのノートIDです
+	receiver struct {
+		key    string
+		noteId string // 返信・リアクションの対象(純粋なリノートならリノート元)のID
+	}
+)
+
+const (
+	maxKeptNotes = 10   // 保持するノートの数
+	maxSeenNotes = 1000 // 重複を調べるためにURIを覚えておくノートの数
+)
+
+// addNote はノートを新しい順に並ぶ位置へ追加し、追加したノートを返します
+// 別のアカウントで受信済みのノートであれば受信者だけを追加してnilを返します
+// 保持しなくなったノートが遅れて届いた場合も、追加せずにnilを返します
+func (c *column) addNote(account *Account, note *misskey.Note) *timelineNote {
+	uri := noteURI(account.Instance.BaseUrl, note)
+	r := receiver{key: account.Key, noteId: targetNoteId(note)}
+
+	for _, entry := range c.notes {
+		if entry.uri == uri {
+			if !entry.receivedBy(account.Key) {
+				entry.receivers = append(entry.receivers, r)
+			}
+			return nil
+		}
+	}
+	if c.seen[uri] {
+		return nil
+	}
+	c.remember(uri)
+
+	entry := &timelineNote{
+		note:      note,
+		uri:       uri,
+		receivers: []receiver{r},
+	}
+	createdAt := entry.createdAt()
+	i := sort.Search(len(c.notes), func(i int) bool {
+		return c.notes[i].createdAt().Before(createdAt)
+	})
+	c.notes = append(c.notes, nil)
+	copy(c.notes[i+1:], c.notes[i:])
+	c.notes[i] = entry
+
+	if len(c.notes) > maxKeptNotes {
+		c.notes = c.notes[:maxKeptNotes]
+	}
+	return entry
+}
+
+// remember はノートのURIを覚えます。覚えておくのは最近のmaxSeenNotes件だけです
+func (c *column) remember(uri string) {
+	if c.seen == nil {
+		c.seen = make(map[string]bool)
+	}
+	c.seen[uri] = true
+	c.seenOrder = append(c.seenOrder, uri)
+	if len(c.seenOrder) > maxSeenNotes {
+		delete(c.seen, c.seenOrder[0])
+		c.seenOrder = c.seenOrder[1:]
+	}
+}
+
+// selectedNote は選択中のノートを返します(なければnil)
+func (c *column) selectedNote() *timelineNote {
+	for _, entry := range c.notes {
+		if entry.uri == c.selected {
+			return entry
+		}
+	}
+	return nil
+}
+
+// moveSelection は選択中のノートをdeltaだけ移動します(負なら新しい方へ)
+func (c *column) moveSelection(delta int) {
+	if len(c.notes) == 0 {
+		return
+	}
+	index := -1
+	for i, entry := range c.notes {
+		if entry.uri == c.selected {
+			index = i
+		}
+	}
+	if index < 0 {
+		c.selected = c.notes[0].uri
+		return
+	}
+	index = min(max(index+delta, 0), len(c.notes)-1)
+	c.selected = c.notes[index].uri
+}
+
+// clear は表示中のノートと選択を消します
+func (c *column) clear() {
+	c.notes = make([]*timelineNote, 0, maxKeptNotes)
+	c.notifications = nil
+	c.selected = ""
+	c.seen = nil
+	c.seenOrder = nil
+}
+
+func (n *timelineNote) createdAt() time.Time {
+	return n.note.Body.Body.CreatedAt
+}
+
+func (n *timelineNote) receivedBy(key string) bool {
+	for _, r := range n.receivers {
+		if r.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// receiverKeys は受信したアカウントのキーを表示用に連結します
+func (n *timelineNote) receiverKeys() string {
+	keys := make([]string, 0, len(n.receivers))
+	for _, r := range n.receivers {
+		keys = append(keys, r.key)
+	}
+	return strings.Join(keys, ", ")
+}
+
+// noteURI はノートを識別するURIを返します
+// ローカルのノートはuriを持たないため、インスタンスのURLとIDから組み立てます
+func noteURI(baseUrl string, note *misskey.Note) string {
+	body := note.Body.Body
+	if body.Uri != "" {
+		return body.Uri
+	}
+	origin := baseUrl
+	if u, err := url.Parse(baseUrl); err == nil && u.Host != "" {
+		origin = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	}
+	return fmt.Sprintf("%s/notes/%s", origin, body.ID)
+}
+
+// targetNoteId は返信やリアクションの対象になるノートのIDを返します
+// 本文のない純粋なリノートであればリノート元を対象にします
+func targetNoteId(note *misskey.Note) string {
+	body := note.Body.Body
+	if body.RenoteID != "" && body.Text == "" {
+		return body.Renote.ID
+	}
+	return body.ID
+}
+
+// account はノートを最初に受信した接続中のアカウントを返します
+func (n *timelineNote) account(m *Model) *Account {
+	return m.accountByKey(n.receivers[0].key)
+}
@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+)
+
+func TestUnifiedTimeline(t *testing.T) {
+	a := newTestAccount("a")
+	b := newTestAccount("b")
+	model := NewAccountModel(a, logger.New(false))
+	model.JoinAccounts(b)
+	model.Init()
+
+	base := time.Now()
+	older := createTestNote(1)
+	older.Body.Body.CreatedAt = base.Add(-time.Minute)
+	older.Body.Body.Uri = "https://origin.example/notes/1"
+	newer := createTestNote(2)
+	newer.Body.Body.CreatedAt = base
+
+	model.Update(accountMsg{key: "a", gen: a.gen, msg: websocket.NoteMessage{Note: newer}})
+	model.Update(accountMsg{key: "a", gen: a.gen, msg: websocket.NoteMessage{Note: older}})
+
+	// 同じURIのノートを別のインスタンスで受信した場合は1つにまとめる
+	federated := createTestNote(1)
+	federated.Body.Body.ID = "remote-id"
+	federated.Body.Body.CreatedAt = older.Body.Body.CreatedAt
+	federated.Body.Body.Uri = older.Body.Body.Uri
+	model.Update(accountMsg{key: "b", gen: b.gen, msg: websocket.NoteMessage{Note: federated}})
+
+	assert.Len(t, model.mainColumn().notes, 2)
+	assert.Equal(t, "note-id-2", model.mainColumn().notes[0].note.Body.Body.ID)
+	assert.Equal(t, []receiver{{key: "a", noteId: "note-id-1"}, {key: "b", noteId: "remote-id"}}, model.mainColumn().notes[1].receivers)
+
+	// 選択は新しい方から始まり、末尾で止まる
+	model.mainColumn().moveSelection(1)
+	assert.Equal(t, model.mainColumn().notes[0].uri, model.mainColumn().selected)
+	model.mainColumn().moveSelection(1)
+	model.mainColumn().moveSelection(1)
+	assert.Equal(t, model.mainColumn().notes[1].uri, model.mainColumn().selected)
+}
+
+func TestDropEvictedDuplicates(t *testing.T) {
+	a := newTestAccount("a")
+	b := newTestAccount("b")
+	model := NewAccountModel(a, logger.New(false))
+	model.JoinAccounts(b)
+	model.Init()
+
+	base := time.Now()
+	first := createTestNote(0)
+	first.Body.Body.CreatedAt = base
+	first.Body.Body.Uri = "https://origin.example/notes/0"
+	model.Update(accountMsg{key: "a", gen: a.gen, msg: websocket.NoteMessage{Note: first}})
+	for i := 1; i <= maxKeptNotes; i++ {
+		note := createTestNote(i)
+		note.Body.Body.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		model.Update(accountMsg{key: "a", gen: a.gen, msg: websocket.NoteMessage{Note: note}})
+	}
+	assert.Len(t, model.mainColumn().notes, maxKeptNotes)
+
+	// 保持しなくなったノートを別のインスタンスで遅れて受信しても、再び表示しない
+	federated := createTestNote(0)
+	federated.Body.Body.ID = "remote-id"
+	federated.Body.Body.CreatedAt = base.Add(time.Hour)
+	federated.Body.Body.Uri = first.Body.Body.Uri
+	model.Update(accountMsg{key: "b", gen: b.gen, msg: websocket.NoteMessage{Note: federated}})
+	assert.Len(t, model.mainColumn().notes, maxKeptNotes)
+	for _, entry := range model.mainColumn().notes {
+		assert.NotEqual(t, first.Body.Body.Uri, entry.uri)
+	}
+}
+
+func TestNoteURI(t *testing.T) {
+	note := createTestNote(1)
+	assert.Equal(t, "https://misskey.example/notes/note-id-1", noteURI("https://misskey.example/api", note))
+
+	note.Body.Body.Uri = "https://remote.example/notes/xyz"
+	assert.Equal(t, "https://remote.example/notes/xyz", noteURI("https://misskey.example/api", note))
+}
@@ -0,0 +1,249 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/model/misskey"
+	"github.com/wasya-io/petit-misskey/service/watch"
+)
+
+type (
+	// highlight は注目の条件に当てはまったノートの記録です
+	// タイムラインから流れた後も :highlights で確認できます
+	highlight struct {
+		at   time.Time
+		key  string
+		user string
+		text string
+		hit  watch.Hit
+	}
+
+	// highlightView は :highlights で開く、注目のノートの一覧です
+	highlightView struct {
+		open bool
+	}
+
+	// hookResultMsg は注目の条件のフックを実行した結果です
+	hookResultMsg struct {
+		name string
+		err  error
+	}
+)
+
+const maxHighlights = 100 // 記録しておく注目のノートの数
+
+// watcherFor はアカウントの注目の条件から作ったWatcherを返します
+func (m *Model) watcherFor(account *Account) *watch.Watcher {
+	if account.watcher == nil {
+		instance := account.Instance
+		me := watch.Me{Username: instance.UserName}
+		if u, err := url.Parse(instance.BaseUrl); err == nil {
+			me.Host = u.Hostname()
+		}
+		watcher, err := watch.New(instance.Preferences.Watch, me)
+		if err != nil {
+			m.err = fmt.Errorf("注目の条件を一部使えません: %w", err)
+		}
+		account.watcher = watcher
+	}
+	return account.watcher
+}
+
+// applyWatch はノートが注目の条件に当てはまれば強調して記録し、端末での通知とフックを実行します
+func (m *Model) applyWatch(account *Account, entry *timelineNote) tea.Cmd {
+	hit, ok := m.watcherFor(account).Match(entry.note)
+	if !ok {
+		return nil
+	}
+	entry.watched = &hit
+	m.logger.Log("stream", fmt.Sprintf("watched: %s (%s)", entry.note.Body.Body.ID, hit))
+
+	body := entry.note.Body.Body
+	user, text := body.User.Username, body.Text
+	if body.RenoteID != "" && text == "" {
+		user, text = body.Renote.User.Username, body.Renote.Text
+	}
+	m.highlights = append([]highlight{{
+		at:   time.Now(),
+		key:  account.Key,
+		user: user,
+		text: strings.ReplaceAll(text, "\n", " "),
+		hit:  hit,
+	}}, m.highlights...)
+	if len(m.highlights) > maxHighlights {
+		m.highlights = m.highlights[:maxHighlights]
+	}
+	if !m.watchView.open {
+		m.unseenWatch++
+	}
+	m.refreshStatusView()
+
+	title := fmt.Sprintf("petit-misskey: %s", hit.Name)
+	message := fmt.Sprintf("@%s: %s", user, text)
+	m.runHook(account, hit, entry.note)
+	return m.alert(hit.Alert, title, message)
+}
+
+// alert は端末のベルやデスクトップ通知のエスケープシーケンスを書き出すコマンドを返します
+// 画面の描画に含めると再描画のたびに通知されるため、描画とは別に一度だけ書き出します
+// 書き出し先は描画と同じ view.Terminal なので、描画の途中に割り込むことはありません
+func (m *Model) alert(alert setting.WatchAlert, title string, message string) tea.Cmd {
+	seq := alertSequence(alert, title, message)
+	if seq == "" || m.alertOut == nil {
+		return nil
+	}
+	out := m.alertOut
+	return func() tea.Msg {
+		fmt.Fprint(out, seq)
+		return nil
+	}
+}
+
+// alertSequence は通知の方法に対応するエスケープシーケンスを返します
+func alertSequence(alert setting.WatchAlert, title string, message string) string {
+	switch alert {
+	case setting.WatchAlertBell:
+		return "\a"
+	case setting.WatchAlertOsc9:
+		return "\x1b]9;" + oscText(title+" "+message) + "\a"
+	case setting.WatchAlertOsc777:
+		// タイトルと本文は ; で区切るため、タイトルには ; を含めない
+		return "\x1b]777;notify;" + strings.ReplaceAll(oscText(title), ";", ",") + ";" + oscText(message) + "\a"
+	}
+	return ""
+}
+
+// oscText は制御文字を取り除き、通知に収まる長さにします
+func oscText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return ' '
+		}
+		return r
+	}, s)
+	if r := []rune(s); len(r) > 200 {
+		s = string(r[:200]) + "…"
+	}
+	return s
+}
+
+// runHook は注目の条件に設定されたシェルのコマンドを実行します
+// イベントのフックと同じく、同時に実行する数を制限して実行し、失敗はメッセージで知らせます
+// ノートはJSONで標準入力に渡し、主な値は環境変数でも渡します
+func (m *Model) runHook(account *Account, hit watch.Hit, note *misskey.Note) {
+	if hit.Hook == "" {
+		return
+	}
+	body := note.Body.Body
+	stdin, err := json.Marshal(body)
+	if err != nil {
+		m.logger.Log("stream", fmt.Sprintf("hook error: %s: %v", hit.Name, err))
+		return
+	}
+	env := []string{
+		"PETIT_MISSKEY_WATCH=" + hit.Name,
+		"PETIT_MISSKEY_REASON=" + hit.Reason,
+		"PETIT_MISSKEY_ACCOUNT=" + account.Key,
+		"PETIT_MISSKEY_NOTE_ID=" + body.ID,
+		"PETIT_MISSKEY_USER=" + body.User.Username,
+		"PETIT_MISSKEY_TEXT=" + body.Text,
+		"PETIT_MISSKEY_URL=" + noteURL(account, body),
+	}
+	m.hookDispatcher().Exec(m.ctx, hit.Hook, env, stdin, func(err error) {
+		if err == nil {
+			return
+		}
+		select {
+		case m.msgCh <- hookResultMsg{name: hit.Name, err: err}:
+		case <-m.ctx.Done():
+		}
+	})
+}
+
+// updateHookResult はフックの失敗をログと一時的な表示で知らせます
+func (m *Model) updateHookResult(msg hookResultMsg) tea.Cmd {
+	if msg.err == nil || m.ctx.Err() == context.Canceled {
+		return nil
+	}
+	m.logger.Log("stream", fmt.Sprintf("hook error: %s: %v", msg.name, msg.err))
+	return m.showToast(fmt.Sprintf("%s のフックが失敗しました: %v", msg.name, msg.err))
+}
+
+// noteURL はノートのURLを返します(リモートのノートは元のURL)
+func noteURL(account *Account, body misskey.NoteBody) string {
+	if body.Url != "" {
+		return body.Url
+	}
+	if body.Uri != "" {
+		return body.Uri
+	}
+	u, err := url.Parse(account.Instance.BaseUrl)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s/notes/%s", u.Scheme, u.Host, body.ID)
+}
+
+// highlightTerms は描画済みの本文の中で注目の語を強調します
+func highlightTerms(text string, terms []string, style func(format string, a ...interface{}) string) string {
+	if len(terms) == 0 {
+		return text
+	}
+	quoted := make([]string, 0, len(terms))
+	for _, term := range terms {
+		quoted = append(quoted, regexp.QuoteMeta(term))
+	}
+	re, err := regexp.Compile("(?i)" + strings.Join(quoted, "|"))
+	if err != nil {
+		return text
+	}
+	return re.ReplaceAllStringFunc(text, func(s string) string {
+		return style("%s", s)
+	})
+}
+
+// openHighlights は注目のノートの一覧を開きます
+func (m *Model) openHighlights() {
+	m.watchView.open = true
+	m.unseenWatch = 0
+	m.refreshStatusView()
+	m.refreshViewBuffer()
+}
+
+// renderHighlights はアカウントごとの注目の条件と、注目のノートの一覧を表示します
+func (m *Model) renderHighlights() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("注目の条件 [%s] 閉じる\n", m.keyMap.Cancel.Help().Key))
+	for _, account := range m.accounts {
+		b.WriteString(m.theme.Account(account.Key) + "\n")
+		rules := m.watcherFor(account).Rules()
+		if len(rules) == 0 {
+			b.WriteString("  なし\n")
+		}
+		for _, rule := range rules {
+			b.WriteString("  - " + rule + "\n")
+		}
+	}
+
+	b.WriteString("\n注目のノート\n")
+	if len(m.highlights) == 0 {
+		b.WriteString("  なし\n")
+	}
+	for _, h := range m.highlights {
+		b.WriteString(fmt.Sprintf("  %s [%s] @%s %s\n    %s\n",
+			h.at.Format("15:04"),
+			h.key,
+			m.theme.Username(h.user),
+			h.hit,
+			highlightTerms(h.text, h.hit.Terms, m.theme.Highlight)))
+	}
+	return b.String()
+}
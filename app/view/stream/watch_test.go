@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/wasya-io/petit-misskey/infrastructure/setting"
+	"github.com/wasya-io/petit-misskey/infrastructure/websocket"
+	"github.com/wasya-io/petit-misskey/logger"
+)
+
+func TestWatch(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hook.txt")
+	account := newTestAccount("a")
+	account.Instance.Preferences.Watch = []setting.Watch{
+		{Name: "test", Words: []string{"ノート2"}, Alert: setting.WatchAlertOsc777, Hook: `printf '%s' "$PETIT_MISSKEY_NOTE_ID" > "` + out + `"`},
+	}
+	model := NewAccountModel(account, logger.New(false))
+	var alerts bytes.Buffer
+	model.alertOut = &alerts
+	model.Init()
+
+	_, cmd := model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(1)}})
+	assert.Nil(t, cmd)
+	_, cmd = model.Update(accountMsg{key: "a", gen: account.gen, msg: websocket.NoteMessage{Note: createTestNote(2)}})
+	deliver(model, cmd)
+
+	// 強調して表示し、端末での通知とフックを実行する
+	entry := model.mainColumn().notes[0]
+	assert.Equal(t, "test: 「ノート2」を含む", entry.watched.String())
+	assert.Contains(t, formatNote(entry.note, model.theme, model.renderer, filePreview{}, entry.watched), "★ test: 「ノート2」を含む")
+	assert.Equal(t, "\x1b]777;notify;petit-misskey: test;@user2: これはテストノート2です\a", alerts.String())
+	model.hooks.Wait()
+	if runtime.GOOS != "windows" {
+		b, err := os.ReadFile(out)
+		assert.NoError(t, err)
+		assert.Equal(t, "note-id-2", string(b))
+	}
+
+	// タイムラインから流れても一覧に残る
+	model.mainColumn().notes = nil
+	assert.Equal(t, 1, model.unseenWatch)
+	model.textarea.SetValue(":highlights")
+	_, cmd = model.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+	deliver(model, cmd)
+	assert.True(t, model.watchView.open)
+	assert.Equal(t, 0, model.unseenWatch)
+	view := model.renderHighlights()
+	assert.Contains(t, view, "- test (語: ノート2)")
+	assert.Contains(t, view, "@user2 test: 「ノート2」を含む")
+
+	model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, model.watchView.open)
+}
+
+func TestAlertSequence(t *testing.T) {
+	assert.Equal(t, "\a", alertSequence(setting.WatchAlertBell, "title", "body"))
+	assert.Equal(t, "\x1b]9;title a b\a", alertSequence(setting.WatchAlertOsc9, "title", "a\x1bb"))
+	assert.Equal(t, "\x1b]777;notify;a,b;c;d\a", alertSequence(setting.WatchAlertOsc777, "a;b", "c;d"))
+	assert.Equal(t, "", alertSequence("", "title", "body"))
+}
+
+func TestHighlightTerms(t *testing.T) {
+	style := func(format string, a ...interface{}) string { return "[" + a[0].(string) + "]" }
+	assert.Equal(t, "[Deploy] and [deploy] (x.y)", highlightTerms("Deploy and deploy (x.y)", []string{"deploy"}, style))
+	assert.Equal(t, "[x.y]z", highlightTerms("x.yz", []string{"x.y"}, style))
+}
@@ -0,0 +1,72 @@
+package view
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/term"
+)
+
+type (
+	// terminal は描画と、描画の外で書き出すエスケープシーケンス(端末の通知など)を1つずつ書き出す出力先です
+	// 同時に書き込むと、描画の途中に通知が割り込んで画面が崩れるためです
+	terminal struct {
+		mu      sync.Mutex
+		file    *os.File
+		overlay string // 描画のたびに重ねて書き出すエスケープシーケンス
+	}
+)
+
+// exitAltScreen は代替画面を抜けるエスケープシーケンスです。抜けたあとは画像を重ねて描きません
+const exitAltScreen = "\x1b[?1049l"
+
+// Terminal はRunで起動したプログラムと同じ端末への出力先です
+// 描画の外で端末に書き出すときは、標準出力ではなくこれを使います
+var Terminal = &terminal{file: os.Stdout}
+
+func (t *terminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, err := t.file.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if bytes.Contains(p, []byte(exitAltScreen)) {
+		t.overlay = ""
+	}
+	if t.overlay != "" {
+		// 描画で書き換えた行の上に画像を描き直す
+		if _, err := io.WriteString(t.file, t.overlay); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// SetOverlay は描画のたびに画面に重ねて書き出すエスケープシーケンス(画像など)を設定します
+// bubbleteaは行を画面幅で切り詰めるときにエスケープシーケンスの途中で切るため、画像は描画のあとに書き出します
+func (t *terminal) SetOverlay(s string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.overlay = s
+}
+
+// Read と Fd は termenv が端末かどうか(色を使えるか)を調べるのに使います
+func (t *terminal) Read(p []byte) (int, error) {
+	return t.file.Read(p)
+}
+
+func (t *terminal) Fd() uintptr {
+	return t.file.Fd()
+}
+
+// sendSize は端末の大きさをプログラムに知らせます
+// bubbleteaは出力先が *os.File でないと大きさを調べないため、代わりに知らせます
+func (t *terminal) sendSize(p *tea.Program) {
+	if w, h, err := term.GetSize(int(t.file.Fd())); err == nil {
+		p.Send(tea.WindowSizeMsg{Width: w, Height: h})
+	}
+}
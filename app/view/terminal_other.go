@@ -0,0 +1,10 @@
+//go:build !unix
+
+package view
+
+import tea "github.com/charmbracelet/bubbletea"
+
+// watchSize は起動時の端末の大きさをプログラムに知らせます
+func (t *terminal) watchSize(p *tea.Program) {
+	go t.sendSize(p)
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package view
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// watchSize は起動時と端末の大きさが変わるたびに、大きさをプログラムに知らせます
+func (t *terminal) watchSize(p *tea.Program) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGWINCH)
+	go func() {
+		t.sendSize(p)
+		for range sig {
+			t.sendSize(p)
+		}
+	}()
+}